@@ -0,0 +1,64 @@
+package hl7
+
+import "time"
+
+// Acknowledgment codes written to MSA-1.
+const (
+	AckAccept = "AA" // the message was accepted
+	AckError  = "AE" // the message was rejected because of an error
+	AckReject = "AR" // the message was rejected, e.g. for an unsupported type
+)
+
+// NewAck returns an acknowledgment for msg with the given MSA-1 code and an
+// optional MSA-3 text message. The ACK uses the delimiters and version of
+// msg, swaps its sending and receiving application and facility, and echoes
+// its control ID in MSA-2, so replies can be matched to requests without
+// further state. MSH-10 of the ACK is a new control ID of its own.
+func NewAck(msg *GenericMessage, code, text string) *GenericMessage {
+	opts := msg.Delimiters()
+	get := func(field int) string {
+		return msg.Value(Path{Segment: "MSH", FieldPath: FieldPath{Field: field}})
+	}
+
+	ack := &GenericMessage{}
+	ack.SetValue(Path{Segment: "MSH", FieldPath: FieldPath{Field: 1}}, string(opts.FieldSeparator))
+	ack.SetValue(Path{Segment: "MSH", FieldPath: FieldPath{Field: 2}}, string([]byte{
+		opts.ComponentSeparator,
+		opts.RepetitionSeparator,
+		opts.EscapeCharacter,
+		opts.SubcomponentSeparator,
+	}))
+
+	trigger := nthValue(get(9), opts.ComponentSeparator, 2)
+	msgType := "ACK"
+	if trigger != "" {
+		msgType += string(opts.ComponentSeparator) + trigger + string(opts.ComponentSeparator) + "ACK"
+	}
+	processingID := get(11)
+	if processingID == "" {
+		processingID = "P"
+	}
+	for field, value := range map[int]string{
+		3:  get(5),
+		4:  get(6),
+		5:  get(3),
+		6:  get(4),
+		7:  time.Now().Format("20060102150405"),
+		9:  msgType,
+		10: newControlID(),
+		11: processingID,
+		12: get(12),
+	} {
+		if value == "" {
+			continue
+		}
+		ack.SetValue(Path{Segment: "MSH", FieldPath: FieldPath{Field: field}}, value)
+	}
+
+	ack.SetValue(Path{Segment: "MSA", FieldPath: FieldPath{Field: 1}}, code)
+	ack.SetValue(Path{Segment: "MSA", FieldPath: FieldPath{Field: 2}}, get(10))
+	if text != "" {
+		ack.SetValue(Path{Segment: "MSA", FieldPath: FieldPath{Field: 3}}, opts.Escape(text))
+	}
+	return ack
+}
@@ -0,0 +1,56 @@
+package hl7_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/esequiel378/hl7"
+)
+
+func TestNewAck(t *testing.T) {
+	msg, err := hl7.ParseGeneric([]byte("MSH|^~\\&|LAB|NORTH|EHR|MAIN|20250101120000||ORU^R01^ORU_R01|MSG001|T|2.5.1\rPID|1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ack := hl7.NewAck(msg, hl7.AckError, "PID-7 is not a date")
+	out, err := hl7.MarshalGeneric(ack)
+	if err != nil {
+		t.Fatal(err)
+	}
+	segs := strings.Split(string(out), "\r")
+	if len(segs) != 2 {
+		t.Fatalf("expected MSH and MSA, got %q", out)
+	}
+	msh := strings.Split(segs[0], "|")
+	if got := strings.Join(msh[:6], "|"); got != "MSH|^~\\&|EHR|MAIN|LAB|NORTH" {
+		t.Errorf("expected swapped applications, got %q", got)
+	}
+	if got := msh[8] + "|" + strings.Join(msh[10:], "|"); got != "ACK^R01^ACK|T|2.5.1" {
+		t.Errorf("unexpected MSH-9, MSH-11 and MSH-12 %q", got)
+	}
+	if msh[9] == "" || msh[9] == "MSG001" {
+		t.Errorf("expected a new control ID in MSH-10, got %q", msh[9])
+	}
+	if len(msh[6]) != 14 {
+		t.Errorf("expected a timestamp in MSH-7, got %q", msh[6])
+	}
+	if segs[1] != "MSA|AE|MSG001|PID-7 is not a date" {
+		t.Errorf("unexpected MSA %q", segs[1])
+	}
+}
+
+func TestNewAckCustomDelimiters(t *testing.T) {
+	msg, err := hl7.ParseGeneric([]byte("MSH#*@!%#A######ADT*A01#1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := hl7.MarshalGeneric(hl7.NewAck(msg, hl7.AckAccept, "ok#done"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(string(out), "MSH#*@!%###A#") || !strings.Contains(string(out), "#ACK*A01*ACK#") ||
+		!strings.HasSuffix(string(out), "#P\rMSA#AA#1#ok!F!done") {
+		t.Errorf("unexpected ACK %q", out)
+	}
+}
@@ -192,7 +192,10 @@ func BenchmarkMarshalMultiSegment(b *testing.B) {
 }
 
 // Schema-based benchmarks
-var benchSchema *hl7.MessageSchema
+var (
+	benchSchema         *hl7.MessageSchema
+	benchCompiledSchema *hl7.CompiledSchema
+)
 
 func init() {
 	var err error
@@ -241,6 +244,10 @@ func init() {
 	if err != nil {
 		panic(err)
 	}
+	benchCompiledSchema, err = benchSchema.Compile()
+	if err != nil {
+		panic(err)
+	}
 }
 
 func BenchmarkSchemaUnmarshalSimple(b *testing.B) {
@@ -261,8 +268,59 @@ func BenchmarkSchemaUnmarshalMultiSegment(b *testing.B) {
 	}
 }
 
+func BenchmarkCompiledSchemaUnmarshalSimple(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := benchCompiledSchema.Unmarshal(simpleMSH); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkCompiledSchemaUnmarshalMultiSegment(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := benchCompiledSchema.Unmarshal(multiSegmentMessage); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkCompiledSchemaUnmarshalParallel(b *testing.B) {
+	b.ReportAllocs()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			if _, err := benchCompiledSchema.Unmarshal(multiSegmentMessage); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
 func BenchmarkSchemaMarshalSimple(b *testing.B) {
-	data := map[string]any{
+	data := benchSchemaMarshalData()
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := hl7.MarshalWithSchema(data, benchSchema); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkCompiledSchemaMarshalSimple(b *testing.B) {
+	data := benchSchemaMarshalData()
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := benchCompiledSchema.Marshal(data); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func benchSchemaMarshalData() map[string]any {
+	return map[string]any{
 		"MSH": map[string]any{
 			"fieldSeparator":       "|",
 			"encodingCharacters":   "^~\\&",
@@ -280,23 +338,29 @@ func BenchmarkSchemaMarshalSimple(b *testing.B) {
 			"versionID":        "2.3",
 		},
 	}
+}
 
+func BenchmarkSchemaRoundTrip(b *testing.B) {
 	b.ReportAllocs()
 	for i := 0; i < b.N; i++ {
-		if _, err := hl7.MarshalWithSchema(data, benchSchema); err != nil {
+		result, err := hl7.UnmarshalWithSchema(multiSegmentMessage, benchSchema)
+		if err != nil {
+			b.Fatal(err)
+		}
+		if _, err := hl7.MarshalWithSchema(result, benchSchema); err != nil {
 			b.Fatal(err)
 		}
 	}
 }
 
-func BenchmarkSchemaRoundTrip(b *testing.B) {
+func BenchmarkCompiledSchemaRoundTrip(b *testing.B) {
 	b.ReportAllocs()
 	for i := 0; i < b.N; i++ {
-		result, err := hl7.UnmarshalWithSchema(multiSegmentMessage, benchSchema)
+		result, err := benchCompiledSchema.Unmarshal(multiSegmentMessage)
 		if err != nil {
 			b.Fatal(err)
 		}
-		if _, err := hl7.MarshalWithSchema(result, benchSchema); err != nil {
+		if _, err := benchCompiledSchema.Marshal(result); err != nil {
 			b.Fatal(err)
 		}
 	}
@@ -314,3 +378,33 @@ func BenchmarkRoundTrip(b *testing.B) {
 		}
 	}
 }
+
+// Routing benchmarks: read MSH-9.1 and PID-3.1 only.
+func BenchmarkViewRouting(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		v := hl7.NewView(multiSegmentMessage)
+		if len(v.Segment("MSH", 1).Field(9).Comp(1).Bytes()) == 0 {
+			b.Fatal("missing MSH-9.1")
+		}
+		if len(v.Segment("PID", 1).Field(3).Comp(1).Bytes()) == 0 {
+			b.Fatal("missing PID-3.1")
+		}
+	}
+}
+
+func BenchmarkParseGenericRouting(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		msg, err := hl7.ParseGeneric(multiSegmentMessage)
+		if err != nil {
+			b.Fatal(err)
+		}
+		if msg.Segments[0].Fields[8].Components[0].Value == "" {
+			b.Fatal("missing MSH-9.1")
+		}
+		if msg.Segments[1].Fields[2].Components[0].Value == "" {
+			b.Fatal("missing PID-3.1")
+		}
+	}
+}
@@ -0,0 +1,144 @@
+package hl7
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// A MessageBuilder builds a message one segment at a time, for messages that
+// do not warrant a tagged struct or a schema:
+//
+//	data, err := hl7.NewMessage("ADT", "A01", "2.5.1").
+//		Segment("PID").Set("3.1", mrn).Set("5.1", family).Set("5.2", given).
+//		Repeat("OBX", func(s *hl7.SegmentBuilder) { s.Set("2", "NM").Set("5", "13.5") }).
+//		Bytes()
+//
+// Values are plain text and are escaped when the message is encoded. The
+// first error, such as an invalid path, is kept and returned by Bytes and
+// Marshal, so a chain of calls needs no error checks.
+type MessageBuilder struct {
+	segments []builderSegment
+	setIDs   map[string]int
+	err      error
+}
+
+// builderSegment is a segment of a MessageBuilder with its plain text
+// values, in the order they were set.
+type builderSegment struct {
+	name   string
+	values []builderValue
+}
+
+type builderValue struct {
+	path  FieldPath
+	value string
+}
+
+// A SegmentBuilder sets the fields of one segment of a MessageBuilder. The
+// methods of the MessageBuilder are available on it, so that a chain can
+// move on to the next segment.
+type SegmentBuilder struct {
+	*MessageBuilder
+	index int // of the segment in segments
+}
+
+// NewMessage returns a builder for a message of the given type, trigger
+// event and version. Its MSH segment has MSH-9 set to the type and trigger
+// event and MSH-12 to the version; MSH-7 and MSH-10 are filled in when the
+// message is encoded.
+func NewMessage(messageCode, triggerEvent, version string) *MessageBuilder {
+	b := &MessageBuilder{setIDs: make(map[string]int)}
+	b.segments = []builderSegment{{name: "MSH"}}
+	b.Segment("MSH").
+		Set("9.1", messageCode).
+		Set("9.2", triggerEvent).
+		Set("12", version)
+	return b
+}
+
+// Segment returns a builder for the MSH segment when name is "MSH", and
+// otherwise for a new segment appended to the message.
+func (b *MessageBuilder) Segment(name string) *SegmentBuilder {
+	if name == "MSH" {
+		return &SegmentBuilder{MessageBuilder: b, index: 0}
+	}
+	if !isSegmentName(name) && b.err == nil {
+		b.err = fmt.Errorf("hl7: invalid segment name %q", name)
+	}
+	b.segments = append(b.segments, builderSegment{name: name})
+	return &SegmentBuilder{MessageBuilder: b, index: len(b.segments) - 1}
+}
+
+// Repeat appends a segment that repeats within the message, such as OBX or
+// NTE, sets its Set ID (field 1) to one more than that of the previous
+// segment of the same name, and calls fill to set its other fields.
+func (b *MessageBuilder) Repeat(name string, fill func(s *SegmentBuilder)) *MessageBuilder {
+	b.setIDs[name]++
+	s := b.Segment(name).Set("1", strconv.Itoa(b.setIDs[name]))
+	if fill != nil {
+		fill(s)
+	}
+	return b
+}
+
+// Set sets the value at path, a field path relative to the segment such as
+// "5", "3.1", "3[2].1" or "5.1.2", to the plain text value. Delimiters in
+// the value are escaped when the message is encoded. MSH-1 and MSH-2 come
+// from the MarshalOptions instead.
+func (s *SegmentBuilder) Set(path, value string) *SegmentBuilder {
+	if s.err != nil {
+		return s
+	}
+	seg := &s.segments[s.index]
+	p, err := ParsePath("MSH-" + path)
+	if err != nil {
+		s.err = fmt.Errorf("hl7: invalid path %q for %s", path, seg.name)
+		return s
+	}
+	if seg.name == "MSH" && p.Field <= 2 {
+		s.err = fmt.Errorf("hl7: MSH-%d is set by the MarshalOptions", p.Field)
+		return s
+	}
+	seg.values = append(seg.values, builderValue{path: p.FieldPath, value: value})
+	return s
+}
+
+// Bytes encodes the message with DefaultMarshalOptions.
+func (b *MessageBuilder) Bytes() ([]byte, error) {
+	return b.Marshal(DefaultMarshalOptions())
+}
+
+// Marshal encodes the message with the delimiters, line ending, MSH
+// defaults and character set of opts, as Marshal and MarshalWithOptions
+// would. Unless opts says otherwise, MSH-7 is the current time and MSH-10 a
+// random control ID of 20 hexadecimal digits.
+func (b *MessageBuilder) Marshal(opts MarshalOptions) ([]byte, error) {
+	if b.err != nil {
+		return nil, b.err
+	}
+	if opts.Now == nil {
+		opts.Now = time.Now
+	}
+	if opts.ControlID == nil {
+		opts.ControlID = newControlID
+	}
+	msg := &GenericMessage{Segments: make([]GenericSegment, len(b.segments))}
+	for i, bs := range b.segments {
+		seg := &msg.Segments[i]
+		seg.Name, seg.Fields = bs.name, []GenericField{}
+		if bs.name == "MSH" {
+			seg.field(1).Value = string(opts.FieldSeparator)
+			seg.field(2).Value = string([]byte{
+				opts.ComponentSeparator,
+				opts.RepetitionSeparator,
+				opts.EscapeCharacter,
+				opts.SubcomponentSeparator,
+			})
+		}
+		for _, v := range bs.values {
+			seg.SetValue(v.path, opts.Escape(v.value), opts)
+		}
+	}
+	return marshalGeneric(msg, opts)
+}
@@ -0,0 +1,89 @@
+package hl7_test
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/esequiel378/hl7"
+)
+
+func TestNewMessage(t *testing.T) {
+	data, err := hl7.NewMessage("ORU", "R01", "2.5.1").
+		Segment("MSH").Set("3", "LAB").Set("4", "HOSP").
+		Segment("PID").Set("3.1", "123456").Set("3.4", "HOSP").Set("3[2].1", "987").Set("5", "O^Brien & Co").
+		Repeat("OBX", func(s *hl7.SegmentBuilder) { s.Set("2", "NM").Set("3.1", "718-7").Set("5", "13.5") }).
+		Repeat("OBX", func(s *hl7.SegmentBuilder) { s.Set("2", "ST").Set("5", "a|b~c") }).
+		Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lines := strings.Split(string(data), "\r")
+	if len(lines) != 4 {
+		t.Fatalf("expected 4 segments, got %q", data)
+	}
+	if !regexp.MustCompile(`^MSH\|\^~\\&\|LAB\|HOSP\|\|\|\d{14}\|\|ORU\^R01\|[0-9A-F]{20}\|\|2\.5\.1$`).MatchString(lines[0]) {
+		t.Errorf("unexpected MSH %q", lines[0])
+	}
+	for i, want := range []string{
+		`PID|||123456^^^HOSP~987||O\S\Brien \T\ Co`,
+		`OBX|1|NM|718-7||13.5`,
+		`OBX|2|ST|||a\F\b\R\c`,
+	} {
+		if lines[i+1] != want {
+			t.Errorf("segment %d: got %q, want %q", i+2, lines[i+1], want)
+		}
+	}
+
+	msg, err := hl7.ParseGeneric(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v := msg.Value(hl7.Path{Segment: "PID", FieldPath: hl7.FieldPath{Field: 5}}); msg.Delimiters().Unescape(v) != "O^Brien & Co" {
+		t.Errorf("expected the escaped name to decode, got %q", v)
+	}
+
+	first, _ := hl7.NewMessage("ADT", "A01", "2.5").Bytes()
+	second, _ := hl7.NewMessage("ADT", "A01", "2.5").Bytes()
+	if strings.Split(string(first), "|")[9] == strings.Split(string(second), "|")[9] {
+		t.Error("expected different control IDs")
+	}
+}
+
+func TestNewMessageOptions(t *testing.T) {
+	opts := hl7.MarshalOptions{
+		FieldSeparator:        '#',
+		ComponentSeparator:    '$',
+		RepetitionSeparator:   '%',
+		EscapeCharacter:       '!',
+		SubcomponentSeparator: '*',
+		LineEnding:            "\n",
+		Charset:               hl7.CharsetLatin1,
+	}
+	data, err := hl7.NewMessage("ADT", "A01", "2.5").
+		Segment("PID").Set("5.1", "Müller").Set("5.2", "a#b").Set("13", "x|y").
+		Marshal(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(string(data), "\n")
+	if !strings.HasPrefix(lines[0], "MSH#$%!*#") || strings.Contains(lines[0], "|") {
+		t.Errorf("unexpected MSH %q", lines[0])
+	}
+	if want := "PID#####M\xfcller$a!F!b########x|y"; lines[1] != want {
+		t.Errorf("got %q, want %q", lines[1], want)
+	}
+}
+
+func TestNewMessageErrors(t *testing.T) {
+	for name, b := range map[string]*hl7.MessageBuilder{
+		"bad path":    hl7.NewMessage("ADT", "A01", "2.5").Segment("PID").Set("x", "1").Segment("PV1").Set("2", "I").MessageBuilder,
+		"MSH-2":       hl7.NewMessage("ADT", "A01", "2.5").Segment("MSH").Set("2", "#").MessageBuilder,
+		"bad segment": hl7.NewMessage("ADT", "A01", "2.5").Segment("pid").MessageBuilder,
+	} {
+		if _, err := b.Bytes(); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
@@ -0,0 +1,187 @@
+package hl7
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// Character sets, as named by MSH-18, that the decoders transcode to UTF-8
+// and MarshalOptions.Charset transcodes back to.
+const (
+	CharsetASCII       = "ASCII"
+	CharsetLatin1      = "8859/1"
+	CharsetLatin9      = "8859/15"
+	CharsetUTF8        = "UNICODE UTF-8"
+	CharsetWindows1252 = "WINDOWS-1252"
+)
+
+// A charset converts between UTF-8 and a character set that extends ASCII.
+// A nil *charset leaves bytes unchanged.
+type charset struct {
+	name  string
+	high  *[128]rune    // runes of bytes 0x80-0xFF, or nil for UTF-8 and ASCII
+	bytes map[rune]byte // the reverse of high
+}
+
+func newCharset(name string, high *[128]rune) *charset {
+	c := &charset{name: name, high: high}
+	if high != nil {
+		c.bytes = make(map[rune]byte, len(high))
+		for i, r := range high {
+			c.bytes[r] = byte(0x80 + i)
+		}
+	}
+	return c
+}
+
+// latin1High maps the bytes 0x80-0xFF of ISO 8859-1 to runes.
+var latin1High = func() *[128]rune {
+	var high [128]rune
+	for i := range high {
+		high[i] = rune(0x80 + i)
+	}
+	return &high
+}()
+
+// windows1252High maps the bytes 0x80-0xFF of Windows-1252, which differs
+// from ISO 8859-1 in 0x80-0x9F. The five bytes it leaves undefined keep
+// their ISO 8859-1 control characters.
+var windows1252High = func() *[128]rune {
+	high := *latin1High
+	copy(high[:0x20], []rune{
+		0x20AC, 0x0081, 0x201A, 0x0192, 0x201E, 0x2026, 0x2020, 0x2021,
+		0x02C6, 0x2030, 0x0160, 0x2039, 0x0152, 0x008D, 0x017D, 0x008F,
+		0x0090, 0x2018, 0x2019, 0x201C, 0x201D, 0x2022, 0x2013, 0x2014,
+		0x02DC, 0x2122, 0x0161, 0x203A, 0x0153, 0x009D, 0x017E, 0x0178,
+	})
+	return &high
+}()
+
+// latin9High maps the bytes 0x80-0xFF of ISO 8859-15, which replaces eight
+// characters of ISO 8859-1, among them the euro sign.
+var latin9High = func() *[128]rune {
+	high := *latin1High
+	for b, r := range map[byte]rune{
+		0xA4: 0x20AC, 0xA6: 0x0160, 0xA8: 0x0161, 0xB4: 0x017D,
+		0xB8: 0x017E, 0xBC: 0x0152, 0xBD: 0x0153, 0xBE: 0x0178,
+	} {
+		high[b-0x80] = r
+	}
+	return &high
+}()
+
+var (
+	charsetUTF8  = newCharset(CharsetUTF8, nil)
+	charsetASCII = newCharset(CharsetASCII, nil)
+	// Messages labeled 8859/1 are often written in Windows-1252, and
+	// 0x80-0x9F are control characters in ISO 8859-1 that text does not
+	// use, so 8859/1 is read and written as Windows-1252.
+	charsetLatin1      = newCharset(CharsetLatin1, windows1252High)
+	charsetLatin9      = newCharset(CharsetLatin9, latin9High)
+	charsetWindows1252 = newCharset(CharsetWindows1252, windows1252High)
+)
+
+// lookupCharset returns the character set named by an MSH-18 value, and
+// whether it is supported. An empty name is UTF-8.
+func lookupCharset(name string) (*charset, bool) {
+	switch strings.ToUpper(strings.TrimSpace(name)) {
+	case "", "UNICODE UTF-8", "UNICODE", "UTF-8":
+		return charsetUTF8, true
+	case "ASCII":
+		return charsetASCII, true
+	case "8859/1", "ISO-8859-1":
+		return charsetLatin1, true
+	case "8859/15", "ISO-8859-15":
+		return charsetLatin9, true
+	case "WINDOWS-1252", "CP1252":
+		return charsetWindows1252, true
+	}
+	return nil, false
+}
+
+// messageCharset returns the character set declared by the MSH-18 of an MSH
+// line, or the fallback of d when MSH-18 is empty. Unsupported character
+// sets are read as they are.
+func messageCharset(msh []byte, d *decodeState) *charset {
+	fields := bytes.Split(msh, msh[3:4])
+	var name []byte
+	if len(fields) > 17 {
+		name = fields[17]
+		// Only the first repetition is the default character set, and
+		// MSH-18 is a primitive value, so cut at any encoding character.
+		if i := bytes.IndexAny(name, string(fields[1])); i >= 0 {
+			name = name[:i]
+		}
+	}
+	if len(bytes.TrimSpace(name)) == 0 && d != nil {
+		name = []byte(d.opts.Charset)
+	}
+	c, _ := lookupCharset(string(name))
+	return c
+}
+
+// decode returns b converted to UTF-8.
+func (c *charset) decode(b []byte) string {
+	if c == nil || c.high == nil || !hasHighBytes(b) {
+		return string(b)
+	}
+	var s strings.Builder
+	s.Grow(len(b) + len(b)/4)
+	for _, x := range b {
+		if x < 0x80 {
+			s.WriteByte(x)
+		} else {
+			s.WriteRune(c.high[x-0x80])
+		}
+	}
+	return s.String()
+}
+
+// encode returns the UTF-8 text b converted to the character set. Bytes
+// that are not valid UTF-8 are kept as they are.
+func (c *charset) encode(b []byte) ([]byte, error) {
+	if c == nil || (c.high == nil && c != charsetASCII) || !hasHighBytes(b) {
+		return b, nil
+	}
+	out := make([]byte, 0, len(b))
+	for len(b) > 0 {
+		r, size := utf8.DecodeRune(b)
+		switch x, ok := c.bytes[r]; {
+		case r < utf8.RuneSelf:
+			out = append(out, byte(r))
+		case r == utf8.RuneError && size == 1:
+			out = append(out, b[0])
+		case ok:
+			out = append(out, x)
+		default:
+			return nil, fmt.Errorf("hl7: %q cannot be encoded in character set %s", r, c.name)
+		}
+		b = b[size:]
+	}
+	return out, nil
+}
+
+// hasHighBytes reports whether b has bytes outside ASCII.
+func hasHighBytes(b []byte) bool {
+	for _, x := range b {
+		if x >= 0x80 {
+			return true
+		}
+	}
+	return false
+}
+
+// transcode converts a message written by an encoder to the character set
+// of opts.
+func (opts MarshalOptions) transcode(data []byte) ([]byte, error) {
+	if opts.Charset == "" {
+		return data, nil
+	}
+	c, ok := lookupCharset(opts.Charset)
+	if !ok {
+		return nil, fmt.Errorf("hl7: unsupported character set %q", opts.Charset)
+	}
+	return c.encode(data)
+}
@@ -0,0 +1,120 @@
+package hl7_test
+
+import (
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	"github.com/esequiel378/hl7"
+)
+
+// latin1Message has MSH-18 8859/1 and "Müller^José" (0xFC, 0xE9) and a
+// euro sign written as Windows-1252 (0x80) in PID-5.
+const latin1Message = "MSH|^~\\&|LAB|HOSP|||20250114||ADT^A01|1|P|2.5.1||||||8859/1\r" +
+	"PID|1||42||M\xfcller^Jos\xe9||||||\x80 5\r"
+
+type charsetMessage struct {
+	MSH struct {
+		FieldSeparator     string `hl7:"1"`
+		EncodingCharacters string `hl7:"2"`
+		CharacterSet       string `hl7:"18"`
+	} `hl7:"segment:MSH"`
+	PID struct {
+		Name struct {
+			Family string `hl7:"1"`
+			Given  string `hl7:"2"`
+		} `hl7:"5"`
+		Address string `hl7:"11"`
+	} `hl7:"segment:PID"`
+}
+
+func TestCharsetDecode(t *testing.T) {
+	var msg charsetMessage
+	if err := hl7.Unmarshal([]byte(latin1Message), &msg); err != nil {
+		t.Fatal(err)
+	}
+	if msg.PID.Name.Family != "Müller" || msg.PID.Name.Given != "José" || msg.PID.Address != "€ 5" {
+		t.Errorf("got %q %q %q", msg.PID.Name.Family, msg.PID.Name.Given, msg.PID.Address)
+	}
+
+	generic, err := hl7.ParseGeneric([]byte(latin1Message))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v := generic.Value(hl7.Path{Segment: "PID", FieldPath: hl7.FieldPath{Field: 5}}); v != "Müller^José" {
+		t.Errorf("got %q", v)
+	}
+	out, err := hl7.MarshalGeneric(generic)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(out) != strings.TrimSuffix(latin1Message, "\r") {
+		t.Errorf("expected MarshalGeneric to write 8859/1 again, got %q", out)
+	}
+
+	latin9 := strings.Replace(latin1Message, "8859/1", "8859/15", 1)
+	latin9 = strings.Replace(latin9, "\x80", "\xa4", 1)
+	if err := hl7.Unmarshal([]byte(latin9), &msg); err != nil {
+		t.Fatal(err)
+	}
+	if msg.PID.Address != "€ 5" {
+		t.Errorf("expected a euro sign from 8859/15, got %q", msg.PID.Address)
+	}
+}
+
+func TestCharsetDecoderFallback(t *testing.T) {
+	data := "MSH|^~\\&|LAB\rPID|1||42||M\xfcller\rMSH|^~\\&|LAB|||||||||||||||UNICODE UTF-8\rPID|1||43||M\xc3\xbcller\r"
+
+	for _, charset := range []string{"", hl7.CharsetLatin1} {
+		dec := hl7.NewDecoderWithOptions(iotest.OneByteReader(strings.NewReader(data)), hl7.DecodeOptions{Charset: charset})
+		var names []string
+		for dec.More() {
+			msg, err := dec.DecodeGeneric()
+			if err != nil {
+				t.Fatal(err)
+			}
+			names = append(names, msg.Value(hl7.Path{Segment: "PID", FieldPath: hl7.FieldPath{Field: 5}}))
+		}
+		want := "M\xfcller Müller"
+		if charset != "" {
+			want = "Müller Müller"
+		}
+		if got := strings.Join(names, " "); got != want {
+			t.Errorf("Charset %q: got %q, want %q", charset, got, want)
+		}
+	}
+}
+
+func TestCharsetEncode(t *testing.T) {
+	var msg charsetMessage
+	msg.MSH.FieldSeparator, msg.MSH.EncodingCharacters, msg.MSH.CharacterSet = "|", "^~\\&", hl7.CharsetLatin1
+	msg.PID.Name.Family, msg.PID.Name.Given = "Müller", "José"
+	msg.PID.Address = "€ 5"
+
+	opts := hl7.DefaultMarshalOptions()
+	opts.Charset = hl7.CharsetLatin1
+	out, err := hl7.MarshalWithOptions(msg, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "PID|||||M\xfcller^Jos\xe9||||||\x80 5"; !strings.HasSuffix(string(out), want) {
+		t.Errorf("got %q, want suffix %q", out, want)
+	}
+
+	msg.PID.Name.Given = "Zoë 李"
+	if _, err := hl7.MarshalWithOptions(msg, opts); err == nil || !strings.Contains(err.Error(), "cannot be encoded") {
+		t.Errorf("expected an error for a character outside 8859/1, got %v", err)
+	}
+	opts.Charset = hl7.CharsetASCII
+	if _, err := hl7.MarshalWithOptions(msg, opts); err == nil {
+		t.Error("expected an error for a character outside ASCII")
+	}
+	opts.Charset = "ISO IR87"
+	if _, err := hl7.MarshalWithOptions(msg, opts); err == nil || !strings.Contains(err.Error(), "unsupported character set") {
+		t.Errorf("expected an unsupported character set error, got %v", err)
+	}
+	opts.Charset = hl7.CharsetUTF8
+	if out, err := hl7.MarshalWithOptions(msg, opts); err != nil || !strings.Contains(string(out), "Zoë 李") {
+		t.Errorf("expected UTF-8 output, got %q, %v", out, err)
+	}
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/esequiel378/hl7"
+)
+
+// outputFormat selects how convertStream writes its JSON documents.
+type outputFormat int
+
+const (
+	formatDocuments outputFormat = iota // one document after another
+	formatNDJSON                        // one compact document per line
+	formatArray                         // a single JSON array
+)
+
+// convertStream decodes every message read from r with decode and writes one
+// JSON document per message to w in the given format. A message that fails
+// to decode is reported on errw with its 1-based position and skipped, and
+// input that cannot be read to the end counts as one more failure. It
+// returns the number of messages converted and the number that failed.
+func convertStream(r io.Reader, w, errw io.Writer, decode func(*hl7.Decoder) (any, error), format outputFormat, compact bool) (ok, failed int, err error) {
+	dec := hl7.NewDecoder(r)
+	if format == formatArray {
+		if _, err := io.WriteString(w, "["); err != nil {
+			return 0, 0, err
+		}
+	}
+
+	for n := 1; dec.More(); n++ {
+		v, err := decode(dec)
+		if dec.Err() != nil {
+			break // the input could not be read; reported below
+		}
+		if err != nil {
+			failed++
+			fmt.Fprintf(errw, "hl7: message %d: %v\n", n, err)
+			continue
+		}
+
+		var out []byte
+		switch {
+		case format == formatNDJSON, compact:
+			out, err = json.Marshal(v)
+		case format == formatArray:
+			out, err = json.MarshalIndent(v, "  ", "  ")
+		default:
+			out, err = json.MarshalIndent(v, "", "  ")
+		}
+		if err != nil {
+			return ok, failed, fmt.Errorf("message %d: %w", n, err)
+		}
+
+		if format == formatArray {
+			prefix := ""
+			if ok > 0 {
+				prefix = ","
+			}
+			if !compact {
+				prefix += "\n  "
+			}
+			out = append([]byte(prefix), out...)
+		} else {
+			out = append(out, '\n')
+		}
+		if _, err := w.Write(out); err != nil {
+			return ok, failed, err
+		}
+		ok++
+	}
+	if err := dec.Err(); err != nil {
+		failed++
+		fmt.Fprintf(errw, "hl7: reading input: %v\n", err)
+	}
+
+	if format == formatArray {
+		end := "]\n"
+		if ok > 0 && !compact {
+			end = "\n" + end
+		}
+		if _, err := io.WriteString(w, end); err != nil {
+			return ok, failed, err
+		}
+	}
+	return ok, failed, nil
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	"github.com/esequiel378/hl7"
+)
+
+// decodeSender decodes a message to its sending application, MSH-3, and
+// fails for messages from "BAD".
+func decodeSender(dec *hl7.Decoder) (any, error) {
+	msg, err := dec.DecodeGeneric()
+	if err != nil {
+		return nil, err
+	}
+	app := msg.Value(hl7.Path{Segment: "MSH", FieldPath: hl7.FieldPath{Field: 3}})
+	if app == "BAD" {
+		return nil, errors.New("bad sender")
+	}
+	return map[string]string{"app": app}, nil
+}
+
+func TestConvertStream(t *testing.T) {
+	input := "MSH|^~\\&|A\rPID|1\nMSH|^~\\&|BAD\rPID|2\r\nMSH|^~\\&|C\r"
+
+	tests := []struct {
+		name    string
+		format  outputFormat
+		compact bool
+		want    string
+	}{
+		{"documents", formatDocuments, false, "{\n  \"app\": \"A\"\n}\n{\n  \"app\": \"C\"\n}\n"},
+		{"compact", formatDocuments, true, "{\"app\":\"A\"}\n{\"app\":\"C\"}\n"},
+		{"ndjson", formatNDJSON, false, "{\"app\":\"A\"}\n{\"app\":\"C\"}\n"},
+		{"array", formatArray, false, "[\n  {\n    \"app\": \"A\"\n  },\n  {\n    \"app\": \"C\"\n  }\n]\n"},
+		{"compact array", formatArray, true, "[{\"app\":\"A\"},{\"app\":\"C\"}]\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out, errOut bytes.Buffer
+			ok, failed, err := convertStream(strings.NewReader(input), &out, &errOut, decodeSender, tt.format, tt.compact)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if ok != 2 || failed != 1 {
+				t.Errorf("expected 2 converted and 1 failed, got %d and %d", ok, failed)
+			}
+			if out.String() != tt.want {
+				t.Errorf("unexpected output:\n got %q\nwant %q", out.String(), tt.want)
+			}
+			if want := "hl7: message 2: bad sender\n"; errOut.String() != want {
+				t.Errorf("expected stderr %q, got %q", want, errOut.String())
+			}
+		})
+	}
+}
+
+func TestConvertStreamEmptyArray(t *testing.T) {
+	var out bytes.Buffer
+	if _, _, err := convertStream(strings.NewReader(""), &out, &out, decodeSender, formatArray, false); err != nil {
+		t.Fatal(err)
+	}
+	if out.String() != "[]\n" {
+		t.Errorf("expected an empty array, got %q", out.String())
+	}
+}
+
+func TestConvertStreamReadError(t *testing.T) {
+	input := io.MultiReader(strings.NewReader("MSH|^~\\&|A\rPID|1\rMSH|^~\\&|C\rPID|"), iotest.ErrReader(errors.New("connection reset")))
+	var out, errOut bytes.Buffer
+	ok, failed, err := convertStream(input, &out, &errOut, decodeSender, formatNDJSON, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ok != 1 || failed != 1 {
+		t.Errorf("expected 1 converted and 1 failed, got %d and %d", ok, failed)
+	}
+	if want := "hl7: reading input: connection reset\n"; errOut.String() != want {
+		t.Errorf("expected stderr %q, got %q", want, errOut.String())
+	}
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	"github.com/esequiel378/hl7/deid"
+)
+
+func TestDeidentifyStream(t *testing.T) {
+	input := "MSH|^~\\&|A|B|||20250101||ADT^A01|1|P|2.5\rPID|1||MRN1^^^H||DOE^JANE||19800101\r" +
+		"MSH|^~\\&|A|B|||20250102||ADT^A08|2|P|2.5\rPID|1||MRN1^^^H||DOE^JANE||19800101\rOBX|1|TX|||A\\T\\B\r"
+
+	d, err := deid.New(deid.Options{Salt: []byte("salt")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+	if err := deidentifyStream(strings.NewReader(input), &out, d, "\n"); err != nil {
+		t.Fatalf("deidentifyStream failed: %v", err)
+	}
+
+	lines := strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n")
+	if len(lines) != 5 {
+		t.Fatalf("expected 5 segments, got %q", out.String())
+	}
+	if strings.Contains(out.String(), "DOE") || strings.Contains(out.String(), "MRN1") {
+		t.Errorf("expected identifiers to be replaced, got %q", out.String())
+	}
+	if lines[1] != lines[3] {
+		t.Errorf("expected the same patient to get the same pseudonyms:\n%s\n%s", lines[1], lines[3])
+	}
+	if lines[4] != "OBX|1|TX|||A\\T\\B" {
+		t.Errorf("expected untouched segment to round-trip, got %q", lines[4])
+	}
+}
+
+func TestDeidentifyStreamReadError(t *testing.T) {
+	d, err := deid.New(deid.Options{Salt: []byte("salt")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	readErr := errors.New("connection reset")
+	if err := deidentifyStream(iotest.ErrReader(readErr), &bytes.Buffer{}, d, "\n"); !errors.Is(err, readErr) {
+		t.Errorf("expected the read error, got %v", err)
+	}
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/esequiel378/hl7"
+)
+
+// pathFlags collects repeated, comma-separated path flags.
+type pathFlags []hl7.Path
+
+func (f *pathFlags) String() string {
+	parts := make([]string, len(*f))
+	for i, p := range *f {
+		parts[i] = p.String()
+	}
+	return strings.Join(parts, ",")
+}
+
+func (f *pathFlags) Set(s string) error {
+	for _, part := range strings.Split(s, ",") {
+		p, err := hl7.ParsePath(strings.TrimSpace(part))
+		if err != nil {
+			return err
+		}
+		*f = append(*f, p)
+	}
+	return nil
+}
+
+// messageDiff is a difference in the JSON output of `hl7 diff`, numbered by
+// message within the input files.
+type messageDiff struct {
+	Message int `json:"message"`
+	hl7.Difference
+}
+
+// runDiff implements `hl7 diff`, which compares the messages of two files.
+func runDiff(args []string) error {
+	fs := flag.NewFlagSet("hl7 diff", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, `Usage: hl7 diff [flags] <a.hl7> <b.hl7>
+
+Compare the HL7 messages of two files at the segment, field, repetition and
+component level and print the values that were added, removed or changed,
+e.g. PID-5.2: "JOHN" → "JON". Files with several messages are compared
+message by message.
+
+Flags:
+  --ignore <paths>      Comma-separated paths to ignore, e.g. MSH-7,MSH-10,
+                        or whole segments such as NTE. May be repeated.
+  --key <path>          Match repeating segments by a key field instead of
+                        by position, e.g. OBX-3. May be repeated.
+  --json                Print the differences as a JSON array.`)
+	}
+
+	var ignore, keys pathFlags
+	var asJSON bool
+	fs.Var(&ignore, "ignore", "paths to ignore")
+	fs.Var(&keys, "key", "segment key field")
+	fs.BoolVar(&asJSON, "json", false, "print JSON")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 2 {
+		fs.Usage()
+		return errors.New("diff: two files are required")
+	}
+
+	opts := hl7.DiffOptions{Ignore: ignore}
+	for _, k := range keys {
+		if k.Field == 0 {
+			return fmt.Errorf("diff: --key %s: expected a field such as OBX-3", k)
+		}
+		if opts.Keys == nil {
+			opts.Keys = make(map[string]hl7.FieldPath)
+		}
+		opts.Keys[k.Segment] = k.FieldPath
+	}
+
+	var inputs [2][]*hl7.GenericMessage
+	for i, name := range fs.Args() {
+		data, err := os.ReadFile(name)
+		if err != nil {
+			return fmt.Errorf("diff: %w", err)
+		}
+		if inputs[i], err = hl7.ParseGenericMulti(data); err != nil {
+			return fmt.Errorf("diff: %s: %w", name, err)
+		}
+	}
+
+	diffs := diffMessages(inputs[0], inputs[1], opts)
+	return printDiffs(os.Stdout, diffs, len(inputs[0]) > 1 || len(inputs[1]) > 1, asJSON)
+}
+
+// diffMessages compares two lists of messages pairwise. Messages without a
+// partner are compared with an empty message.
+func diffMessages(as, bs []*hl7.GenericMessage, opts hl7.DiffOptions) []messageDiff {
+	var diffs []messageDiff
+	for i := range max(len(as), len(bs)) {
+		a, b := &hl7.GenericMessage{}, &hl7.GenericMessage{}
+		if i < len(as) {
+			a = as[i]
+		}
+		if i < len(bs) {
+			b = bs[i]
+		}
+		for _, d := range hl7.DiffGeneric(a, b, opts) {
+			diffs = append(diffs, messageDiff{Message: i + 1, Difference: d})
+		}
+	}
+	return diffs
+}
+
+// printDiffs writes the differences as text, one per line and prefixed by
+// the message number when there are several messages, or as JSON.
+func printDiffs(w io.Writer, diffs []messageDiff, numbered, asJSON bool) error {
+	if asJSON {
+		if diffs == nil {
+			diffs = []messageDiff{}
+		}
+		out, err := json.MarshalIndent(diffs, "", "  ")
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(w, "%s\n", out)
+		return err
+	}
+	for _, d := range diffs {
+		prefix := ""
+		if numbered {
+			prefix = fmt.Sprintf("message %d: ", d.Message)
+		}
+		if _, err := fmt.Fprintln(w, prefix+d.Difference.String()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
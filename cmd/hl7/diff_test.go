@@ -0,0 +1,43 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/esequiel378/hl7"
+)
+
+func TestDiffMessages(t *testing.T) {
+	a, err := hl7.ParseGenericMulti([]byte("MSH|^~\\&|A|B|||20250101||ADT^A01|1\rPID|1||X||DOE^JOHN\r" +
+		"MSH|^~\\&|A|B|||20250101||ADT^A01|2\rPID|1||Y\r"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := hl7.ParseGenericMulti([]byte("MSH|^~\\&|A|B|||20250102||ADT^A01|1\rPID|1||X||DOE^JON\r"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ignore := []hl7.Path{{Segment: "MSH", FieldPath: hl7.FieldPath{Field: 7}}}
+	diffs := diffMessages(a, b, hl7.DiffOptions{Ignore: ignore})
+
+	var out bytes.Buffer
+	if err := printDiffs(&out, diffs, true, false); err != nil {
+		t.Fatal(err)
+	}
+	want := "message 1: PID-5.2: \"JOHN\" → \"JON\"\n" +
+		"message 2: MSH: removed \"MSH|^~\\\\&|A|B|||20250101||ADT^A01|2\"\n" +
+		"message 2: PID: removed \"PID|1||Y\"\n"
+	if out.String() != want {
+		t.Errorf("unexpected text output:\n%s", out.String())
+	}
+
+	out.Reset()
+	if err := printDiffs(&out, diffs[:1], false, true); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), `"path": "PID-5.2"`) || !strings.Contains(out.String(), `"message": 1`) {
+		t.Errorf("unexpected JSON output:\n%s", out.String())
+	}
+}
@@ -0,0 +1,214 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/esequiel378/hl7"
+)
+
+// lineEndings maps the values of --line-ending to segment terminators.
+var lineEndings = map[string]string{
+	"cr":   "\r",
+	"lf":   "\n",
+	"crlf": "\r\n",
+}
+
+// runEncode implements `hl7 encode`, which turns JSON documents back into
+// HL7 messages.
+func runEncode(args []string) error {
+	fs := flag.NewFlagSet("hl7 encode", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, `Usage: hl7 encode (--schema <file> | --generic) [flags] [file]
+
+Encode JSON documents read from --file, the positional [file] argument, or
+stdin as HL7 messages. Several documents may be given as NDJSON (one per
+line) or simply one after another; each becomes one message.
+
+With --schema, documents have the shape produced by hl7 --schema and are
+encoded with MarshalWithSchemaOptions. With --generic, documents have the
+shape produced by hl7 without a schema and are encoded with MarshalGeneric.
+
+Flags:
+  -f, --file <file>         JSON input file.
+  -s, --schema <file>       JSON schema file describing the documents.
+  --generic                 Read generic message documents.
+  --field-sep <c>           Field separator (default |).
+  --component-sep <c>       Component separator (default ^).
+  --repetition-sep <c>      Repetition separator (default ~).
+  --escape-char <c>         Escape character (default \).
+  --subcomponent-sep <c>    Subcomponent separator (default &).
+  --line-ending <ending>    Segment terminator: cr, lf or crlf (default cr).
+
+In --generic mode the separators declared by each message's MSH-1 and MSH-2
+are kept unless a separator flag is given, in which case every value is
+re-encoded for the new separators.
+
+Examples:
+  hl7 -c -s adt_a01.json -f in.hl7 | hl7 encode -s adt_a01.json
+  hl7 encode --generic --line-ending lf messages.ndjson`)
+	}
+
+	var inputFile, schemaFile, lineEnding string
+	var generic bool
+	opts := hl7.DefaultMarshalOptions()
+	fs.StringVar(&inputFile, "file", "", "JSON input file")
+	fs.StringVar(&inputFile, "f", "", "JSON input file (shorthand)")
+	fs.StringVar(&schemaFile, "schema", "", "JSON schema file")
+	fs.StringVar(&schemaFile, "s", "", "JSON schema file (shorthand)")
+	fs.BoolVar(&generic, "generic", false, "read generic message documents")
+	fs.Var((*delimiterFlag)(&opts.FieldSeparator), "field-sep", "field separator")
+	fs.Var((*delimiterFlag)(&opts.ComponentSeparator), "component-sep", "component separator")
+	fs.Var((*delimiterFlag)(&opts.RepetitionSeparator), "repetition-sep", "repetition separator")
+	fs.Var((*delimiterFlag)(&opts.EscapeCharacter), "escape-char", "escape character")
+	fs.Var((*delimiterFlag)(&opts.SubcomponentSeparator), "subcomponent-sep", "subcomponent separator")
+	fs.StringVar(&lineEnding, "line-ending", "cr", "segment terminator: cr, lf or crlf")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if (schemaFile == "") == !generic {
+		fs.Usage()
+		return errors.New("encode: exactly one of --schema or --generic is required")
+	}
+	var ok bool
+	if opts.LineEnding, ok = lineEndings[lineEnding]; !ok {
+		return fmt.Errorf("encode: invalid --line-ending %q: want cr, lf or crlf", lineEnding)
+	}
+	if err := checkDelimiters(opts); err != nil {
+		return fmt.Errorf("encode: %w", err)
+	}
+
+	var encode func(doc []byte) ([]byte, error)
+	if generic {
+		custom := false
+		fs.Visit(func(f *flag.Flag) {
+			switch f.Name {
+			case "field-sep", "component-sep", "repetition-sep", "escape-char", "subcomponent-sep":
+				custom = true
+			}
+		})
+		encode = genericEncoder(opts, custom)
+	} else {
+		schema, err := hl7.LoadSchemaFile(schemaFile)
+		if err != nil {
+			return fmt.Errorf("encode: %w", err)
+		}
+		compiled, err := schema.Compile()
+		if err != nil {
+			return fmt.Errorf("encode: %w", err)
+		}
+		encode = schemaEncoder(compiled, opts)
+	}
+
+	in, err := openInput(inputFile, fs.Args())
+	if err != nil {
+		return fmt.Errorf("encode: %w", err)
+	}
+	defer in.Close()
+
+	_, err = encodeStream(in, os.Stdout, encode, opts.LineEnding)
+	return err
+}
+
+// delimiterFlag is a flag.Value holding a single-character delimiter.
+type delimiterFlag byte
+
+func (f *delimiterFlag) String() string {
+	if f == nil || *f == 0 {
+		return ""
+	}
+	return string(rune(*f))
+}
+
+func (f *delimiterFlag) Set(s string) error {
+	if len(s) != 1 || s[0] == '\r' || s[0] == '\n' {
+		return fmt.Errorf("delimiter must be a single character, got %q", s)
+	}
+	*f = delimiterFlag(s[0])
+	return nil
+}
+
+// checkDelimiters reports an error when two delimiters of opts are the same.
+func checkDelimiters(opts hl7.MarshalOptions) error {
+	delims := []byte{
+		opts.FieldSeparator,
+		opts.ComponentSeparator,
+		opts.RepetitionSeparator,
+		opts.EscapeCharacter,
+		opts.SubcomponentSeparator,
+	}
+	for i, c := range delims {
+		if bytes.IndexByte(delims[i+1:], c) >= 0 {
+			return fmt.Errorf("delimiter %q is used more than once", c)
+		}
+	}
+	return nil
+}
+
+// schemaEncoder returns an encoder for documents shaped like the output of
+// UnmarshalWithSchema.
+func schemaEncoder(c *hl7.CompiledSchema, opts hl7.MarshalOptions) func([]byte) ([]byte, error) {
+	return func(doc []byte) ([]byte, error) {
+		var v map[string]any
+		if err := json.Unmarshal(doc, &v); err != nil {
+			return nil, err
+		}
+		return c.MarshalWithOptions(v, opts)
+	}
+}
+
+// genericEncoder returns an encoder for GenericMessage documents. The
+// delimiters of opts replace those declared by each message only when
+// custom is set.
+func genericEncoder(opts hl7.MarshalOptions, custom bool) func([]byte) ([]byte, error) {
+	return func(doc []byte) ([]byte, error) {
+		var msg hl7.GenericMessage
+		if err := json.Unmarshal(doc, &msg); err != nil {
+			return nil, err
+		}
+		if custom {
+			msg.SetDelimiters(opts)
+		}
+		out, err := hl7.MarshalGeneric(&msg)
+		if err != nil {
+			return nil, err
+		}
+		if opts.LineEnding != "\r" {
+			out = bytes.ReplaceAll(out, []byte("\r"), []byte(opts.LineEnding))
+		}
+		return out, nil
+	}
+}
+
+// encodeStream encodes every JSON document read from r and writes the
+// resulting messages to w, terminating the last segment of each with
+// lineEnding. It returns the number of messages written.
+func encodeStream(r io.Reader, w io.Writer, encode func(doc []byte) ([]byte, error), lineEnding string) (int, error) {
+	dec := json.NewDecoder(r)
+	n := 0
+	for doc := 1; ; doc++ {
+		var raw json.RawMessage
+		if err := dec.Decode(&raw); err == io.EOF {
+			return n, nil
+		} else if err != nil {
+			return n, fmt.Errorf("encode: document %d: %w", doc, err)
+		}
+		out, err := encode(raw)
+		if err != nil {
+			return n, fmt.Errorf("encode: document %d: %w", doc, err)
+		}
+		if len(out) == 0 {
+			continue
+		}
+		if _, err := w.Write(append(out, lineEnding...)); err != nil {
+			return n, err
+		}
+		n++
+	}
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/esequiel378/hl7"
+)
+
+func TestEncodeStreamSchema(t *testing.T) {
+	schema, err := hl7.ParseSchema([]byte(`{
+		"segments": {
+			"MSH": {"fields": {"sendingApp": {"index": 3, "type": "string"}}},
+			"PID": {"fields": {
+				"name": {"index": 5, "type": "object", "components": {
+					"family": {"index": 1, "type": "string"},
+					"given": {"index": 2, "type": "string"}
+				}},
+				"dob": {"index": 7, "type": "timestamp"}
+			}}
+		},
+		"order": ["MSH", "PID"]
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := schema.Compile()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	input := `{"MSH": {"sendingApp": "A"}, "PID": {"name": {"family": "DOE", "given": "JANE"}, "dob": "1985-03-15T00:00:00Z"}}
+{"MSH": {"sendingApp": "B"}}
+`
+	opts := hl7.DefaultMarshalOptions()
+	opts.ComponentSeparator = '*'
+	opts.LineEnding = "\n"
+
+	var out bytes.Buffer
+	n, err := encodeStream(strings.NewReader(input), &out, schemaEncoder(c, opts), opts.LineEnding)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "MSH|*~\\&|A\nPID|||||DOE*JANE||19850315000000\n" +
+		"MSH|*~\\&|B\n"
+	if n != 2 || out.String() != want {
+		t.Errorf("unexpected output (%d messages):\n got %q\nwant %q", n, out.String(), want)
+	}
+}
+
+func TestEncodeStreamGeneric(t *testing.T) {
+	msg, err := hl7.ParseGeneric([]byte("MSH|^~\\&|A|B\rPID|1||1^^^H||O\\T\\Brien^PAT"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var in bytes.Buffer
+	for range 2 {
+		if err := json.NewEncoder(&in).Encode(msg); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	opts := hl7.DefaultMarshalOptions()
+	var out bytes.Buffer
+	n, err := encodeStream(bytes.NewReader(in.Bytes()), &out, genericEncoder(opts, false), "\r")
+	if err != nil {
+		t.Fatal(err)
+	}
+	one := "MSH|^~\\&|A|B\rPID|1||1^^^H||O\\T\\Brien^PAT\r"
+	if n != 2 || out.String() != one+one {
+		t.Errorf("unexpected output (%d messages): %q", n, out.String())
+	}
+
+	opts.ComponentSeparator = '*'
+	opts.SubcomponentSeparator = '^'
+	opts.LineEnding = "\r\n"
+	out.Reset()
+	if _, err := encodeStream(bytes.NewReader(in.Bytes()), &out, genericEncoder(opts, true), opts.LineEnding); err != nil {
+		t.Fatal(err)
+	}
+	if want := "MSH|*~\\^|A|B\r\nPID|1||1***H||O\\T\\Brien*PAT\r\n"; !strings.HasPrefix(out.String(), want) {
+		t.Errorf("expected re-encoded message %q, got %q", want, out.String())
+	}
+}
+
+func TestEncodeStreamReportsDocument(t *testing.T) {
+	input := `{"segments": []}` + "\n" + `{"segments": 1}`
+	_, err := encodeStream(strings.NewReader(input), &bytes.Buffer{}, genericEncoder(hl7.DefaultMarshalOptions(), false), "\r")
+	if err == nil || !strings.Contains(err.Error(), "document 2") {
+		t.Errorf("expected an error for document 2, got %v", err)
+	}
+}
+
+func TestCheckDelimiters(t *testing.T) {
+	opts := hl7.DefaultMarshalOptions()
+	if err := checkDelimiters(opts); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	opts.SubcomponentSeparator = '^'
+	if err := checkDelimiters(opts); err == nil {
+		t.Error("expected an error for a duplicate delimiter")
+	}
+}
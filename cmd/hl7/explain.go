@@ -0,0 +1,240 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/esequiel378/hl7"
+)
+
+// runExplain implements `hl7 explain`, which prints messages as an annotated
+// tree.
+func runExplain(args []string) error {
+	fs := flag.NewFlagSet("hl7 explain", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, `Usage: hl7 explain [flags] [file]
+
+Print the HL7 messages read from --file, the positional [file] argument, or
+stdin as an indented tree of segments, fields, repetitions, components and
+subcomponents. Each line shows the path of the value, its name and its raw
+value. Names come from --schema when it describes the value, or else from a
+built-in dictionary of common HL7 v2.5 segments.
+
+Flags:
+  -f, --file <file>     HL7 input file.
+  -s, --schema <file>   JSON schema file whose field names are shown.
+  --only-populated      Omit empty fields and components.
+  --color               Color the output with ANSI escape codes.
+
+Examples:
+  hl7 explain --only-populated adt.hl7
+  hl7 explain -s vendor.json --color < oru.hl7 | less -R`)
+	}
+
+	var inputFile, schemaFile string
+	var opts explainOptions
+	fs.StringVar(&inputFile, "file", "", "HL7 input file")
+	fs.StringVar(&inputFile, "f", "", "HL7 input file (shorthand)")
+	fs.StringVar(&schemaFile, "schema", "", "JSON schema file")
+	fs.StringVar(&schemaFile, "s", "", "JSON schema file (shorthand)")
+	fs.BoolVar(&opts.onlyPopulated, "only-populated", false, "omit empty values")
+	fs.BoolVar(&opts.color, "color", false, "use ANSI colors")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if schemaFile != "" {
+		var err error
+		if opts.schema, err = hl7.LoadSchemaFile(schemaFile); err != nil {
+			return fmt.Errorf("explain: %w", err)
+		}
+	}
+	in, err := openInput(inputFile, fs.Args())
+	if err != nil {
+		return fmt.Errorf("explain: %w", err)
+	}
+	defer in.Close()
+
+	dec := hl7.NewDecoder(in)
+	for n := 1; dec.More(); n++ {
+		msg, err := dec.DecodeGeneric()
+		if err != nil {
+			return fmt.Errorf("explain: message %d: %w", n, err)
+		}
+		if n > 1 {
+			fmt.Println()
+		}
+		if err := explainMessage(os.Stdout, msg, opts); err != nil {
+			return err
+		}
+	}
+	if err := dec.Err(); err != nil {
+		return fmt.Errorf("explain: %w", err)
+	}
+	return nil
+}
+
+// explainOptions configures explainMessage.
+type explainOptions struct {
+	schema        *hl7.MessageSchema
+	onlyPopulated bool
+	color         bool
+}
+
+// ANSI escape codes used with --color.
+const (
+	ansiReset = "\x1b[0m"
+	ansiBold  = "\x1b[1m"
+	ansiDim   = "\x1b[2m"
+	ansiCyan  = "\x1b[36m"
+	ansiGreen = "\x1b[32m"
+)
+
+// explainer writes the tree of one message.
+type explainer struct {
+	w    io.Writer
+	opts explainOptions
+	seps hl7.MarshalOptions
+	err  error
+}
+
+// explainMessage writes msg to w as an indented tree, one line per
+// segment, field, repetition, component and subcomponent.
+func explainMessage(w io.Writer, msg *hl7.GenericMessage, opts explainOptions) error {
+	e := &explainer{w: w, opts: opts, seps: msg.Delimiters()}
+
+	counts := make(map[string]int)
+	for _, seg := range msg.Segments {
+		counts[seg.Name]++
+	}
+	seen := make(map[string]int)
+	for i := range msg.Segments {
+		seg := &msg.Segments[i]
+		seen[seg.Name]++
+		at := hl7.Path{Segment: seg.Name}
+		if counts[seg.Name] > 1 {
+			at.Occurrence = seen[seg.Name]
+		}
+		e.segment(at, seg)
+	}
+	return e.err
+}
+
+func (e *explainer) segment(at hl7.Path, seg *hl7.GenericSegment) {
+	e.line(0, at, hl7.SegmentName(seg.Name), "")
+
+	maxIndex := 0
+	for _, f := range seg.Fields {
+		maxIndex = max(maxIndex, f.Index)
+	}
+	for field := 1; field <= maxIndex; field++ {
+		at.FieldPath = hl7.FieldPath{Field: field}
+		v := seg.Value(at.FieldPath, e.seps)
+		if v == "" && e.opts.onlyPopulated {
+			continue
+		}
+		e.line(1, at, e.name(at), v)
+		if seg.Name == "MSH" && field <= 2 {
+			continue
+		}
+
+		reps := strings.Split(v, string(e.seps.RepetitionSeparator))
+		if len(reps) == 1 {
+			e.components(2, at, v)
+			continue
+		}
+		for r, rep := range reps {
+			if rep == "" && e.opts.onlyPopulated {
+				continue
+			}
+			at.Repetition = r + 1
+			e.line(2, at, "", rep)
+			e.components(3, at, rep)
+		}
+	}
+}
+
+// components writes the components of a repetition, and their
+// subcomponents, unless it has none.
+func (e *explainer) components(depth int, at hl7.Path, v string) {
+	sub := string(e.seps.SubcomponentSeparator)
+	comps := strings.Split(v, string(e.seps.ComponentSeparator))
+	if len(comps) == 1 && !strings.Contains(v, sub) {
+		return
+	}
+	for c, comp := range comps {
+		if comp == "" && e.opts.onlyPopulated {
+			continue
+		}
+		at.Component = c + 1
+		at.Subcomponent = 0
+		e.line(depth, at, e.name(at), comp)
+
+		subs := strings.Split(comp, sub)
+		if len(subs) == 1 {
+			continue
+		}
+		for s, v := range subs {
+			if v == "" && e.opts.onlyPopulated {
+				continue
+			}
+			at.Subcomponent = s + 1
+			e.line(depth+1, at, "", v)
+		}
+	}
+}
+
+// name returns the name of the field or component at p, from the schema
+// or the built-in dictionary.
+func (e *explainer) name(p hl7.Path) string {
+	if name := schemaFieldName(e.opts.schema, p); name != "" {
+		if p.Component > 0 {
+			name = name[strings.LastIndexByte(name, '.')+1:]
+		}
+		return name
+	}
+	if p.Component == 0 {
+		return hl7.FieldName(p.Segment, p.Field)
+	}
+	return hl7.ComponentName(hl7.FieldType(p.Segment, p.Field), p.Component)
+}
+
+// line writes one line of the tree: the path indented by depth, then the
+// name and value in aligned columns.
+func (e *explainer) line(depth int, at hl7.Path, name, value string) {
+	if e.err != nil {
+		return
+	}
+	path := strings.Repeat("  ", depth) + at.String()
+	switch {
+	case depth == 0:
+		if name != "" {
+			name = "  " + name
+		}
+	case value != "":
+		path = fmt.Sprintf("%-22s", path)
+		name = fmt.Sprintf(" %-34s", name)
+		value = " " + value
+	case name != "":
+		path = fmt.Sprintf("%-22s", path)
+		name = " " + name
+	}
+
+	if e.opts.color {
+		style := ansiCyan
+		if depth == 0 {
+			style = ansiBold
+		}
+		path = style + path + ansiReset
+		if name != "" {
+			name = ansiDim + name + ansiReset
+		}
+		if value != "" {
+			value = ansiGreen + value + ansiReset
+		}
+	}
+	_, e.err = fmt.Fprintln(e.w, path+name+value)
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/esequiel378/hl7"
+)
+
+func TestExplainMessage(t *testing.T) {
+	msg, err := hl7.ParseGeneric([]byte("MSH|^~\\&|LAB\r" +
+		"PID|1||7^^^H&X~8||DOE^JANE\r" +
+		"OBX|1\rOBX|2||GLU"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var out bytes.Buffer
+	if err := explainMessage(&out, msg, explainOptions{onlyPopulated: true}); err != nil {
+		t.Fatal(err)
+	}
+	want := `MSH  Message Header
+  MSH-1                Field Separator                    |
+  MSH-2                Encoding Characters                ^~\&
+  MSH-3                Sending Application                LAB
+PID  Patient Identification
+  PID-1                Set ID - PID                       1
+  PID-3                Patient Identifier List            7^^^H&X~8
+    PID-3[1]                                              7^^^H&X
+      PID-3[1].1       ID Number                          7
+      PID-3[1].4       Assigning Authority                H&X
+        PID-3[1].4.1                                      H
+        PID-3[1].4.2                                      X
+    PID-3[2]                                              8
+  PID-5                Patient Name                       DOE^JANE
+    PID-5.1            Family Name                        DOE
+    PID-5.2            Given Name                         JANE
+OBX[1]  Observation/Result
+  OBX[1]-1             Set ID - OBX                       1
+OBX[2]  Observation/Result
+  OBX[2]-1             Set ID - OBX                       2
+  OBX[2]-3             Observation Identifier             GLU
+`
+	if out.String() != want {
+		t.Errorf("unexpected tree:\n%s\nwant:\n%s", out.String(), want)
+	}
+}
+
+func TestExplainMessageSchemaNames(t *testing.T) {
+	schema, err := hl7.ParseSchema([]byte(`{"segments": {"PID": {"fields": {
+		"name": {"index": 5, "type": "object", "components": {"last": {"index": 1}}}
+	}}}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg, err := hl7.ParseGeneric([]byte("PID|||||DOE^JANE\rZZ1|x"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var out bytes.Buffer
+	if err := explainMessage(&out, msg, explainOptions{schema: schema}); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"\n  PID-2                Patient ID\n",
+		"\n  PID-5                name ",
+		"\n    PID-5.1            last ",
+		"\n    PID-5.2            Given Name ",
+		"\nZZ1\n  ZZ1-1                                                   x\n",
+	} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("expected %q in:\n%s", want, out.String())
+		}
+	}
+}
+
+func TestExplainMessageColor(t *testing.T) {
+	msg, err := hl7.ParseGeneric([]byte("PID|1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+	if err := explainMessage(&out, msg, explainOptions{color: true}); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(out.String(), ansiBold+"PID"+ansiReset) || !strings.Contains(out.String(), ansiGreen+" 1"+ansiReset) {
+		t.Errorf("expected colored output, got %q", out.String())
+	}
+}
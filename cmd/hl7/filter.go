@@ -0,0 +1,108 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/esequiel378/hl7"
+)
+
+// runFilter implements `hl7 filter`, which writes the messages of a stream
+// that match a filter expression.
+func runFilter(args []string) error {
+	fs := flag.NewFlagSet("hl7 filter", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, `Usage: hl7 filter [flags] <expression> [file]
+
+Write the HL7 messages read from --file, the positional [file] argument, or
+stdin that match a filter expression. Matching messages are written back
+unchanged.
+
+Expressions combine predicates on paths such as MSH-9.1, PID-3[2].1 or
+OBX[2]-5 with AND, OR, NOT and parentheses:
+
+  PATH = "v", !=, <, <=, >, >=   compare (numerically for numbers)
+  PATH IN ("a", "b")             list membership; also NOT IN
+  PATH MATCHES "re", PATH =~ "re"  regular expression
+  EXISTS PATH, PATH EXISTS       any non-empty value
+  ANY PATH ..., ALL PATH ...     quantify over segment occurrences and
+                                 repetitions (ANY is the default)
+
+Flags:
+  -f, --file <file>     HL7 input file.
+  -v, --invert          Write the messages that do not match.
+  --count               Print the number of matching messages instead.
+  --cr                  Terminate segments with \r instead of \n.
+
+Examples:
+  hl7 filter 'MSH-9.1 = "ORU" AND OBR-4.1 IN ("CBC","BMP")' results.hl7
+  hl7 filter --count 'ALL OBX-8 = "N"' < feed.hl7`)
+	}
+
+	var inputFile string
+	var invert, count, cr bool
+	fs.StringVar(&inputFile, "file", "", "HL7 input file")
+	fs.StringVar(&inputFile, "f", "", "HL7 input file (shorthand)")
+	fs.BoolVar(&invert, "invert", false, "write non-matching messages")
+	fs.BoolVar(&invert, "v", false, "write non-matching messages (shorthand)")
+	fs.BoolVar(&count, "count", false, "print the number of matches")
+	fs.BoolVar(&cr, "cr", false, "terminate segments with \\r")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return errors.New("filter: an expression is required")
+	}
+
+	f, err := hl7.Compile(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	in, err := openInput(inputFile, fs.Args()[1:])
+	if err != nil {
+		return fmt.Errorf("filter: %w", err)
+	}
+	defer in.Close()
+
+	lineEnding := "\n"
+	if cr {
+		lineEnding = "\r"
+	}
+	out := io.Writer(os.Stdout)
+	if count {
+		out = io.Discard
+	}
+	n, err := filterStream(in, out, f, invert, lineEnding)
+	if err != nil {
+		return err
+	}
+	if count {
+		fmt.Println(n)
+	}
+	return nil
+}
+
+// filterStream writes every message read from r that matches f, or that
+// does not when invert is set, to w. It returns the number written.
+func filterStream(r io.Reader, w io.Writer, f *hl7.Filter, invert bool, lineEnding string) (int, error) {
+	dec := hl7.NewDecoder(r)
+	n := 0
+	for dec.More() {
+		msg, err := dec.DecodeGeneric()
+		if err != nil {
+			return n, err
+		}
+		if f.Match(msg) == invert {
+			continue
+		}
+		if err := writeGeneric(w, msg, lineEnding); err != nil {
+			return n, err
+		}
+		n++
+	}
+	return n, dec.Err()
+}
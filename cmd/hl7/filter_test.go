@@ -0,0 +1,46 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	"github.com/esequiel378/hl7"
+)
+
+func TestFilterStream(t *testing.T) {
+	input := "MSH|^~\\&|A|B|||20250101||ORU^R01|1|P|2.5\rOBR|1|||CBC\r" +
+		"MSH|^~\\&|A|B|||20250101||ADT^A01|2|P|2.5\rPID|1||X\r" +
+		"MSH|^~\\&|A|B|||20250101||ORU^R01|3|P|2.5\rOBR|1|||LIPID\\T\\X\r"
+
+	f := hl7.MustCompile(`MSH-9.1 = "ORU"`)
+
+	var out bytes.Buffer
+	n, err := filterStream(strings.NewReader(input), &out, f, false, "\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "MSH|^~\\&|A|B|||20250101||ORU^R01|1|P|2.5\nOBR|1|||CBC\n" +
+		"MSH|^~\\&|A|B|||20250101||ORU^R01|3|P|2.5\nOBR|1|||LIPID\\T\\X\n"
+	if n != 2 || out.String() != want {
+		t.Errorf("unexpected output (%d messages):\n%s", n, out.String())
+	}
+
+	out.Reset()
+	n, err = filterStream(strings.NewReader(input), &out, f, true, "\r")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 1 || !strings.Contains(out.String(), "ADT^A01|2") || !strings.HasSuffix(out.String(), "PID|1||X\r") {
+		t.Errorf("unexpected inverted output (%d messages): %q", n, out.String())
+	}
+}
+
+func TestFilterStreamReadError(t *testing.T) {
+	readErr := errors.New("connection reset")
+	if _, err := filterStream(iotest.ErrReader(readErr), &bytes.Buffer{}, hl7.MustCompile(`MSH-9.1 = "ORU"`), false, "\n"); !errors.Is(err, readErr) {
+		t.Errorf("expected the read error, got %v", err)
+	}
+}
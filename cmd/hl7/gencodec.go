@@ -0,0 +1,934 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"go/ast"
+	"go/build"
+	"go/format"
+	"go/importer"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+const hl7ImportPath = "github.com/esequiel378/hl7"
+
+// runGenCodec implements `hl7 gen-codec`, which writes reflection-free
+// UnmarshalHL7Message and MarshalHL7Message methods for tagged message types.
+func runGenCodec(args []string) error {
+	fs := flag.NewFlagSet("hl7 gen-codec", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, `Usage: hl7 gen-codec -type <Name>[,<Name>...] [flags]
+
+Generate UnmarshalHL7Message and MarshalHL7Message methods for message
+structs tagged with hl7:"segment:<name>". hl7.Unmarshal and hl7.Marshal use
+the generated methods automatically. Typically run through go:generate:
+
+  //go:generate hl7 gen-codec -type ADTMessage
+
+Flags:
+  -type <names>   Comma-separated message type names (required).
+  -dir <dir>      Package directory (default ".").
+  -output <file>  Output file (default <dir>/<type>_hl7.go).
+  -test           Also write a test that checks the generated codec against
+                  the reflection path for every testdata/*.hl7 message.`)
+	}
+
+	var typeNames, dir, output string
+	var withTest bool
+	fs.StringVar(&typeNames, "type", "", "comma-separated message type names")
+	fs.StringVar(&dir, "dir", ".", "package directory")
+	fs.StringVar(&output, "output", "", "output file")
+	fs.BoolVar(&withTest, "test", false, "also write a codec verification test")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if typeNames == "" {
+		fs.Usage()
+		return errors.New("gen-codec: -type is required")
+	}
+	names := strings.Split(typeNames, ",")
+	if output == "" {
+		output = filepath.Join(dir, strings.ToLower(names[0])+"_hl7.go")
+	}
+
+	pkg, err := loadPackage(dir, output)
+	if err != nil {
+		return fmt.Errorf("gen-codec: %w", err)
+	}
+
+	src, err := generateCodec(pkg, names)
+	if err != nil {
+		return fmt.Errorf("gen-codec: %w", err)
+	}
+	if err := os.WriteFile(output, src, 0o644); err != nil {
+		return fmt.Errorf("gen-codec: %w", err)
+	}
+
+	if withTest {
+		testSrc, err := generateCodecTest(pkg, names)
+		if err != nil {
+			return fmt.Errorf("gen-codec: %w", err)
+		}
+		testOutput := strings.TrimSuffix(output, ".go") + "_test.go"
+		if err := os.WriteFile(testOutput, testSrc, 0o644); err != nil {
+			return fmt.Errorf("gen-codec: %w", err)
+		}
+	}
+	return nil
+}
+
+// loadPackage parses and type-checks the package in dir, leaving out the
+// previously generated output file so stale code cannot break the build.
+func loadPackage(dir, output string) (*types.Package, error) {
+	bp, err := build.ImportDir(dir, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	skip, err := filepath.Abs(output)
+	if err != nil {
+		return nil, err
+	}
+
+	fset := token.NewFileSet()
+	var files []*ast.File
+	for _, name := range bp.GoFiles {
+		path, err := filepath.Abs(filepath.Join(dir, name))
+		if err != nil {
+			return nil, err
+		}
+		if path == skip {
+			continue
+		}
+		f, err := parser.ParseFile(fset, path, nil, 0)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, f)
+	}
+
+	conf := types.Config{Importer: importer.ForCompiler(fset, "source", nil)}
+	return conf.Check(bp.Name, fset, files, nil)
+}
+
+// codecGen accumulates the generated codec source for one package.
+type codecGen struct {
+	pkg         *types.Package
+	unmarshaler *types.Interface
+	marshaler   *types.Interface
+	imports     map[string]string // import path -> package name
+
+	funcs   bytes.Buffer
+	structs []types.Type // struct types with generated helpers, by position
+	pending []types.Type // struct types whose helpers are not written yet
+	anon    int
+	names   map[types.Type]string
+	tmp     int
+	usedSep map[string]bool // separator expressions referenced by encodeValue
+}
+
+func newCodecGen(pkg *types.Package) *codecGen {
+	byteSlice := types.NewSlice(types.Typ[types.Byte])
+	errType := types.Universe.Lookup("error").Type()
+	param := func(t types.Type) *types.Tuple { return types.NewTuple(types.NewVar(token.NoPos, nil, "", t)) }
+
+	unmarshalSig := types.NewSignatureType(nil, nil, nil, param(byteSlice), param(errType), false)
+	marshalSig := types.NewSignatureType(nil, nil, nil, nil,
+		types.NewTuple(types.NewVar(token.NoPos, nil, "", byteSlice), types.NewVar(token.NoPos, nil, "", errType)), false)
+
+	return &codecGen{
+		pkg:         pkg,
+		unmarshaler: types.NewInterfaceType([]*types.Func{types.NewFunc(token.NoPos, nil, "Unmarshal", unmarshalSig)}, nil).Complete(),
+		marshaler:   types.NewInterfaceType([]*types.Func{types.NewFunc(token.NoPos, nil, "MarshalHL7", marshalSig)}, nil).Complete(),
+		imports:     map[string]string{hl7ImportPath: "hl7"},
+		names:       make(map[types.Type]string),
+	}
+}
+
+// generateCodec returns the formatted source of the codec for the named
+// message types of pkg.
+func generateCodec(pkg *types.Package, names []string) ([]byte, error) {
+	if pkg.Path() == hl7ImportPath {
+		return nil, errors.New("cannot generate a codec inside the hl7 package")
+	}
+
+	g := newCodecGen(pkg)
+	var methods bytes.Buffer
+	for _, name := range names {
+		if err := g.message(&methods, name); err != nil {
+			return nil, err
+		}
+	}
+	for len(g.pending) > 0 {
+		t := g.pending[0]
+		g.pending = g.pending[1:]
+		if err := g.structHelpers(t); err != nil {
+			return nil, err
+		}
+	}
+
+	var out bytes.Buffer
+	fmt.Fprintf(&out, "// Code generated by hl7 gen-codec. DO NOT EDIT.\n\npackage %s\n\n", pkg.Name())
+	out.WriteString("import (\n")
+	paths := make([]string, 0, len(g.imports))
+	for path := range g.imports {
+		paths = append(paths, path)
+	}
+	// Standard library imports first, then the rest, as goimports groups them.
+	slices.SortFunc(paths, func(a, b string) int {
+		if sa, sb := isStdlib(a), isStdlib(b); sa != sb {
+			if sa {
+				return -1
+			}
+			return 1
+		}
+		return strings.Compare(a, b)
+	})
+	for i, path := range paths {
+		if i > 0 && isStdlib(paths[i-1]) && !isStdlib(path) {
+			out.WriteString("\n")
+		}
+		if g.imports[path] != filepath.Base(path) {
+			fmt.Fprintf(&out, "%s %q\n", g.imports[path], path)
+		} else {
+			fmt.Fprintf(&out, "%q\n", path)
+		}
+	}
+	out.WriteString(")\n\n")
+	out.Write(methods.Bytes())
+	out.Write(g.funcs.Bytes())
+
+	src, err := format.Source(out.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("formatting generated code: %w\n%s", err, out.Bytes())
+	}
+	return src, nil
+}
+
+// isStdlib reports whether an import path belongs to the standard library.
+func isStdlib(path string) bool {
+	first, _, _ := strings.Cut(path, "/")
+	return !strings.Contains(first, ".")
+}
+
+// generateCodecTest returns the source of a test that runs hl7.VerifyCodec
+// for every message type over the sample messages in testdata/*.hl7.
+func generateCodecTest(pkg *types.Package, names []string) ([]byte, error) {
+	var out bytes.Buffer
+	fmt.Fprintf(&out, `// Code generated by hl7 gen-codec. DO NOT EDIT.
+
+package %s
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/esequiel378/hl7"
+)
+`, pkg.Name())
+
+	for _, name := range names {
+		fmt.Fprintf(&out, `
+func Test%[1]sHL7Codec(t *testing.T) {
+	files, err := filepath.Glob(filepath.Join("testdata", "*.hl7"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) == 0 {
+		t.Skip("no testdata/*.hl7 sample messages")
+	}
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := hl7.VerifyCodec(data, new(%[1]s)); err != nil {
+			t.Errorf("%%s: %%v", file, err)
+		}
+	}
+}
+`, name)
+	}
+	return format.Source(out.Bytes())
+}
+
+// qualifier names packages in generated type expressions, recording every
+// package other than the target one as an import.
+func (g *codecGen) qualifier(p *types.Package) string {
+	if p == g.pkg {
+		return ""
+	}
+	g.imports[p.Path()] = p.Name()
+	return p.Name()
+}
+
+func (g *codecGen) typeString(t types.Type) string {
+	return types.TypeString(t, g.qualifier)
+}
+
+func (g *codecGen) use(path string) {
+	g.imports[path] = filepath.Base(path)
+}
+
+func (g *codecGen) tmpName(prefix string) string {
+	g.tmp++
+	return fmt.Sprintf("%s%d", prefix, g.tmp)
+}
+
+// implements reports whether t or *t implements iface. Generated code only
+// calls methods on addressable values, so pointer receivers count.
+func (g *codecGen) implements(t types.Type, iface *types.Interface) bool {
+	return types.Implements(t, iface) || types.Implements(types.NewPointer(t), iface)
+}
+
+// helperName returns the suffix used for the helper functions of a struct
+// type, registering the type for generation on first use.
+func (g *codecGen) helperName(t types.Type) string {
+	for _, known := range g.structs {
+		if types.Identical(known, t) {
+			return g.names[known]
+		}
+	}
+
+	var name string
+	if named, ok := t.(*types.Named); ok {
+		obj := named.Obj()
+		name = obj.Name()
+		if obj.Pkg() != g.pkg && obj.Pkg() != nil {
+			name = exportedName(obj.Pkg().Name()) + name
+		}
+		name = strings.Map(func(r rune) rune {
+			if unicode.IsLetter(r) || unicode.IsDigit(r) {
+				return r
+			}
+			return '_'
+		}, name)
+	} else {
+		g.anon++
+		name = fmt.Sprintf("Anon%d", g.anon)
+	}
+	g.structs = append(g.structs, t)
+	g.pending = append(g.pending, t)
+	g.names[t] = name
+	return name
+}
+
+func exportedName(s string) string {
+	if s == "" {
+		return s
+	}
+	return strings.ToUpper(s[:1]) + s[1:]
+}
+
+// segmentField is a segment struct field of a message type.
+type segmentField struct {
+	name  string // segment name from the tag
+	field string // Go field name
+	typ   types.Type
+	notes *notesField
+}
+
+// notesField is the hl7:"notes" field of a segment struct.
+type notesField struct {
+	field string
+	elem  types.Type
+}
+
+// message writes the UnmarshalHL7Message and MarshalHL7Message methods of
+// the named message type.
+func (g *codecGen) message(w *bytes.Buffer, name string) error {
+	obj := g.pkg.Scope().Lookup(name)
+	if obj == nil {
+		return fmt.Errorf("type %s not found in package %s", name, g.pkg.Name())
+	}
+	tn, ok := obj.(*types.TypeName)
+	if !ok {
+		return fmt.Errorf("%s is not a type", name)
+	}
+	st, ok := tn.Type().Underlying().(*types.Struct)
+	if !ok {
+		return fmt.Errorf("%s is not a struct type", name)
+	}
+
+	var segments []segmentField
+	for i := 0; i < st.NumFields(); i++ {
+		f := st.Field(i)
+		tag := reflect.StructTag(st.Tag(i)).Get("hl7")
+		if tag == "" {
+			continue
+		}
+		parts := strings.Split(tag, ":")
+		if len(parts) < 2 || parts[0] != "segment" {
+			return fmt.Errorf("%s.%s: tag %q is not in the correct format, expected `hl7:\"segment:<name>\"`", name, f.Name(), tag)
+		}
+		if !f.Exported() {
+			return fmt.Errorf("%s.%s: tagged field must be exported", name, f.Name())
+		}
+		if _, ok := f.Type().Underlying().(*types.Struct); !ok {
+			return fmt.Errorf("%s.%s: segment field must be a struct, got %s", name, f.Name(), f.Type())
+		}
+		seg := segmentField{name: parts[1], field: f.Name(), typ: f.Type()}
+		notes, err := g.notesField(f.Type())
+		if err != nil {
+			return fmt.Errorf("%s.%s: %w", name, f.Name(), err)
+		}
+		seg.notes = notes
+		segments = append(segments, seg)
+	}
+
+	g.unmarshalMethod(w, name, segments)
+	g.marshalMethod(w, name, segments)
+	return nil
+}
+
+// notesField returns the notes field of a segment struct type, if any. As in
+// the reflection path, only the first field tagged hl7:"notes" counts, and
+// only if it is a slice of structs.
+func (g *codecGen) notesField(t types.Type) (*notesField, error) {
+	st := t.Underlying().(*types.Struct)
+	for i := 0; i < st.NumFields(); i++ {
+		if reflect.StructTag(st.Tag(i)).Get("hl7") != "notes" {
+			continue
+		}
+		f := st.Field(i)
+		s, ok := f.Type().Underlying().(*types.Slice)
+		if !ok {
+			return nil, nil
+		}
+		if _, ok := s.Elem().Underlying().(*types.Struct); !ok {
+			return nil, nil
+		}
+		if !f.Exported() {
+			return nil, fmt.Errorf("notes field %s must be exported", f.Name())
+		}
+		return &notesField{field: f.Name(), elem: s.Elem()}, nil
+	}
+	return nil, nil
+}
+
+func (g *codecGen) unmarshalMethod(w *bytes.Buffer, name string, segments []segmentField) {
+	// A later field with the same segment name wins, as in the reflection path.
+	byName := make(map[string]int)
+	var order []string
+	for i, seg := range segments {
+		if _, ok := byName[seg.name]; !ok {
+			order = append(order, seg.name)
+		}
+		byName[seg.name] = i
+	}
+	hasNotes := false
+	for _, segName := range order {
+		if segments[byName[segName]].notes != nil {
+			hasNotes = true
+		}
+	}
+
+	fmt.Fprintf(w, "// UnmarshalHL7Message implements hl7.MessageUnmarshaler.\n")
+	fmt.Fprintf(w, "func (m *%s) UnmarshalHL7Message(data []byte) error {\n", name)
+	fmt.Fprintf(w, "segments, err := hl7.SplitSegments(data)\nif err != nil {\nreturn err\n}\n")
+	if hasNotes {
+		fmt.Fprintf(w, "last := -1\n")
+	}
+	fmt.Fprintf(w, "for k := range segments {\nseg := &segments[k]\n")
+	fmt.Fprintf(w, "if seg.Name == \"NTE\" {\n")
+	if hasNotes {
+		fmt.Fprintf(w, "switch last {\n")
+		for _, segName := range order {
+			i := byName[segName]
+			seg := segments[i]
+			if seg.notes == nil {
+				continue
+			}
+			fmt.Fprintf(w, "case %d:\n", i)
+			fmt.Fprintf(w, "var note %s\n", g.typeString(seg.notes.elem))
+			fmt.Fprintf(w, "if err := hl7Decode%s(seg, &note, seg.Fields, 0, hl7.FieldPath{}); err != nil {\nreturn err\n}\n",
+				g.helperName(seg.notes.elem))
+			fmt.Fprintf(w, "m.%s.%s = append(m.%s.%s, note)\n", seg.field, seg.notes.field, seg.field, seg.notes.field)
+		}
+		fmt.Fprintf(w, "}\n")
+	}
+	fmt.Fprintf(w, "continue\n}\n")
+	if len(order) > 0 {
+		fmt.Fprintf(w, "switch seg.Name {\n")
+		for _, segName := range order {
+			i := byName[segName]
+			seg := segments[i]
+			if segName == "NTE" {
+				// NTE lines are always treated as notes.
+				continue
+			}
+			fmt.Fprintf(w, "case %q:\n", segName)
+			fmt.Fprintf(w, "if err := hl7Decode%s(seg, &m.%s, seg.Fields, 0, hl7.FieldPath{}); err != nil {\nreturn err\n}\n",
+				g.helperName(seg.typ), seg.field)
+			if hasNotes {
+				fmt.Fprintf(w, "last = %d\n", i)
+			}
+		}
+		fmt.Fprintf(w, "}\n")
+	}
+	fmt.Fprintf(w, "}\nreturn nil\n}\n\n")
+}
+
+func (g *codecGen) marshalMethod(w *bytes.Buffer, name string, segments []segmentField) {
+	fmt.Fprintf(w, "// MarshalHL7Message implements hl7.MessageMarshaler.\n")
+	fmt.Fprintf(w, "func (m %s) MarshalHL7Message(opts hl7.MarshalOptions) ([]byte, error) {\n", name)
+	if len(segments) == 0 {
+		fmt.Fprintf(w, "return []byte{}, nil\n}\n\n")
+		return
+	}
+	g.use("bytes")
+	fmt.Fprintf(w, "ec := string([]byte{opts.ComponentSeparator, opts.RepetitionSeparator, opts.EscapeCharacter, opts.SubcomponentSeparator})\n")
+	fmt.Fprintf(w, "var lines [][]byte\n")
+	for _, seg := range segments {
+		helper := g.helperName(seg.typ)
+		fmt.Fprintf(w, "{\nline, err := hl7EncodeSegment%s(%q, &m.%s, opts, ec)\nif err != nil {\nreturn nil, err\n}\nlines = append(lines, line)\n",
+			helper, seg.name, seg.field)
+		if seg.notes != nil {
+			fmt.Fprintf(w, "for k := range m.%s.%s {\nline, err := hl7EncodeSegment%s(\"NTE\", &m.%s.%s[k], opts, ec)\nif err != nil {\nreturn nil, err\n}\nlines = append(lines, line)\n}\n",
+				seg.field, seg.notes.field, g.helperName(seg.notes.elem), seg.field, seg.notes.field)
+		}
+		fmt.Fprintf(w, "}\n")
+	}
+	fmt.Fprintf(w, "return bytes.Join(lines, []byte(opts.LineEnding)), nil\n}\n\n")
+}
+
+// indexedField is a struct field tagged with a numeric hl7 index.
+type indexedField struct {
+	index int
+	name  string
+	typ   types.Type
+}
+
+// indexedFields returns the fields of a struct type tagged with a numeric
+// hl7 index, in declaration order.
+func (g *codecGen) indexedFields(t types.Type) ([]indexedField, error) {
+	st := t.Underlying().(*types.Struct)
+	var fields []indexedField
+	for i := 0; i < st.NumFields(); i++ {
+		f := st.Field(i)
+		tag := reflect.StructTag(st.Tag(i)).Get("hl7")
+		if tag == "" || tag == "notes" {
+			continue
+		}
+		index, err := strconv.Atoi(tag)
+		if err != nil {
+			return nil, fmt.Errorf("%s.%s: invalid field index tag %q", t, f.Name(), tag)
+		}
+		if !f.Exported() {
+			return nil, fmt.Errorf("%s.%s: tagged field must be exported", t, f.Name())
+		}
+		fields = append(fields, indexedField{index: index, name: f.Name(), typ: f.Type()})
+	}
+	return fields, nil
+}
+
+// structHelpers writes the decoder, component encoder and segment encoder
+// of a struct type.
+func (g *codecGen) structHelpers(t types.Type) error {
+	fields, err := g.indexedFields(t)
+	if err != nil {
+		return err
+	}
+	name := g.names[t]
+	if err := g.decoder(name, t, fields); err != nil {
+		return err
+	}
+	if err := g.componentEncoder(name, t, fields); err != nil {
+		return err
+	}
+	return g.segmentEncoder(name, t, fields)
+}
+
+// decoder writes the equivalent of setValuesByIndex for a struct type.
+func (g *codecGen) decoder(name string, t types.Type, fields []indexedField) error {
+	var body bytes.Buffer
+	usesCS, usesRS := false, false
+	for _, f := range fields {
+		fmt.Fprintf(&body, "if i := %d - off; i >= 0 && i < len(fields) {\n", f.index)
+		fmt.Fprintf(&body, "raw := fields[i]\nif seg.Name == \"MSH\" && level == 0 && i == 0 {\nraw = seg.FieldSeparator\n}\n")
+		cs, rs, err := g.decodeField(&body, "v."+f.name, f.typ, fmt.Sprintf("at.Child(level, %d)", f.index))
+		if err != nil {
+			return fmt.Errorf("%s.%s: %w", t, f.name, err)
+		}
+		usesCS = usesCS || cs
+		usesRS = usesRS || rs
+		fmt.Fprintf(&body, "}\n")
+	}
+
+	w := &g.funcs
+	fmt.Fprintf(w, "func hl7Decode%s(seg *hl7.RawSegment, v *%s, fields []string, level uint, at hl7.FieldPath) error {\n", name, g.typeString(t))
+	if len(fields) > 0 {
+		if usesCS || usesRS {
+			fmt.Fprintf(w, "ec := seg.EncodingCharacters\n")
+		}
+		if usesCS {
+			fmt.Fprintf(w, "cs := \"^\"\nif len(ec) > 0 {\ncs = string(ec[0])\n}\n")
+		}
+		if usesRS {
+			fmt.Fprintf(w, "rs := \"\"\nif len(ec) > 1 {\nrs = string(ec[1])\n}\n")
+		}
+		fmt.Fprintf(w, "off := 0\nif seg.Name == \"MSH\" || level > 0 {\noff = 1\n}\n")
+		w.Write(body.Bytes())
+	}
+	fmt.Fprintf(w, "return nil\n}\n\n")
+	return nil
+}
+
+// decodeField writes the decoding of raw into target, mirroring the slice,
+// component and scalar branches of setValuesByIndex. path is the
+// hl7.FieldPath expression of raw. It reports whether the code uses the
+// component and repetition separators.
+func (g *codecGen) decodeField(w *bytes.Buffer, target string, t types.Type, path string) (usesCS, usesRS bool, err error) {
+	if s, ok := t.Underlying().(*types.Slice); ok {
+		g.use("strings")
+		elem := s.Elem()
+		repPath := path + ".Repeat(level, ri+1)"
+		fmt.Fprintf(w, "if rs != \"\" {\nreps := strings.Split(raw, rs)\ns := make(%s, len(reps))\nfor ri, rep := range reps {\n", g.typeString(t))
+		if _, ok := elem.Underlying().(*types.Struct); ok {
+			usesCS = true
+			fmt.Fprintf(w, "if comps := strings.Split(rep, cs); len(comps) > 1 {\nif err := hl7Decode%s(seg, &s[ri], comps, level+1, %s); err != nil {\nreturn err\n}\ncontinue\n}\n",
+				g.helperName(elem), repPath)
+		}
+		if err := g.decodeScalar(w, "s[ri]", elem, "rep", repPath); err != nil {
+			return false, false, err
+		}
+		fmt.Fprintf(w, "}\n%s = s\n} else {\n", target)
+		if err := g.decodeScalar(w, target, t, "raw", path); err != nil {
+			return false, false, err
+		}
+		fmt.Fprintf(w, "}\n")
+		return usesCS, true, nil
+	}
+
+	if _, ok := t.Underlying().(*types.Struct); ok {
+		g.use("strings")
+		fmt.Fprintf(w, "if comps := strings.Split(raw, cs); len(comps) > 1 {\nif err := hl7Decode%s(seg, &%s, comps, level+1, %s); err != nil {\nreturn err\n}\n}",
+			g.helperName(t), target, path)
+		// Structs without components are skipped unless they unmarshal themselves.
+		if g.implements(t, g.unmarshaler) {
+			fmt.Fprintf(w, " else {\n")
+			if err := g.decodeScalar(w, target, t, "raw", path); err != nil {
+				return false, false, err
+			}
+			fmt.Fprintf(w, "}")
+		}
+		fmt.Fprintf(w, "\n")
+		return true, false, nil
+	}
+
+	return false, false, g.decodeScalar(w, target, t, "raw", path)
+}
+
+// decodeScalar writes the equivalent of setFieldValue(target, value), where
+// path is the hl7.FieldPath expression of value.
+func (g *codecGen) decodeScalar(w *bytes.Buffer, target string, t types.Type, value, path string) error {
+	fail := func(errExpr string) string {
+		return fmt.Sprintf("return seg.FieldError(%s, %s, %s)", path, value, errExpr)
+	}
+	typ := g.typeString(t)
+
+	switch u := t.Underlying().(type) {
+	case *types.Basic:
+		info := u.Info()
+		switch {
+		case info&types.IsInteger != 0 && info&types.IsUnsigned == 0:
+			n := g.tmpName("n")
+			fmt.Fprintf(w, "if %s, err := hl7.DecodeInt(%s, %d); err != nil {\n%s\n} else {\n%s = %s(%s)\n}\n",
+				n, value, basicBits(u.Kind()), fail("err"), target, typ, n)
+			return nil
+		case info&types.IsInteger != 0:
+			n := g.tmpName("n")
+			fmt.Fprintf(w, "if %s, err := hl7.DecodeUint(%s, %d); err != nil {\n%s\n} else {\n%s = %s(%s)\n}\n",
+				n, value, basicBits(u.Kind()), fail("err"), target, typ, n)
+			return nil
+		case info&types.IsFloat != 0:
+			n := g.tmpName("n")
+			fmt.Fprintf(w, "if %s, err := hl7.DecodeFloat(%s, %d); err != nil {\n%s\n} else {\n%s = %s(%s)\n}\n",
+				n, value, basicBits(u.Kind()), fail("err"), target, typ, n)
+			return nil
+		case info&types.IsString != 0:
+			if types.Identical(t, types.Typ[types.String]) {
+				fmt.Fprintf(w, "%s = %s\n", target, value)
+			} else {
+				fmt.Fprintf(w, "%s = %s(%s)\n", target, typ, value)
+			}
+			return nil
+		case info&types.IsBoolean != 0:
+			b := g.tmpName("b")
+			fmt.Fprintf(w, "if %s, err := hl7.DecodeBool(%s); err != nil {\n%s\n} else {\n%s = %s(%s)\n}\n",
+				b, value, fail("err"), target, typ, b)
+			return nil
+		}
+
+	case *types.Pointer:
+		elem := u.Elem()
+		zero, ok := g.zeroValue(elem)
+		if !ok {
+			return fmt.Errorf("pointer to non-comparable type %s is not supported", elem)
+		}
+		fmt.Fprintf(w, "if %s == nil {\n%s = new(%s)\n}\n", target, target, g.typeString(elem))
+		if err := g.decodeScalar(w, "(*"+target+")", elem, value, path); err != nil {
+			return err
+		}
+		fmt.Fprintf(w, "if *%s == %s {\n%s = nil\n}\n", target, zero, target)
+		return nil
+	}
+
+	if g.implements(t, g.unmarshaler) {
+		fmt.Fprintf(w, "if err := %s.Unmarshal([]byte(%s)); err != nil {\n%s\n}\n", target, value, fail("err"))
+		return nil
+	}
+	g.use("fmt")
+	fmt.Fprintf(w, "if err := fmt.Errorf(\"%%w: %%s\", hl7.ErrUnsupportedKind, %q); err != nil {\n%s\n}\n", kindName(t), fail("err"))
+	return nil
+}
+
+// zeroValue returns the expression comparing equal to the zero value of t,
+// and false if t is not comparable.
+func (g *codecGen) zeroValue(t types.Type) (string, bool) {
+	if !types.Comparable(t) {
+		return "", false
+	}
+	switch u := t.Underlying().(type) {
+	case *types.Basic:
+		switch {
+		case u.Info()&types.IsString != 0:
+			return `""`, true
+		case u.Info()&types.IsBoolean != 0:
+			return "false", true
+		case u.Info()&types.IsNumeric != 0:
+			return "0", true
+		}
+	case *types.Pointer, *types.Interface, *types.Chan:
+		return "nil", true
+	}
+	return "(" + g.typeString(t) + "{})", true
+}
+
+// componentEncoder writes the equivalent of marshalStruct for a struct type.
+func (g *codecGen) componentEncoder(name string, t types.Type, fields []indexedField) error {
+	byIndex, maxIndex := lastByIndex(fields)
+
+	w := &g.funcs
+	fmt.Fprintf(w, "func hl7Encode%s(v *%s, cs string) (string, error) {\n", name, g.typeString(t))
+	if maxIndex <= 0 {
+		fmt.Fprintf(w, "return \"\", nil\n}\n\n")
+		return nil
+	}
+	g.use("strings")
+	fmt.Fprintf(w, "parts := make([]string, %d)\n", maxIndex)
+	fail := func(errExpr string) string { return "return \"\", " + errExpr }
+	for idx := 1; idx <= maxIndex; idx++ {
+		f, ok := byIndex[idx]
+		if !ok {
+			continue
+		}
+		if err := g.encodeValue(w, fmt.Sprintf("parts[%d]", idx-1), "v."+f.name, f.typ, `""`, `""`, fail); err != nil {
+			return fmt.Errorf("%s.%s: %w", t, f.name, err)
+		}
+	}
+	fmt.Fprintf(w, "for len(parts) > 0 && parts[len(parts)-1] == \"\" {\nparts = parts[:len(parts)-1]\n}\n")
+	fmt.Fprintf(w, "return strings.Join(parts, cs), nil\n}\n\n")
+	return nil
+}
+
+// segmentEncoder writes the equivalent of marshalSegment for a struct type.
+func (g *codecGen) segmentEncoder(name string, t types.Type, fields []indexedField) error {
+	byIndex, maxIndex := lastByIndex(fields)
+
+	var body bytes.Buffer
+	g.usedSep = make(map[string]bool)
+	for idx := 1; idx <= maxIndex; idx++ {
+		f, ok := byIndex[idx]
+		if !ok {
+			continue
+		}
+		fmt.Fprintf(&body, "case %d:\n", idx)
+		if idx == 2 {
+			fmt.Fprintf(&body, "if isMSH {\nbuf.WriteString(ec)\ncontinue\n}\n")
+		}
+		fmt.Fprintf(&body, "var str string\n")
+		fail := func(errExpr string) string {
+			g.use("fmt")
+			return fmt.Sprintf("return nil, fmt.Errorf(\"hl7: %%s.%%d: %%w\", name, idx, %s)", errExpr)
+		}
+		if err := g.encodeValue(&body, "str", "v."+f.name, f.typ, "cs", "rs", fail); err != nil {
+			return fmt.Errorf("%s.%s: %w", t, f.name, err)
+		}
+		fmt.Fprintf(&body, "buf.WriteString(str)\n")
+	}
+
+	w := &g.funcs
+	g.use("bytes")
+	fmt.Fprintf(w, "func hl7EncodeSegment%s(name string, v *%s, opts hl7.MarshalOptions, ec string) ([]byte, error) {\n", name, g.typeString(t))
+	fmt.Fprintf(w, "var buf bytes.Buffer\nbuf.WriteString(name)\n")
+	if maxIndex > 0 {
+		fmt.Fprintf(w, "fs := string(opts.FieldSeparator)\n")
+		if g.usedSep["cs"] {
+			fmt.Fprintf(w, "cs := string(opts.ComponentSeparator)\n")
+		}
+		if g.usedSep["rs"] {
+			fmt.Fprintf(w, "rs := string(opts.RepetitionSeparator)\n")
+		}
+		fmt.Fprintf(w, "isMSH := name == \"MSH\"\n")
+		fmt.Fprintf(w, "for idx := 1; idx <= %d; idx++ {\n", maxIndex)
+		fmt.Fprintf(w, "if isMSH && idx == 1 {\nbuf.WriteByte(opts.FieldSeparator)\ncontinue\n}\n")
+		fmt.Fprintf(w, "if !(isMSH && idx == 2) {\nbuf.WriteString(fs)\n}\n")
+		fmt.Fprintf(w, "switch idx {\n%s}\n}\n", body.Bytes())
+	}
+	fmt.Fprintf(w, "return buf.Bytes(), nil\n}\n\n")
+	return nil
+}
+
+// lastByIndex maps each positive hl7 index to the last field declared with
+// it, as the reflection path does, and returns the highest index.
+func lastByIndex(fields []indexedField) (map[int]indexedField, int) {
+	byIndex := make(map[int]indexedField)
+	maxIndex := 0
+	for _, f := range fields {
+		if f.index > 0 {
+			byIndex[f.index] = f
+			maxIndex = max(maxIndex, f.index)
+		}
+	}
+	return byIndex, maxIndex
+}
+
+// encodeValue writes the equivalent of dst, err = marshalValue(expr, cs, rs),
+// where cs and rs are Go expressions. fail returns the statement that
+// reports an error expression.
+func (g *codecGen) encodeValue(w *bytes.Buffer, dst, expr string, t types.Type, cs, rs string, fail func(string) string) error {
+	if p, ok := t.Underlying().(*types.Pointer); ok {
+		fmt.Fprintf(w, "if %s != nil {\n", expr)
+		if err := g.encodeDeref(w, dst, "(*"+expr+")", p.Elem(), cs, rs, fail); err != nil {
+			return err
+		}
+		fmt.Fprintf(w, "}\n")
+		return nil
+	}
+	return g.encodeDeref(w, dst, expr, t, cs, rs, fail)
+}
+
+// encodeDeref is encodeValue after the optional pointer dereference.
+func (g *codecGen) encodeDeref(w *bytes.Buffer, dst, expr string, t types.Type, cs, rs string, fail func(string) string) error {
+	if g.implements(t, g.marshaler) {
+		b := g.tmpName("b")
+		fmt.Fprintf(w, "if %s, err := %s.MarshalHL7(); err != nil {\n%s\n} else {\n%s = string(%s)\n}\n", b, expr, fail("err"), dst, b)
+		return nil
+	}
+
+	switch u := t.Underlying().(type) {
+	case *types.Basic:
+		info := u.Info()
+		switch {
+		case info&types.IsString != 0:
+			fmt.Fprintf(w, "%s = string(%s)\n", dst, expr)
+			return nil
+		case info&types.IsInteger != 0 && info&types.IsUnsigned == 0:
+			g.use("strconv")
+			fmt.Fprintf(w, "%s = strconv.FormatInt(int64(%s), 10)\n", dst, expr)
+			return nil
+		case info&types.IsInteger != 0 && u.Kind() != types.Uintptr:
+			g.use("strconv")
+			fmt.Fprintf(w, "%s = strconv.FormatUint(uint64(%s), 10)\n", dst, expr)
+			return nil
+		case info&types.IsFloat != 0:
+			g.use("strconv")
+			fmt.Fprintf(w, "%s = strconv.FormatFloat(float64(%s), 'f', -1, %d)\n", dst, expr, basicBits(u.Kind()))
+			return nil
+		case info&types.IsBoolean != 0:
+			fmt.Fprintf(w, "if %s {\n%s = \"Y\"\n} else {\n%s = \"N\"\n}\n", expr, dst, dst)
+			return nil
+		}
+
+	case *types.Struct:
+		g.markSep(cs)
+		s := g.tmpName("s")
+		fmt.Fprintf(w, "if %s, err := hl7Encode%s(&%s, %s); err != nil {\n%s\n} else {\n%s = %s\n}\n",
+			s, g.helperName(t), expr, cs, fail("err"), dst, s)
+		return nil
+
+	case *types.Slice:
+		g.use("strings")
+		parts, k, item := g.tmpName("parts"), g.tmpName("k"), g.tmpName("item")
+		fmt.Fprintf(w, "%s := make([]string, 0, len(%s))\n", parts, expr)
+		fmt.Fprintf(w, "for %s := range %s {\nvar %s string\n", k, expr, item)
+		if err := g.encodeValue(w, item, expr+"["+k+"]", u.Elem(), cs, rs, fail); err != nil {
+			return err
+		}
+		fmt.Fprintf(w, "%s = append(%s, %s)\n}\n", parts, parts, item)
+		g.markSep(rs)
+		fmt.Fprintf(w, "%s = strings.Join(%s, %s)\n", dst, parts, rs)
+		return nil
+	}
+
+	g.use("fmt")
+	fmt.Fprintf(w, "if err := fmt.Errorf(\"unsupported type: %%s\", %q); err != nil {\n%s\n}\n", kindName(t), fail("err"))
+	return nil
+}
+
+func (g *codecGen) markSep(expr string) {
+	if g.usedSep != nil {
+		g.usedSep[expr] = true
+	}
+}
+
+// basicBits returns the bit size strconv uses for a basic numeric kind, as
+// in intBitSizes and uintBitSizes of the hl7 package.
+func basicBits(k types.BasicKind) int {
+	switch k {
+	case types.Int8, types.Uint8:
+		return 8
+	case types.Int16, types.Uint16:
+		return 16
+	case types.Int32, types.Uint32, types.Float32:
+		return 32
+	case types.Int64, types.Uint64, types.Uintptr, types.Float64:
+		return 64
+	default:
+		return 0
+	}
+}
+
+// kindName returns the reflect.Kind name of t, as printed in errors by the
+// reflection path.
+func kindName(t types.Type) string {
+	switch u := t.Underlying().(type) {
+	case *types.Basic:
+		if u.Kind() == types.UnsafePointer {
+			return "unsafe.Pointer"
+		}
+		return types.Typ[u.Kind()].Name()
+	case *types.Pointer:
+		return "ptr"
+	case *types.Struct:
+		return "struct"
+	case *types.Slice:
+		return "slice"
+	case *types.Array:
+		return "array"
+	case *types.Map:
+		return "map"
+	case *types.Chan:
+		return "chan"
+	case *types.Signature:
+		return "func"
+	case *types.Interface:
+		return "interface"
+	default:
+		return "invalid"
+	}
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestGenCodecGolden(t *testing.T) {
+	dir := filepath.Join("..", "..", "internal", "codectest")
+	output := filepath.Join(dir, "codec_hl7.go")
+
+	pkg, err := loadPackage(dir, output)
+	if err != nil {
+		t.Fatalf("loadPackage failed: %v", err)
+	}
+	got, err := generateCodec(pkg, []string{"ADTMessage", "ORUMessage"})
+	if err != nil {
+		t.Fatalf("generateCodec failed: %v", err)
+	}
+
+	want, err := os.ReadFile(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("%s is out of date; run go generate in %s", output, dir)
+	}
+}
+
+func TestGenCodecErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		typ  string
+		want string
+	}{
+		{
+			name: "missing type",
+			src:  "type Message struct{}",
+			typ:  "Other",
+			want: "type Other not found",
+		},
+		{
+			name: "not a struct",
+			src:  "type Message int",
+			typ:  "Message",
+			want: "not a struct type",
+		},
+		{
+			name: "invalid segment tag",
+			src:  "type Message struct {\n\tMSH struct{} `hl7:\"MSH\"`\n}",
+			typ:  "Message",
+			want: "not in the correct format",
+		},
+		{
+			name: "segment not a struct",
+			src:  "type Message struct {\n\tMSH string `hl7:\"segment:MSH\"`\n}",
+			typ:  "Message",
+			want: "segment field must be a struct",
+		},
+		{
+			name: "invalid field index",
+			src:  "type Message struct {\n\tMSH struct {\n\t\tID string `hl7:\"one\"`\n\t} `hl7:\"segment:MSH\"`\n}",
+			typ:  "Message",
+			want: "invalid field index tag",
+		},
+		{
+			name: "unexported field",
+			src:  "type Message struct {\n\tMSH struct {\n\t\tid string `hl7:\"10\"`\n\t} `hl7:\"segment:MSH\"`\n}",
+			typ:  "Message",
+			want: "must be exported",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			src := "package sample\n\n" + tt.src + "\n"
+			if err := os.WriteFile(filepath.Join(dir, "sample.go"), []byte(src), 0o644); err != nil {
+				t.Fatal(err)
+			}
+
+			pkg, err := loadPackage(dir, filepath.Join(dir, "sample_hl7.go"))
+			if err != nil {
+				t.Fatalf("loadPackage failed: %v", err)
+			}
+			_, err = generateCodec(pkg, []string{tt.typ})
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("expected error containing %q, got %v", tt.want, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/esequiel378/hl7"
+	"github.com/esequiel378/hl7/mllp"
+)
+
+// runListen implements `hl7 listen`, which receives messages over MLLP.
+func runListen(args []string) error {
+	fs := flag.NewFlagSet("hl7 listen", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, `Usage: hl7 listen [flags]
+
+Accept MLLP connections and receive HL7 messages until interrupted. Each
+message is written to its own file in --out, or else to stdout as one compact
+JSON document per line. With --ack, every message is answered with an ACK:
+AA when it parses (against --schema when given) and AE with the error
+otherwise.
+
+Flags:
+  --addr <addr>         TCP address to listen on (default ":2575").
+  --out <dir>           Directory to write received messages to.
+  --ack                 Reply to every message with an AA or AE ACK.
+  -s, --schema <file>   JSON schema file the messages must conform to.
+
+Examples:
+  hl7 listen --addr :2575 --out inbox/ --ack
+  hl7 listen --ack -s adt_a01.json > received.ndjson`)
+	}
+
+	var addr, outDir, schemaFile string
+	var ack bool
+	fs.StringVar(&addr, "addr", ":2575", "TCP address to listen on")
+	fs.StringVar(&outDir, "out", "", "directory to write messages to")
+	fs.BoolVar(&ack, "ack", false, "reply with an ACK")
+	fs.StringVar(&schemaFile, "schema", "", "JSON schema file")
+	fs.StringVar(&schemaFile, "s", "", "JSON schema file (shorthand)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() > 0 {
+		return fmt.Errorf("listen: unexpected argument %q", fs.Arg(0))
+	}
+
+	l := &listener{out: os.Stdout, dir: outDir, ack: ack, log: func(err error) {
+		fmt.Fprintf(os.Stderr, "hl7 listen: %v\n", err)
+	}}
+	if schemaFile != "" {
+		schema, err := hl7.LoadSchemaFile(schemaFile)
+		if err != nil {
+			return fmt.Errorf("listen: %w", err)
+		}
+		if l.compiled, err = schema.Compile(); err != nil {
+			return fmt.Errorf("listen: %w", err)
+		}
+	}
+	if outDir != "" {
+		if err := os.MkdirAll(outDir, 0o755); err != nil {
+			return fmt.Errorf("listen: %w", err)
+		}
+	}
+
+	srv := &mllp.Server{Addr: addr, Handler: mllp.HandlerFunc(l.handle), ErrorLog: l.log}
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt)
+	go func() {
+		<-interrupt
+		srv.Close()
+	}()
+
+	fmt.Fprintf(os.Stderr, "hl7 listen: listening on %s\n", addr)
+	if err := srv.ListenAndServe(); err != nil && err != mllp.ErrServerClosed {
+		return fmt.Errorf("listen: %w", err)
+	}
+	return nil
+}
+
+// listener handles the messages received by `hl7 listen`.
+type listener struct {
+	compiled *hl7.CompiledSchema // optional schema the messages must conform to
+	dir      string              // directory for received messages, or "" for out
+	out      io.Writer           // JSON output when dir is empty
+	ack      bool                // reply with an ACK
+	log      func(error)
+
+	mu  sync.Mutex
+	seq int
+}
+
+// handle stores data and returns its ACK, or nil without --ack.
+func (l *listener) handle(data []byte) []byte {
+	msg, err := hl7.ParseGeneric(data)
+	var doc any = msg
+	if err == nil && l.compiled != nil {
+		doc, err = l.compiled.Unmarshal(data)
+	}
+
+	n, storeErr := l.store(data, msg, doc, err)
+	if err == nil {
+		err = storeErr
+	}
+	if err != nil {
+		l.log(fmt.Errorf("message %d: %w", n, err))
+	}
+	if !l.ack {
+		return nil
+	}
+
+	if msg == nil {
+		// Answer with whatever MSH could be read, so that the sender can
+		// still match the ACK to its message.
+		dec := hl7.NewDecoderWithOptions(bytes.NewReader(data), hl7.DecodeOptions{Lenient: true})
+		if msg, _ = dec.DecodeGeneric(); msg == nil {
+			msg = &hl7.GenericMessage{}
+		}
+	}
+	code, text := hl7.AckAccept, ""
+	if err != nil {
+		code, text = hl7.AckError, err.Error()
+	}
+	reply, err := hl7.MarshalGeneric(hl7.NewAck(msg, code, text))
+	if err != nil {
+		l.log(err)
+		return nil
+	}
+	return reply
+}
+
+// store writes a received message and returns its 1-based number. With a
+// directory every message is kept as received, including those that failed
+// to parse; otherwise the parsed document is written to out as a JSON line.
+func (l *listener) store(data []byte, msg *hl7.GenericMessage, doc any, parseErr error) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.seq++
+
+	if l.dir != "" {
+		id := ""
+		if msg != nil {
+			id = msg.Value(hl7.Path{Segment: "MSH", FieldPath: hl7.FieldPath{Field: 10}})
+		}
+		name := fmt.Sprintf("%s-%06d", time.Now().Format("20060102T150405"), l.seq)
+		if id = sanitizeFileName(id); id != "" {
+			name += "-" + id
+		}
+		return l.seq, os.WriteFile(filepath.Join(l.dir, name+".hl7"), data, 0o644)
+	}
+
+	if parseErr != nil {
+		return l.seq, nil
+	}
+	out, err := json.Marshal(doc)
+	if err != nil {
+		return l.seq, err
+	}
+	_, err = l.out.Write(append(out, '\n'))
+	return l.seq, err
+}
+
+// sanitizeFileName keeps the characters of s that are safe in a file name.
+func sanitizeFileName(s string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '-', r == '_', r == '.':
+			return r
+		}
+		return -1
+	}, s)
+}
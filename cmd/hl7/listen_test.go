@@ -0,0 +1,86 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/esequiel378/hl7"
+)
+
+// ackValue returns the value of ack at path.
+func ackValue(t *testing.T, ack *hl7.GenericMessage, path string) string {
+	t.Helper()
+	p, err := hl7.ParsePath(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ack.Value(p)
+}
+
+func TestListenerAck(t *testing.T) {
+	var out bytes.Buffer
+	l := &listener{out: &out, ack: true, log: func(error) {}}
+
+	reply := l.handle([]byte("MSH|^~\\&|SEND|CLINIC|RECV|HOSP|20250101||ADT^A01|M1|P|2.5\rPID|1||123"))
+	ack, err := hl7.ParseGeneric(reply)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for path, want := range map[string]string{"MSH-3": "RECV", "MSH-9": "ACK^A01^ACK", "MSA-1": "AA", "MSA-2": "M1"} {
+		if got := ackValue(t, ack, path); got != want {
+			t.Errorf("%s: expected %q, got %q", path, want, got)
+		}
+	}
+	if !strings.Contains(out.String(), `"123"`) || strings.Count(out.String(), "\n") != 1 {
+		t.Errorf("expected one JSON line, got %q", out.String())
+	}
+
+	schema, err := hl7.ParseSchema([]byte(`{"segments": {"PID": {"fields": {"setId": {"index": 1, "type": "int"}}}}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if l.compiled, err = schema.Compile(); err != nil {
+		t.Fatal(err)
+	}
+	reply = l.handle([]byte("MSH|^~\\&|SEND|CLINIC|RECV|HOSP|20250101||ADT^A01|M2|P|2.5\rPID|one"))
+	if ack, err = hl7.ParseGeneric(reply); err != nil {
+		t.Fatal(err)
+	}
+	if ackValue(t, ack, "MSA-1") != "AE" || ackValue(t, ack, "MSA-2") != "M2" {
+		t.Errorf("expected AE for M2, got %q", reply)
+	}
+	if !strings.Contains(ackValue(t, ack, "MSA-3"), "PID") {
+		t.Errorf("expected the error in MSA-3, got %q", reply)
+	}
+}
+
+func TestListenerOutDir(t *testing.T) {
+	dir := t.TempDir()
+	l := &listener{dir: dir, log: func(error) {}}
+	data := []byte("MSH|^~\\&|SEND|CLINIC|||20250101||ADT^A01|../M 1|P|2.5")
+	if reply := l.handle(data); reply != nil {
+		t.Errorf("expected no reply without ack, got %q", reply)
+	}
+	l.handle([]byte("PID|not a message"))
+
+	names, err := filepath.Glob(filepath.Join(dir, "*.hl7"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(names) != 2 {
+		t.Fatalf("expected 2 files, got %v", names)
+	}
+	if !strings.HasSuffix(names[0], "-000001-..M1.hl7") && !strings.HasSuffix(names[1], "-000001-..M1.hl7") {
+		t.Errorf("expected a sanitized control ID in %v", names)
+	}
+	got, err := os.ReadFile(names[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Errorf("expected the message as received, got %q", got)
+	}
+}
@@ -3,9 +3,26 @@
 // Usage:
 //
 //	hl7 [flags] [file]
+//	hl7 <command> [flags]
 //
 // Input is read from --file, the positional [file] argument, or stdin (in
-// that order of precedence). Output is written to stdout.
+// that order of precedence). Each message in the input, starting at its MSH
+// segment, is written to stdout as its own JSON document. Messages that fail
+// to parse are reported on stderr and skipped, and hl7 then exits with a
+// non-zero status.
+//
+// Commands:
+//
+//	deid                  De-identify messages (HIPAA Safe Harbor by default).
+//	diff                  Compare the values of two messages.
+//	encode                Encode JSON documents as HL7 messages.
+//	explain               Print messages as an annotated tree.
+//	filter                Write the messages that match a filter expression.
+//	gen-codec             Generate reflection-free codecs for message structs.
+//	listen                Receive messages over MLLP and acknowledge them.
+//	query                 Extract values from the messages of many files.
+//	send                  Send messages over MLLP and print their ACKs.
+//	validate              Check the messages of many files against a schema.
 //
 // Flags:
 //
@@ -13,6 +30,8 @@
 //	-s, --schema <file>   Path to a JSON schema file (query mode).
 //	                      Without this flag the message is parsed generically.
 //	-c, --compact         Emit compact JSON instead of pretty-printed output.
+//	--ndjson              Emit one compact JSON document per line.
+//	--array               Emit a single JSON array of messages.
 //	-h, --help            Show this help text.
 //
 // Examples:
@@ -28,19 +47,48 @@
 //
 //	# Compact output
 //	hl7 -c -s schema.json -f message.hl7
+//
+//	# One JSON document per line for a file of many messages
+//	hl7 --ndjson -f batch.hl7
 package main
 
 import (
-	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
-	"io"
 	"os"
 
 	"github.com/esequiel378/hl7"
 )
 
+// subcommands maps command names to their implementations. Without a
+// command, hl7 parses its input into JSON.
+var subcommands = map[string]func(args []string) error{
+	"deid":      runDeid,
+	"diff":      runDiff,
+	"encode":    runEncode,
+	"explain":   runExplain,
+	"filter":    runFilter,
+	"gen-codec": runGenCodec,
+	"listen":    runListen,
+	"query":     runQuery,
+	"send":      runSend,
+	"validate":  runValidate,
+}
+
 func main() {
+	if len(os.Args) > 1 {
+		if run, ok := subcommands[os.Args[1]]; ok {
+			if err := run(os.Args[2:]); err != nil {
+				if errors.Is(err, flag.ErrHelp) {
+					os.Exit(0)
+				}
+				fatalf("%v", err)
+			}
+			return
+		}
+	}
+
 	fs := flag.NewFlagSet("hl7", flag.ContinueOnError)
 	fs.Usage = usage(fs)
 
@@ -52,66 +100,61 @@ func main() {
 	fs.StringVar(&schemaFile, "schema", "", "path to JSON schema file (query mode)")
 	fs.StringVar(&schemaFile, "s", "", "path to JSON schema file (shorthand)")
 
-	var compact bool
+	var compact, ndjson, array bool
 	fs.BoolVar(&compact, "compact", false, "emit compact JSON")
 	fs.BoolVar(&compact, "c", false, "emit compact JSON (shorthand)")
+	fs.BoolVar(&ndjson, "ndjson", false, "emit one compact JSON document per line")
+	fs.BoolVar(&array, "array", false, "emit a JSON array of messages")
 
 	if err := fs.Parse(os.Args[1:]); err != nil {
 		os.Exit(2)
 	}
+	if ndjson && array {
+		fatalf("--ndjson and --array cannot be used together")
+	}
 
 	if inputFile == "" && len(fs.Args()) == 0 && isTerminal(os.Stdin) {
 		fs.Usage()
 		os.Exit(0)
 	}
 
-	input, err := readInput(inputFile, fs.Args())
+	input, err := openInput(inputFile, fs.Args())
 	if err != nil {
 		fatalf("error reading input: %v", err)
 	}
+	defer input.Close()
 
-	var result any
-
+	decode := func(dec *hl7.Decoder) (any, error) {
+		return dec.DecodeGeneric()
+	}
 	if schemaFile != "" {
 		schema, err := hl7.LoadSchemaFile(schemaFile)
 		if err != nil {
 			fatalf("error loading schema: %v", err)
 		}
-		result, err = hl7.UnmarshalWithSchema(input, schema)
+		compiled, err := schema.Compile()
 		if err != nil {
-			fatalf("error parsing HL7: %v", err)
+			fatalf("error loading schema: %v", err)
 		}
-	} else {
-		result, err = hl7.ParseGeneric(input)
-		if err != nil {
-			fatalf("error parsing HL7: %v", err)
+		decode = func(dec *hl7.Decoder) (any, error) {
+			return dec.DecodeWithCompiledSchema(compiled)
 		}
 	}
 
-	out, err := marshalJSON(result, compact)
+	format := formatDocuments
+	switch {
+	case ndjson:
+		format = formatNDJSON
+	case array:
+		format = formatArray
+	}
+	ok, failed, err := convertStream(input, os.Stdout, os.Stderr, decode, format, compact)
 	if err != nil {
 		fatalf("error serializing JSON: %v", err)
 	}
-
-	os.Stdout.Write(out)
-	os.Stdout.Write([]byte("\n"))
-}
-
-func readInput(file string, args []string) ([]byte, error) {
-	if file != "" {
-		return os.ReadFile(file)
-	}
-	if len(args) > 0 {
-		return os.ReadFile(args[0])
+	if failed > 0 {
+		fatalf("%d of %d messages failed to parse", failed, ok+failed)
 	}
-	return io.ReadAll(os.Stdin)
-}
-
-func marshalJSON(v any, compact bool) ([]byte, error) {
-	if compact {
-		return json.Marshal(v)
-	}
-	return json.MarshalIndent(v, "", "  ")
 }
 
 func isTerminal(f *os.File) bool {
@@ -130,15 +173,32 @@ func fatalf(format string, args ...any) {
 func usage(fs *flag.FlagSet) func() {
 	return func() {
 		fmt.Fprintln(os.Stderr, `Usage: hl7 [flags] [file]
-
-Parse an HL7 v2.x message and output JSON. Input is read from --file, the
-positional [file] argument, or stdin (in that order of precedence).
+       hl7 <command> [flags]
+
+Parse HL7 v2.x messages and output JSON. Input is read from --file, the
+positional [file] argument, or stdin (in that order of precedence). Each
+message is written as its own JSON document; messages that fail to parse are
+reported on stderr and skipped, and hl7 exits with a non-zero status.
+
+Commands:
+  deid                  De-identify messages (HIPAA Safe Harbor by default).
+  diff                  Compare the values of two messages.
+  encode                Encode JSON documents as HL7 messages.
+  explain               Print messages as an annotated tree.
+  filter                Write the messages that match a filter expression.
+  gen-codec             Generate reflection-free codecs for message structs.
+  listen                Receive messages over MLLP and acknowledge them.
+  query                 Extract values from the messages of many files.
+  send                  Send messages over MLLP and print their ACKs.
+  validate              Check the messages of many files against a schema.
 
 Flags:
   -f, --file <file>     HL7 input file.
   -s, --schema <file>   JSON schema file for query mode (schema-based parsing).
                         Without this flag the message is parsed generically.
   -c, --compact         Emit compact JSON instead of pretty-printed output.
+  --ndjson              Emit one compact JSON document per line.
+  --array               Emit a single JSON array of messages.
   -h, --help            Show this help text.
 
 Examples:
@@ -152,7 +212,10 @@ Examples:
   hl7 --schema adt_a01.json --file message.hl7
 
   # Compact output
-  hl7 -c -s schema.json -f message.hl7`)
+  hl7 -c -s schema.json -f message.hl7
+
+  # One JSON document per line for a file of many messages
+  hl7 --ndjson -f batch.hl7`)
 		_ = fs
 	}
 }
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"slices"
+
+	"github.com/esequiel378/hl7"
+)
+
+// schemaFieldName returns the name a schema gives to the field or component
+// at p, e.g. "patientName.family" for PID-5.1, or "" when the schema does not
+// describe it. When several names share an index the first in sorted order
+// is used.
+func schemaFieldName(schema *hl7.MessageSchema, p hl7.Path) string {
+	if schema == nil || schema.Segments[p.Segment] == nil {
+		return ""
+	}
+	name, field := lookupIndex(schema.Segments[p.Segment].Fields, p.Field)
+	if field == nil || p.Component == 0 {
+		return name
+	}
+	if field.Type == hl7.SchemaTypeArray && field.Items != nil {
+		field = field.Items
+	}
+	comp, _ := lookupIndex(field.Components, p.Component)
+	if comp == "" {
+		return ""
+	}
+	return name + "." + comp
+}
+
+// lookupIndex returns the name and schema of the entry of fields with the
+// given HL7 index.
+func lookupIndex(fields map[string]*hl7.FieldSchema, index int) (string, *hl7.FieldSchema) {
+	names := make([]string, 0, len(fields))
+	for name, f := range fields {
+		if f != nil && f.Index == index {
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 {
+		return "", nil
+	}
+	slices.Sort(names)
+	return names[0], fields[names[0]]
+}
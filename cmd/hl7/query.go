@@ -0,0 +1,301 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/esequiel378/hl7"
+)
+
+// runQuery implements `hl7 query`, which extracts values from every message
+// of many files as CSV, TSV or JSON lines.
+func runQuery(args []string) error {
+	flags := flag.NewFlagSet("hl7 query", flag.ContinueOnError)
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, `Usage: hl7 query -e <path> [-e <path>...] [flags] [file|dir|glob...]
+
+Print the values at one or more paths for every message of the given files,
+one row per message. Directories are searched recursively, quoted globs are
+expanded, and "-" or no arguments read stdin. Values are unescaped.
+
+Paths have the form SEG[occurrence]-field[repetition].component.subcomponent,
+e.g. MSH-10, PID-3.1, PID-3[2].1 or OBX[2]-5.
+
+Flags:
+  -e, --expr <path>     Path to extract. May be repeated or comma-separated.
+  --format <format>     Output format: csv, tsv or json (default csv).
+  --each <segment>      Print one row per occurrence of a repeating segment,
+                        such as OBX. Paths into that segment read the row's
+                        occurrence; messages without it print no rows.
+  -s, --schema <file>   Use the field names of a JSON schema as headers.
+  -H, --filename        Add a "file" column with the name of each file.
+  --no-header           Omit the header row of CSV and TSV output.
+
+Examples:
+  hl7 query -e MSH-10 -e PID-3.1 -e OBX-5 feeds/*.hl7
+  hl7 query -e MSH-7,PID-3.1 --format tsv -H 'archive/2025-01-*/lab-x*'
+  hl7 query --each OBX -e PID-3.1 -e OBX-3.1 -e OBX-5 --format json results/`)
+	}
+
+	var exprs pathFlags
+	var format, each, schemaFile string
+	var filename, noHeader bool
+	flags.Var(&exprs, "expr", "path to extract")
+	flags.Var(&exprs, "e", "path to extract (shorthand)")
+	flags.StringVar(&format, "format", "csv", "output format")
+	flags.StringVar(&each, "each", "", "repeating segment")
+	flags.StringVar(&schemaFile, "schema", "", "JSON schema file")
+	flags.StringVar(&schemaFile, "s", "", "JSON schema file (shorthand)")
+	flags.BoolVar(&filename, "filename", false, "add a file column")
+	flags.BoolVar(&filename, "H", false, "add a file column (shorthand)")
+	flags.BoolVar(&noHeader, "no-header", false, "omit the header row")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if len(exprs) == 0 {
+		flags.Usage()
+		return errors.New("query: at least one -e path is required")
+	}
+	for _, p := range exprs {
+		if p.Field == 0 {
+			return fmt.Errorf("query: -e %s: expected a field such as PID-3", p)
+		}
+	}
+
+	var schema *hl7.MessageSchema
+	if schemaFile != "" {
+		var err error
+		if schema, err = hl7.LoadSchemaFile(schemaFile); err != nil {
+			return fmt.Errorf("query: %w", err)
+		}
+	}
+	w, err := newRowWriter(os.Stdout, format, !noHeader)
+	if err != nil {
+		return fmt.Errorf("query: %w", err)
+	}
+	q := &query{paths: exprs, each: each, filename: filename}
+	if err := w.header(q.headers(schema)); err != nil {
+		return err
+	}
+
+	files, err := expandInputs(flags.Args())
+	if err != nil {
+		return fmt.Errorf("query: %w", err)
+	}
+	failed := 0
+	for _, name := range files {
+		if err := q.file(w, name); err != nil {
+			failed++
+			fmt.Fprintf(os.Stderr, "hl7: query: %v\n", err)
+		}
+	}
+	if err := w.flush(); err != nil {
+		return err
+	}
+	if failed > 0 {
+		return fmt.Errorf("query: %d of %d files could not be read", failed, len(files))
+	}
+	return nil
+}
+
+// query extracts the values at paths from messages.
+type query struct {
+	paths    []hl7.Path
+	each     string
+	filename bool
+}
+
+// headers returns the column names: the schema name of each path when
+// schema describes it and the name is not already taken, or else the path.
+func (q *query) headers(schema *hl7.MessageSchema) []string {
+	var headers []string
+	if q.filename {
+		headers = append(headers, "file")
+	}
+	seen := make(map[string]bool)
+	for _, p := range q.paths {
+		h := schemaFieldName(schema, p)
+		if h == "" || seen[h] || p.Occurrence > 0 || p.Repetition > 0 {
+			h = p.String()
+		}
+		seen[h] = true
+		headers = append(headers, h)
+	}
+	return headers
+}
+
+// file writes the rows of every message in the named file, or stdin for "-".
+func (q *query) file(w rowWriter, name string) error {
+	data, err := readFile(name)
+	if err != nil {
+		return err
+	}
+	msgs, err := hl7.ParseGenericMulti(data)
+	if err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+	for _, msg := range msgs {
+		for _, row := range q.rows(msg) {
+			if q.filename {
+				row = append([]string{name}, row...)
+			}
+			if err := w.row(row); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// rows returns the unescaped values of the paths in msg: one row, or one
+// per occurrence of the each segment.
+func (q *query) rows(msg *hl7.GenericMessage) [][]string {
+	opts := msg.Delimiters()
+	n := 1
+	if q.each != "" {
+		n = 0
+		for _, seg := range msg.Segments {
+			if seg.Name == q.each {
+				n++
+			}
+		}
+	}
+
+	rows := make([][]string, n)
+	for i := range rows {
+		row := make([]string, len(q.paths))
+		for j, p := range q.paths {
+			if p.Segment == q.each && p.Occurrence == 0 {
+				p.Occurrence = i + 1
+			}
+			row[j] = opts.Unescape(msg.Value(p))
+		}
+		rows[i] = row
+	}
+	return rows
+}
+
+// expandInputs turns the file arguments into a list of files: globs are
+// expanded, directories are walked and "-" stands for stdin, which is also
+// used when there are no arguments.
+func expandInputs(args []string) ([]string, error) {
+	if len(args) == 0 {
+		return []string{"-"}, nil
+	}
+	var files []string
+	for _, arg := range args {
+		matches := []string{arg}
+		if arg != "-" && strings.ContainsAny(arg, "*?[") {
+			var err error
+			if matches, err = filepath.Glob(arg); err != nil {
+				return nil, err
+			}
+			if len(matches) == 0 {
+				return nil, fmt.Errorf("no files match %s", arg)
+			}
+		}
+		for _, name := range matches {
+			info, err := os.Stat(name)
+			if name == "-" || err != nil || !info.IsDir() {
+				files = append(files, name)
+				continue
+			}
+			err = filepath.WalkDir(name, func(path string, d fs.DirEntry, err error) error {
+				if err != nil {
+					return err
+				}
+				if d.Type().IsRegular() {
+					files = append(files, path)
+				}
+				return nil
+			})
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	return files, nil
+}
+
+// rowWriter writes the rows of `hl7 query`.
+type rowWriter interface {
+	header(names []string) error
+	row(values []string) error
+	flush() error
+}
+
+// newRowWriter returns a writer for the csv, tsv or json format. The header
+// row of CSV and TSV is only written when withHeader is set; JSON lines use
+// the header names as keys.
+func newRowWriter(w io.Writer, format string, withHeader bool) (rowWriter, error) {
+	switch format {
+	case "csv", "tsv":
+		cw := csv.NewWriter(w)
+		if format == "tsv" {
+			cw.Comma = '\t'
+		}
+		return &csvRows{w: cw, withHeader: withHeader}, nil
+	case "json":
+		return &jsonRows{w: w}, nil
+	default:
+		return nil, fmt.Errorf("invalid format %q: want csv, tsv or json", format)
+	}
+}
+
+type csvRows struct {
+	w          *csv.Writer
+	withHeader bool
+}
+
+func (c *csvRows) header(names []string) error {
+	if !c.withHeader {
+		return nil
+	}
+	return c.w.Write(names)
+}
+
+func (c *csvRows) row(values []string) error { return c.w.Write(values) }
+
+func (c *csvRows) flush() error {
+	c.w.Flush()
+	return c.w.Error()
+}
+
+// jsonRows writes one JSON object per row, with keys in column order.
+type jsonRows struct {
+	w     io.Writer
+	names []string
+}
+
+func (j *jsonRows) header(names []string) error {
+	j.names = names
+	return nil
+}
+
+func (j *jsonRows) row(values []string) error {
+	var b strings.Builder
+	b.WriteByte('{')
+	for i, v := range values {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		k, _ := json.Marshal(j.names[i])
+		s, _ := json.Marshal(v)
+		b.Write(k)
+		b.WriteByte(':')
+		b.Write(s)
+	}
+	b.WriteString("}\n")
+	_, err := io.WriteString(j.w, b.String())
+	return err
+}
+
+func (j *jsonRows) flush() error { return nil }
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/esequiel378/hl7"
+)
+
+func mustPaths(t *testing.T, s string) []hl7.Path {
+	t.Helper()
+	var p pathFlags
+	if err := p.Set(s); err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func TestQueryRows(t *testing.T) {
+	msg, err := hl7.ParseGeneric([]byte("MSH|^~\\&|LAB|F|||||ORU^R01|MSG1\r" +
+		"PID|1||MRN1^^^H||DOE^JANE\r" +
+		"OBX|1|NM|GLU||95\r" +
+		"OBX|2|ST|NOTE||A\\T\\B"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	q := &query{paths: mustPaths(t, "MSH-10,PID-3.1,OBX-3,OBX-5")}
+	if got := q.rows(msg); !slices.Equal(got[0], []string{"MSG1", "MRN1", "GLU", "95"}) || len(got) != 1 {
+		t.Errorf("unexpected rows %q", got)
+	}
+
+	q.each = "OBX"
+	got := q.rows(msg)
+	if len(got) != 2 || !slices.Equal(got[1], []string{"MSG1", "MRN1", "NOTE", "A&B"}) {
+		t.Errorf("unexpected rows per OBX %q", got)
+	}
+
+	q.each = "NTE"
+	if got := q.rows(msg); len(got) != 0 {
+		t.Errorf("expected no rows without NTE, got %q", got)
+	}
+}
+
+func TestQueryHeaders(t *testing.T) {
+	schema, err := hl7.ParseSchema([]byte(`{"segments": {"PID": {"fields": {
+		"patientId": {"index": 3, "type": "object", "components": {"id": {"index": 1}}},
+		"name": {"index": 5}
+	}}}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	q := &query{paths: mustPaths(t, "MSH-10,PID-3.1,PID-5,PID[2]-5"), filename: true}
+	want := []string{"file", "MSH-10", "patientId.id", "name", "PID[2]-5"}
+	if got := q.headers(schema); !slices.Equal(got, want) {
+		t.Errorf("expected headers %q, got %q", want, got)
+	}
+}
+
+func TestQueryWholeSegment(t *testing.T) {
+	err := runQuery([]string{"-e", "PID-3.1,PID"})
+	if err == nil || !strings.Contains(err.Error(), "-e PID:") {
+		t.Errorf("expected an error for a whole-segment path, got %v", err)
+	}
+}
+
+func TestExpandInputs(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"a.hl7", "b.txt", "sub/c.hl7"} {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	got, err := expandInputs([]string{filepath.Join(dir, "*.hl7"), filepath.Join(dir, "sub"), "-"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{filepath.Join(dir, "a.hl7"), filepath.Join(dir, "sub", "c.hl7"), "-"}
+	if !slices.Equal(got, want) {
+		t.Errorf("expected %q, got %q", want, got)
+	}
+
+	if _, err := expandInputs([]string{filepath.Join(dir, "*.dat")}); err == nil {
+		t.Error("expected an error for a glob without matches")
+	}
+}
+
+func TestRowWriters(t *testing.T) {
+	tests := []struct {
+		format string
+		want   string
+	}{
+		{"csv", "a,b\n\"x,1\",y\n"},
+		{"tsv", "a\tb\nx,1\ty\n"},
+		{"json", "{\"a\":\"x,1\",\"b\":\"y\"}\n"},
+	}
+	for _, tt := range tests {
+		var out bytes.Buffer
+		w, err := newRowWriter(&out, tt.format, true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := w.header([]string{"a", "b"}); err != nil {
+			t.Fatal(err)
+		}
+		if err := w.row([]string{"x,1", "y"}); err != nil {
+			t.Fatal(err)
+		}
+		if err := w.flush(); err != nil {
+			t.Fatal(err)
+		}
+		if out.String() != tt.want {
+			t.Errorf("%s: expected %q, got %q", tt.format, tt.want, out.String())
+		}
+	}
+	if _, err := newRowWriter(&bytes.Buffer{}, "xml", true); err == nil {
+		t.Error("expected an error for an unknown format")
+	}
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/esequiel378/hl7"
+	"github.com/esequiel378/hl7/mllp"
+)
+
+// runSend implements `hl7 send`, which sends messages over MLLP.
+func runSend(args []string) error {
+	fs := flag.NewFlagSet("hl7 send", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, `Usage: hl7 send --addr <host:port> [flags] [file|dir|glob...]
+
+Send every message of the given files over one MLLP connection, waiting for
+the reply to each before sending the next, and print the ACKs received.
+Directories are searched recursively, quoted globs are expanded, and "-" or
+no arguments read stdin. hl7 send exits with a non-zero status unless every
+message is answered with AA or CA in MSA-1.
+
+Flags:
+  --addr <host:port>    MLLP server to send to.
+  --timeout <duration>  Time to wait for the connection and each ACK
+                        (default 10s).
+
+Examples:
+  hl7 send --addr localhost:2575 adt.hl7
+  hl7 send --addr engine:2575 --timeout 30s 'outbox/*.hl7'`)
+	}
+
+	var addr string
+	var timeout time.Duration
+	fs.StringVar(&addr, "addr", "", "MLLP server address")
+	fs.DurationVar(&timeout, "timeout", 10*time.Second, "connection and ACK timeout")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if addr == "" {
+		fs.Usage()
+		return errors.New("send: --addr is required")
+	}
+
+	files, err := expandInputs(fs.Args())
+	if err != nil {
+		return fmt.Errorf("send: %w", err)
+	}
+	client, err := mllp.Dial(addr, timeout)
+	if err != nil {
+		return fmt.Errorf("send: %w", err)
+	}
+	defer client.Close()
+
+	s := &sender{client: client, w: os.Stdout}
+	for _, name := range files {
+		if err := s.file(name); err != nil {
+			return fmt.Errorf("send: %w", err)
+		}
+	}
+	if s.rejected > 0 {
+		return fmt.Errorf("send: %d of %d messages were not accepted", s.rejected, s.sent)
+	}
+	return nil
+}
+
+// sender sends messages and prints their ACKs.
+type sender struct {
+	client   *mllp.Client
+	w        io.Writer
+	sent     int // messages read, whether or not they could be sent
+	rejected int // messages without an AA or CA acknowledgment
+}
+
+// file sends every message of the named file. A message that cannot be
+// parsed is counted as rejected without being sent; a connection error stops
+// the sending.
+func (s *sender) file(name string) error {
+	data, err := readFile(name)
+	if err != nil {
+		return err
+	}
+	dec := hl7.NewDecoder(bytes.NewReader(data))
+	for n := 1; dec.More(); n++ {
+		msg, err := dec.DecodeGeneric()
+		if dec.Err() != nil {
+			break // the file could not be read; reported below
+		}
+		s.sent++
+		if err == nil {
+			err = s.message(msg)
+		}
+		var netErr *sendError
+		if errors.As(err, &netErr) {
+			return fmt.Errorf("%s: message %d: %w", name, n, netErr.err)
+		}
+		if err != nil {
+			s.rejected++
+			fmt.Fprintf(os.Stderr, "hl7: send: %s: message %d: %v\n", name, n, err)
+		}
+	}
+	if err := dec.Err(); err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+	return nil
+}
+
+// sendError wraps the connection errors that stop the sending.
+type sendError struct{ err error }
+
+func (e *sendError) Error() string { return e.err.Error() }
+
+// message sends msg and prints its ACK. It returns an error unless MSA-1 of
+// the ACK is AA or CA.
+func (s *sender) message(msg *hl7.GenericMessage) error {
+	out, err := hl7.MarshalGeneric(msg)
+	if err != nil {
+		return err
+	}
+	reply, err := s.client.Send(out)
+	if err != nil {
+		return &sendError{err}
+	}
+
+	reply = bytes.TrimRight(reply, "\r\n")
+	if _, err := fmt.Fprintf(s.w, "%s\n\n", bytes.ReplaceAll(reply, []byte("\r"), []byte("\n"))); err != nil {
+		return &sendError{err}
+	}
+	ack, err := hl7.ParseGeneric(reply)
+	if err != nil {
+		return fmt.Errorf("invalid ACK: %w", err)
+	}
+	switch code := ack.Value(hl7.Path{Segment: "MSA", FieldPath: hl7.FieldPath{Field: 1}}); code {
+	case hl7.AckAccept, "CA":
+		return nil
+	default:
+		text := ack.Value(hl7.Path{Segment: "MSA", FieldPath: hl7.FieldPath{Field: 3}})
+		return fmt.Errorf("%s %s", code, ack.Delimiters().Unescape(text))
+	}
+}
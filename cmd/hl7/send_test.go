@@ -0,0 +1,50 @@
+package main
+
+import (
+	"bytes"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/esequiel378/hl7"
+	"github.com/esequiel378/hl7/mllp"
+)
+
+func TestSendFile(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	l := &listener{out: &bytes.Buffer{}, ack: true, log: func(error) {}}
+	schema, err := hl7.ParseSchema([]byte(`{"segments": {"PID": {"fields": {"setId": {"index": 1, "type": "int"}}}}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if l.compiled, err = schema.Compile(); err != nil {
+		t.Fatal(err)
+	}
+	srv := &mllp.Server{Handler: mllp.HandlerFunc(l.handle)}
+	go srv.Serve(ln)
+	defer srv.Close()
+
+	client, err := mllp.Dial(ln.Addr().String(), 5*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	name := writeTestFile(t, "MSH|^~\\&|SEND|CLINIC|RECV|HOSP|20250101||ADT^A01|M1|P|2.5\rPID|1\r"+
+		"MSH|^~\\&|SEND|CLINIC|RECV|HOSP|20250101||ADT^A01|M2|P|2.5\rPID|one\r")
+	var out bytes.Buffer
+	s := &sender{client: client, w: &out}
+	if err := s.file(name); err != nil {
+		t.Fatal(err)
+	}
+	if s.sent != 2 || s.rejected != 1 {
+		t.Errorf("expected 1 of 2 messages rejected, got %d of %d", s.rejected, s.sent)
+	}
+	if !strings.Contains(out.String(), "\nMSA|AA|M1\n\n") || !strings.Contains(out.String(), "\nMSA|AE|M2|") {
+		t.Errorf("unexpected ACKs %q", out.String())
+	}
+}
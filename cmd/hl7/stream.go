@@ -0,0 +1,43 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"os"
+
+	"github.com/esequiel378/hl7"
+)
+
+// openInput opens --file, the first positional argument, or stdin, in that
+// order of precedence.
+func openInput(file string, args []string) (io.ReadCloser, error) {
+	if file == "" && len(args) > 0 {
+		file = args[0]
+	}
+	if file == "" {
+		return io.NopCloser(os.Stdin), nil
+	}
+	return os.Open(file)
+}
+
+// readFile reads the named file, or stdin for "-".
+func readFile(name string) ([]byte, error) {
+	if name == "-" {
+		return io.ReadAll(os.Stdin)
+	}
+	return os.ReadFile(name)
+}
+
+// writeGeneric writes msg with MarshalGeneric, terminating each segment,
+// including the last, with lineEnding.
+func writeGeneric(w io.Writer, msg *hl7.GenericMessage, lineEnding string) error {
+	out, err := hl7.MarshalGeneric(msg)
+	if err != nil {
+		return err
+	}
+	if lineEnding != "\r" {
+		out = bytes.ReplaceAll(out, []byte("\r"), []byte(lineEnding))
+	}
+	_, err = w.Write(append(out, lineEnding...))
+	return err
+}
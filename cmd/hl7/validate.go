@@ -0,0 +1,380 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+
+	"github.com/esequiel378/hl7"
+)
+
+// runValidate implements `hl7 validate`, which checks every message of
+// many files against a schema.
+func runValidate(args []string) error {
+	fs := flag.NewFlagSet("hl7 validate", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, `Usage: hl7 validate --schema <file> [flags] [file|dir|glob...]
+
+Parse every message of the given files against a JSON schema and report
+each problem with its file, message number, control ID (MSH-10) and
+location. Directories are searched recursively, quoted globs are expanded,
+and "-" or no arguments read stdin. The exit status is 1 when any message
+or file fails.
+
+Flags:
+  -s, --schema <file>   JSON schema file (required).
+  --format <format>     Report format: text, json or junit (default text).
+  --strict              Also report segments the schema does not describe.
+  --redact              Mask message values in error messages.
+
+Examples:
+  hl7 validate -s vendor.json vendor-tests/
+  hl7 validate -s vendor.json --strict --format junit 'inbox/*.hl7' > report.xml`)
+	}
+
+	var schemaFile, format string
+	var strict, redact bool
+	fs.StringVar(&schemaFile, "schema", "", "JSON schema file")
+	fs.StringVar(&schemaFile, "s", "", "JSON schema file (shorthand)")
+	fs.StringVar(&format, "format", "text", "report format")
+	fs.BoolVar(&strict, "strict", false, "report unknown segments")
+	fs.BoolVar(&redact, "redact", false, "mask values in errors")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if schemaFile == "" {
+		fs.Usage()
+		return errors.New("validate: --schema is required")
+	}
+	write, ok := reportWriters[format]
+	if !ok {
+		return fmt.Errorf("validate: invalid format %q: want text, json or junit", format)
+	}
+
+	schema, err := hl7.LoadSchemaFile(schemaFile)
+	if err != nil {
+		return fmt.Errorf("validate: %w", err)
+	}
+	files, err := expandInputs(fs.Args())
+	if err != nil {
+		return fmt.Errorf("validate: %w", err)
+	}
+
+	compiled, err := schema.Compile()
+	if err != nil {
+		return fmt.Errorf("validate: %w", err)
+	}
+	v := validator{compiled: compiled, opts: hl7.DecodeOptions{
+		CollectErrors:           true,
+		DisallowUnknownSegments: strict,
+	}}
+	if redact {
+		v.opts.Redaction = hl7.RedactMask
+	}
+	reports := make([]fileReport, len(files))
+	for i, name := range files {
+		reports[i] = v.file(name)
+	}
+
+	if err := write(os.Stdout, reports); err != nil {
+		return err
+	}
+	if s := summarize(reports); s.failedMessages > 0 || s.failedFiles > 0 {
+		return fmt.Errorf("validate: %s", s)
+	}
+	return nil
+}
+
+// fileReport is the result of validating one file.
+type fileReport struct {
+	Name     string          `json:"file"`
+	Err      string          `json:"error,omitempty"` // the file could not be read
+	Messages []messageReport `json:"messages"`
+}
+
+// messageReport is the result of validating one message.
+type messageReport struct {
+	Index     int       `json:"message"`
+	ControlID string    `json:"controlId,omitempty"`
+	Problems  []problem `json:"problems,omitempty"`
+}
+
+// problem is one error found in a message.
+type problem struct {
+	Location string `json:"location,omitempty"` // e.g. PID-7 or OBX[2]
+	Line     int    `json:"line,omitempty"`
+	Error    string `json:"error"`
+}
+
+type validator struct {
+	compiled *hl7.CompiledSchema
+	opts     hl7.DecodeOptions
+}
+
+// file validates every message of the named file, or stdin for "-".
+func (v *validator) file(name string) fileReport {
+	report := fileReport{Name: name, Messages: []messageReport{}}
+	data, err := readFile(name)
+	if err != nil {
+		report.Err = err.Error()
+		return report
+	}
+
+	for i, msg := range splitMessages(data) {
+		m := messageReport{Index: i + 1, ControlID: controlID(msg)}
+		dec := hl7.NewDecoderWithOptions(bytes.NewReader(msg), v.opts)
+		if _, err := dec.DecodeWithCompiledSchema(v.compiled); err != nil {
+			m.Problems = problems(err)
+		}
+		report.Messages = append(report.Messages, m)
+	}
+	return report
+}
+
+// splitMessages splits data into messages the way a Decoder does: a message
+// starts at the first non-empty line and at every later MSH line.
+func splitMessages(data []byte) [][]byte {
+	var msgs [][]byte
+	for line := range bytes.FieldsFuncSeq(data, func(r rune) bool { return r == '\r' || r == '\n' }) {
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+		if len(msgs) == 0 || bytes.HasPrefix(bytes.TrimSpace(line), []byte("MSH")) {
+			msgs = append(msgs, bytes.Clone(line))
+			continue
+		}
+		last := &msgs[len(msgs)-1]
+		*last = append(append(*last, '\n'), line...)
+	}
+	return msgs
+}
+
+// controlID returns MSH-10 of a message starting with an MSH segment,
+// without parsing the rest of it.
+func controlID(msg []byte) string {
+	line, _, _ := bytes.Cut(msg, []byte("\n"))
+	line = bytes.TrimSpace(line)
+	if !bytes.HasPrefix(line, []byte("MSH")) || len(line) < 4 {
+		return ""
+	}
+	// fields[0] is "MSH" and fields[1] is MSH-2, as MSH-1 is the separator
+	// between them.
+	fields := bytes.Split(line, line[3:4])
+	if len(fields) < 10 {
+		return ""
+	}
+	return string(fields[9])
+}
+
+// problems flattens an error joined by the Decoder into one problem per
+// error, locating FieldError, SegmentError and ParseError values.
+func problems(err error) []problem {
+	if joined, ok := err.(interface{ Unwrap() []error }); ok {
+		var ps []problem
+		for _, e := range joined.Unwrap() {
+			ps = append(ps, problems(e)...)
+		}
+		return ps
+	}
+
+	p := problem{Error: err.Error()}
+	var fe *hl7.FieldError
+	var se *hl7.SegmentError
+	var pe *hl7.ParseError
+	switch {
+	case errors.As(err, &fe):
+		p.Location = hl7.Path{
+			Segment:    fe.Segment,
+			Occurrence: occurrenceRef(fe.Occurrence),
+			FieldPath: hl7.FieldPath{
+				Field:        fe.Field,
+				Repetition:   fe.Repetition,
+				Component:    fe.Component,
+				Subcomponent: fe.Subcomponent,
+			},
+		}.String()
+		p.Line = fe.Line
+	case errors.As(err, &se):
+		p.Location = hl7.Path{Segment: se.Segment, Occurrence: occurrenceRef(se.Occurrence)}.String()
+		p.Line = se.Line
+	case errors.As(err, &pe):
+		p.Location = "line " + strconv.Itoa(pe.Line)
+		p.Line = pe.Line
+	}
+	return []problem{p}
+}
+
+// occurrenceRef returns the occurrence to show in a path: only repeated
+// segments are numbered, as in the error messages.
+func occurrenceRef(occurrence int) int {
+	if occurrence > 1 {
+		return occurrence
+	}
+	return 0
+}
+
+// validationSummary counts the files and messages of a validation run.
+type validationSummary struct {
+	files, failedFiles, messages, failedMessages, problems int
+}
+
+func summarize(reports []fileReport) validationSummary {
+	var s validationSummary
+	for _, r := range reports {
+		s.files++
+		failed := r.Err != ""
+		for _, m := range r.Messages {
+			s.messages++
+			if len(m.Problems) > 0 {
+				s.failedMessages++
+				s.problems += len(m.Problems)
+				failed = true
+			}
+		}
+		if failed {
+			s.failedFiles++
+		}
+	}
+	return s
+}
+
+func (s validationSummary) String() string {
+	return fmt.Sprintf("%d of %d messages failed with %d problems; %d of %d files failed",
+		s.failedMessages, s.messages, s.problems, s.failedFiles, s.files)
+}
+
+// reportWriters maps the values of --format to report writers.
+var reportWriters = map[string]func(io.Writer, []fileReport) error{
+	"text":  writeTextReport,
+	"json":  writeJSONReport,
+	"junit": writeJUnitReport,
+}
+
+// writeTextReport writes one line per problem, followed by a summary.
+func writeTextReport(w io.Writer, reports []fileReport) error {
+	for _, r := range reports {
+		if r.Err != "" {
+			if _, err := fmt.Fprintf(w, "%s: %s\n", r.Name, r.Err); err != nil {
+				return err
+			}
+		}
+		for _, m := range r.Messages {
+			for _, p := range m.Problems {
+				if _, err := fmt.Fprintf(w, "%s: %s: %s\n", r.Name, messageName(m), p.Error); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	_, err := fmt.Fprintln(w, summarize(reports))
+	return err
+}
+
+// messageName identifies a message as e.g. "message 2 (MSG00002)".
+func messageName(m messageReport) string {
+	name := "message " + strconv.Itoa(m.Index)
+	if m.ControlID != "" {
+		name += " (" + m.ControlID + ")"
+	}
+	return name
+}
+
+// writeJSONReport writes the reports with their totals as one JSON object.
+func writeJSONReport(w io.Writer, reports []fileReport) error {
+	s := summarize(reports)
+	out, err := json.MarshalIndent(struct {
+		Valid          bool         `json:"valid"`
+		Messages       int          `json:"messages"`
+		FailedMessages int          `json:"failedMessages"`
+		Files          []fileReport `json:"files"`
+	}{s.failedMessages == 0 && s.failedFiles == 0, s.messages, s.failedMessages, reports}, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "%s\n", out)
+	return err
+}
+
+type junitSuites struct {
+	XMLName  xml.Name     `xml:"testsuites"`
+	Tests    int          `xml:"tests,attr"`
+	Failures int          `xml:"failures,attr"`
+	Errors   int          `xml:"errors,attr"`
+	Suites   []junitSuite `xml:"testsuite"`
+}
+
+type junitSuite struct {
+	Name     string      `xml:"name,attr"`
+	Tests    int         `xml:"tests,attr"`
+	Failures int         `xml:"failures,attr"`
+	Errors   int         `xml:"errors,attr"`
+	Cases    []junitCase `xml:"testcase"`
+}
+
+type junitCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+	Error     *junitFailure `xml:"error,omitempty"`
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Type    string `xml:"type,attr,omitempty"`
+	Text    string `xml:",chardata"`
+}
+
+// writeJUnitReport writes a JUnit XML report with one test suite per file
+// and one test case per message. A file that cannot be read is reported as
+// a test case with an error.
+func writeJUnitReport(w io.Writer, reports []fileReport) error {
+	var suites junitSuites
+	for _, r := range reports {
+		suite := junitSuite{Name: r.Name}
+		if r.Err != "" {
+			suite.Errors++
+			suite.Cases = append(suite.Cases, junitCase{
+				Name:      "read",
+				ClassName: r.Name,
+				Error:     &junitFailure{Message: r.Err},
+			})
+		}
+		for _, m := range r.Messages {
+			c := junitCase{Name: messageName(m), ClassName: r.Name}
+			if len(m.Problems) > 0 {
+				var text bytes.Buffer
+				for _, p := range m.Problems {
+					fmt.Fprintln(&text, p.Error)
+				}
+				c.Failure = &junitFailure{
+					Message: fmt.Sprintf("%d problems; first at %s", len(m.Problems), m.Problems[0].Location),
+					Type:    "validation",
+					Text:    text.String(),
+				}
+				if len(m.Problems) == 1 {
+					c.Failure.Message = m.Problems[0].Error
+				}
+				suite.Failures++
+			}
+			suite.Cases = append(suite.Cases, c)
+		}
+		suite.Tests = len(suite.Cases)
+		suites.Tests += suite.Tests
+		suites.Failures += suite.Failures
+		suites.Errors += suite.Errors
+		suites.Suites = append(suites.Suites, suite)
+	}
+
+	out, err := xml.MarshalIndent(suites, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "%s%s\n", xml.Header, out)
+	return err
+}
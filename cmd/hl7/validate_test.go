@@ -0,0 +1,131 @@
+package main
+
+import (
+	"bytes"
+	"encoding/xml"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/esequiel378/hl7"
+)
+
+func newTestValidator(t *testing.T, strict bool) *validator {
+	t.Helper()
+	schema, err := hl7.ParseSchema([]byte(`{"segments": {
+		"MSH": {"fields": {"controlId": {"index": 10}}},
+		"PID": {"fields": {
+			"setId": {"index": 1, "type": "int"},
+			"dob": {"index": 7, "type": "timestamp"}
+		}}
+	}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := schema.Compile()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &validator{compiled: c, opts: hl7.DecodeOptions{
+		CollectErrors:           true,
+		DisallowUnknownSegments: strict,
+	}}
+}
+
+func writeTestFile(t *testing.T, data string) string {
+	t.Helper()
+	name := filepath.Join(t.TempDir(), "vendor.hl7")
+	if err := os.WriteFile(name, []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return name
+}
+
+func TestValidateFile(t *testing.T) {
+	name := writeTestFile(t, "MSH|^~\\&|A|F||||||M1\rPID|1||||||19850101\r"+
+		"MSH|^~\\&|A|F||||||M2\rPID|one||||||later\rZZZ|1\r")
+
+	report := newTestValidator(t, false).file(name)
+	if len(report.Messages) != 2 || report.Messages[1].ControlID != "M2" {
+		t.Fatalf("unexpected messages %+v", report.Messages)
+	}
+	if len(report.Messages[0].Problems) != 0 {
+		t.Errorf("expected message 1 to be valid, got %+v", report.Messages[0].Problems)
+	}
+	ps := report.Messages[1].Problems
+	if len(ps) != 2 || ps[0].Location != "PID-1" || ps[1].Location != "PID-7" || ps[1].Line != 2 {
+		t.Errorf("unexpected problems %+v", ps)
+	}
+
+	ps = newTestValidator(t, true).file(name).Messages[1].Problems
+	if len(ps) != 3 || ps[2].Location != "ZZZ" {
+		t.Errorf("expected the unknown segment in strict mode, got %+v", ps)
+	}
+}
+
+func TestSplitMessages(t *testing.T) {
+	msgs := splitMessages([]byte("PID|0\r\nMSH|^~\\&|A|F||||||M1\r\n\nPID|1\nMSH#^~\\&#A#F######M2\r"))
+	var ids []string
+	for _, msg := range msgs {
+		ids = append(ids, controlID(msg))
+	}
+	if got := strings.Join(ids, ","); got != ",M1,M2" {
+		t.Errorf("expected control IDs ,M1,M2, got %q", got)
+	}
+	if string(msgs[1]) != "MSH|^~\\&|A|F||||||M1\nPID|1" {
+		t.Errorf("unexpected message %q", msgs[1])
+	}
+}
+
+func TestValidateValidFile(t *testing.T) {
+	name := writeTestFile(t, "MSH|^~\\&|A|F||||||M1\rPID|1\r")
+	reports := []fileReport{newTestValidator(t, false).file(name)}
+	if s := summarize(reports); s.failedMessages != 0 || s.failedFiles != 0 || s.messages != 1 {
+		t.Errorf("unexpected summary %+v", s)
+	}
+}
+
+func TestValidateReports(t *testing.T) {
+	reports := []fileReport{
+		{Name: "a.hl7", Messages: []messageReport{
+			{Index: 1, ControlID: "M1"},
+			{Index: 2, ControlID: "M2", Problems: []problem{{Location: "PID-7", Line: 2, Error: "bad date"}}},
+		}},
+		{Name: "b.hl7", Err: "permission denied", Messages: []messageReport{}},
+	}
+
+	var out bytes.Buffer
+	if err := writeTextReport(&out, reports); err != nil {
+		t.Fatal(err)
+	}
+	want := "a.hl7: message 2 (M2): bad date\n" +
+		"b.hl7: permission denied\n" +
+		"1 of 2 messages failed with 1 problems; 2 of 2 files failed\n"
+	if out.String() != want {
+		t.Errorf("unexpected text report:\n got %q\nwant %q", out.String(), want)
+	}
+
+	out.Reset()
+	if err := writeJSONReport(&out, reports); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), `"valid": false`) || !strings.Contains(out.String(), `"location": "PID-7"`) {
+		t.Errorf("unexpected JSON report:\n%s", out.String())
+	}
+
+	out.Reset()
+	if err := writeJUnitReport(&out, reports); err != nil {
+		t.Fatal(err)
+	}
+	var suites junitSuites
+	if err := xml.Unmarshal(out.Bytes(), &suites); err != nil {
+		t.Fatal(err)
+	}
+	if suites.Tests != 3 || suites.Failures != 1 || suites.Errors != 1 || len(suites.Suites) != 2 {
+		t.Errorf("unexpected JUnit totals %+v", suites)
+	}
+	if f := suites.Suites[0].Cases[1].Failure; f == nil || f.Message != "bad date" {
+		t.Errorf("unexpected failure %+v", f)
+	}
+}
@@ -0,0 +1,163 @@
+package hl7
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+)
+
+// MessageUnmarshaler is implemented by message types that decode themselves
+// without reflection, typically through code written by `hl7 gen-codec`.
+// Unmarshal calls UnmarshalHL7Message instead of its reflection path when
+// the destination implements it.
+type MessageUnmarshaler interface {
+	UnmarshalHL7Message(data []byte) error
+}
+
+// MessageMarshaler is implemented by message types that encode themselves
+// without reflection, typically through code written by `hl7 gen-codec`.
+// Marshal and MarshalWithOptions call MarshalHL7Message instead of their
+// reflection path when the value implements it.
+type MessageMarshaler interface {
+	MarshalHL7Message(opts MarshalOptions) ([]byte, error)
+}
+
+// RawSegment is a segment line split into fields, exactly as the decoders
+// see it. It is part of the support API for generated codecs; most callers
+// should use Unmarshal, UnmarshalWithSchema or ParseGeneric instead.
+type RawSegment struct {
+	Name               Segment
+	Fields             []string // Fields[0] is the segment name
+	FieldSeparator     string
+	EncodingCharacters string
+	Occurrence         int // 1-based occurrence of Name in the message
+	Line               int // 1-based line in the message
+	Offset             int // byte offset of the line in the message
+}
+
+// FieldError returns a FieldError for the value at path p of the segment,
+// located exactly as Unmarshal locates it.
+func (s *RawSegment) FieldError(p FieldPath, value string, err error) *FieldError {
+	line := segmentLine{
+		name:               s.Name,
+		fields:             s.Fields,
+		fieldSeparator:     s.FieldSeparator,
+		encodingCharacters: s.EncodingCharacters,
+		occurrence:         s.Occurrence,
+		line:               s.Line,
+		offset:             s.Offset,
+	}
+	return line.fieldError(p, value, err)
+}
+
+// SplitSegments splits a message into its segment lines, detecting the
+// separators from the MSH header. It is part of the support API for
+// generated codecs.
+func SplitSegments(data []byte) ([]RawSegment, error) {
+	lines, err := parseMessage(data, nil)
+	if err != nil {
+		return nil, err
+	}
+	segments := make([]RawSegment, len(lines))
+	for i, line := range lines {
+		segments[i] = RawSegment{
+			Name:               line.name,
+			Fields:             line.fields,
+			FieldSeparator:     line.fieldSeparator,
+			EncodingCharacters: line.encodingCharacters,
+			Occurrence:         line.occurrence,
+			Line:               line.line,
+			Offset:             line.offset,
+		}
+	}
+	return segments, nil
+}
+
+// DecodeInt parses a signed integer field value the way Unmarshal does.
+func DecodeInt(s string, bitSize int) (int64, error) {
+	v, err := strconv.ParseInt(s, 10, bitSize)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %v", ErrInvalidIntValue, err)
+	}
+	return v, nil
+}
+
+// DecodeUint parses an unsigned integer field value the way Unmarshal does.
+func DecodeUint(s string, bitSize int) (uint64, error) {
+	v, err := strconv.ParseUint(s, 10, bitSize)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %v", ErrInvalidUintValue, err)
+	}
+	return v, nil
+}
+
+// DecodeFloat parses a floating-point field value the way Unmarshal does.
+func DecodeFloat(s string, bitSize int) (float64, error) {
+	v, err := strconv.ParseFloat(s, bitSize)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %v", ErrInvalidFloatValue, err)
+	}
+	return v, nil
+}
+
+// DecodeBool parses a boolean field value the way Unmarshal does.
+func DecodeBool(s string) (bool, error) {
+	v, err := strconv.ParseBool(s)
+	if err != nil {
+		return false, fmt.Errorf("%w: %v", ErrInvalidBooleanValue, err)
+	}
+	return v, nil
+}
+
+// ErrCodecMismatch is returned by VerifyCodec when a generated codec and the
+// reflection path disagree.
+var ErrCodecMismatch = errors.New("hl7: generated codec does not match reflection")
+
+// VerifyCodec checks that the generated codec of v's type behaves exactly
+// like the reflection-based Unmarshal and Marshal for data. v must be a
+// non-nil pointer to a type implementing MessageUnmarshaler and
+// MessageMarshaler; its contents are not modified. Generated codec tests
+// call it for every sample message.
+func VerifyCodec(data []byte, v any) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Pointer || rv.IsNil() {
+		return InvalidMessageParserError{reflect.TypeOf(v)}
+	}
+	t := rv.Elem().Type()
+
+	generated := reflect.New(t)
+	u, ok := generated.Interface().(MessageUnmarshaler)
+	if !ok {
+		return fmt.Errorf("hl7: %s does not implement MessageUnmarshaler", t)
+	}
+	m, ok := generated.Interface().(MessageMarshaler)
+	if !ok {
+		return fmt.Errorf("hl7: %s does not implement MessageMarshaler", t)
+	}
+
+	reflected := reflect.New(t)
+	genErr := u.UnmarshalHL7Message(data)
+	refErr := unmarshalReflect(data, reflected, nil)
+	if fmt.Sprint(genErr) != fmt.Sprint(refErr) {
+		return fmt.Errorf("%w: unmarshal error %v, want %v", ErrCodecMismatch, genErr, refErr)
+	}
+	if !reflect.DeepEqual(generated.Interface(), reflected.Interface()) {
+		return fmt.Errorf("%w: unmarshal result %+v, want %+v", ErrCodecMismatch, generated.Elem(), reflected.Elem())
+	}
+	if genErr != nil {
+		return nil
+	}
+
+	opts := DefaultMarshalOptions()
+	genOut, genErr := m.MarshalHL7Message(opts)
+	refOut, refErr := marshalReflect(reflected.Elem(), opts)
+	if fmt.Sprint(genErr) != fmt.Sprint(refErr) {
+		return fmt.Errorf("%w: marshal error %v, want %v", ErrCodecMismatch, genErr, refErr)
+	}
+	if !bytes.Equal(genOut, refOut) {
+		return fmt.Errorf("%w: marshal output %q, want %q", ErrCodecMismatch, genOut, refOut)
+	}
+	return nil
+}
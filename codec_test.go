@@ -0,0 +1,77 @@
+package hl7_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/esequiel378/hl7"
+)
+
+type codecMSH struct {
+	MessageControlID string `hl7:"10"`
+}
+
+// codecMessage decodes itself by hand; flip changes the control ID so the
+// result no longer matches the reflection path.
+type codecMessage struct {
+	MSH  codecMSH `hl7:"segment:MSH"`
+	flip bool
+}
+
+func (m *codecMessage) UnmarshalHL7Message(data []byte) error {
+	segments, err := hl7.SplitSegments(data)
+	if err != nil {
+		return err
+	}
+	for _, seg := range segments {
+		if seg.Name == "MSH" && len(seg.Fields) > 9 {
+			m.MSH.MessageControlID = seg.Fields[9]
+			if m.flip {
+				m.MSH.MessageControlID += "!"
+			}
+		}
+	}
+	return nil
+}
+
+func (m codecMessage) MarshalHL7Message(opts hl7.MarshalOptions) ([]byte, error) {
+	return []byte("MSH" + string(opts.FieldSeparator) + "custom"), nil
+}
+
+func TestUnmarshalUsesMessageUnmarshaler(t *testing.T) {
+	data := []byte("MSH|^~\\&|App|Fac|||20250101||ADT^A01|CTRL1|P|2.5")
+
+	msg := codecMessage{flip: true}
+	if err := hl7.Unmarshal(data, &msg); err != nil {
+		t.Fatalf("Unmarshal failed: %v", err)
+	}
+	if msg.MSH.MessageControlID != "CTRL1!" {
+		t.Errorf("expected custom decoder to run, got %q", msg.MSH.MessageControlID)
+	}
+
+	out, err := hl7.Marshal(msg)
+	if err != nil {
+		t.Fatalf("Marshal failed: %v", err)
+	}
+	if string(out) != "MSH|custom" {
+		t.Errorf("expected custom encoder to run, got %q", out)
+	}
+}
+
+func TestVerifyCodecMismatch(t *testing.T) {
+	data := []byte("MSH|^~\\&|App|Fac|||20250101||ADT^A01|CTRL1|P|2.5")
+
+	err := hl7.VerifyCodec(data, new(codecMessage))
+	if !errors.Is(err, hl7.ErrCodecMismatch) {
+		t.Fatalf("expected ErrCodecMismatch for marshal output, got %v", err)
+	}
+}
+
+func TestVerifyCodecNotImplemented(t *testing.T) {
+	type Message struct {
+		MSH codecMSH `hl7:"segment:MSH"`
+	}
+	if err := hl7.VerifyCodec([]byte("MSH|^~\\&"), new(Message)); err == nil {
+		t.Fatal("expected error for type without generated codec")
+	}
+}
@@ -1,10 +1,8 @@
 package hl7
 
 import (
-	"bufio"
 	"bytes"
 	"errors"
-	"fmt"
 	"reflect"
 	"strconv"
 	"strings"
@@ -47,6 +45,96 @@ type segmentLine struct {
 	fields             []string
 	fieldSeparator     string
 	encodingCharacters string
+	occurrence         int // 1-based occurrence of name in the message
+	line               int // 1-based line in the message
+	offset             int // byte offset of the line in the message
+}
+
+// fieldError returns a FieldError for the value at path p of the segment.
+func (s *segmentLine) fieldError(p FieldPath, value string, err error) *FieldError {
+	return &FieldError{
+		Segment:      string(s.name),
+		Occurrence:   s.occurrence,
+		Field:        p.Field,
+		Repetition:   p.Repetition,
+		Component:    p.Component,
+		Subcomponent: p.Subcomponent,
+		Line:         s.line,
+		Offset:       s.valueOffset(p),
+		Value:        value,
+		Err:          err,
+	}
+}
+
+// segmentError returns a SegmentError for the whole segment.
+func (s *segmentLine) segmentError(err error) *SegmentError {
+	return &SegmentError{
+		Segment:    string(s.name),
+		Occurrence: s.occurrence,
+		Line:       s.line,
+		Offset:     s.offset,
+		Err:        err,
+	}
+}
+
+// valueOffset returns the byte offset in the message of the value at path
+// p. It is only computed for errors, so it re-splits the field instead of
+// tracking positions while decoding.
+func (s *segmentLine) valueOffset(p FieldPath) int {
+	i := p.Field
+	if s.name == "MSH" {
+		// MSH-1 is the field separator right after the segment name.
+		if i == 1 {
+			return s.offset + len(s.name)
+		}
+		i--
+	}
+	if i < 0 || i >= len(s.fields) {
+		return s.offset
+	}
+
+	offset := s.offset
+	for _, f := range s.fields[:i] {
+		offset += len(f) + len(s.fieldSeparator)
+	}
+
+	value := s.fields[i]
+	ec := s.encodingCharacters
+	if p.Repetition > 0 && len(ec) > 1 {
+		offset, value = nthPartOffset(value, ec[1], p.Repetition, offset)
+	}
+	cs := byte('^')
+	if len(ec) > 0 {
+		cs = ec[0]
+	}
+	if p.Component > 0 {
+		offset, value = nthPartOffset(value, cs, p.Component, offset)
+	}
+	if p.Subcomponent > 0 {
+		ss := byte('&')
+		if len(ec) > 3 {
+			ss = ec[3]
+		}
+		offset, _ = nthPartOffset(value, ss, p.Subcomponent, offset)
+	}
+	return offset
+}
+
+// nthPartOffset returns the offset and text of the 1-based nth part of
+// value split by sep, where value starts at offset.
+func nthPartOffset(value string, sep byte, n, offset int) (int, string) {
+	for ; n > 1; n-- {
+		i := strings.IndexByte(value, sep)
+		if i < 0 {
+			return offset + len(value), ""
+		}
+		offset += i + 1
+		value = value[i+1:]
+	}
+	if i := strings.IndexByte(value, sep); i >= 0 {
+		value = value[:i]
+	}
+	return offset, value
 }
 
 // splitMessages splits raw HL7 data into individual message byte slices,
@@ -75,21 +163,34 @@ func splitMessages(data []byte) [][]byte {
 	return messages
 }
 
-// parseMessage scans raw HL7 data and returns parsed segment lines with detected separators.
-func parseMessage(data []byte) ([]segmentLine, error) {
-	// Normalize \r\n and standalone \r (HL7 standard segment terminator) to \n.
-	data = bytes.ReplaceAll(data, []byte("\r\n"), []byte("\n"))
-	data = bytes.ReplaceAll(data, []byte("\r"), []byte("\n"))
-
+// parseMessage splits raw HL7 data into segment lines with detected separators.
+// Lines may end in "\r", "\n" or "\r\n". Lines that cannot be parsed are
+// reported through d.
+func parseMessage(data []byte, d *decodeState) ([]segmentLine, error) {
 	fieldSeparator := "|"
 	encodingCharacters := "^~\\&"
 
 	var lines []segmentLine
-
-	scanner := bufio.NewScanner(bytes.NewReader(data))
-	scanner.Buffer(make([]byte, 0, 1024*1024), 10*1024*1024)
-	for scanner.Scan() {
-		line := scanner.Text()
+	var occurrences map[Segment]int
+	var cs *charset
+
+	offset := 0
+	for lineNum := 1; offset < len(data); lineNum++ {
+		raw := data[offset:]
+		next := len(data)
+		if i := bytes.IndexAny(raw, "\r\n"); i >= 0 {
+			raw = raw[:i]
+			next = offset + i + 1
+			if data[offset+i] == '\r' && next < len(data) && data[next] == '\n' {
+				next++
+			}
+		}
+		lineOffset := offset
+		offset = next
+		if bytes.HasPrefix(raw, []byte("MSH")) && len(raw) > 3 {
+			cs = messageCharset(raw, d)
+		}
+		line := cs.decode(raw)
 
 		if strings.HasPrefix(line, "MSH") && len(line) > 3 {
 			fieldSeparator = string(line[3])
@@ -106,21 +207,29 @@ func parseMessage(data []byte) ([]segmentLine, error) {
 
 		segment := Segment(parts[0])
 		if segment == "" {
-			return nil, fmt.Errorf("%w: %s", ErrSegmentInvalid, segment)
+			err := &ParseError{Line: lineNum, Offset: lineOffset, Text: line, Err: ErrSegmentInvalid}
+			if err := d.valueError(err); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		if occurrences == nil {
+			occurrences = make(map[Segment]int)
 		}
+		occurrences[segment]++
 
 		lines = append(lines, segmentLine{
 			name:               segment,
 			fields:             parts,
 			fieldSeparator:     fieldSeparator,
 			encodingCharacters: encodingCharacters,
+			occurrence:         occurrences[segment],
+			line:               lineNum,
+			offset:             lineOffset,
 		})
 	}
 
-	if err := scanner.Err(); err != nil {
-		return nil, fmt.Errorf("hl7: failed to read message: %w", err)
-	}
-
 	return lines, nil
 }
 
@@ -129,6 +238,7 @@ func parseMessage(data []byte) ([]segmentLine, error) {
 // and `hl7:"<index>"` for fields within the segment.
 // NTE segments are attached to the preceding segment if that segment has a field tagged `hl7:"notes"`.
 // If no such field exists, NTE segments are ignored.
+// If v implements MessageUnmarshaler, its UnmarshalHL7Message method is used instead.
 func Unmarshal(data []byte, v any) error {
 	// Validate that v is a pointer to a struct
 	rv := reflect.ValueOf(v)
@@ -136,34 +246,29 @@ func Unmarshal(data []byte, v any) error {
 		return InvalidMessageParserError{reflect.TypeOf(v)}
 	}
 
-	// Map to store the tag to struct field mapping
-	tagToField := make(map[Segment]reflect.Value)
+	if u, ok := v.(MessageUnmarshaler); ok {
+		return u.UnmarshalHL7Message(data)
+	}
+	return unmarshalReflect(data, rv, nil)
+}
 
-	// Iterate over struct fields to map segment names to fields
-	for i := 0; i < rv.Elem().NumField(); i++ {
-		field := rv.Elem().Field(i)
-		tag, err := getHL7SegmentTypeFromTag(rv.Elem().Type().Field(i).Tag.Get("hl7"))
-		if errors.Is(err, errTagEmpty) {
-			continue
-		}
-		if err != nil {
-			return err
-		}
-		// Ensure the segment field is a struct
-		if field.Kind() != reflect.Struct {
-			return fmt.Errorf("%w: %s", ErrSegmentTypeInvalid, reflect.TypeOf(field).Name())
-		}
-		tagToField[tag] = field
+// unmarshalReflect is the reflection path of Unmarshal. rv must be a non-nil
+// pointer to a struct.
+func unmarshalReflect(data []byte, rv reflect.Value, d *decodeState) error {
+	msgFields := cachedMessageFields(rv.Elem().Type())
+	if msgFields.err != nil {
+		return msgFields.err
 	}
 
-	segments, err := parseMessage(data)
+	segments, err := parseMessage(data, d)
 	if err != nil {
 		return err
 	}
 
 	var lastSegment reflect.Value
 
-	for _, seg := range segments {
+	for i := range segments {
+		seg := &segments[i]
 		if seg.name == "NTE" {
 			if !lastSegment.IsValid() {
 				continue
@@ -175,7 +280,7 @@ func Unmarshal(data []byte, v any) error {
 			elemType := notesField.Type().Elem()
 			elem := reflect.New(elemType).Elem()
 			if elemType.Kind() == reflect.Struct {
-				if err := setValuesByIndex("NTE", elem, seg.fields, seg.fieldSeparator, seg.encodingCharacters, 0); err != nil {
+				if err := setValuesByIndex(seg, elem, seg.fields, 0, FieldPath{}, d); err != nil {
 					return err
 				}
 			}
@@ -183,13 +288,17 @@ func Unmarshal(data []byte, v any) error {
 			continue
 		}
 
-		segmentField, ok := tagToField[seg.name]
+		num, ok := msgFields.byName[seg.name]
 		if !ok {
-			continue // Ignore unknown segments
+			if err := d.unknownSegment(seg); err != nil {
+				return err
+			}
+			continue
 		}
+		segmentField := rv.Elem().Field(num)
 
 		// Populate the struct fields with parsed values
-		if err := setValuesByIndex(seg.name, segmentField, seg.fields, seg.fieldSeparator, seg.encodingCharacters, 0); err != nil {
+		if err := setValuesByIndex(seg, segmentField, seg.fields, 0, FieldPath{}, d); err != nil {
 			return err
 		}
 		lastSegment = segmentField
@@ -201,26 +310,20 @@ func Unmarshal(data []byte, v any) error {
 // findNotesField returns the field tagged hl7:"notes" in a struct value, if any.
 // The returned field is guaranteed to be a slice whose element type is a struct.
 func findNotesField(v reflect.Value) (reflect.Value, bool) {
-	for i := 0; i < v.NumField(); i++ {
-		if v.Type().Field(i).Tag.Get("hl7") != "notes" {
-			continue
-		}
-		field := v.Field(i)
-		if field.Kind() != reflect.Slice {
-			return reflect.Value{}, false
-		}
-		if field.Type().Elem().Kind() != reflect.Struct {
-			return reflect.Value{}, false
-		}
-		return field, true
+	num := cachedStructFields(v.Type()).notes
+	if num < 0 {
+		return reflect.Value{}, false
 	}
-	return reflect.Value{}, false
+	return v.Field(num), true
 }
 
 var ErrFieldIndexOutOfBounds = errors.New("hl7: field index out of bounds")
 
 // setValuesByIndex maps HL7 field values to struct fields using the hl7 tags.
-func setValuesByIndex(segment Segment, parent reflect.Value, fields []string, fs, ec string, level uint) error {
+// fields holds the fields of seg at level 0 and the components of the value
+// at path at below it. Values that cannot be converted are reported through d.
+func setValuesByIndex(seg *segmentLine, parent reflect.Value, fields []string, level uint, at FieldPath, d *decodeState) error {
+	segment, fs, ec := seg.name, seg.fieldSeparator, seg.encodingCharacters
 	componentSeparator := "^" // Default component separator
 	if len(ec) > 0 {
 		componentSeparator = string(ec[0])
@@ -230,16 +333,15 @@ func setValuesByIndex(segment Segment, parent reflect.Value, fields []string, fs
 		repetitionSeparator = string(ec[1])
 	}
 
-	for i := 0; i < parent.NumField(); i++ {
-		parentField := parent.Field(i)
-		tag := parent.Type().Field(i).Tag.Get("hl7")
-		sIndex, err := getHL7FieldIndexFromTag(tag)
-		if err != nil {
-			if errors.Is(err, errTagEmpty) {
-				continue
-			}
-			return fmt.Errorf("hl7: invalid field index tag %q: %w", tag, err)
-		}
+	structFields := cachedStructFields(parent.Type())
+	if structFields.err != nil {
+		return structFields.err
+	}
+
+	for _, f := range structFields.list {
+		parentField := parent.Field(f.num)
+		sIndex := f.index
+		path := at.Child(level, f.index)
 
 		// HL7 field indexing:
 		// - For MSH at level 0: MSH-1 is the field separator (not in parts array),
@@ -272,12 +374,13 @@ func setValuesByIndex(segment Segment, parent reflect.Value, fields []string, fs
 
 			for ri, rep := range repetitions {
 				elem := newSlice.Index(ri)
+				repPath := path.Repeat(level, ri+1)
 
 				// If element is a struct, parse components recursively
 				if elemType.Kind() == reflect.Struct {
 					repComponents := strings.Split(rep, componentSeparator)
 					if len(repComponents) > 1 {
-						if err := setValuesByIndex(segment, elem, repComponents, fs, ec, level+1); err != nil {
+						if err := setValuesByIndex(seg, elem, repComponents, level+1, repPath, d); err != nil {
 							return err
 						}
 						continue
@@ -285,12 +388,10 @@ func setValuesByIndex(segment Segment, parent reflect.Value, fields []string, fs
 				}
 
 				if err := setFieldValue(elem, rep); err != nil {
-					return &FieldError{
-						Segment: string(segment),
-						Field:   sIndex + 1,
-						Value:   rep,
-						Err:     err,
+					if err := d.valueError(seg.fieldError(repPath, rep, err)); err != nil {
+						return err
 					}
+					elem.SetZero()
 				}
 			}
 			parentField.Set(newSlice)
@@ -304,7 +405,7 @@ func setValuesByIndex(segment Segment, parent reflect.Value, fields []string, fs
 
 		// Handle components recursively
 		if shouldParseComponents {
-			if err := setValuesByIndex(segment, parentField, components, fs, ec, level+1); err != nil {
+			if err := setValuesByIndex(seg, parentField, components, level+1, path, d); err != nil {
 				return err
 			}
 
@@ -319,12 +420,14 @@ func setValuesByIndex(segment Segment, parent reflect.Value, fields []string, fs
 		}
 
 		// Set field value based on its type
+		wasNil := parentField.Kind() == reflect.Pointer && parentField.IsNil()
 		if err := setFieldValue(parentField, sField); err != nil {
-			return &FieldError{
-				Segment: string(segment),
-				Field:   sIndex + 1, // Convert back to 1-based for user-facing error
-				Value:   sField,
-				Err:     err,
+			if err := d.valueError(seg.fieldError(path, sField, err)); err != nil {
+				return err
+			}
+			// A skipped value must not leave a pointer allocated by setFieldValue.
+			if wasNil {
+				parentField.SetZero()
 			}
 		}
 	}
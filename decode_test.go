@@ -1,8 +1,10 @@
 package hl7_test
 
 import (
+	"errors"
 	"reflect"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -603,3 +605,78 @@ func TestUnmarshalNTEMultipleSegments(t *testing.T) {
 		t.Errorf("PID.Notes mismatch\ngot:  %+v\nwant: %+v", got.PID.Notes, expectedPIDNotes)
 	}
 }
+
+func TestUnmarshalInvalidTags(t *testing.T) {
+	type BadFieldPID struct {
+		SetID string `hl7:"1"`
+		Name  string `hl7:"name"`
+	}
+	type BadFieldMessage struct {
+		PID BadFieldPID `hl7:"segment:PID"`
+	}
+	type BadSegmentMessage struct {
+		PID struct {
+			SetID string `hl7:"1"`
+		} `hl7:"PID"`
+	}
+	type NonStructSegmentMessage struct {
+		PID string `hl7:"segment:PID"`
+	}
+
+	raw := []byte("MSH|^~\\&|App|Fac|||20250101||ADT^A01|1|P|2.3\rPID|1||12345")
+
+	// Tag errors are computed once per type; every call must still report them.
+	for range 2 {
+		var badField BadFieldMessage
+		if err := hl7.Unmarshal(raw, &badField); err == nil || !strings.Contains(err.Error(), `"name"`) {
+			t.Errorf("expected invalid field index tag error, got %v", err)
+		}
+
+		var badSegment BadSegmentMessage
+		if err := hl7.Unmarshal(raw, &badSegment); !errors.Is(err, hl7.ErrTagInvalidFormat) {
+			t.Errorf("expected ErrTagInvalidFormat, got %v", err)
+		}
+
+		var nonStruct NonStructSegmentMessage
+		if err := hl7.Unmarshal(raw, &nonStruct); !errors.Is(err, hl7.ErrSegmentTypeInvalid) {
+			t.Errorf("expected ErrSegmentTypeInvalid, got %v", err)
+		}
+	}
+}
+
+func TestUnmarshalConcurrent(t *testing.T) {
+	type PIDSegment struct {
+		SetID     string   `hl7:"1"`
+		PatientID []string `hl7:"3"`
+	}
+	type Message struct {
+		PID PIDSegment `hl7:"segment:PID"`
+	}
+
+	raw := []byte("MSH|^~\\&|App|Fac|||20250101||ADT^A01|1|P|2.3\rPID|1||A~B")
+	expected := Message{PID: PIDSegment{SetID: "1", PatientID: []string{"A", "B"}}}
+
+	var wg sync.WaitGroup
+	for range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range 100 {
+				var got Message
+				if err := hl7.Unmarshal(raw, &got); err != nil {
+					t.Errorf("Unmarshal failed: %v", err)
+					return
+				}
+				if !reflect.DeepEqual(expected, got) {
+					t.Errorf("got %+v, want %+v", got, expected)
+					return
+				}
+				if _, err := hl7.Marshal(got); err != nil {
+					t.Errorf("Marshal failed: %v", err)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
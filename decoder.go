@@ -0,0 +1,271 @@
+package hl7
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"reflect"
+)
+
+// ErrSegmentUnknown is reported for segments the decoding target does not
+// map when DecodeOptions.DisallowUnknownSegments is set.
+var ErrSegmentUnknown = errors.New("hl7: unknown segment")
+
+// maxSegmentSize bounds a single segment line read by a Decoder.
+const maxSegmentSize = 64 << 20
+
+// DecodeOptions configures how a Decoder handles problems in a message.
+// The zero value behaves like Unmarshal, UnmarshalWithSchema and
+// ParseGeneric: unknown segments are ignored and decoding stops at the
+// first error.
+type DecodeOptions struct {
+	// DisallowUnknownSegments rejects segments the target does not map: a
+	// segment without a `hl7:"segment:<name>"` field or schema entry. NTE
+	// segments are always allowed. Generic parsing maps every segment, so
+	// it is not affected.
+	DisallowUnknownSegments bool
+
+	// CollectErrors keeps decoding after an error in a field, segment or
+	// line and returns every problem as one error joined with errors.Join.
+	// The partially decoded result is still filled in.
+	CollectErrors bool
+
+	// Lenient skips values that cannot be converted to their target type,
+	// and segment lines that cannot be parsed, leaving the target as if the
+	// value were absent. The skipped problems are reported by
+	// Decoder.Warnings instead of failing the decode.
+	Lenient bool
+
+	// Redaction controls how the errors and warnings of the Decoder show
+	// raw message values. RedactDefault uses the package-level policy set
+	// by SetRedaction.
+	Redaction Redaction
+
+	// Charset is the character set of messages without an MSH-18 value,
+	// named as in MSH-18, e.g. CharsetLatin1. Messages are transcoded from
+	// their character set to UTF-8 once they have been split into
+	// segments, so no character is split. Empty means UTF-8.
+	Charset string
+
+	// RecordSegmentOrder stores the names of the segments decoded with a
+	// schema under SegmentOrderKey, in the order they appeared, so that
+	// MarshalWithSchema writes interleaved repeating segments back in
+	// place. It does not affect struct or generic decoding.
+	RecordSegmentOrder bool
+}
+
+// decodeState carries the options and the problems found while decoding one
+// message. A nil *decodeState behaves like the zero DecodeOptions.
+type decodeState struct {
+	opts     DecodeOptions
+	errs     []error
+	warnings []error
+}
+
+// valueError handles an error converting a value or parsing a line. It
+// returns the error to stop decoding with, or nil to continue.
+func (d *decodeState) valueError(err error) error {
+	if d == nil {
+		return err
+	}
+	err = redactError(err, d.opts.Redaction)
+	if d.opts.Lenient {
+		d.warnings = append(d.warnings, err)
+		return nil
+	}
+	return d.collect(err)
+}
+
+// unknownSegment handles a segment the target does not map. It returns the
+// error to stop decoding with, or nil to continue.
+func (d *decodeState) unknownSegment(seg *segmentLine) error {
+	if d == nil || !d.opts.DisallowUnknownSegments {
+		return nil
+	}
+	return d.collect(redactError(seg.segmentError(ErrSegmentUnknown), d.opts.Redaction))
+}
+
+func (d *decodeState) collect(err error) error {
+	if !d.opts.CollectErrors {
+		return err
+	}
+	d.errs = append(d.errs, err)
+	return nil
+}
+
+// err returns the collected errors, if any.
+func (d *decodeState) err() error {
+	if d == nil {
+		return nil
+	}
+	return errors.Join(d.errs...)
+}
+
+// A Decoder reads and decodes HL7 messages from an input stream, starting a
+// new message at each MSH segment. Unlike Unmarshal, it applies
+// DecodeOptions to every message it decodes.
+type Decoder struct {
+	sc       *bufio.Scanner
+	opts     DecodeOptions
+	next     []byte // MSH line of the next message, already read
+	warnings []error
+}
+
+// NewDecoder returns a Decoder that reads from r with the zero DecodeOptions.
+func NewDecoder(r io.Reader) *Decoder {
+	return NewDecoderWithOptions(r, DecodeOptions{})
+}
+
+// NewDecoderWithOptions returns a Decoder that reads from r using opts.
+func NewDecoderWithOptions(r io.Reader, opts DecodeOptions) *Decoder {
+	sc := bufio.NewScanner(r)
+	sc.Buffer(nil, maxSegmentSize)
+	sc.Split(scanSegmentLines)
+	return &Decoder{sc: sc, opts: opts}
+}
+
+// scanSegmentLines is a bufio.SplitFunc that splits on '\r' and '\n', the
+// segment terminators accepted by the decoders.
+func scanSegmentLines(data []byte, atEOF bool) (advance int, token []byte, err error) {
+	if i := bytes.IndexAny(data, "\r\n"); i >= 0 {
+		return i + 1, data[:i], nil
+	}
+	if atEOF && len(data) > 0 {
+		return len(data), data, nil
+	}
+	return 0, nil, nil
+}
+
+// More reports whether there is another message in the input. It returns
+// false when the input ends or cannot be read; use Err to tell them apart.
+func (dec *Decoder) More() bool {
+	if dec.next != nil {
+		return true
+	}
+	for dec.sc.Scan() {
+		if line := dec.sc.Bytes(); len(bytes.TrimSpace(line)) > 0 {
+			dec.next = bytes.Clone(line)
+			return true
+		}
+	}
+	return false
+}
+
+// Err returns the error that stopped the Decoder reading its input, such
+// as an error from the reader or a segment longer than 64 MiB, or nil if
+// the input ended cleanly. A loop over More should check it when More
+// returns false.
+func (dec *Decoder) Err() error {
+	return dec.sc.Err()
+}
+
+// readMessage returns the next message with its segments joined by '\n',
+// or io.EOF when the input is exhausted.
+func (dec *Decoder) readMessage() ([]byte, error) {
+	if !dec.More() {
+		if err := dec.sc.Err(); err != nil {
+			return nil, err
+		}
+		return nil, io.EOF
+	}
+
+	msg := dec.next
+	dec.next = nil
+	for dec.sc.Scan() {
+		line := dec.sc.Bytes()
+		trimmed := bytes.TrimSpace(line)
+		if len(trimmed) == 0 {
+			continue
+		}
+		if bytes.HasPrefix(trimmed, []byte("MSH")) {
+			dec.next = bytes.Clone(line)
+			break
+		}
+		msg = append(msg, '\n')
+		msg = append(msg, line...)
+	}
+	if err := dec.sc.Err(); err != nil {
+		return nil, err
+	}
+	return msg, nil
+}
+
+// begin reads the next message and resets the per-message state.
+func (dec *Decoder) begin() ([]byte, *decodeState, error) {
+	dec.warnings = nil
+	data, err := dec.readMessage()
+	if err != nil {
+		return nil, nil, err
+	}
+	return data, &decodeState{opts: dec.opts}, nil
+}
+
+// end records the warnings of a decoded message and returns its error.
+func (dec *Decoder) end(d *decodeState, err error) error {
+	dec.warnings = d.warnings
+	if err != nil {
+		return errors.Join(append(d.errs, err)...)
+	}
+	return d.err()
+}
+
+// Warnings returns the problems skipped in Lenient mode while decoding the
+// most recent message.
+func (dec *Decoder) Warnings() []error {
+	return dec.warnings
+}
+
+// Decode reads the next message and stores it in the struct pointed to by
+// v, following the same rules as Unmarshal. It returns io.EOF when there are
+// no more messages.
+//
+// Generated MessageUnmarshaler methods stop at the first error, so Decode
+// uses the reflection path unless the options other than Redaction and
+// RecordSegmentOrder are all zero.
+func (dec *Decoder) Decode(v any) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Pointer || rv.IsNil() {
+		return InvalidMessageParserError{reflect.TypeOf(v)}
+	}
+
+	data, d, err := dec.begin()
+	if err != nil {
+		return err
+	}
+	if u, ok := v.(MessageUnmarshaler); ok && dec.opts == (DecodeOptions{Redaction: dec.opts.Redaction, RecordSegmentOrder: dec.opts.RecordSegmentOrder}) {
+		return dec.end(d, redactError(u.UnmarshalHL7Message(data), dec.opts.Redaction))
+	}
+	return dec.end(d, unmarshalReflect(data, rv, d))
+}
+
+// DecodeWithSchema reads the next message and decodes it like
+// UnmarshalWithSchema. It returns io.EOF when there are no more messages.
+// The schema is compiled on every call; use DecodeWithCompiledSchema to
+// reuse a compiled schema.
+func (dec *Decoder) DecodeWithSchema(schema *MessageSchema) (map[string]any, error) {
+	return dec.DecodeWithCompiledSchema(compileSchema(schema))
+}
+
+// DecodeWithCompiledSchema reads the next message and decodes it like
+// CompiledSchema.Unmarshal. It returns io.EOF when there are no more
+// messages.
+func (dec *Decoder) DecodeWithCompiledSchema(c *CompiledSchema) (map[string]any, error) {
+	data, d, err := dec.begin()
+	if err != nil {
+		return nil, err
+	}
+	result, err := c.unmarshal(data, d)
+	return result, dec.end(d, err)
+}
+
+// DecodeGeneric reads the next message and parses it like ParseGeneric. It
+// returns io.EOF when there are no more messages.
+func (dec *Decoder) DecodeGeneric() (*GenericMessage, error) {
+	data, d, err := dec.begin()
+	if err != nil {
+		return nil, err
+	}
+	msg, err := parseGeneric(data, d)
+	return msg, dec.end(d, err)
+}
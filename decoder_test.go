@@ -0,0 +1,240 @@
+package hl7_test
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	"github.com/esequiel378/hl7"
+)
+
+type decoderNote struct {
+	Comment string `hl7:"3"`
+}
+
+type decoderPID struct {
+	SetID     int           `hl7:"1"`
+	PatientID string        `hl7:"3"`
+	Age       *int          `hl7:"7"`
+	Weights   []float64     `hl7:"8"`
+	Notes     []decoderNote `hl7:"notes"`
+}
+
+type decoderMSH struct {
+	MessageControlID string `hl7:"10"`
+}
+
+type decoderMessage struct {
+	MSH decoderMSH `hl7:"segment:MSH"`
+	PID decoderPID `hl7:"segment:PID"`
+}
+
+const decoderStream = "MSH|^~\\&|App|Fac|||20250101||ADT^A01|1|P|2.5\r" +
+	"PID|1||MRN1||||42\r" +
+	"NTE|1||first\r" +
+	"\r\n" +
+	"MSH|^~\\&|App|Fac|||20250101||ADT^A01|2|P|2.5\n" +
+	"PID|2||MRN2\n"
+
+func TestDecoderStream(t *testing.T) {
+	dec := hl7.NewDecoder(strings.NewReader(decoderStream))
+
+	var ids []string
+	for dec.More() {
+		var msg decoderMessage
+		if err := dec.Decode(&msg); err != nil {
+			t.Fatalf("Decode failed: %v", err)
+		}
+		ids = append(ids, msg.MSH.MessageControlID+":"+msg.PID.PatientID)
+		if msg.MSH.MessageControlID == "1" && (len(msg.PID.Notes) != 1 || msg.PID.Notes[0].Comment != "first") {
+			t.Errorf("expected note on first message, got %+v", msg.PID.Notes)
+		}
+	}
+
+	if strings.Join(ids, ",") != "1:MRN1,2:MRN2" {
+		t.Errorf("unexpected messages: %v", ids)
+	}
+
+	var msg decoderMessage
+	if err := dec.Decode(&msg); err != io.EOF {
+		t.Errorf("expected io.EOF, got %v", err)
+	}
+}
+
+func TestDecoderDisallowUnknownSegments(t *testing.T) {
+	data := "MSH|^~\\&|App|Fac|||20250101||ADT^A01|1|P|2.5\rPID|1||MRN1\rNTE|1||note\rZPI|custom\r"
+
+	var msg decoderMessage
+	if err := hl7.NewDecoder(strings.NewReader(data)).Decode(&msg); err != nil {
+		t.Fatalf("expected unknown segments to be ignored by default, got %v", err)
+	}
+
+	opts := hl7.DecodeOptions{DisallowUnknownSegments: true}
+	err := hl7.NewDecoderWithOptions(strings.NewReader(data), opts).Decode(&msg)
+	if !errors.Is(err, hl7.ErrSegmentUnknown) {
+		t.Fatalf("expected ErrSegmentUnknown, got %v", err)
+	}
+	if !strings.Contains(err.Error(), "ZPI") {
+		t.Errorf("expected error to name the segment, got %v", err)
+	}
+
+	schema, err := hl7.ParseSchema([]byte(`{"segments": {"MSH": {"fields": {"controlID": {"index": 10}}}}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = hl7.NewDecoderWithOptions(strings.NewReader(data), opts).DecodeWithSchema(schema)
+	if !errors.Is(err, hl7.ErrSegmentUnknown) {
+		t.Errorf("expected ErrSegmentUnknown from schema decode, got %v", err)
+	}
+
+	if _, err := hl7.NewDecoderWithOptions(strings.NewReader(data), opts).DecodeGeneric(); err != nil {
+		t.Errorf("expected generic parsing to map every segment, got %v", err)
+	}
+}
+
+func TestDecoderCollectErrors(t *testing.T) {
+	data := "MSH|^~\\&|App|Fac|||20250101||ADT^A01|1|P|2.5\rPID|x||MRN1||||old|1.5~heavy\rZPI|custom\r"
+
+	opts := hl7.DecodeOptions{CollectErrors: true, DisallowUnknownSegments: true}
+	var msg decoderMessage
+	err := hl7.NewDecoderWithOptions(strings.NewReader(data), opts).Decode(&msg)
+	if err == nil {
+		t.Fatal("expected joined error")
+	}
+
+	joined, ok := err.(interface{ Unwrap() []error })
+	if !ok {
+		t.Fatalf("expected a joined error, got %T", err)
+	}
+	var fields []int
+	for _, e := range joined.Unwrap() {
+		var fe *hl7.FieldError
+		if errors.As(e, &fe) {
+			fields = append(fields, fe.Field)
+		}
+	}
+	if len(joined.Unwrap()) != 4 || len(fields) != 3 {
+		t.Errorf("expected 3 field errors and 1 segment error, got %v", err)
+	}
+	if !errors.Is(err, hl7.ErrSegmentUnknown) {
+		t.Errorf("expected ErrSegmentUnknown among errors, got %v", err)
+	}
+
+	if msg.PID.PatientID != "MRN1" {
+		t.Errorf("expected valid fields to be decoded, got %+v", msg.PID)
+	}
+}
+
+func TestDecoderLenient(t *testing.T) {
+	data := "MSH|^~\\&|App|Fac|||20250101||ADT^A01|1|P|2.5\rPID|x||MRN1||||old|1.5~heavy\r"
+
+	dec := hl7.NewDecoderWithOptions(strings.NewReader(data), hl7.DecodeOptions{Lenient: true})
+	var msg decoderMessage
+	if err := dec.Decode(&msg); err != nil {
+		t.Fatalf("expected lenient decode to succeed, got %v", err)
+	}
+
+	if msg.PID.SetID != 0 || msg.PID.Age != nil {
+		t.Errorf("expected unparseable values to be skipped, got %+v", msg.PID)
+	}
+	if len(msg.PID.Weights) != 2 || msg.PID.Weights[0] != 1.5 || msg.PID.Weights[1] != 0 {
+		t.Errorf("unexpected weights: %v", msg.PID.Weights)
+	}
+	if msg.PID.PatientID != "MRN1" {
+		t.Errorf("expected valid fields to be decoded, got %+v", msg.PID)
+	}
+
+	warnings := dec.Warnings()
+	if len(warnings) != 3 {
+		t.Fatalf("expected 3 warnings, got %v", warnings)
+	}
+	if !errors.Is(warnings[0], hl7.ErrInvalidIntValue) {
+		t.Errorf("expected ErrInvalidIntValue warning, got %v", warnings[0])
+	}
+}
+
+func TestDecoderLenientSchema(t *testing.T) {
+	schema, err := hl7.ParseSchema([]byte(`{
+		"segments": {
+			"PID": {
+				"fields": {
+					"setID": { "index": 1, "type": "int" },
+					"patientID": { "index": 3 },
+					"weights": { "index": 8, "type": "array", "items": { "type": "float" } }
+				}
+			}
+		}
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data := "MSH|^~\\&|App|Fac|||20250101||ADT^A01|1|P|2.5\rPID|x||MRN1|||||1.5~heavy\r"
+	dec := hl7.NewDecoderWithOptions(strings.NewReader(data), hl7.DecodeOptions{Lenient: true})
+	result, err := dec.DecodeWithSchema(schema)
+	if err != nil {
+		t.Fatalf("expected lenient decode to succeed, got %v", err)
+	}
+
+	pid := result["PID"].(map[string]any)
+	if _, ok := pid["setID"]; ok {
+		t.Errorf("expected setID to be skipped, got %v", pid["setID"])
+	}
+	if pid["patientID"] != "MRN1" {
+		t.Errorf("expected patientID MRN1, got %v", pid["patientID"])
+	}
+	if weights := pid["weights"].([]any); len(weights) != 1 {
+		t.Errorf("expected one valid weight, got %v", weights)
+	}
+	if len(dec.Warnings()) != 2 {
+		t.Errorf("expected 2 warnings, got %v", dec.Warnings())
+	}
+}
+
+func TestDecoderLenientGeneric(t *testing.T) {
+	data := "MSH|^~\\&|App|Fac|||20250101||ADT^A01|1|P|2.5\r|broken\rPID|1||MRN1\r"
+
+	if _, err := hl7.NewDecoder(strings.NewReader(data)).DecodeGeneric(); !errors.Is(err, hl7.ErrSegmentInvalid) {
+		t.Fatalf("expected ErrSegmentInvalid by default, got %v", err)
+	}
+
+	dec := hl7.NewDecoderWithOptions(strings.NewReader(data), hl7.DecodeOptions{Lenient: true})
+	msg, err := dec.DecodeGeneric()
+	if err != nil {
+		t.Fatalf("expected lenient parse to succeed, got %v", err)
+	}
+	if len(msg.Segments) != 2 || msg.Segments[1].Name != "PID" {
+		t.Errorf("expected MSH and PID, got %+v", msg.Segments)
+	}
+	if len(dec.Warnings()) != 1 {
+		t.Errorf("expected 1 warning, got %v", dec.Warnings())
+	}
+}
+
+func TestDecoderErr(t *testing.T) {
+	readErr := errors.New("connection reset")
+	dec := hl7.NewDecoder(io.MultiReader(strings.NewReader(decoderStream), iotest.ErrReader(readErr)))
+
+	n := 0
+	for dec.More() {
+		var msg decoderMessage
+		if err := dec.Decode(&msg); err != nil && !errors.Is(err, readErr) {
+			t.Fatalf("Decode failed: %v", err)
+		}
+		n++
+	}
+	if !errors.Is(dec.Err(), readErr) {
+		t.Errorf("expected the read error from Err, got %v (after %d messages)", dec.Err(), n)
+	}
+
+	dec = hl7.NewDecoder(strings.NewReader(decoderStream))
+	for dec.More() {
+		var msg decoderMessage
+		dec.Decode(&msg)
+	}
+	if err := dec.Err(); err != nil {
+		t.Errorf("expected no error at the end of the input, got %v", err)
+	}
+}
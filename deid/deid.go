@@ -0,0 +1,342 @@
+// Package deid removes or replaces identifying information in HL7 v2
+// messages.
+//
+// A Deidentifier applies a set of rules, each selecting a field or component
+// by segment and field path (e.g. PID-5 or PID-3.1), to a parsed
+// hl7.GenericMessage. Values are unescaped before they are transformed and
+// escaped again afterwards, and untouched fields keep their raw bytes, so
+// the message structure and escape sequences round-trip unchanged.
+//
+//	d, err := deid.New(deid.Options{Salt: salt})
+//	if err != nil {
+//		return err
+//	}
+//	out, err := d.Deidentify(data)
+//
+// Without explicit rules the Safe Harbor defaults of SafeHarbor are used.
+// Hashes, date offsets and fake names are derived from the salt, so the same
+// salt maps an identifier to the same pseudonym across messages and runs.
+package deid
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/esequiel378/hl7"
+)
+
+// DefaultMaxDateShift is the largest date shift, in days, used when
+// Options.MaxDateShift is zero.
+const DefaultMaxDateShift = 365
+
+// Options configures a Deidentifier.
+type Options struct {
+	// Rules are applied in order. A rule replaces an earlier one with the
+	// same path, so rules can be appended to SafeHarbor to override it. A
+	// nil slice uses SafeHarbor.
+	Rules []Rule
+
+	// Salt keys the hashes, date offsets and fake names. Without a salt a
+	// random one is generated, so pseudonyms cannot be linked across
+	// Deidentifier instances.
+	Salt []byte
+
+	// MaxDateShift bounds the per-patient date offset, in days. The offset
+	// is never zero. Zero means DefaultMaxDateShift.
+	MaxDateShift int
+}
+
+// A Deidentifier applies de-identification rules to messages. It is safe
+// for concurrent use.
+type Deidentifier struct {
+	rules    []Rule
+	salt     []byte
+	maxShift int
+}
+
+// New returns a Deidentifier configured by opts.
+func New(opts Options) (*Deidentifier, error) {
+	rules := opts.Rules
+	if rules == nil {
+		rules = SafeHarbor()
+	}
+
+	d := &Deidentifier{salt: opts.Salt, maxShift: opts.MaxDateShift}
+	if d.maxShift < 0 {
+		return nil, fmt.Errorf("deid: negative MaxDateShift %d", d.maxShift)
+	}
+	if d.maxShift == 0 {
+		d.maxShift = DefaultMaxDateShift
+	}
+	if len(d.salt) == 0 {
+		d.salt = make([]byte, 32)
+		if _, err := rand.Read(d.salt); err != nil {
+			return nil, fmt.Errorf("deid: generating salt: %w", err)
+		}
+	}
+
+	positions := make(map[string]int, len(rules))
+	for _, r := range rules {
+		if err := r.validate(); err != nil {
+			return nil, err
+		}
+		if i, ok := positions[r.path()]; ok {
+			d.rules[i] = r
+			continue
+		}
+		positions[r.path()] = len(d.rules)
+		d.rules = append(d.rules, r)
+	}
+	return d, nil
+}
+
+// Rules returns the rules applied by d, after overrides are resolved.
+func (d *Deidentifier) Rules() []Rule {
+	return append([]Rule(nil), d.rules...)
+}
+
+// Deidentify parses an HL7 message, applies the rules to it and returns it
+// serialized with hl7.MarshalGeneric.
+func (d *Deidentifier) Deidentify(data []byte) ([]byte, error) {
+	msg, err := hl7.ParseGeneric(data)
+	if err != nil {
+		return nil, err
+	}
+	d.Apply(msg)
+	return hl7.MarshalGeneric(msg)
+}
+
+// Apply de-identifies msg in place. Dates are shifted by an offset derived
+// from the patient identifier in the first repetition of PID-3 (or PID-2
+// when PID-3 is empty), read before any rule changes it. Ages are computed
+// at the message time in MSH-7, or at the current time when it is missing.
+func (d *Deidentifier) Apply(msg *hl7.GenericMessage) {
+	opts := msg.Delimiters()
+	t := transform{d: d, opts: opts, shift: d.dateShift(patientKey(msg, opts)), now: messageTime(msg)}
+
+	for i := range msg.Segments {
+		seg := &msg.Segments[i]
+		for _, r := range d.rules {
+			if r.Segment != seg.Name {
+				continue
+			}
+			if f := findField(seg, r.Field); f != nil && f.Value != "" {
+				t.field(f, r)
+			}
+		}
+	}
+}
+
+// findField returns the field of seg with the given index, or nil.
+func findField(seg *hl7.GenericSegment, index int) *hl7.GenericField {
+	for i := range seg.Fields {
+		if seg.Fields[i].Index == index {
+			return &seg.Fields[i]
+		}
+	}
+	return nil
+}
+
+// patientKey returns the unescaped identifier of the patient of msg, or ""
+// when it has none.
+func patientKey(msg *hl7.GenericMessage, opts hl7.MarshalOptions) string {
+	for i := range msg.Segments {
+		seg := &msg.Segments[i]
+		if seg.Name != "PID" {
+			continue
+		}
+		for _, index := range []int{3, 2} {
+			f := findField(seg, index)
+			if f == nil {
+				continue
+			}
+			id, _, _ := strings.Cut(f.Value, string(opts.RepetitionSeparator))
+			id, _, _ = strings.Cut(id, string(opts.ComponentSeparator))
+			if id != "" {
+				return opts.Unescape(id)
+			}
+		}
+		break
+	}
+	return ""
+}
+
+// messageTime returns the date of MSH-7, or the current time when it is
+// missing or not a date.
+func messageTime(msg *hl7.GenericMessage) time.Time {
+	if t, n := parseDate(msg.Value(hl7.Path{Segment: "MSH", FieldPath: hl7.FieldPath{Field: 7}})); n > 0 {
+		return t
+	}
+	return time.Now()
+}
+
+// mac returns the salted digest of value for the given purpose. Each
+// purpose uses its own domain, so a hash never reveals a date offset or a
+// fake name of the same value.
+func (d *Deidentifier) mac(purpose, value string) []byte {
+	h := hmac.New(sha256.New, d.salt)
+	h.Write([]byte(purpose))
+	h.Write([]byte{0})
+	h.Write([]byte(value))
+	return h.Sum(nil)
+}
+
+// dateShift returns the offset in days for the patient with the given key,
+// in [-maxShift, -1] or [1, maxShift].
+func (d *Deidentifier) dateShift(key string) int {
+	n := binary.BigEndian.Uint64(d.mac("date", key))
+	days := int(n%uint64(2*d.maxShift)) - d.maxShift
+	if days >= 0 {
+		days++
+	}
+	return days
+}
+
+// transform applies rules to the fields of one message.
+type transform struct {
+	d     *Deidentifier
+	opts  hl7.MarshalOptions
+	shift int
+	now   time.Time // the message time, for ages
+}
+
+// field applies r to every repetition of f.
+func (t transform) field(f *hl7.GenericField, r Rule) {
+	if r.Action == Remove && r.Component == 0 {
+		f.SetValue("", t.opts)
+		return
+	}
+
+	cs, rs := string(t.opts.ComponentSeparator), string(t.opts.RepetitionSeparator)
+	reps := strings.Split(f.Value, rs)
+	for i, rep := range reps {
+		if r.Component == 0 {
+			reps[i] = t.value(rep, r.Action, 0)
+			continue
+		}
+		comps := strings.Split(rep, cs)
+		if r.Component <= len(comps) {
+			comps[r.Component-1] = t.value(comps[r.Component-1], r.Action, r.Component)
+			reps[i] = strings.Join(comps, cs)
+		}
+	}
+	f.SetValue(strings.Join(reps, rs), t.opts)
+}
+
+// value returns the replacement of a raw value, escaped for the message.
+// component is the component the value was taken from, or 0 for a whole
+// repetition.
+func (t transform) value(raw string, action Action, component int) string {
+	if raw == "" {
+		return ""
+	}
+	if action == Mask {
+		return t.mask(raw)
+	}
+	v := t.opts.Unescape(raw)
+
+	switch action {
+	case Hash:
+		return hex.EncodeToString(t.d.mac("hash", v)[:8])
+	case ShiftDate:
+		return t.opts.Escape(shiftDate(v, t.shift))
+	case ShiftBirthDate:
+		return t.opts.Escape(t.shiftBirthDate(v))
+	case FakeName:
+		sum := t.d.mac("name", v)
+		family := familyNames[int(sum[0])%len(familyNames)]
+		given := givenNames[int(sum[1])%len(givenNames)]
+		switch component {
+		case 0:
+			return family + string(t.opts.ComponentSeparator) + given
+		case 1:
+			return family
+		default:
+			return given
+		}
+	default:
+		return ""
+	}
+}
+
+// mask replaces the letters and digits of a raw value with '*', keeping
+// separators and escape sequences for delimiters and formatting. Other
+// escape sequences, such as hexadecimal data, are replaced by a single '*'.
+func (t transform) mask(raw string) string {
+	esc := t.opts.EscapeCharacter
+	var b strings.Builder
+	for len(raw) > 0 {
+		if raw[0] == esc {
+			if j := strings.IndexByte(raw[1:], esc); j >= 0 {
+				seq := raw[1 : j+1]
+				switch {
+				case len(seq) == 1 && strings.Contains("FSRTEHN", seq), strings.HasPrefix(seq, "."):
+					b.WriteString(raw[:j+2])
+				default:
+					b.WriteByte('*')
+				}
+				raw = raw[j+2:]
+				continue
+			}
+		}
+		r, size := utf8.DecodeRuneInString(raw)
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			r = '*'
+		}
+		b.WriteRune(r)
+		raw = raw[size:]
+	}
+	return b.String()
+}
+
+// shiftBirthDate shifts a date of birth, or replaces it by the date 90
+// years before the shifted message time, at the same precision, when the
+// person was 90 or older at the time of the message.
+func (t transform) shiftBirthDate(v string) string {
+	birth, n := parseDate(v)
+	if n == 0 {
+		return ""
+	}
+	if birth.AddDate(90, 0, 0).After(t.now) {
+		return shiftDate(v, t.shift)
+	}
+	return t.now.AddDate(-90, 0, t.shift).Format("20060102")[:n]
+}
+
+// shiftDate moves an HL7 date or timestamp (YYYY[MM[DD[HH...]]][+ZZZZ]) by
+// days, keeping its precision and everything after the date. Values that
+// do not start with a valid date are removed.
+func shiftDate(v string, days int) string {
+	t, n := parseDate(v)
+	if n == 0 {
+		return ""
+	}
+	return t.AddDate(0, 0, days).Format("20060102")[:n] + v[n:]
+}
+
+// parseDate parses the date at the start of an HL7 date or timestamp and
+// returns it with the number of digits it takes, 4, 6 or 8, or 0 when v
+// does not start with a valid date. Missing months and days are taken to
+// be the first.
+func parseDate(v string) (time.Time, int) {
+	n := 0
+	for n < len(v) && n < 8 && v[n] >= '0' && v[n] <= '9' {
+		n++
+	}
+	if n != 4 && n != 6 && n != 8 {
+		return time.Time{}, 0
+	}
+	t, err := time.Parse("20060102", v[:n]+"0101"[n-4:])
+	if err != nil {
+		return time.Time{}, 0
+	}
+	return t, n
+}
@@ -0,0 +1,275 @@
+package deid_test
+
+import (
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/esequiel378/hl7"
+	"github.com/esequiel378/hl7/deid"
+)
+
+var adtMessage = "MSH|^~\\&|HIS|GHH|EHR|GHH|20250115103000||ADT^A01|MSG001|P|2.5\r" +
+	"EVN|A01|20250115103000\r" +
+	"PID|1||MRN123^^^GHH^MR~999-88-7777^^^SSA^SS||O\\T\\BRIEN^PAT^Q||19850315|F|||12 Main St^^Springfield^IL^62701||555-867-5309|||||ACCT9|999887777\r" +
+	"NK1|1|O\\T\\BRIEN^SAM|SPO|12 Main St^^Springfield^IL\r" +
+	"PV1|1|I|4N^401^A" + strings.Repeat("|", 16) + "V100" + strings.Repeat("|", 25) + "20250115|20250120\r" +
+	"OBX|1|TX|NOTE||Result A\\F\\B\\.br\\done||||||F\r" +
+	"NTE|1||Patient Pat O'Brien called"
+
+func field(t *testing.T, msg *hl7.GenericMessage, segment string, index int) string {
+	t.Helper()
+	for _, seg := range msg.Segments {
+		if seg.Name != segment {
+			continue
+		}
+		for _, f := range seg.Fields {
+			if f.Index == index {
+				return f.Value
+			}
+		}
+		return ""
+	}
+	t.Fatalf("segment %s not found", segment)
+	return ""
+}
+
+func deidentify(t *testing.T, d *deid.Deidentifier, data string) *hl7.GenericMessage {
+	t.Helper()
+	out, err := d.Deidentify([]byte(data))
+	if err != nil {
+		t.Fatalf("Deidentify failed: %v", err)
+	}
+	msg, err := hl7.ParseGeneric(out)
+	if err != nil {
+		t.Fatalf("output does not parse: %v\n%s", err, out)
+	}
+	return msg
+}
+
+func TestSafeHarbor(t *testing.T) {
+	d, err := deid.New(deid.Options{Salt: []byte("salt")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg := deidentify(t, d, adtMessage)
+
+	if name := field(t, msg, "PID", 5); strings.Contains(name, "BRIEN") || strings.Count(name, "^") != 1 {
+		t.Errorf("expected fake family^given name, got %q", name)
+	}
+	ids := field(t, msg, "PID", 3)
+	if strings.Contains(ids, "MRN123") || strings.Contains(ids, "999-88-7777") {
+		t.Errorf("expected identifiers to be hashed, got %q", ids)
+	}
+	if !strings.HasSuffix(strings.Split(ids, "~")[0], "^^^GHH^MR") {
+		t.Errorf("expected identifier components to be kept, got %q", ids)
+	}
+	for _, loc := range []struct {
+		segment string
+		index   int
+	}{{"PID", 11}, {"PID", 13}, {"PID", 19}, {"NK1", 4}, {"NTE", 3}} {
+		if v := field(t, msg, loc.segment, loc.index); v != "" {
+			t.Errorf("expected %s-%d to be removed, got %q", loc.segment, loc.index, v)
+		}
+	}
+	if dob := field(t, msg, "PID", 7); dob == "19850315" || len(dob) != 8 {
+		t.Errorf("expected shifted date of birth, got %q", dob)
+	}
+
+	// Fields without rules keep their raw bytes, escapes included.
+	if v := field(t, msg, "OBX", 5); v != `Result A\F\B\.br\done` {
+		t.Errorf("expected OBX-5 to be untouched, got %q", v)
+	}
+	if v := field(t, msg, "PV1", 3); v != "4N^401^A" {
+		t.Errorf("expected PV1-3 to be untouched, got %q", v)
+	}
+}
+
+func TestDateShiftPreservesIntervals(t *testing.T) {
+	d, err := deid.New(deid.Options{Salt: []byte("salt")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg := deidentify(t, d, adtMessage)
+
+	admit, err := time.Parse("20060102", field(t, msg, "PV1", 44))
+	if err != nil {
+		t.Fatal(err)
+	}
+	discharge, err := time.Parse("20060102", field(t, msg, "PV1", 45))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if days := discharge.Sub(admit).Hours() / 24; days != 5 {
+		t.Errorf("expected a 5 day stay, got %v days", days)
+	}
+	if admit.Format("20060102") == "20250115" {
+		t.Error("expected admission date to be shifted")
+	}
+
+	msh7 := field(t, msg, "MSH", 7)
+	if len(msh7) != 14 || !strings.HasSuffix(msh7, "103000") || msh7[:8] != admit.Format("20060102") {
+		t.Errorf("expected message time shifted like the admission, got %q", msh7)
+	}
+}
+
+func TestConsistentAcrossMessages(t *testing.T) {
+	salt := []byte("shared")
+	d1, _ := deid.New(deid.Options{Salt: salt})
+	d2, _ := deid.New(deid.Options{Salt: salt})
+	other, _ := deid.New(deid.Options{Salt: []byte("other")})
+
+	a := deidentify(t, d1, adtMessage)
+	b := deidentify(t, d2, strings.Replace(adtMessage, "MSG001", "MSG002", 1))
+	c := deidentify(t, other, adtMessage)
+
+	for _, loc := range []struct {
+		segment string
+		index   int
+	}{{"PID", 3}, {"PID", 5}, {"PID", 7}} {
+		if field(t, a, loc.segment, loc.index) != field(t, b, loc.segment, loc.index) {
+			t.Errorf("expected %s-%d to match with the same salt", loc.segment, loc.index)
+		}
+	}
+	if field(t, a, "PID", 3) == field(t, c, "PID", 3) {
+		t.Error("expected a different salt to give different hashes")
+	}
+}
+
+func TestRulesAndOverrides(t *testing.T) {
+	rules := append(deid.SafeHarbor(),
+		mustRule(t, "PID-5=remove"),
+		mustRule(t, "PID-13=mask"),
+		mustRule(t, "OBX-5=mask"),
+		mustRule(t, "PID-7=shift-date"),
+	)
+	d, err := deid.New(deid.Options{Rules: rules, Salt: []byte("salt"), MaxDateShift: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(d.Rules()) != len(deid.SafeHarbor())+1 {
+		t.Errorf("expected overrides to replace rules, got %d rules", len(d.Rules()))
+	}
+
+	msg := deidentify(t, d, adtMessage)
+	if v := field(t, msg, "PID", 5); v != "" {
+		t.Errorf("expected PID-5 removed, got %q", v)
+	}
+	if v := field(t, msg, "PID", 13); v != "***-***-****" {
+		t.Errorf("expected masked phone, got %q", v)
+	}
+	if v := field(t, msg, "OBX", 5); v != `****** *\F\*\.br\****` {
+		t.Errorf("expected masked text with escapes kept, got %q", v)
+	}
+	if v := field(t, msg, "PID", 7); v != "19850314" && v != "19850316" {
+		t.Errorf("expected date shifted by one day, got %q", v)
+	}
+}
+
+func TestShiftDatePrecision(t *testing.T) {
+	d, err := deid.New(deid.Options{Rules: []deid.Rule{mustRule(t, "OBX-5=shift-date")}, MaxDateShift: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		in   string
+		want []string
+	}{
+		{"2024", []string{"2023", "2024"}},
+		{"202403", []string{"202402", "202403"}},
+		{"20240301", []string{"20240229", "20240302"}},
+		{"202403010830-0500", []string{"202402290830-0500", "202403020830-0500"}},
+		{"not a date", []string{""}},
+	}
+	for _, tt := range tests {
+		msg := deidentify(t, d, "MSH|^~\\&|A\rOBX|1|TS|||"+tt.in)
+		got := field(t, msg, "OBX", 5)
+		ok := false
+		for _, w := range tt.want {
+			ok = ok || got == w
+		}
+		if !ok {
+			t.Errorf("shift %q: got %q, want one of %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestSafeHarborMerge(t *testing.T) {
+	d, err := deid.New(deid.Options{Salt: []byte("salt")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg := deidentify(t, d, "MSH|^~\\&|HIS|GHH|||20250115||ADT^A40|1|P|2.5\r"+
+		"PID|1||MRN123^^^GHH^MR||DOE^JANE\r"+
+		"MRG|MRN123^^^GHH^MR||ACCT9|OLD7|V100||ROE^JANE")
+
+	if got, want := field(t, msg, "MRG", 1), field(t, msg, "PID", 3); got != want {
+		t.Errorf("expected MRG-1 hashed like PID-3 (%q), got %q", want, got)
+	}
+	for _, index := range []int{3, 4, 5} {
+		if v := field(t, msg, "MRG", index); v == "" || strings.ContainsAny(v, "ACOLDV") {
+			t.Errorf("expected MRG-%d to be hashed, got %q", index, v)
+		}
+	}
+	if name := field(t, msg, "MRG", 7); strings.Contains(name, "ROE") || strings.Count(name, "^") != 1 {
+		t.Errorf("expected a fake prior name, got %q", name)
+	}
+}
+
+func TestShiftBirthDate(t *testing.T) {
+	d, err := deid.New(deid.Options{Rules: []deid.Rule{mustRule(t, "PID-7=shift-birth-date")}, MaxDateShift: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		dob  string
+		want []string
+	}{
+		// 89 years old on the message date: shifted.
+		{"19350616", []string{"19350615", "19350617"}},
+		// 90 and older: 90 years before the shifted message date.
+		{"19350615", []string{"19350614", "19350616"}},
+		{"19120101", []string{"19350614", "19350616"}},
+		{"1912", []string{"1935"}},
+		{"191201011230", []string{"19350614", "19350616"}},
+		{"not a date", []string{""}},
+	}
+	for _, tt := range tests {
+		msg := deidentify(t, d, "MSH|^~\\&|A||||20250615\rPID|1||||||"+tt.dob)
+		got := field(t, msg, "PID", 7)
+		if !slices.Contains(tt.want, got) {
+			t.Errorf("date of birth %q: got %q, want one of %q", tt.dob, got, tt.want)
+		}
+	}
+}
+
+func TestParseRule(t *testing.T) {
+	r, err := deid.ParseRule("PID-3.1=hash")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r != (deid.Rule{Segment: "PID", Field: 3, Component: 1, Action: deid.Hash}) {
+		t.Errorf("unexpected rule %+v", r)
+	}
+	if r.String() != "PID-3.1=hash" {
+		t.Errorf("unexpected String %q", r)
+	}
+
+	for _, s := range []string{"PID-5", "PID=remove", "PID-x=remove", "PID-5.0=remove", "PID-5=scramble", "MSH-2=remove"} {
+		if _, err := deid.ParseRule(s); err == nil {
+			t.Errorf("ParseRule(%q): expected error", s)
+		}
+	}
+}
+
+func mustRule(t *testing.T, s string) deid.Rule {
+	t.Helper()
+	r, err := deid.ParseRule(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return r
+}
@@ -0,0 +1,151 @@
+package deid
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Action is what a Rule does to the values it selects.
+type Action int
+
+const (
+	// Remove clears the value.
+	Remove Action = iota + 1
+	// Mask replaces every letter and digit with '*', keeping punctuation
+	// such as the dashes of a phone number.
+	Mask
+	// Hash replaces the value with a salted HMAC-SHA256 digest, so equal
+	// identifiers map to equal pseudonyms and records can still be linked.
+	Hash
+	// ShiftDate moves an HL7 date or timestamp by a number of days that is
+	// consistent for each patient, preserving intervals between the dates of
+	// one patient. Values that are not dates are removed.
+	ShiftDate
+	// FakeName replaces a name with a made-up one chosen deterministically
+	// from the original. On a whole field it writes family^given; on a
+	// component it writes a family name for component 1 and a given name
+	// otherwise.
+	FakeName
+	// ShiftBirthDate shifts a date of birth like ShiftDate, unless the
+	// person was 90 or older at the time of the message. Such dates, whose
+	// year alone would reveal an age over 89, are replaced by the date 90
+	// years before the shifted message time, so all those ages read as 90.
+	ShiftBirthDate
+)
+
+var actionNames = map[Action]string{
+	Remove:         "remove",
+	Mask:           "mask",
+	Hash:           "hash",
+	ShiftDate:      "shift-date",
+	FakeName:       "fake-name",
+	ShiftBirthDate: "shift-birth-date",
+}
+
+// String returns the name of the action as accepted by ParseRule.
+func (a Action) String() string {
+	if name, ok := actionNames[a]; ok {
+		return name
+	}
+	return "Action(" + strconv.Itoa(int(a)) + ")"
+}
+
+// parseAction returns the action with the given name.
+func parseAction(name string) (Action, error) {
+	for a, n := range actionNames {
+		if n == name {
+			return a, nil
+		}
+	}
+	return 0, fmt.Errorf("deid: unknown action %q", name)
+}
+
+// Rule applies an Action to a field, or to one component of it, in every
+// occurrence and repetition of a segment.
+type Rule struct {
+	Segment   string // segment name, e.g. "PID"
+	Field     int    // 1-based field index, e.g. 5 for PID-5
+	Component int    // 1-based component index, or 0 for the whole field
+	Action    Action
+}
+
+// ParseRule parses a rule written as PATH=ACTION, where PATH is a segment
+// and field such as PID-5, optionally followed by a component as in PID-3.1,
+// and ACTION is one of remove, mask, hash, shift-date, shift-birth-date and
+// fake-name.
+func ParseRule(s string) (Rule, error) {
+	path, action, ok := strings.Cut(s, "=")
+	if !ok {
+		return Rule{}, fmt.Errorf("deid: rule %q: expected PATH=ACTION", s)
+	}
+
+	var r Rule
+	var err error
+	if r.Action, err = parseAction(strings.TrimSpace(action)); err != nil {
+		return Rule{}, err
+	}
+
+	seg, loc, ok := strings.Cut(strings.TrimSpace(path), "-")
+	if !ok || seg == "" {
+		return Rule{}, fmt.Errorf("deid: rule %q: expected a path like PID-5 or PID-5.1", s)
+	}
+	r.Segment = seg
+	field, comp, hasComp := strings.Cut(loc, ".")
+	if r.Field, err = strconv.Atoi(field); err != nil || r.Field < 1 {
+		return Rule{}, fmt.Errorf("deid: rule %q: invalid field %q", s, field)
+	}
+	if hasComp {
+		if r.Component, err = strconv.Atoi(comp); err != nil || r.Component < 1 {
+			return Rule{}, fmt.Errorf("deid: rule %q: invalid component %q", s, comp)
+		}
+	}
+	if err := r.validate(); err != nil {
+		return Rule{}, err
+	}
+	return r, nil
+}
+
+// validate reports rules that would corrupt the message structure.
+func (r Rule) validate() error {
+	if r.Segment == "MSH" && r.Field <= 2 {
+		return fmt.Errorf("deid: rule %s: MSH-1 and MSH-2 hold the message delimiters", r)
+	}
+	if r.Segment == "" || r.Field < 1 || r.Component < 0 {
+		return fmt.Errorf("deid: invalid rule path %s", r.path())
+	}
+	if _, ok := actionNames[r.Action]; !ok {
+		return fmt.Errorf("deid: rule %s: unknown action", r.path())
+	}
+	return nil
+}
+
+// path returns the location of the rule, e.g. PID-3.1.
+func (r Rule) path() string {
+	p := r.Segment + "-" + strconv.Itoa(r.Field)
+	if r.Component > 0 {
+		p += "." + strconv.Itoa(r.Component)
+	}
+	return p
+}
+
+// String returns the rule in the form accepted by ParseRule.
+func (r Rule) String() string {
+	return r.path() + "=" + r.Action.String()
+}
+
+// MarshalText implements encoding.TextMarshaler using the ParseRule form.
+func (r Rule) MarshalText() ([]byte, error) {
+	return []byte(r.String()), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler using ParseRule, so a
+// rule set can be stored as a JSON array of strings.
+func (r *Rule) UnmarshalText(text []byte) error {
+	rule, err := ParseRule(string(text))
+	if err != nil {
+		return err
+	}
+	*r = rule
+	return nil
+}
@@ -0,0 +1,104 @@
+package deid
+
+// SafeHarbor returns the default rule set. It covers the identifiers of the
+// HIPAA Safe Harbor method (45 CFR 164.514(b)(2)) where the standard HL7
+// v2 segments carry them:
+//
+//   - names of the patient, including the prior name of a merge, next of
+//     kin, guarantor and insured are replaced with fake names, and aliases
+//     and maiden names are removed;
+//   - addresses, county codes, phone numbers and e-mail addresses are
+//     removed;
+//   - dates of birth, death, admission, discharge, observation and the
+//     message and event times are shifted, so intervals are preserved, and
+//     dates of birth of people over 89 are aggregated into age 90;
+//   - medical record, account, visit, health plan and policy numbers,
+//     including the prior ones of MRG segments, are hashed, so messages of
+//     one patient can still be linked;
+//   - social security, driver's license and other document numbers are
+//     removed, and so is the free text of NTE segments.
+//
+// Identifiers outside these fields, such as names typed into observation
+// text, are not detected. Review the result against your own data before
+// calling it de-identified.
+func SafeHarbor() []Rule {
+	return []Rule{
+		// Message and event times
+		{Segment: "MSH", Field: 7, Action: ShiftDate},
+		{Segment: "EVN", Field: 2, Action: ShiftDate},
+		{Segment: "EVN", Field: 3, Action: ShiftDate},
+		{Segment: "EVN", Field: 6, Action: ShiftDate},
+
+		// Patient identification
+		{Segment: "PID", Field: 2, Component: 1, Action: Hash},
+		{Segment: "PID", Field: 3, Component: 1, Action: Hash},
+		{Segment: "PID", Field: 4, Component: 1, Action: Hash},
+		{Segment: "PID", Field: 5, Action: FakeName},
+		{Segment: "PID", Field: 6, Action: Remove},
+		{Segment: "PID", Field: 7, Action: ShiftBirthDate},
+		{Segment: "PID", Field: 9, Action: Remove},
+		{Segment: "PID", Field: 11, Action: Remove},
+		{Segment: "PID", Field: 12, Action: Remove},
+		{Segment: "PID", Field: 13, Action: Remove},
+		{Segment: "PID", Field: 14, Action: Remove},
+		{Segment: "PID", Field: 18, Component: 1, Action: Hash},
+		{Segment: "PID", Field: 19, Action: Remove},
+		{Segment: "PID", Field: 20, Action: Remove},
+		{Segment: "PID", Field: 21, Component: 1, Action: Hash},
+		{Segment: "PID", Field: 29, Action: ShiftDate},
+
+		// Merged patient
+		{Segment: "MRG", Field: 1, Component: 1, Action: Hash},
+		{Segment: "MRG", Field: 2, Component: 1, Action: Hash},
+		{Segment: "MRG", Field: 3, Component: 1, Action: Hash},
+		{Segment: "MRG", Field: 4, Component: 1, Action: Hash},
+		{Segment: "MRG", Field: 5, Component: 1, Action: Hash},
+		{Segment: "MRG", Field: 6, Component: 1, Action: Hash},
+		{Segment: "MRG", Field: 7, Action: FakeName},
+
+		// Additional demographics
+		{Segment: "PD1", Field: 4, Action: Remove},
+
+		// Next of kin
+		{Segment: "NK1", Field: 2, Action: FakeName},
+		{Segment: "NK1", Field: 4, Action: Remove},
+		{Segment: "NK1", Field: 5, Action: Remove},
+		{Segment: "NK1", Field: 6, Action: Remove},
+		{Segment: "NK1", Field: 16, Action: ShiftBirthDate},
+		{Segment: "NK1", Field: 37, Action: Remove},
+
+		// Visit
+		{Segment: "PV1", Field: 19, Component: 1, Action: Hash},
+		{Segment: "PV1", Field: 44, Action: ShiftDate},
+		{Segment: "PV1", Field: 45, Action: ShiftDate},
+
+		// Guarantor
+		{Segment: "GT1", Field: 2, Component: 1, Action: Hash},
+		{Segment: "GT1", Field: 3, Action: FakeName},
+		{Segment: "GT1", Field: 5, Action: Remove},
+		{Segment: "GT1", Field: 6, Action: Remove},
+		{Segment: "GT1", Field: 7, Action: Remove},
+		{Segment: "GT1", Field: 8, Action: ShiftBirthDate},
+		{Segment: "GT1", Field: 12, Action: Remove},
+
+		// Insurance
+		{Segment: "IN1", Field: 16, Action: FakeName},
+		{Segment: "IN1", Field: 18, Action: ShiftBirthDate},
+		{Segment: "IN1", Field: 19, Action: Remove},
+		{Segment: "IN1", Field: 36, Action: Hash},
+		{Segment: "IN1", Field: 49, Component: 1, Action: Hash},
+
+		// Orders and results
+		{Segment: "ORC", Field: 9, Action: ShiftDate},
+		{Segment: "OBR", Field: 6, Action: ShiftDate},
+		{Segment: "OBR", Field: 7, Action: ShiftDate},
+		{Segment: "OBR", Field: 8, Action: ShiftDate},
+		{Segment: "OBR", Field: 14, Action: ShiftDate},
+		{Segment: "OBR", Field: 22, Action: ShiftDate},
+		{Segment: "OBX", Field: 14, Action: ShiftDate},
+		{Segment: "OBX", Field: 19, Action: ShiftDate},
+
+		// Free text
+		{Segment: "NTE", Field: 3, Action: Remove},
+	}
+}
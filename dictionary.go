@@ -0,0 +1,352 @@
+package hl7
+
+// fieldTypes lists the HL7 v2.5 data types of the fields of common
+// segments, in order from field 1. OBX-5 is "varies": its type is given by
+// OBX-2.
+var fieldTypes = map[string][]string{
+	"MSH": {
+		"ST", "ST", "HD", "HD", "HD", "HD", "TS", "ST", "MSG", "ST",
+		"PT", "VID", "NM", "ST", "ID", "ID", "ID", "ID", "CE", "ID",
+		"EI",
+	},
+	"EVN": {"ID", "TS", "TS", "IS", "XCN", "TS", "HD"},
+	"PID": {
+		"SI", "CX", "CX", "CX", "XPN", "XPN", "TS", "IS", "XPN", "CE",
+		"XAD", "IS", "XTN", "XTN", "CE", "CE", "CE", "CX", "ST", "DLN",
+		"CX", "CE", "ST", "ID", "NM", "CE", "CE", "CE", "TS", "ID",
+		"ID", "IS", "TS", "HD", "CE", "CE", "ST", "CE", "CWE",
+	},
+	"PD1": {
+		"IS", "IS", "XON", "XCN", "IS", "IS", "IS", "IS", "ID", "CX",
+		"CE", "ID", "DT", "XON", "CE", "IS", "DT", "DT", "IS", "IS",
+		"IS",
+	},
+	"NK1": {
+		"SI", "XPN", "CE", "XAD", "XTN", "XTN", "CE", "DT", "DT", "ST",
+		"JCC", "CX", "XON", "CE", "IS", "TS", "IS", "IS", "CE", "CE",
+		"IS", "CE", "ID", "IS", "CE", "XPN", "CE", "CE", "CE", "XPN",
+		"XTN", "XAD", "CX", "IS", "CE", "IS", "ST", "ST", "IS",
+	},
+	"PV1": {
+		"SI", "IS", "PL", "IS", "CX", "PL", "XCN", "XCN", "XCN", "IS",
+		"PL", "IS", "IS", "IS", "IS", "IS", "XCN", "IS", "CX", "FC",
+		"IS", "IS", "IS", "IS", "DT", "NM", "NM", "IS", "IS", "DT",
+		"IS", "NM", "NM", "IS", "DT", "IS", "DLD", "CE", "IS", "IS",
+		"IS", "PL", "PL", "TS", "TS", "NM", "NM", "NM", "NM", "CX",
+		"IS", "XCN",
+	},
+	"ORC": {
+		"ID", "EI", "EI", "EI", "ID", "ID", "TQ", "EIP", "TS", "XCN",
+		"XCN", "XCN", "PL", "XTN", "TS", "CE", "CE", "CE", "XCN", "CE",
+		"XON", "XAD", "XTN", "XAD", "CWE", "CWE", "TS", "CWE", "CWE", "CWE",
+		"CWE",
+	},
+	"OBR": {
+		"SI", "EI", "EI", "CE", "ID", "TS", "TS", "TS", "CQ", "XCN",
+		"ID", "CE", "ST", "TS", "SPS", "XCN", "XTN", "ST", "ST", "ST",
+		"ST", "TS", "MOC", "ID", "ID", "PRL", "TQ", "XCN", "EIP", "ID",
+		"CE", "NDL", "NDL", "NDL", "NDL", "TS", "NM", "CE", "CE", "CE",
+		"ID", "ID", "CE", "CE", "CE", "CE", "CE", "CWE", "IS",
+	},
+	"OBX": {
+		"SI", "ID", "CE", "ST", "varies", "CE", "ST", "IS", "NM", "ID",
+		"ID", "TS", "ST", "TS", "CE", "XCN", "CE", "EI", "TS",
+	},
+	"NTE": {"SI", "ID", "FT", "CE"},
+	"AL1": {"SI", "CE", "CE", "CE", "ST", "DT"},
+	"DG1": {
+		"SI", "ID", "CE", "ST", "TS", "IS", "CE", "CE", "ID", "IS",
+		"CE", "NM", "CP", "ST", "ID", "XCN", "IS", "ID", "TS", "EI",
+		"ID",
+	},
+	"MSA": {"ID", "ST", "ST", "NM", "ID", "CE"},
+	"ERR": {"ELD", "ERL", "CWE", "ID", "CWE", "ST", "TX", "TX", "IS", "IS", "CWE", "XTN"},
+	"RXA": {
+		"NM", "NM", "TS", "TS", "CE", "NM", "CE", "CE", "CE", "XCN",
+		"LA2", "ST", "NM", "CE", "ST", "TS", "CE", "CE", "CE", "ID",
+		"ID", "TS", "NM", "CWE", "CWE", "CWE",
+	},
+	"RXR": {"CE", "CWE", "CE", "CE", "CE", "CWE"},
+}
+
+// componentTypes lists the data types of the components of composite
+// types, in order from component 1.
+var componentTypes = map[string][]string{
+	"CE":  {"ST", "ST", "ID", "ST", "ST", "ID"},
+	"CNN": {"ST", "ST", "ST", "ST", "ST", "ST", "IS", "IS", "IS", "ID"},
+	"CP":  {"MO", "ID", "NM", "NM", "CE", "ID"},
+	"CQ":  {"NM", "CE"},
+	"CWE": {"ST", "ST", "ID", "ST", "ST", "ID", "ST", "ST", "ST"},
+	"CX":  {"ST", "ST", "ID", "HD", "ID", "HD", "DT", "DT", "CWE", "CWE"},
+	"DLD": {"IS", "TS"},
+	"DLN": {"ST", "IS", "DT"},
+	"DR":  {"TS", "TS"},
+	"ED":  {"HD", "ID", "ID", "ID", "TX"},
+	"EI":  {"ST", "IS", "ST", "ID"},
+	"EIP": {"EI", "EI"},
+	"ELD": {"ST", "NM", "NM", "CE"},
+	"ERL": {"ST", "NM", "NM", "NM", "NM", "NM"},
+	"FC":  {"IS", "TS"},
+	"FN":  {"ST", "ST", "ST", "ST", "ST"},
+	"HD":  {"IS", "ST", "ID"},
+	"JCC": {"IS", "IS", "TX"},
+	"LA2": {"IS", "IS", "IS", "HD", "IS", "IS", "IS", "IS", "ST", "ST", "ST", "ST", "ST", "ST", "ID", "ST"},
+	"MO":  {"NM", "ID"},
+	"MOC": {"MO", "CE"},
+	"MSG": {"ID", "ID", "ID"},
+	"NDL": {"CNN", "TS", "TS", "IS", "IS", "IS", "IS", "IS", "IS", "IS", "HD"},
+	"PL":  {"IS", "IS", "IS", "HD", "IS", "IS", "IS", "IS", "ST", "EI"},
+	"PRL": {"CE", "ST", "TX"},
+	"PT":  {"ID", "ID"},
+	"RI":  {"IS", "ST"},
+	"SAD": {"ST", "ST", "ST"},
+	"SN":  {"ST", "NM", "ST", "NM"},
+	"SPS": {"CWE", "CWE", "TX", "CWE", "CWE", "CWE", "CWE"},
+	"TQ":  {"CQ", "RI", "ST", "TS", "TS", "ST", "ST", "TX", "ID", "ST", "ID", "TS"},
+	"TS":  {"DTM", "ID"},
+	"VID": {"ID", "CE", "CE"},
+	"XAD": {"SAD", "ST", "ST", "ST", "ST", "ID", "ID", "ST", "IS", "IS", "ID", "DR", "TS", "TS"},
+	"XCN": {
+		"ST", "FN", "ST", "ST", "ST", "ST", "IS", "IS", "HD", "ID",
+		"ST", "HD", "ID", "HD", "ID", "CE", "DR", "ID", "TS", "TS",
+		"ST", "CWE", "CWE",
+	},
+	"XON": {"ST", "IS", "NM", "NM", "ID", "HD", "ID", "HD", "ID", "ST"},
+	"XPN": {"FN", "ST", "ST", "ST", "ST", "IS", "ID", "ID", "CE", "DR", "ID", "TS", "TS", "ST"},
+	"XTN": {"ST", "ID", "ID", "ST", "NM", "NM", "NM", "NM", "ST", "ST", "ST", "ST"},
+}
+
+// segmentNames describes the segments of the built-in dictionary.
+var segmentNames = map[string]string{
+	"MSH": "Message Header",
+	"EVN": "Event Type",
+	"PID": "Patient Identification",
+	"PD1": "Patient Additional Demographic",
+	"NK1": "Next of Kin / Associated Parties",
+	"PV1": "Patient Visit",
+	"ORC": "Common Order",
+	"OBR": "Observation Request",
+	"OBX": "Observation/Result",
+	"NTE": "Notes and Comments",
+	"AL1": "Patient Allergy Information",
+	"DG1": "Diagnosis",
+	"MSA": "Message Acknowledgment",
+	"ERR": "Error",
+}
+
+// fieldNames lists the HL7 v2.5 names of the fields of the segments in
+// fieldTypes, in order from field 1.
+var fieldNames = map[string][]string{
+	"MSH": {
+		"Field Separator", "Encoding Characters", "Sending Application",
+		"Sending Facility", "Receiving Application", "Receiving Facility",
+		"Date/Time of Message", "Security", "Message Type",
+		"Message Control ID", "Processing ID", "Version ID",
+		"Sequence Number", "Continuation Pointer", "Accept Acknowledgment Type",
+		"Application Acknowledgment Type", "Country Code", "Character Set",
+		"Principal Language of Message", "Alternate Character Set Handling Scheme",
+		"Message Profile Identifier",
+	},
+	"EVN": {
+		"Event Type Code", "Recorded Date/Time", "Date/Time Planned Event",
+		"Event Reason Code", "Operator ID", "Event Occurred",
+		"Event Facility",
+	},
+	"PID": {
+		"Set ID - PID", "Patient ID", "Patient Identifier List",
+		"Alternate Patient ID - PID", "Patient Name", "Mother's Maiden Name",
+		"Date/Time of Birth", "Administrative Sex", "Patient Alias",
+		"Race", "Patient Address", "County Code",
+		"Phone Number - Home", "Phone Number - Business", "Primary Language",
+		"Marital Status", "Religion", "Patient Account Number",
+		"SSN Number - Patient", "Driver's License Number - Patient", "Mother's Identifier",
+		"Ethnic Group", "Birth Place", "Multiple Birth Indicator",
+		"Birth Order", "Citizenship", "Veterans Military Status",
+		"Nationality", "Patient Death Date and Time", "Patient Death Indicator",
+		"Identity Unknown Indicator", "Identity Reliability Code", "Last Update Date/Time",
+		"Last Update Facility", "Species Code", "Breed Code",
+		"Strain", "Production Class Code", "Tribal Citizenship",
+	},
+	"PD1": {
+		"Living Dependency", "Living Arrangement", "Patient Primary Facility",
+		"Patient Primary Care Provider Name & ID No.", "Student Indicator", "Handicap",
+		"Living Will Code", "Organ Donor Code", "Separate Bill",
+		"Duplicate Patient", "Publicity Code", "Protection Indicator",
+		"Protection Indicator Effective Date", "Place of Worship", "Advance Directive Code",
+		"Immunization Registry Status", "Immunization Registry Status Effective Date",
+		"Publicity Code Effective Date", "Military Branch", "Military Rank/Grade",
+		"Military Status",
+	},
+	"NK1": {
+		"Set ID - NK1", "Name", "Relationship",
+		"Address", "Phone Number", "Business Phone Number",
+		"Contact Role", "Start Date", "End Date",
+		"Next of Kin / Associated Parties Job Title", "Next of Kin / Associated Parties Job Code/Class",
+		"Next of Kin / Associated Parties Employee Number", "Organization Name - NK1",
+		"Marital Status", "Administrative Sex", "Date/Time of Birth",
+		"Living Dependency", "Ambulatory Status", "Citizenship",
+		"Primary Language", "Living Arrangement", "Publicity Code",
+		"Protection Indicator", "Student Indicator", "Religion",
+		"Mother's Maiden Name", "Nationality", "Ethnic Group",
+		"Contact Reason", "Contact Person's Name", "Contact Person's Telephone Number",
+		"Contact Person's Address", "Next of Kin/Associated Party's Identifiers",
+		"Job Status", "Race", "Handicap",
+		"Contact Person Social Security Number", "Next of Kin Birth Place", "VIP Indicator",
+	},
+	"PV1": {
+		"Set ID - PV1", "Patient Class", "Assigned Patient Location",
+		"Admission Type", "Preadmit Number", "Prior Patient Location",
+		"Attending Doctor", "Referring Doctor", "Consulting Doctor",
+		"Hospital Service", "Temporary Location", "Preadmit Test Indicator",
+		"Re-admission Indicator", "Admit Source", "Ambulatory Status",
+		"VIP Indicator", "Admitting Doctor", "Patient Type",
+		"Visit Number", "Financial Class", "Charge Price Indicator",
+		"Courtesy Code", "Credit Rating", "Contract Code",
+		"Contract Effective Date", "Contract Amount", "Contract Period",
+		"Interest Code", "Transfer to Bad Debt Code", "Transfer to Bad Debt Date",
+		"Bad Debt Agency Code", "Bad Debt Transfer Amount", "Bad Debt Recovery Amount",
+		"Delete Account Indicator", "Delete Account Date", "Discharge Disposition",
+		"Discharged to Location", "Diet Type", "Servicing Facility",
+		"Bed Status", "Account Status", "Pending Location",
+		"Prior Temporary Location", "Admit Date/Time", "Discharge Date/Time",
+		"Current Patient Balance", "Total Charges", "Total Adjustments",
+		"Total Payments", "Alternate Visit ID", "Visit Indicator",
+		"Other Healthcare Provider",
+	},
+	"ORC": {
+		"Order Control", "Placer Order Number", "Filler Order Number",
+		"Placer Group Number", "Order Status", "Response Flag",
+		"Quantity/Timing", "Parent", "Date/Time of Transaction",
+		"Entered By", "Verified By", "Ordering Provider",
+		"Enterer's Location", "Call Back Phone Number", "Order Effective Date/Time",
+		"Order Control Code Reason", "Entering Organization", "Entering Device",
+		"Action By", "Advanced Beneficiary Notice Code", "Ordering Facility Name",
+		"Ordering Facility Address", "Ordering Facility Phone Number",
+		"Ordering Provider Address", "Order Status Modifier",
+		"Advanced Beneficiary Notice Override Reason", "Filler's Expected Availability Date/Time",
+		"Confidentiality Code", "Order Type", "Enterer Authorization Mode",
+		"Parent Universal Service Identifier",
+	},
+	"OBR": {
+		"Set ID - OBR", "Placer Order Number", "Filler Order Number",
+		"Universal Service Identifier", "Priority - OBR", "Requested Date/Time",
+		"Observation Date/Time", "Observation End Date/Time", "Collection Volume",
+		"Collector Identifier", "Specimen Action Code", "Danger Code",
+		"Relevant Clinical Information", "Specimen Received Date/Time", "Specimen Source",
+		"Ordering Provider", "Order Callback Phone Number", "Placer Field 1",
+		"Placer Field 2", "Filler Field 1", "Filler Field 2",
+		"Results Rpt/Status Chng - Date/Time", "Charge to Practice", "Diagnostic Serv Sect ID",
+		"Result Status", "Parent Result", "Quantity/Timing",
+		"Result Copies To", "Parent", "Transportation Mode",
+		"Reason for Study", "Principal Result Interpreter", "Assistant Result Interpreter",
+		"Technician", "Transcriptionist", "Scheduled Date/Time",
+		"Number of Sample Containers", "Transport Logistics of Collected Sample",
+		"Collector's Comment", "Transport Arrangement Responsibility", "Transport Arranged",
+		"Escort Required", "Planned Patient Transport Comment", "Procedure Code",
+		"Procedure Code Modifier", "Placer Supplemental Service Information",
+		"Filler Supplemental Service Information", "Medically Necessary Duplicate Procedure Reason",
+		"Result Handling",
+	},
+	"OBX": {
+		"Set ID - OBX", "Value Type", "Observation Identifier",
+		"Observation Sub-ID", "Observation Value", "Units",
+		"References Range", "Abnormal Flags", "Probability",
+		"Nature of Abnormal Test", "Observation Result Status",
+		"Effective Date of Reference Range", "User Defined Access Checks",
+		"Date/Time of the Observation", "Producer's ID", "Responsible Observer",
+		"Observation Method", "Equipment Instance Identifier", "Date/Time of the Analysis",
+	},
+	"NTE": {
+		"Set ID - NTE", "Source of Comment", "Comment", "Comment Type",
+	},
+	"AL1": {
+		"Set ID - AL1", "Allergen Type Code", "Allergen Code/Mnemonic/Description",
+		"Allergy Severity Code", "Allergy Reaction Code", "Identification Date",
+	},
+	"DG1": {
+		"Set ID - DG1", "Diagnosis Coding Method", "Diagnosis Code - DG1",
+		"Diagnosis Description", "Diagnosis Date/Time", "Diagnosis Type",
+		"Major Diagnostic Category", "Diagnostic Related Group", "DRG Approval Indicator",
+		"DRG Grouper Review Code", "Outlier Type", "Outlier Days",
+		"Outlier Cost", "Grouper Version and Type", "Diagnosis Priority",
+		"Diagnosing Clinician", "Diagnosis Classification", "Confidential Indicator",
+		"Attestation Date/Time", "Diagnosis Identifier", "Diagnosis Action Code",
+	},
+	"MSA": {
+		"Acknowledgment Code", "Message Control ID", "Text Message",
+		"Expected Sequence Number", "Delayed Acknowledgment Type", "Error Condition",
+	},
+	"ERR": {
+		"Error Code and Location", "Error Location", "HL7 Error Code",
+		"Severity", "Application Error Code", "Application Error Parameter",
+		"Diagnostic Information", "User Message", "Inform Person Indicator",
+		"Override Type", "Override Reason Code", "Help Desk Contact Point",
+	},
+}
+
+// componentNames lists the names of the components of common composite
+// types, in order from component 1.
+var componentNames = map[string][]string{
+	"CE":  {"Identifier", "Text", "Name of Coding System", "Alternate Identifier", "Alternate Text", "Name of Alternate Coding System"},
+	"CWE": {"Identifier", "Text", "Name of Coding System", "Alternate Identifier", "Alternate Text", "Name of Alternate Coding System", "Coding System Version ID", "Alternate Coding System Version ID", "Original Text"},
+	"CX":  {"ID Number", "Check Digit", "Check Digit Scheme", "Assigning Authority", "Identifier Type Code", "Assigning Facility", "Effective Date", "Expiration Date"},
+	"EI":  {"Entity Identifier", "Namespace ID", "Universal ID", "Universal ID Type"},
+	"HD":  {"Namespace ID", "Universal ID", "Universal ID Type"},
+	"MSG": {"Message Code", "Trigger Event", "Message Structure"},
+	"PL":  {"Point of Care", "Room", "Bed", "Facility", "Location Status", "Person Location Type", "Building", "Floor", "Location Description"},
+	"XAD": {"Street Address", "Other Designation", "City", "State or Province", "Zip or Postal Code", "Country", "Address Type", "Other Geographic Designation", "County/Parish Code", "Census Tract"},
+	"XCN": {"ID Number", "Family Name", "Given Name", "Second and Further Given Names", "Suffix", "Prefix", "Degree", "Source Table", "Assigning Authority"},
+	"XPN": {"Family Name", "Given Name", "Second and Further Given Names", "Suffix", "Prefix", "Degree", "Name Type Code"},
+	"XTN": {"Telephone Number", "Telecommunication Use Code", "Telecommunication Equipment Type", "Email Address", "Country Code", "Area/City Code", "Local Number", "Extension"},
+}
+
+// FieldType returns the HL7 v2.5 data type of a segment field, such as
+// "XPN" for PID-5, or "" when the field is not in the built-in dictionary.
+// OBX-5 has the type "varies".
+func FieldType(segment string, field int) string {
+	types := fieldTypes[segment]
+	if field < 1 || field > len(types) {
+		return ""
+	}
+	return types[field-1]
+}
+
+// ComponentType returns the data type of the component of a composite data
+// type with the given 1-based index, such as "FN" for XPN-1, or "" when it
+// is unknown. Primitive types such as ST have no components.
+func ComponentType(dataType string, component int) string {
+	types := componentTypes[dataType]
+	if component < 1 || component > len(types) {
+		return ""
+	}
+	return types[component-1]
+}
+
+// SegmentName returns the HL7 v2.5 description of a segment, such as
+// "Patient Identification" for PID, or "" when it is not in the built-in
+// dictionary.
+func SegmentName(segment string) string {
+	return segmentNames[segment]
+}
+
+// FieldName returns the HL7 v2.5 name of a segment field, such as
+// "Patient Name" for PID-5, or "" when it is not in the built-in
+// dictionary.
+func FieldName(segment string, field int) string {
+	names := fieldNames[segment]
+	if field < 1 || field > len(names) {
+		return ""
+	}
+	return names[field-1]
+}
+
+// ComponentName returns the name of the component of a composite data type
+// with the given 1-based index, such as "Family Name" for XPN-1, or "" when
+// it is unknown.
+func ComponentName(dataType string, component int) string {
+	names := componentNames[dataType]
+	if component < 1 || component > len(names) {
+		return ""
+	}
+	return names[component-1]
+}
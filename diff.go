@@ -0,0 +1,291 @@
+package hl7
+
+import (
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// DiffKind classifies a Difference.
+type DiffKind string
+
+const (
+	DiffAdded   DiffKind = "added"   // present only in the second message
+	DiffRemoved DiffKind = "removed" // present only in the first message
+	DiffChanged DiffKind = "changed" // present in both with different values
+)
+
+// Difference is a value that differs between two messages. Path has no
+// Field when a whole segment was added or removed; Old and New then hold
+// the segment text. Otherwise they hold unescaped values.
+//
+// Path shows a segment occurrence, repetition or component only where the
+// messages have more than one, e.g. PID-5.2 or OBX[2]-5. The occurrence is
+// the one in the first message, or in the second for added segments.
+type Difference struct {
+	Path Path     `json:"path"`
+	Kind DiffKind `json:"kind"`
+	Old  string   `json:"old,omitempty"`
+	New  string   `json:"new,omitempty"`
+}
+
+// String formats the difference as e.g. PID-5.2: "JOHN" → "JON".
+func (d Difference) String() string {
+	switch d.Kind {
+	case DiffAdded:
+		return d.Path.String() + ": added " + strconv.Quote(d.New)
+	case DiffRemoved:
+		return d.Path.String() + ": removed " + strconv.Quote(d.Old)
+	default:
+		return d.Path.String() + ": " + strconv.Quote(d.Old) + " → " + strconv.Quote(d.New)
+	}
+}
+
+// DiffOptions configures DiffWithOptions.
+type DiffOptions struct {
+	// Ignore lists paths whose differences are not reported, such as MSH-7
+	// and MSH-10. A path matches the values under it, and a path without
+	// an occurrence or repetition matches every one. A Path with only a
+	// Segment ignores the whole segment.
+	Ignore []Path
+
+	// Keys matches the occurrences of a segment by the unescaped value of a
+	// key field instead of by position, e.g. "OBX": {Field: 3} pairs
+	// results by observation identifier. Occurrences without a partner are
+	// reported as added or removed.
+	Keys map[string]FieldPath
+}
+
+// Diff compares two HL7 messages at the segment, field, repetition,
+// component and subcomponent level, matching repeating segments by position.
+func Diff(a, b []byte) ([]Difference, error) {
+	return DiffWithOptions(a, b, DiffOptions{})
+}
+
+// DiffWithOptions parses two HL7 messages with ParseGeneric and compares
+// them like DiffGeneric.
+func DiffWithOptions(a, b []byte, opts DiffOptions) ([]Difference, error) {
+	ma, err := ParseGeneric(a)
+	if err != nil {
+		return nil, err
+	}
+	mb, err := ParseGeneric(b)
+	if err != nil {
+		return nil, err
+	}
+	return DiffGeneric(ma, mb, opts), nil
+}
+
+// DiffGeneric compares two generic messages and returns their differences
+// in segment order. Segments are compared by name, in the order the names
+// first appear in a, then in b.
+func DiffGeneric(a, b *GenericMessage, opts DiffOptions) []Difference {
+	d := differ{opts: opts, oa: a.Delimiters(), ob: b.Delimiters()}
+
+	var names []string
+	for _, m := range []*GenericMessage{a, b} {
+		for _, seg := range m.Segments {
+			if !slices.Contains(names, seg.Name) {
+				names = append(names, seg.Name)
+			}
+		}
+	}
+	for _, name := range names {
+		d.segments(name, occurrences(a, name), occurrences(b, name))
+	}
+	return d.diffs
+}
+
+// occurrences returns the segments of m named name.
+func occurrences(m *GenericMessage, name string) []*GenericSegment {
+	var segs []*GenericSegment
+	for i := range m.Segments {
+		if m.Segments[i].Name == name {
+			segs = append(segs, &m.Segments[i])
+		}
+	}
+	return segs
+}
+
+type differ struct {
+	opts   DiffOptions
+	oa, ob MarshalOptions
+	diffs  []Difference
+}
+
+// segments pairs and compares the occurrences of one segment.
+func (d *differ) segments(name string, as, bs []*GenericSegment) {
+	multiple := len(as) > 1 || len(bs) > 1
+	occurrence := func(i int) int {
+		if multiple {
+			return i + 1
+		}
+		return 0
+	}
+
+	// pairs[i] is the index in bs matched with as[i], or -1.
+	pairs := make([]int, len(as))
+	matched := make([]bool, len(bs))
+	key, byKey := d.opts.Keys[name]
+	for i := range as {
+		pairs[i] = -1
+		if !byKey {
+			if i < len(bs) {
+				pairs[i], matched[i] = i, true
+			}
+			continue
+		}
+		k := d.oa.Unescape(as[i].Value(key, d.oa))
+		for j := range bs {
+			if !matched[j] && d.ob.Unescape(bs[j].Value(key, d.ob)) == k {
+				pairs[i], matched[j] = j, true
+				break
+			}
+		}
+	}
+
+	for i, j := range pairs {
+		at := Path{Segment: name, Occurrence: occurrence(i)}
+		if j < 0 {
+			d.add(at, i+1, DiffRemoved, segmentText(as[i], d.oa), "")
+			continue
+		}
+		d.fields(at, i+1, as[i], bs[j])
+	}
+	for j, ok := range matched {
+		if !ok {
+			at := Path{Segment: name, Occurrence: occurrence(j)}
+			d.add(at, j+1, DiffAdded, "", segmentText(bs[j], d.ob))
+		}
+	}
+}
+
+// segmentText returns the HL7 text of one segment.
+func segmentText(seg *GenericSegment, opts MarshalOptions) string {
+	var b strings.Builder
+	if err := writeGenericSegment(&b, seg, opts); err != nil {
+		return seg.Name
+	}
+	return b.String()
+}
+
+// fields compares two matched segments field by field.
+func (d *differ) fields(at Path, occurrence int, a, b *GenericSegment) {
+	maxIndex := 0
+	for _, seg := range []*GenericSegment{a, b} {
+		for _, f := range seg.Fields {
+			maxIndex = max(maxIndex, f.Index)
+		}
+	}
+
+	for field := 1; field <= maxIndex; field++ {
+		at.Field = field
+		va := a.Value(FieldPath{Field: field}, d.oa)
+		vb := b.Value(FieldPath{Field: field}, d.ob)
+		if a.Name == "MSH" && field <= 2 {
+			if va != vb {
+				d.add(at, occurrence, kindOf(va, vb), va, vb)
+			}
+			continue
+		}
+		d.repetitions(at, occurrence, va, vb)
+	}
+}
+
+// repetitions compares two raw field values, down to their subcomponents.
+func (d *differ) repetitions(at Path, occurrence int, va, vb string) {
+	ra := strings.Split(va, string(d.oa.RepetitionSeparator))
+	rb := strings.Split(vb, string(d.ob.RepetitionSeparator))
+	multiple := len(ra) > 1 || len(rb) > 1
+
+	for r := range max(len(ra), len(rb)) {
+		a, b := part(ra, r), part(rb, r)
+		ca := strings.Split(a, string(d.oa.ComponentSeparator))
+		cb := strings.Split(b, string(d.ob.ComponentSeparator))
+
+		rep := at
+		if multiple {
+			rep.Repetition = r + 1
+		}
+		for c := range max(len(ca), len(cb)) {
+			comp := rep
+			if len(ca) > 1 || len(cb) > 1 {
+				comp.Component = c + 1
+			}
+			d.subcomponents(comp, occurrence, r+1, part(ca, c), part(cb, c))
+		}
+	}
+}
+
+// subcomponents compares two raw component values.
+func (d *differ) subcomponents(at Path, occurrence, repetition int, a, b string) {
+	sa := strings.Split(a, string(d.oa.SubcomponentSeparator))
+	sb := strings.Split(b, string(d.ob.SubcomponentSeparator))
+	if len(sa) == 1 && len(sb) == 1 {
+		d.value(at, occurrence, repetition, a, b)
+		return
+	}
+	for i := range max(len(sa), len(sb)) {
+		sub := at
+		sub.Component = max(at.Component, 1)
+		sub.Subcomponent = i + 1
+		d.value(sub, occurrence, repetition, part(sa, i), part(sb, i))
+	}
+}
+
+// part returns parts[i], or "" when there is no such part.
+func part(parts []string, i int) string {
+	if i < len(parts) {
+		return parts[i]
+	}
+	return ""
+}
+
+// value records a difference between two raw leaf values.
+func (d *differ) value(at Path, occurrence, repetition int, a, b string) {
+	a, b = d.oa.Unescape(a), d.ob.Unescape(b)
+	if a != b && !d.ignored(at, occurrence, repetition) {
+		d.diffs = append(d.diffs, Difference{Path: at, Kind: kindOf(a, b), Old: a, New: b})
+	}
+}
+
+// add records a difference that is not a leaf value.
+func (d *differ) add(at Path, occurrence int, kind DiffKind, a, b string) {
+	if !d.ignored(at, occurrence, 0) {
+		d.diffs = append(d.diffs, Difference{Path: at, Kind: kind, Old: a, New: b})
+	}
+}
+
+func kindOf(a, b string) DiffKind {
+	switch {
+	case a == "":
+		return DiffAdded
+	case b == "":
+		return DiffRemoved
+	default:
+		return DiffChanged
+	}
+}
+
+// ignored reports whether a difference at the given location matches one of
+// the ignored paths. occurrence and repetition are the actual 1-based
+// numbers, which at may omit.
+func (d *differ) ignored(at Path, occurrence, repetition int) bool {
+	// A value without components is its own first component, and a
+	// component without subcomponents its own first subcomponent.
+	component := max(at.Component, 1)
+	subcomponent := max(at.Subcomponent, 1)
+	for _, p := range d.opts.Ignore {
+		switch {
+		case p.Segment != at.Segment,
+			p.Occurrence > 0 && p.Occurrence != occurrence,
+			p.Field > 0 && p.Field != at.Field,
+			p.Repetition > 0 && p.Repetition != repetition,
+			p.Component > 0 && p.Component != component,
+			p.Subcomponent > 0 && p.Subcomponent != subcomponent:
+			continue
+		}
+		return true
+	}
+	return false
+}
@@ -0,0 +1,128 @@
+package hl7_test
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/esequiel378/hl7"
+)
+
+const diffBefore = "MSH|^~\\&|LAB|GHH|||20250301083000||ORU^R01|1|P|2.5\r" +
+	"PID|1||123^^^HOSP~456^^^SSA||DOE^JOHN||19800101\r" +
+	"OBX|1|NM|WBC||7.2\r" +
+	"OBX|2|NM|HGB||13.5\r" +
+	"NTE|1||O\\T\\K"
+
+const diffAfter = "MSH|^~\\&|LAB|GHH|||20250301090000||ORU^R01|2|P|2.5\r" +
+	"PID|1||123^^^HOSP~789^^^SSA||DOE^JON||19800101|M\r" +
+	"OBX|1|NM|HGB||13.9\r" +
+	"OBX|2|NM|WBC||7.2\r" +
+	"OBX|3|NM|PLT||250\r" +
+	"NTE|1||O&K"
+
+func diffStrings(diffs []hl7.Difference) string {
+	lines := make([]string, len(diffs))
+	for i, d := range diffs {
+		lines[i] = d.String()
+	}
+	return strings.Join(lines, "\n")
+}
+
+func TestDiff(t *testing.T) {
+	diffs, err := hl7.Diff([]byte(diffBefore), []byte(diffBefore))
+	if err != nil || len(diffs) != 0 {
+		t.Fatalf("expected no differences, got %v, %v", diffs, err)
+	}
+
+	opts := hl7.DiffOptions{Ignore: []hl7.Path{{Segment: "MSH", FieldPath: hl7.FieldPath{Field: 7}}, {Segment: "MSH", FieldPath: hl7.FieldPath{Field: 10}}}}
+	diffs, err = hl7.DiffWithOptions([]byte(diffBefore), []byte(diffAfter), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := strings.Join([]string{
+		`PID-3[2].1: "456" → "789"`,
+		`PID-5.2: "JOHN" → "JON"`,
+		`PID-8: added "M"`,
+		`OBX[1]-3: "WBC" → "HGB"`,
+		`OBX[1]-5: "7.2" → "13.9"`,
+		`OBX[2]-3: "HGB" → "WBC"`,
+		`OBX[2]-5: "13.5" → "7.2"`,
+		`OBX[3]: added "OBX|3|NM|PLT||250"`,
+		`NTE-3.1.1: "O&K" → "O"`,
+		`NTE-3.1.2: added "K"`,
+	}, "\n")
+	if got := diffStrings(diffs); got != want {
+		t.Errorf("unexpected differences:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestDiffByKey(t *testing.T) {
+	opts := hl7.DiffOptions{
+		Ignore: []hl7.Path{{Segment: "MSH"}, {Segment: "PID"}, {Segment: "NTE"}},
+		Keys:   map[string]hl7.FieldPath{"OBX": {Field: 3}},
+	}
+	diffs, err := hl7.DiffWithOptions([]byte(diffBefore), []byte(diffAfter), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := strings.Join([]string{
+		`OBX[1]-1: "1" → "2"`,
+		`OBX[2]-1: "2" → "1"`,
+		`OBX[2]-5: "13.5" → "13.9"`,
+		`OBX[3]: added "OBX|3|NM|PLT||250"`,
+	}, "\n")
+	if got := diffStrings(diffs); got != want {
+		t.Errorf("unexpected differences:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestDiffIgnoreSubcomponent(t *testing.T) {
+	a := "MSH|^~\\&|A\rPID|1||1^^^H&1.2&ISO\rNTE|1||x"
+	b := "MSH|^~\\&|A\rPID|1||1^^^H&1.3&DNS\rNTE|1||y"
+	var ignore []hl7.Path
+	for _, s := range []string{"PID-3.4.2", "NTE"} {
+		p, err := hl7.ParsePath(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ignore = append(ignore, p)
+	}
+	diffs, err := hl7.DiffWithOptions([]byte(a), []byte(b), hl7.DiffOptions{Ignore: ignore})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := diffStrings(diffs), `PID-3.4.3: "ISO" → "DNS"`; got != want {
+		t.Errorf("unexpected differences:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestDiffEscapesAndJSON(t *testing.T) {
+	a := "MSH|^~\\&|A\rNTE|1||O&K\\F\\X"
+	b := "MSH#*@!%#A\rNTE#1##O%K|X"
+	diffs, err := hl7.Diff([]byte(a), []byte(b))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(diffs) != 2 || diffs[0].Path.String() != "MSH-1" || diffs[1].Path.String() != "MSH-2" {
+		t.Errorf("expected only the delimiters to differ, got:\n%s", diffStrings(diffs))
+	}
+
+	diffs, err = hl7.Diff([]byte(a), []byte("MSH|^~\\&|A\rNTE|1||O&Q\\F\\X"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := diffStrings(diffs); got != `NTE-3.1.2: "K|X" → "Q|X"` {
+		t.Errorf("unexpected subcomponent difference %s", got)
+	}
+
+	data, err := json.Marshal(hl7.Difference{Path: hl7.Path{Segment: "PID", FieldPath: hl7.FieldPath{Field: 5, Component: 2}}, Kind: hl7.DiffChanged, Old: "JOHN", New: "JON"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `{"path":"PID-5.2","kind":"changed","old":"JOHN","new":"JON"}`; string(data) != want {
+		t.Errorf("expected %s, got %s", want, data)
+	}
+}
@@ -29,6 +29,32 @@
 //
 //	msg, _ := hl7.ParseGeneric(data)
 //
+// Use [View] for high-throughput routing when only a few fields are read;
+// it indexes the raw bytes lazily and returns subslices without copying:
+//
+//	v := hl7.NewView(data)
+//	mrn := v.Segment("PID", 1).Field(3).Rep(1).Comp(1).Bytes()
+//
+// [MarshalGeneric] writes a GenericMessage back with its raw values, so
+// tools can edit a message without disturbing the fields they do not touch;
+// the deid subpackage builds de-identification on top of it, the fhir
+// subpackage converts messages into FHIR R4 bundles, and
+// [Transform] runs declarative JSON [Mapping] rules that translate one
+// vendor's layout into another's. [Compile] parses filter expressions such
+// as `MSH-9.1 = "ORU" AND OBR-4.1 IN ("CBC","BMP")` for content-based
+// routing, [Diff] reports the values that differ between two messages, and
+// [Idempotency] detects retransmitted messages.
+// [MarshalXML] and [UnmarshalXML] convert messages to and from HL7 v2.xml.
+// [NewMessage] builds an outbound message one segment at a time, without a
+// struct or schema, and [MarshalOptions] can fill in empty MSH fields such
+// as the control ID, from a [ControlIDGenerator], and the message time.
+// The mllp subpackage exchanges messages over TCP, and the queue subpackage
+// stores outbound messages on disk until they are acknowledged.
+//
+// For hot paths, `hl7 gen-codec` generates [MessageUnmarshaler] and
+// [MessageMarshaler] implementations that Unmarshal and Marshal use instead
+// of reflection. [VerifyCodec] checks them against the reflection path.
+//
 // # Features
 //
 // The library has zero external dependencies, supports every HL7 v2.x
@@ -60,13 +86,15 @@
 //
 // # Behavior
 //
-//   - Unknown segments are ignored during unmarshaling.
+//   - Unknown segments are ignored during unmarshaling, unless a [Decoder] sets DisallowUnknownSegments.
 //   - Missing or out-of-bounds fields are treated as optional and skipped, leaving zero values in the destination struct.
 //   - Subcomponents ('&') are not yet parsed into separate structures.
 //
 // # Error Handling
 //
-//   - [FieldError] provides context about which segment and field caused an error.
+//   - [FieldError] provides context about which segment occurrence, field, repetition and
+//     component caused an error, with its line and byte offset in the message.
+//   - [SegmentError] and [ParseError] locate problems with whole segments and lines.
 //   - Use errors.As to extract field-level error information.
 //
 // See the README for comprehensive examples and usage patterns.
@@ -4,7 +4,6 @@ import (
 	"errors"
 	"fmt"
 	"reflect"
-	"strconv"
 )
 
 var (
@@ -37,20 +36,16 @@ var (
 func setFieldValue(field reflect.Value, value string) error {
 	switch field.Kind() {
 	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
-		bitSize := intBitSizes[field.Kind()]
-
-		intVal, err := strconv.ParseInt(value, 10, bitSize)
+		intVal, err := DecodeInt(value, intBitSizes[field.Kind()])
 		if err != nil {
-			return fmt.Errorf("%w: %v", ErrInvalidIntValue, err)
+			return err
 		}
 		field.SetInt(intVal)
 
 	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
-		bitSize := uintBitSizes[field.Kind()]
-
-		uintVal, err := strconv.ParseUint(value, 10, bitSize)
+		uintVal, err := DecodeUint(value, uintBitSizes[field.Kind()])
 		if err != nil {
-			return fmt.Errorf("%w: %v", ErrInvalidUintValue, err)
+			return err
 		}
 		field.SetUint(uintVal)
 
@@ -63,9 +58,9 @@ func setFieldValue(field reflect.Value, value string) error {
 			return 64
 		}()
 
-		floatVal, err := strconv.ParseFloat(value, bitSize)
+		floatVal, err := DecodeFloat(value, bitSize)
 		if err != nil {
-			return fmt.Errorf("%w: %v", ErrInvalidFloatValue, err)
+			return err
 		}
 		field.SetFloat(floatVal)
 
@@ -73,9 +68,9 @@ func setFieldValue(field reflect.Value, value string) error {
 		field.SetString(value)
 
 	case reflect.Bool:
-		boolVal, err := strconv.ParseBool(value)
+		boolVal, err := DecodeBool(value)
 		if err != nil {
-			return fmt.Errorf("%w: %v", ErrInvalidBooleanValue, err)
+			return err
 		}
 		field.SetBool(boolVal)
 
@@ -4,6 +4,7 @@ import (
 	"errors"
 	"fmt"
 	"reflect"
+	"strings"
 )
 
 var (
@@ -31,26 +32,134 @@ func (e InvalidMessageParserError) Error() string {
 // It provides context about which segment and field caused the error, making debugging
 // in production healthcare systems significantly easier.
 type FieldError struct {
-	Segment   string // The segment name (e.g., "PID", "MSH")
-	Field     int    // The 1-based field index
-	Component int    // The 1-based component index (0 if not applicable)
-	Value     string // The raw value that caused the error
-	Err       error  // The underlying error
+	Segment      string // The segment name (e.g., "PID", "MSH")
+	Occurrence   int    // The 1-based occurrence of the segment in the message (0 if unknown)
+	Field        int    // The 1-based field index
+	Repetition   int    // The 1-based repetition index (0 if not applicable)
+	Component    int    // The 1-based component index (0 if not applicable)
+	Subcomponent int    // The 1-based subcomponent index (0 if not applicable)
+	Line         int    // The 1-based line of the segment in the message (0 if unknown)
+	Offset       int    // The byte offset of the value in the message (valid if Line > 0)
+	Value        string // The raw value that caused the error
+	Err          error  // The underlying error
+
+	// Redaction controls how Error and LogValue show Value.
+	Redaction Redaction
 }
 
 func (e *FieldError) Error() string {
+	var b strings.Builder
+	b.WriteString("hl7: ")
+	writeSegmentRef(&b, e.Segment, e.Occurrence)
+	fmt.Fprintf(&b, ".%d", e.Field)
+	if e.Repetition > 0 {
+		fmt.Fprintf(&b, "[%d]", e.Repetition)
+	}
 	if e.Component > 0 {
-		return fmt.Sprintf("hl7: %s.%d.%d: %v (value=%q)",
-			e.Segment, e.Field, e.Component, e.Err, e.Value)
+		fmt.Fprintf(&b, ".%d", e.Component)
+	}
+	if e.Subcomponent > 0 {
+		fmt.Fprintf(&b, ".%d", e.Subcomponent)
+	}
+	fmt.Fprintf(&b, ": %s (value=%s", e.Redaction.scrub(e.Err, e.Value), e.Redaction.value(e.Value))
+	if e.Line > 0 {
+		fmt.Fprintf(&b, ", line %d, offset %d", e.Line, e.Offset)
 	}
-	return fmt.Sprintf("hl7: %s.%d: %v (value=%q)",
-		e.Segment, e.Field, e.Err, e.Value)
+	b.WriteString(")")
+	return b.String()
 }
 
 func (e *FieldError) Unwrap() error {
 	return e.Err
 }
 
+// writeSegmentRef writes a segment name, followed by its occurrence in
+// brackets when the segment repeats (e.g., "OBX[3]").
+func writeSegmentRef(b *strings.Builder, segment string, occurrence int) {
+	b.WriteString(segment)
+	if occurrence > 1 {
+		fmt.Fprintf(b, "[%d]", occurrence)
+	}
+}
+
+// SegmentError represents an error concerning a whole segment, such as a
+// segment the decoding target does not map.
+type SegmentError struct {
+	Segment    string // The segment name
+	Occurrence int    // The 1-based occurrence of the segment in the message
+	Line       int    // The 1-based line of the segment in the message
+	Offset     int    // The byte offset of the segment in the message
+	Err        error  // The underlying error
+}
+
+func (e *SegmentError) Error() string {
+	var b strings.Builder
+	b.WriteString("hl7: ")
+	writeSegmentRef(&b, e.Segment, e.Occurrence)
+	fmt.Fprintf(&b, ": %v (line %d, offset %d)", e.Err, e.Line, e.Offset)
+	return b.String()
+}
+
+func (e *SegmentError) Unwrap() error {
+	return e.Err
+}
+
+// ParseError represents a line of the message that could not be split into
+// a segment.
+type ParseError struct {
+	Line   int    // The 1-based line in the message
+	Offset int    // The byte offset of the line in the message
+	Text   string // The offending line
+	Err    error  // The underlying error
+
+	// Redaction controls how Error and LogValue show Text.
+	Redaction Redaction
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("hl7: line %d (offset %d): %s (text=%s)",
+		e.Line, e.Offset, e.Redaction.scrub(e.Err, e.Text), e.Redaction.value(e.Text))
+}
+
+func (e *ParseError) Unwrap() error {
+	return e.Err
+}
+
+// FieldPath locates a value within a segment: a field, optionally narrowed
+// to one repetition, component and subcomponent. Zero means "not
+// applicable" for every part except Field. It is part of the support API
+// for generated codecs.
+type FieldPath struct {
+	Field        int
+	Repetition   int
+	Component    int
+	Subcomponent int
+}
+
+// Child returns the path of the value with the given 1-based index one
+// nesting level below p. Level 0 indexes fields, level 1 components and
+// deeper levels subcomponents, matching how struct tags are resolved.
+func (p FieldPath) Child(level uint, index int) FieldPath {
+	switch level {
+	case 0:
+		return FieldPath{Field: index}
+	case 1:
+		p.Component = index
+	default:
+		p.Subcomponent = index
+	}
+	return p
+}
+
+// Repeat returns p narrowed to the given 1-based repetition. Only fields
+// repeat, so paths below level 0 are returned unchanged.
+func (p FieldPath) Repeat(level uint, repetition int) FieldPath {
+	if level == 0 {
+		p.Repetition = repetition
+	}
+	return p
+}
+
 // SchemaError represents an error in schema definition or validation.
 type SchemaError struct {
 	Path string // The schema path that caused the error (e.g., "segments.PID.fields.3")
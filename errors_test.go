@@ -0,0 +1,151 @@
+package hl7_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/esequiel378/hl7"
+)
+
+const locationMessage = "MSH|^~\\&|LAB|GHH|||20250301083000||ORU^R01|1|P|2.5\r\n" +
+	"PID|1||123^^^HOSP~abc^^^MRN||DOE^JOHN\r\n" +
+	"OBX|1|NM|GLU||182|mg/dL\r\n" +
+	"OBX|2|NM|HGB||13.5|g/dL\r\n" +
+	"OBX|3|NM|WBC||high|10*3/uL\r\n"
+
+// checkFieldError checks the location of a FieldError and that its offset
+// points at the offending value.
+func checkFieldError(t *testing.T, err error, want hl7.FieldError) {
+	t.Helper()
+
+	var fe *hl7.FieldError
+	if !errors.As(err, &fe) {
+		t.Fatalf("expected FieldError, got %v", err)
+	}
+	got := *fe
+	got.Err, got.Offset = nil, 0
+	want.Err, want.Offset = nil, 0
+	if got != want {
+		t.Errorf("expected location %+v, got %+v", want, got)
+	}
+	if !strings.HasPrefix(locationMessage[fe.Offset:], fe.Value) {
+		t.Errorf("offset %d points at %q, expected value %q", fe.Offset, locationMessage[fe.Offset:], fe.Value)
+	}
+}
+
+func TestFieldErrorSegmentOccurrence(t *testing.T) {
+	type OBX struct {
+		SetID int `hl7:"1"`
+		Value int `hl7:"5"`
+	}
+	type Message struct {
+		OBX OBX `hl7:"segment:OBX"`
+	}
+
+	var msg Message
+	err := hl7.Unmarshal([]byte(locationMessage), &msg)
+	checkFieldError(t, err, hl7.FieldError{Segment: "OBX", Occurrence: 2, Field: 5, Line: 4, Value: "13.5"})
+}
+
+func TestFieldErrorRepetitionAndComponent(t *testing.T) {
+	type Identifier struct {
+		ID        int    `hl7:"1"`
+		Authority string `hl7:"4"`
+	}
+	type PID struct {
+		Identifiers []Identifier `hl7:"3"`
+	}
+	type Message struct {
+		PID PID `hl7:"segment:PID"`
+	}
+
+	var msg Message
+	err := hl7.Unmarshal([]byte(locationMessage), &msg)
+	checkFieldError(t, err, hl7.FieldError{Segment: "PID", Occurrence: 1, Field: 3, Repetition: 2, Component: 1, Line: 2, Value: "abc"})
+
+	want := `hl7: PID.3[2].1: hl7: invalid int value: strconv.ParseInt: parsing "abc": invalid syntax (value="abc", line 2, offset 70)`
+	if err.Error() != want {
+		t.Errorf("expected %s, got %s", want, err)
+	}
+}
+
+func TestFieldErrorSchemaLocation(t *testing.T) {
+	schema, err := hl7.ParseSchema([]byte(`{
+		"segments": {
+			"PID": {
+				"fields": {
+					"identifiers": {
+						"index": 3, "type": "array",
+						"items": { "type": "object", "components": { "id": { "index": 1, "type": "int" } } }
+					}
+				}
+			}
+		}
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = hl7.UnmarshalWithSchema([]byte(locationMessage), schema)
+	checkFieldError(t, err, hl7.FieldError{Segment: "PID", Occurrence: 1, Field: 3, Repetition: 2, Component: 1, Line: 2, Value: "abc"})
+}
+
+func TestFieldErrorSchemaRepeatedSegment(t *testing.T) {
+	schema, err := hl7.ParseSchema([]byte(`{
+		"segments": {
+			"OBX": { "repeat": true, "fields": { "value": { "index": 5, "type": "float" } } }
+		}
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = hl7.UnmarshalWithSchema([]byte(locationMessage), schema)
+	checkFieldError(t, err, hl7.FieldError{Segment: "OBX", Occurrence: 3, Field: 5, Line: 5, Value: "high"})
+	if !strings.Contains(err.Error(), "OBX[3].5") {
+		t.Errorf("expected occurrence in message, got %s", err)
+	}
+}
+
+func TestParseErrorLocation(t *testing.T) {
+	data := "MSH|^~\\&|App\r\nPID|1\r\n|broken\r\n"
+
+	_, err := hl7.ParseGeneric([]byte(data))
+	var pe *hl7.ParseError
+	if !errors.As(err, &pe) {
+		t.Fatalf("expected ParseError, got %v", err)
+	}
+	if pe.Line != 3 || pe.Offset != 21 || pe.Text != "|broken" {
+		t.Errorf("unexpected location %+v", pe)
+	}
+	if !errors.Is(err, hl7.ErrSegmentInvalid) {
+		t.Errorf("expected ErrSegmentInvalid, got %v", err)
+	}
+}
+
+func TestSegmentErrorLocation(t *testing.T) {
+	type Message struct {
+		MSH struct {
+			ControlID string `hl7:"10"`
+		} `hl7:"segment:MSH"`
+		OBX struct {
+			SetID string `hl7:"1"`
+		} `hl7:"segment:OBX"`
+	}
+
+	opts := hl7.DecodeOptions{DisallowUnknownSegments: true}
+	var msg Message
+	err := hl7.NewDecoderWithOptions(strings.NewReader(locationMessage), opts).Decode(&msg)
+
+	var se *hl7.SegmentError
+	if !errors.As(err, &se) {
+		t.Fatalf("expected SegmentError, got %v", err)
+	}
+	if se.Segment != "PID" || se.Occurrence != 1 || se.Line != 2 {
+		t.Errorf("unexpected location %+v", se)
+	}
+	if !errors.Is(err, hl7.ErrSegmentUnknown) {
+		t.Errorf("expected ErrSegmentUnknown, got %v", err)
+	}
+}
@@ -0,0 +1,92 @@
+package hl7
+
+import "strings"
+
+// Escape returns s with the delimiters of opts replaced by HL7 escape
+// sequences: \F\ for the field separator, \S\ for the component separator,
+// \R\ for the repetition separator, \T\ for the subcomponent separator and
+// \E\ for the escape character itself (shown with the default \).
+func (opts MarshalOptions) Escape(s string) string {
+	esc := opts.EscapeCharacter
+	if esc == 0 || !strings.ContainsAny(s, opts.delimiters()) {
+		return s
+	}
+
+	var b strings.Builder
+	b.Grow(len(s) + 8)
+	for i := 0; i < len(s); i++ {
+		var code byte
+		switch s[i] {
+		case esc:
+			code = 'E'
+		case opts.FieldSeparator:
+			code = 'F'
+		case opts.ComponentSeparator:
+			code = 'S'
+		case opts.RepetitionSeparator:
+			code = 'R'
+		case opts.SubcomponentSeparator:
+			code = 'T'
+		default:
+			b.WriteByte(s[i])
+			continue
+		}
+		b.WriteByte(esc)
+		b.WriteByte(code)
+		b.WriteByte(esc)
+	}
+	return b.String()
+}
+
+// Unescape reverses Escape. Escape sequences other than \F\, \S\, \R\, \T\
+// and \E\, such as formatting (\.br\) or hexadecimal (\X0D\) sequences, are
+// kept verbatim.
+func (opts MarshalOptions) Unescape(s string) string {
+	esc := opts.EscapeCharacter
+	if esc == 0 || strings.IndexByte(s, esc) < 0 {
+		return s
+	}
+
+	var b strings.Builder
+	b.Grow(len(s))
+	for {
+		i := strings.IndexByte(s, esc)
+		if i < 0 {
+			break
+		}
+		j := strings.IndexByte(s[i+1:], esc)
+		if j < 0 {
+			break
+		}
+		b.WriteString(s[:i])
+		seq := s[i+1 : i+1+j]
+		switch seq {
+		case "F":
+			b.WriteByte(opts.FieldSeparator)
+		case "S":
+			b.WriteByte(opts.ComponentSeparator)
+		case "R":
+			b.WriteByte(opts.RepetitionSeparator)
+		case "T":
+			b.WriteByte(opts.SubcomponentSeparator)
+		case "E":
+			b.WriteByte(esc)
+		default:
+			b.WriteString(s[i : i+j+2])
+		}
+		s = s[i+j+2:]
+	}
+	b.WriteString(s)
+	return b.String()
+}
+
+// delimiters returns the characters Escape replaces.
+func (opts MarshalOptions) delimiters() string {
+	return string([]byte{
+		opts.FieldSeparator,
+		opts.ComponentSeparator,
+		opts.RepetitionSeparator,
+		opts.EscapeCharacter,
+		opts.SubcomponentSeparator,
+	})
+}
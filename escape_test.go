@@ -0,0 +1,39 @@
+package hl7_test
+
+import (
+	"testing"
+
+	"github.com/esequiel378/hl7"
+)
+
+func TestEscape(t *testing.T) {
+	opts := hl7.DefaultMarshalOptions()
+
+	tests := []struct {
+		value, escaped string
+	}{
+		{"plain", "plain"},
+		{"A|B", `A\F\B`},
+		{"Smith^John", `Smith\S\John`},
+		{"a~b&c", `a\R\b\T\c`},
+		{`C:\temp`, `C:\E\temp`},
+	}
+	for _, tt := range tests {
+		if got := opts.Escape(tt.value); got != tt.escaped {
+			t.Errorf("Escape(%q) = %q, want %q", tt.value, got, tt.escaped)
+		}
+		if got := opts.Unescape(tt.escaped); got != tt.value {
+			t.Errorf("Unescape(%q) = %q, want %q", tt.escaped, got, tt.value)
+		}
+	}
+}
+
+func TestUnescapeKeepsOtherSequences(t *testing.T) {
+	opts := hl7.DefaultMarshalOptions()
+
+	for _, s := range []string{`line\.br\next`, `\X0D\`, `\H\bold\N\`, `trailing\`} {
+		if got := opts.Unescape(s); got != s {
+			t.Errorf("Unescape(%q) = %q, want it unchanged", s, got)
+		}
+	}
+}
@@ -0,0 +1,242 @@
+package fhir
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"strconv"
+	"strings"
+
+	"github.com/esequiel378/hl7"
+)
+
+// A SegmentMapper converts one segment, adding resources to the bundle of b
+// or filling in those added by earlier segments.
+type SegmentMapper func(b *Builder, seg Segment) error
+
+// A Segment is a segment of the message being converted.
+type Segment struct {
+	seg  *hl7.GenericSegment
+	opts hl7.MarshalOptions
+}
+
+// Name returns the segment name, e.g. "PID".
+func (s Segment) Name() string { return s.seg.Name }
+
+// Field returns the repetitions of the field with the given 1-based index,
+// or nil when the field is empty.
+func (s Segment) Field(index int) []Value {
+	for _, f := range s.seg.Fields {
+		if f.Index != index || f.Value == "" {
+			continue
+		}
+		if s.seg.Name == "MSH" && index <= 2 {
+			return []Value{{raw: f.Value, depth: 2, opts: s.opts}}
+		}
+		var vs []Value
+		for _, rep := range strings.Split(f.Value, string(s.opts.RepetitionSeparator)) {
+			vs = append(vs, Value{raw: rep, opts: s.opts})
+		}
+		return vs
+	}
+	return nil
+}
+
+// Get returns the first repetition of the field with the given 1-based
+// index.
+func (s Segment) Get(index int) Value {
+	if vs := s.Field(index); len(vs) > 0 {
+		return vs[0]
+	}
+	return Value{opts: s.opts}
+}
+
+// A Value is one repetition of a field, or a component or subcomponent of
+// one. The zero Value is empty.
+type Value struct {
+	raw   string
+	depth int // 0 for a repetition, 1 for a component, 2 for a subcomponent
+	opts  hl7.MarshalOptions
+}
+
+// Component returns the component with the given 1-based index of a field
+// value, or the subcomponent of a component value. The first component of a
+// subcomponent is the subcomponent itself.
+func (v Value) Component(index int) Value {
+	c := Value{depth: v.depth + 1, opts: v.opts}
+	if v.depth >= 2 {
+		if index == 1 {
+			c.raw = v.raw
+		}
+		return c
+	}
+	sep := v.opts.ComponentSeparator
+	if v.depth == 1 {
+		sep = v.opts.SubcomponentSeparator
+	}
+	parts := strings.Split(v.raw, string(sep))
+	if index >= 1 && index <= len(parts) {
+		c.raw = parts[index-1]
+	}
+	return c
+}
+
+// String returns the unescaped value.
+func (v Value) String() string {
+	if v.raw == "" {
+		return ""
+	}
+	return v.opts.Unescape(v.raw)
+}
+
+// Empty reports whether the value is empty.
+func (v Value) Empty() bool { return v.raw == "" }
+
+// A Builder collects the resources converted from one message. Mappers use
+// it to add resources, to find those added by earlier segments and to
+// convert HL7 data types.
+type Builder struct {
+	c       *Converter
+	msg     *hl7.GenericMessage
+	opts    hl7.MarshalOptions
+	bundle  *Bundle
+	seed    string
+	counts  map[string]int
+	doctors map[string]*Reference
+
+	patient      *Patient
+	encounter    *Encounter
+	report       *DiagnosticReport
+	immunization *Immunization
+}
+
+func newBuilder(c *Converter, msg *hl7.GenericMessage) (*Builder, error) {
+	data, err := hl7.MarshalGeneric(msg)
+	if err != nil {
+		return nil, err
+	}
+	sum := sha1.Sum(data)
+	return &Builder{
+		c:       c,
+		msg:     msg,
+		opts:    msg.Delimiters(),
+		bundle:  &Bundle{ResourceType: "Bundle", Type: "collection"},
+		seed:    hex.EncodeToString(sum[:]),
+		counts:  make(map[string]int),
+		doctors: make(map[string]*Reference),
+	}, nil
+}
+
+// Message returns the message being converted.
+func (b *Builder) Message() *hl7.GenericMessage { return b.msg }
+
+// Bundle returns the bundle being built.
+func (b *Builder) Bundle() *Bundle { return b.bundle }
+
+// Add assigns an ID to r, which must have its ResourceType set, appends it
+// to the bundle and returns a reference to it. The first Patient and
+// Encounter added become those returned by Patient and Encounter, and a
+// DiagnosticReport or Immunization starts a new group of results.
+func (b *Builder) Add(r Resource) *Reference {
+	base := r.base()
+	b.counts[base.ResourceType]++
+	base.ID = b.newID(base.ResourceType, b.counts[base.ResourceType])
+	b.bundle.Entry = append(b.bundle.Entry, BundleEntry{FullURL: "urn:uuid:" + base.ID, Resource: r})
+
+	switch r := r.(type) {
+	case *Patient:
+		if b.patient == nil {
+			b.patient = r
+		}
+	case *Encounter:
+		if b.encounter == nil {
+			b.encounter = r
+		}
+	case *DiagnosticReport:
+		b.report, b.immunization = r, nil
+	case *Immunization:
+		b.report, b.immunization = nil, r
+	}
+	return ReferenceTo(r)
+}
+
+// newID returns a UUID derived from the message and the position of the
+// resource among those of its type, formatted like a version 5 UUID.
+func (b *Builder) newID(resourceType string, n int) string {
+	sum := sha1.Sum([]byte(b.seed + "/" + resourceType + "/" + strconv.Itoa(n)))
+	sum[6] = sum[6]&0x0f | 0x50
+	sum[8] = sum[8]&0x3f | 0x80
+	h := hex.EncodeToString(sum[:16])
+	return h[:8] + "-" + h[8:12] + "-" + h[12:16] + "-" + h[16:20] + "-" + h[20:]
+}
+
+// ReferenceTo returns a reference to a resource added to a bundle.
+func ReferenceTo(r Resource) *Reference {
+	return &Reference{Reference: "urn:uuid:" + r.base().ID}
+}
+
+// Patient returns the patient of the message, or nil before PID.
+func (b *Builder) Patient() *Patient { return b.patient }
+
+// Encounter returns the encounter of the message, or nil before PV1.
+func (b *Builder) Encounter() *Encounter { return b.encounter }
+
+// Report returns the DiagnosticReport of the current order, or nil outside
+// an OBR group.
+func (b *Builder) Report() *DiagnosticReport { return b.report }
+
+// Immunization returns the Immunization of the current order, or nil
+// outside an RXA group.
+func (b *Builder) Immunization() *Immunization { return b.immunization }
+
+// EndGroup ends the current OBR or RXA group, so that the following
+// observations are not attached to it.
+func (b *Builder) EndGroup() {
+	b.report, b.immunization = nil, nil
+}
+
+// subject returns a reference to the patient, or nil.
+func (b *Builder) subject() *Reference {
+	if b.patient == nil {
+		return nil
+	}
+	return ReferenceTo(b.patient)
+}
+
+// encounterRef returns a reference to the encounter, or nil.
+func (b *Builder) encounterRef() *Reference {
+	if b.encounter == nil {
+		return nil
+	}
+	return ReferenceTo(b.encounter)
+}
+
+// Practitioner returns a reference to the Practitioner described by an XCN
+// value, adding it to the bundle the first time it is seen. It returns nil
+// for an empty value.
+func (b *Builder) Practitioner(xcn Value) *Reference {
+	if xcn.Empty() {
+		return nil
+	}
+	if ref, ok := b.doctors[xcn.raw]; ok {
+		r := *ref
+		return &r
+	}
+	p := &Practitioner{Base: Base{ResourceType: "Practitioner"}}
+	if id := xcn.Component(1).String(); id != "" {
+		p.Identifier = []Identifier{{Value: id, System: b.assigningSystem(xcn.Component(9))}}
+	}
+	name := HumanName{
+		Family: xcn.Component(2).Component(1).String(),
+		Given:  nonEmpty(xcn.Component(3).String(), xcn.Component(4).String()),
+		Suffix: nonEmpty(xcn.Component(5).String()),
+		Prefix: nonEmpty(xcn.Component(6).String()),
+	}
+	if name.Family != "" || len(name.Given) > 0 {
+		p.Name = []HumanName{name}
+	}
+	ref := b.Add(p)
+	ref.Display = strings.Join(nonEmpty(append(name.Given, name.Family)...), " ")
+	b.doctors[xcn.raw] = ref
+	r := *ref
+	return &r
+}
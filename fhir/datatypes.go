@@ -0,0 +1,338 @@
+package fhir
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultCodeSystems returns the FHIR URIs of common HL7 coding system
+// names. Names of the form HL7nnnn map to the HL7 v2 table nnnn and OIDs map
+// to urn:oid: URIs without an entry; other names are left without a system.
+func DefaultCodeSystems() map[string]string {
+	return map[string]string{
+		"LN":     "http://loinc.org",
+		"SCT":    "http://snomed.info/sct",
+		"SNM":    "http://snomed.info/sct",
+		"CVX":    "http://hl7.org/fhir/sid/cvx",
+		"MVX":    "http://terminology.hl7.org/CodeSystem/MVX",
+		"NDC":    "http://hl7.org/fhir/sid/ndc",
+		"I10":    "http://hl7.org/fhir/sid/icd-10",
+		"I10C":   "http://hl7.org/fhir/sid/icd-10-cm",
+		"I9C":    "http://hl7.org/fhir/sid/icd-9-cm",
+		"UCUM":   "http://unitsofmeasure.org",
+		"RXNORM": "http://www.nlm.nih.gov/research/umls/rxnorm",
+		"C4":     "http://www.ama-assn.org/go/cpt",
+	}
+}
+
+// CodeSystem returns the FHIR URI of an HL7 coding system name, or "" when
+// it is unknown.
+func (b *Builder) CodeSystem(name string) string {
+	if uri, ok := b.c.codeSystems[name]; ok {
+		return uri
+	}
+	switch {
+	case len(name) > 3 && strings.HasPrefix(name, "HL7") && isDigits(name[3:]):
+		return "http://terminology.hl7.org/CodeSystem/v2-" + name[3:]
+	case strings.HasPrefix(name, "http:"), strings.HasPrefix(name, "https:"), strings.HasPrefix(name, "urn:"):
+		return name
+	case strings.Contains(name, ".") && isDigits(strings.ReplaceAll(name, ".", "")):
+		return "urn:oid:" + name
+	}
+	return ""
+}
+
+// CodeableConcept converts a CE or CWE value, with its primary and
+// alternate codes and, for CWE, its original text. It returns nil for an
+// empty value.
+func (b *Builder) CodeableConcept(ce Value) *CodeableConcept {
+	cc := &CodeableConcept{Text: ce.Component(9).String()}
+	for _, i := range []int{1, 4} {
+		code, display := ce.Component(i).String(), ce.Component(i+1).String()
+		if code == "" {
+			if cc.Text == "" {
+				cc.Text = display
+			}
+			continue
+		}
+		cc.Coding = append(cc.Coding, Coding{
+			System:  b.CodeSystem(ce.Component(i + 2).String()),
+			Code:    code,
+			Display: display,
+		})
+	}
+	if len(cc.Coding) == 0 && cc.Text == "" {
+		return nil
+	}
+	return cc
+}
+
+// codeableConcept returns a concept holding a single code, or nil for an
+// empty code.
+func codeableConcept(system, code, display string) *CodeableConcept {
+	if code == "" {
+		return nil
+	}
+	return &CodeableConcept{Coding: []Coding{{System: system, Code: code, Display: display}}}
+}
+
+// Identifier converts a CX value. The system comes from the universal ID of
+// the assigning authority (CX-4) when it has one; otherwise the namespace
+// ID is kept as the assigner's name.
+func (b *Builder) Identifier(cx Value) Identifier {
+	id := Identifier{Value: cx.Component(1).String()}
+	authority := cx.Component(4)
+	if id.System = b.assigningSystem(authority); id.System == "" {
+		if name := authority.Component(1).String(); name != "" {
+			id.Assigner = &Reference{Display: name}
+		}
+	}
+	id.Type = codeableConcept("http://terminology.hl7.org/CodeSystem/v2-0203", cx.Component(5).String(), "")
+	return id
+}
+
+// assigningSystem returns the URI of an HD assigning authority, or "".
+func (b *Builder) assigningSystem(hd Value) string {
+	id := hd.Component(2).String()
+	if id == "" {
+		return ""
+	}
+	switch hd.Component(3).String() {
+	case "ISO":
+		return "urn:oid:" + id
+	case "UUID":
+		return "urn:uuid:" + id
+	case "URI":
+		return id
+	}
+	return ""
+}
+
+// nameUses maps HL7 table 0200 name types to HumanName.use.
+var nameUses = map[string]string{
+	"A":    "usual",
+	"BAD":  "old",
+	"D":    "usual",
+	"L":    "official",
+	"M":    "maiden",
+	"N":    "nickname",
+	"S":    "anonymous",
+	"TEMP": "temp",
+}
+
+// HumanName converts an XPN value.
+func (b *Builder) HumanName(xpn Value) HumanName {
+	return HumanName{
+		Use:    nameUses[xpn.Component(7).String()],
+		Family: xpn.Component(1).Component(1).String(),
+		Given:  nonEmpty(xpn.Component(2).String(), xpn.Component(3).String()),
+		Prefix: nonEmpty(xpn.Component(5).String()),
+		Suffix: nonEmpty(xpn.Component(4).String(), xpn.Component(6).String()),
+	}
+}
+
+// addressUses maps HL7 table 0190 address types to Address.use.
+var addressUses = map[string]string{
+	"B":  "work",
+	"BA": "old",
+	"C":  "temp",
+	"H":  "home",
+	"O":  "work",
+	"P":  "home",
+}
+
+// Address converts an XAD value.
+func (b *Builder) Address(xad Value) Address {
+	a := Address{
+		Line:       nonEmpty(xad.Component(1).Component(1).String(), xad.Component(2).String()),
+		City:       xad.Component(3).String(),
+		State:      xad.Component(4).String(),
+		PostalCode: xad.Component(5).String(),
+		Country:    xad.Component(6).String(),
+		District:   xad.Component(9).String(),
+	}
+	switch t := xad.Component(7).String(); t {
+	case "M":
+		a.Type = "postal"
+	default:
+		a.Use = addressUses[t]
+	}
+	return a
+}
+
+// ContactPoint converts an XTN value. use is the ContactPoint.use of the
+// field, e.g. "home" for PID-13, for values whose use code does not say.
+func (b *Builder) ContactPoint(xtn Value, use string) ContactPoint {
+	cp := ContactPoint{Use: use}
+	switch xtn.Component(2).String() {
+	case "PRN":
+		cp.Use = "home"
+	case "WPN":
+		cp.Use = "work"
+	case "PRS":
+		cp.Use = "mobile"
+	}
+	switch xtn.Component(3).String() {
+	case "PH":
+		cp.System = "phone"
+	case "FX":
+		cp.System = "fax"
+	case "CP":
+		cp.System, cp.Use = "phone", "mobile"
+	case "BP":
+		cp.System = "pager"
+	case "Internet", "X.400":
+		cp.System = "email"
+	}
+
+	if cp.System == "email" {
+		cp.Value = xtn.Component(4).String()
+	}
+	if cp.Value == "" {
+		cp.Value = xtn.Component(1).String()
+	}
+	if cp.Value == "" {
+		var parts []string
+		if c := xtn.Component(5).String(); c != "" {
+			parts = append(parts, "+"+c)
+		}
+		if a := xtn.Component(6).String(); a != "" {
+			parts = append(parts, "("+a+")")
+		}
+		parts = append(parts, xtn.Component(7).String())
+		if x := xtn.Component(8).String(); x != "" {
+			parts = append(parts, "ext. "+x)
+		}
+		cp.Value = strings.TrimSpace(strings.Join(parts, " "))
+	}
+	if cp.System == "" && cp.Value != "" {
+		cp.System = "phone"
+		if strings.Contains(cp.Value, "@") {
+			cp.System = "email"
+		}
+	}
+	return cp
+}
+
+// DateTime converts an HL7 date or timestamp (YYYY[MM[DD[HH[MM[SS[.S]]]]]]
+// with an optional +/-ZZZZ offset) into a FHIR dateTime of the same
+// precision. Times without an offset are taken to be in Options.Location,
+// and minutes and seconds are filled in, since FHIR requires both. It
+// returns "" for a value that is not a timestamp.
+func (b *Builder) DateTime(ts string) string {
+	digits, zone := ts, ""
+	if i := strings.IndexAny(ts, "+-"); i >= 0 {
+		digits, zone = ts[:i], ts[i:]
+	}
+	digits, frac, _ := strings.Cut(digits, ".")
+	if !isDigits(digits) || (frac != "" && !isDigits(frac)) {
+		return ""
+	}
+
+	switch len(digits) {
+	case 4, 6, 8:
+		t, err := time.Parse("20060102"[:len(digits)], digits)
+		if err != nil {
+			return ""
+		}
+		return t.Format(dateLayouts[len(digits)])
+	case 10, 12, 14:
+	default:
+		return ""
+	}
+	digits += "0000"[:14-len(digits)]
+
+	loc := b.c.location
+	if zone != "" {
+		if len(zone) != 5 || !isDigits(zone[1:]) {
+			return ""
+		}
+		h, _ := strconv.Atoi(zone[1:3])
+		m, _ := strconv.Atoi(zone[3:])
+		offset := h*3600 + m*60
+		if zone[0] == '-' {
+			offset = -offset
+		}
+		loc = time.FixedZone("", offset)
+	}
+	t, err := time.ParseInLocation("20060102150405", digits, loc)
+	if err != nil {
+		return ""
+	}
+	s := t.Format("2006-01-02T15:04:05")
+	if frac != "" {
+		s += "." + frac
+	}
+	return s + t.Format("Z07:00")
+}
+
+// dateLayouts are the FHIR date layouts for HL7 dates of each length.
+var dateLayouts = map[int]string{4: "2006", 6: "2006-01", 8: "2006-01-02"}
+
+// Date converts the date part of an HL7 date or timestamp into a FHIR date.
+func (b *Builder) Date(ts string) string {
+	dt := b.DateTime(ts)
+	if len(dt) > 10 {
+		dt = dt[:10]
+	}
+	return dt
+}
+
+// Quantity converts a numeric value and its CE units into a Quantity. Units
+// from UCUM are also given as a code. It returns nil when value is not a
+// number.
+func (b *Builder) Quantity(value string, units Value) *Quantity {
+	number, ok := jsonNumber(value)
+	if !ok {
+		return nil
+	}
+	q := &Quantity{Value: number, Unit: units.Component(2).String()}
+	code := units.Component(1).String()
+	if q.Unit == "" {
+		q.Unit = code
+	}
+	if system := b.CodeSystem(units.Component(3).String()); system != "" && code != "" {
+		q.System, q.Code = system, code
+	}
+	return q
+}
+
+// jsonNumber returns s as a JSON number, keeping its digits when they are
+// valid JSON, and reports whether s is a number at all.
+func jsonNumber(s string) (json.Number, bool) {
+	s = strings.TrimSpace(s)
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil || s == "" || strings.ContainsAny(s, "xXpPnN_") {
+		return "", false
+	}
+	if json.Valid([]byte(s)) {
+		return json.Number(s), true
+	}
+	return json.Number(strconv.FormatFloat(f, 'f', -1, 64)), true
+}
+
+// nonEmpty returns the non-empty strings of ss.
+func nonEmpty(ss ...string) []string {
+	var out []string
+	for _, s := range ss {
+		if s != "" {
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+// isDigits reports whether s is a non-empty string of ASCII digits.
+func isDigits(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return false
+		}
+	}
+	return true
+}
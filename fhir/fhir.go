@@ -0,0 +1,113 @@
+// Package fhir converts HL7 v2 messages into FHIR R4 resources.
+//
+// A Converter turns a parsed ADT, ORU or VXU message into a Bundle of
+// Patient, Encounter, Observation, DiagnosticReport, Immunization and
+// Practitioner resources, following the HL7 v2-to-FHIR mapping for the MSH,
+// PID, PV1, ORC, OBR, OBX and RXA segments. Resources are plain structs that
+// encode with encoding/json:
+//
+//	c := fhir.New(fhir.Options{})
+//	bundle, err := c.Convert(data)
+//	if err != nil {
+//		return err
+//	}
+//	out, err := json.Marshal(bundle)
+//
+// Each segment is converted by a SegmentMapper. DefaultMappings returns the
+// built-in ones; a vendor quirk is handled by replacing or wrapping the
+// mapper of one segment, and segments such as Z-segments are converted by
+// adding a mapper for them:
+//
+//	m := fhir.DefaultMappings()
+//	pid := m["PID"]
+//	m["PID"] = func(b *fhir.Builder, seg fhir.Segment) error {
+//		if err := pid(b, seg); err != nil {
+//			return err
+//		}
+//		// This sender puts the MRN in PID-2.
+//		p := b.Patient()
+//		p.Identifier = append(p.Identifier, b.Identifier(seg.Get(2)))
+//		return nil
+//	}
+//	c := fhir.New(fhir.Options{Mappings: m})
+//
+// Resource IDs are UUIDs derived from the message, so converting the same
+// message twice gives the same IDs, and references between the resources
+// of a bundle use their urn:uuid: full URLs.
+package fhir
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/esequiel378/hl7"
+)
+
+// Options configures a Converter.
+type Options struct {
+	// Mappings maps segment names to the functions that convert them.
+	// Segments without a mapper are ignored. A nil map uses
+	// DefaultMappings.
+	Mappings map[string]SegmentMapper
+
+	// CodeSystems maps HL7 coding system names, as found in the third
+	// component of CE and CWE values, to FHIR code system URIs. Entries are
+	// added to DefaultCodeSystems and replace those with the same name.
+	CodeSystems map[string]string
+
+	// Location is the time zone of HL7 timestamps that have a time but no
+	// offset, which FHIR requires. Nil means UTC.
+	Location *time.Location
+}
+
+// A Converter converts HL7 v2 messages into FHIR bundles. It is safe for
+// concurrent use.
+type Converter struct {
+	mappings    map[string]SegmentMapper
+	codeSystems map[string]string
+	location    *time.Location
+}
+
+// New returns a Converter configured by opts.
+func New(opts Options) *Converter {
+	c := &Converter{mappings: opts.Mappings, codeSystems: DefaultCodeSystems(), location: opts.Location}
+	if c.mappings == nil {
+		c.mappings = DefaultMappings()
+	}
+	for name, uri := range opts.CodeSystems {
+		c.codeSystems[name] = uri
+	}
+	if c.location == nil {
+		c.location = time.UTC
+	}
+	return c
+}
+
+// Convert parses an HL7 message and converts it into a Bundle.
+func (c *Converter) Convert(data []byte) (*Bundle, error) {
+	msg, err := hl7.ParseGeneric(data)
+	if err != nil {
+		return nil, err
+	}
+	return c.ConvertGeneric(msg)
+}
+
+// ConvertGeneric converts a parsed message into a Bundle of type
+// "collection", calling the mapper of every segment in message order.
+func (c *Converter) ConvertGeneric(msg *hl7.GenericMessage) (*Bundle, error) {
+	b, err := newBuilder(c, msg)
+	if err != nil {
+		return nil, err
+	}
+	for i := range msg.Segments {
+		seg := &msg.Segments[i]
+		mapper, ok := c.mappings[seg.Name]
+		if !ok {
+			continue
+		}
+		if err := mapper(b, Segment{seg: seg, opts: b.opts}); err != nil {
+			return nil, fmt.Errorf("fhir: segment %d (%s): %w", i+1, seg.Name, err)
+		}
+	}
+	return b.bundle, nil
+}
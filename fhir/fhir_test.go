@@ -0,0 +1,209 @@
+package fhir_test
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/esequiel378/hl7/fhir"
+)
+
+const adtA01 = "MSH|^~\\&|ADT|HOSP|EHR|HOSP|20250114101500-0500||ADT^A01^ADT_A01|MSG001|P|2.5.1\r" +
+	"EVN|A01|20250114101500\r" +
+	"PID|1||123456^^^HOSP^MR~987^^^&2.16.840.1.113883.4.1&ISO^SS||Doe^John^Q^Jr^Dr^^L||19800215|M|||1 Main St^Apt 4^Springfield^IL^62701^USA^H||^PRN^PH^^1^217^5551234~^NET^Internet^john@example.com|||M^Married^HL70002||||||||||||||N\r" +
+	"PV1|1|I|4E^401^A||||1234^Smith^Anna^^^Dr|||MED|||||||||V100^^^HOSP^VN|||||||||||||||||||||||||20250114100000\r"
+
+const oruR01 = "MSH|^~\\&|LAB|HOSP|EHR|HOSP|20250114120000||ORU^R01|MSG002|P|2.5.1\r" +
+	"PID|1||123456^^^HOSP^MR||Doe^John\r" +
+	"ORC|RE|ORD1|FIL1\r" +
+	"OBR|1|ORD1|FIL1^LAB|58410-2^CBC panel^LN|||20250114080000|||||||||||||||20250114113000|||F\r" +
+	"OBX|1|NM|718-7^Hemoglobin^LN||13.50|g/dL^grams per deciliter^UCUM|13.5-17.5|N|||F|||20250114090000||5678^Lee^Sam\r" +
+	"OBX|2|SN|33914-3^eGFR^LN||>^60|mL/min/{1.73_m2}^^UCUM|||||F\r" +
+	"OBX|3|ST|8251-1^Comment^LN||Sample \\T\\ repeat||||||P\r" +
+	"ORC|RE|ORD2\r" +
+	"OBR|2|ORD2||24323-8^CMP^LN\r" +
+	"OBX|1|CWE|600-7^Culture^LN||3092008^Staph aureus^SCT||||||C\r"
+
+const vxuV04 = "MSH|^~\\&|IIS|CLINIC|REG|STATE|20250114||VXU^V04^VXU_V04|MSG003|P|2.5.1\r" +
+	"PID|1||555^^^CLINIC^MR||Roe^Jane||20240101|F\r" +
+	"ORC|RE||IZ1\r" +
+	"RXA|0|1|20250110||08^Hep B^CVX|0.5|mL^mL^UCUM||00^New record^NIP001|9999^Nurse^Nina|||||LOT42|20260101|MSK^Merck^MVX|||CP|A\r" +
+	"OBX|1|CE|64994-7^Eligibility^LN||V02^Medicaid^HL70064||||||F\r"
+
+func convert(t *testing.T, c *fhir.Converter, msg string) *fhir.Bundle {
+	t.Helper()
+	b, err := c.Convert([]byte(msg))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func TestConvertADT(t *testing.T) {
+	b := convert(t, fhir.New(fhir.Options{}), adtA01)
+	if b.Type != "collection" || b.Identifier.Value != "MSG001" || b.Timestamp != "2025-01-14T10:15:00-05:00" {
+		t.Errorf("unexpected bundle header %+v %q", b.Identifier, b.Timestamp)
+	}
+
+	patients := b.Resources("Patient")
+	if len(patients) != 1 {
+		t.Fatalf("expected one patient, got %d", len(patients))
+	}
+	p := patients[0].(*fhir.Patient)
+	if len(p.Identifier) != 2 || p.Identifier[0].Value != "123456" || p.Identifier[0].Assigner.Display != "HOSP" ||
+		p.Identifier[0].Type.Coding[0].Code != "MR" || p.Identifier[1].System != "urn:oid:2.16.840.1.113883.4.1" {
+		t.Errorf("unexpected identifiers %+v", p.Identifier)
+	}
+	name := p.Name[0]
+	if name.Use != "official" || name.Family != "Doe" || strings.Join(name.Given, " ") != "John Q" ||
+		name.Prefix[0] != "Dr" || name.Suffix[0] != "Jr" {
+		t.Errorf("unexpected name %+v", name)
+	}
+	if p.BirthDate != "1980-02-15" || p.Gender != "male" || p.DeceasedBoolean == nil || *p.DeceasedBoolean {
+		t.Errorf("unexpected demographics %q %q %v", p.BirthDate, p.Gender, p.DeceasedBoolean)
+	}
+	if a := p.Address[0]; a.Use != "home" || strings.Join(a.Line, "|") != "1 Main St|Apt 4" || a.PostalCode != "62701" {
+		t.Errorf("unexpected address %+v", a)
+	}
+	if len(p.Telecom) != 2 || p.Telecom[0] != (fhir.ContactPoint{System: "phone", Value: "+1 (217) 5551234", Use: "home"}) ||
+		p.Telecom[1] != (fhir.ContactPoint{System: "email", Value: "john@example.com", Use: "home"}) {
+		t.Errorf("unexpected telecom %+v", p.Telecom)
+	}
+	if ms := p.MaritalStatus.Coding[0]; ms.System != "http://terminology.hl7.org/CodeSystem/v2-0002" || ms.Code != "M" {
+		t.Errorf("unexpected marital status %+v", ms)
+	}
+
+	e := b.Resources("Encounter")[0].(*fhir.Encounter)
+	if e.Status != "in-progress" || e.Class.Code != "IMP" || e.Identifier[0].Value != "V100" ||
+		e.Location[0].Location.Display != "4E, 401, A" || e.Period.Start != "2025-01-14T10:00:00Z" {
+		t.Errorf("unexpected encounter %+v", e)
+	}
+	if e.Subject.Reference != "urn:uuid:"+p.ID || e.ServiceType.Coding[0].Code != "MED" {
+		t.Errorf("unexpected encounter references %+v %+v", e.Subject, e.ServiceType)
+	}
+	doctors := b.Resources("Practitioner")
+	if len(doctors) != 1 || len(e.Participant) != 1 || e.Participant[0].Type[0].Coding[0].Code != "ATND" ||
+		e.Participant[0].Individual.Reference != "urn:uuid:"+doctors[0].(*fhir.Practitioner).ID ||
+		e.Participant[0].Individual.Display != "Anna Smith" {
+		t.Errorf("unexpected participants %+v", e.Participant)
+	}
+}
+
+func TestConvertORU(t *testing.T) {
+	b := convert(t, fhir.New(fhir.Options{}), oruR01)
+
+	reports := b.Resources("DiagnosticReport")
+	obs := b.Resources("Observation")
+	if len(reports) != 2 || len(obs) != 4 {
+		t.Fatalf("expected 2 reports and 4 observations, got %d and %d", len(reports), len(obs))
+	}
+	r := reports[0].(*fhir.DiagnosticReport)
+	if r.Status != "final" || r.Code.Coding[0].System != "http://loinc.org" || r.Issued != "2025-01-14T11:30:00Z" ||
+		len(r.Identifier) != 2 || r.Identifier[1].Assigner.Display != "LAB" {
+		t.Errorf("unexpected report %+v", r)
+	}
+	if len(r.Result) != 3 || len(reports[1].(*fhir.DiagnosticReport).Result) != 1 {
+		t.Errorf("expected the results of each OBR to be grouped, got %+v", r.Result)
+	}
+
+	hgb := obs[0].(*fhir.Observation)
+	want := fhir.Quantity{Value: "13.50", Unit: "grams per deciliter", System: "http://unitsofmeasure.org", Code: "g/dL"}
+	if *hgb.ValueQuantity != want || hgb.Status != "final" || hgb.EffectiveDateTime != "2025-01-14T09:00:00Z" ||
+		hgb.Interpretation[0].Coding[0].Code != "N" || hgb.ReferenceRange[0].Text != "13.5-17.5" ||
+		hgb.Performer[0].Display != "Sam Lee" {
+		t.Errorf("unexpected hemoglobin %+v", hgb)
+	}
+	if gfr := obs[1].(*fhir.Observation); gfr.ValueQuantity.Comparator != ">" || gfr.ValueQuantity.Value != "60" ||
+		gfr.EffectiveDateTime != "2025-01-14T08:00:00Z" {
+		t.Errorf("unexpected eGFR %+v", gfr.ValueQuantity)
+	}
+	if note := obs[2].(*fhir.Observation); note.ValueString != "Sample & repeat" || note.Status != "preliminary" {
+		t.Errorf("unexpected comment %q %q", note.ValueString, note.Status)
+	}
+	if culture := obs[3].(*fhir.Observation); culture.ValueCodeableConcept.Coding[0].System != "http://snomed.info/sct" ||
+		culture.Status != "corrected" {
+		t.Errorf("unexpected culture %+v", culture)
+	}
+}
+
+func TestConvertVXU(t *testing.T) {
+	b := convert(t, fhir.New(fhir.Options{}), vxuV04)
+	if b.Timestamp != "" {
+		t.Errorf("expected no timestamp for a date, got %q", b.Timestamp)
+	}
+
+	im := b.Resources("Immunization")[0].(*fhir.Immunization)
+	if im.Status != "completed" || im.VaccineCode.Coding[0].System != "http://hl7.org/fhir/sid/cvx" ||
+		im.OccurrenceDateTime != "2025-01-10" || im.LotNumber != "LOT42" || im.ExpirationDate != "2026-01-01" ||
+		im.Manufacturer.Display != "Merck" || !*im.PrimarySource {
+		t.Errorf("unexpected immunization %+v", im)
+	}
+	if im.DoseQuantity.Value != "0.5" || im.DoseQuantity.Code != "mL" {
+		t.Errorf("unexpected dose %+v", im.DoseQuantity)
+	}
+	if len(im.Performer) != 1 || im.Performer[0].Function.Coding[0].Code != "AP" {
+		t.Errorf("unexpected performers %+v", im.Performer)
+	}
+
+	o := b.Resources("Observation")[0].(*fhir.Observation)
+	if len(o.PartOf) != 1 || o.PartOf[0].Reference != "urn:uuid:"+im.ID ||
+		o.ValueCodeableConcept.Coding[0].System != "http://terminology.hl7.org/CodeSystem/v2-0064" {
+		t.Errorf("unexpected eligibility observation %+v", o)
+	}
+}
+
+func TestConvertDeterministic(t *testing.T) {
+	c := fhir.New(fhir.Options{})
+	first, err := json.Marshal(convert(t, c, oruR01))
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := json.Marshal(convert(t, c, oruR01))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(first) != string(second) {
+		t.Error("expected the same bundle for the same message")
+	}
+	if !strings.Contains(string(first), `"resourceType":"Observation","id":"`) ||
+		!strings.Contains(string(first), `"value":13.50`) {
+		t.Errorf("unexpected JSON %s", first)
+	}
+}
+
+func TestConvertOverrides(t *testing.T) {
+	m := fhir.DefaultMappings()
+	pid := m["PID"]
+	m["PID"] = func(b *fhir.Builder, seg fhir.Segment) error {
+		if err := pid(b, seg); err != nil {
+			return err
+		}
+		p := b.Patient()
+		p.Identifier = append(p.Identifier, b.Identifier(seg.Get(2)))
+		return nil
+	}
+	delete(m, "PV1")
+	c := fhir.New(fhir.Options{
+		Mappings:    m,
+		CodeSystems: map[string]string{"L": "http://example.org/local"},
+		Location:    time.FixedZone("", -6*3600),
+	})
+
+	b := convert(t, c, "MSH|^~\\&|A|B|||202501141015||ORU^R01|M|P|2.5\r"+
+		"PID|1|X99|1\rPV1|1|O\rOBR|1|||GLU^Glucose^L\r")
+	p := b.Resources("Patient")[0].(*fhir.Patient)
+	if len(p.Identifier) != 2 || p.Identifier[1].Value != "X99" {
+		t.Errorf("expected the overridden PID mapper, got %+v", p.Identifier)
+	}
+	if len(b.Resources("Encounter")) != 0 {
+		t.Error("expected PV1 to be ignored")
+	}
+	if b.Timestamp != "2025-01-14T10:15:00-06:00" {
+		t.Errorf("expected the configured time zone, got %q", b.Timestamp)
+	}
+	r := b.Resources("DiagnosticReport")[0].(*fhir.DiagnosticReport)
+	if r.Code.Coding[0].System != "http://example.org/local" {
+		t.Errorf("expected the custom code system, got %+v", r.Code)
+	}
+}
@@ -0,0 +1,392 @@
+package fhir
+
+import (
+	"strings"
+
+	"github.com/esequiel378/hl7"
+)
+
+// DefaultMappings returns the built-in segment mappers:
+//
+//   - MSH sets the bundle identifier (MSH-10) and timestamp (MSH-7);
+//   - PID adds the Patient;
+//   - PV1 adds the Encounter, with its practitioners;
+//   - ORC ends the current order group;
+//   - OBR adds a DiagnosticReport that collects the following OBX;
+//   - OBX adds an Observation, part of the preceding RXA if any;
+//   - RXA adds an Immunization.
+//
+// A new map is returned on every call, so it can be changed freely.
+func DefaultMappings() map[string]SegmentMapper {
+	return map[string]SegmentMapper{
+		"MSH": mapMSH,
+		"PID": mapPID,
+		"PV1": mapPV1,
+		"ORC": mapORC,
+		"OBR": mapOBR,
+		"OBX": mapOBX,
+		"RXA": mapRXA,
+	}
+}
+
+// Code system URIs of the HL7 tables used by the mappers.
+const (
+	actCodeSystem          = "http://terminology.hl7.org/CodeSystem/v3-ActCode"
+	participationSystem    = "http://terminology.hl7.org/CodeSystem/v3-ParticipationType"
+	interpretationSystem   = "http://terminology.hl7.org/CodeSystem/v3-ObservationInterpretation"
+	identifierTypeSystem   = "http://terminology.hl7.org/CodeSystem/v2-0203"
+	hospitalServiceSystem  = "http://terminology.hl7.org/CodeSystem/v2-0069"
+	patientClassSystem     = "http://terminology.hl7.org/CodeSystem/v2-0004"
+	providerRoleCodeSystem = "http://terminology.hl7.org/CodeSystem/v2-0443"
+)
+
+func mapMSH(b *Builder, seg Segment) error {
+	if id := seg.Get(10).String(); id != "" {
+		b.bundle.Identifier = &Identifier{Value: id}
+	}
+	// Bundle.timestamp is an instant, which needs a time.
+	if ts := b.DateTime(seg.Get(7).Component(1).String()); strings.Contains(ts, "T") {
+		b.bundle.Timestamp = ts
+	}
+	return nil
+}
+
+// genders maps HL7 table 0001 to Patient.gender.
+var genders = map[string]string{
+	"A": "other",
+	"F": "female",
+	"M": "male",
+	"N": "other",
+	"O": "other",
+	"U": "unknown",
+}
+
+func mapPID(b *Builder, seg Segment) error {
+	p := &Patient{Base: Base{ResourceType: "Patient"}}
+	for _, cx := range seg.Field(3) {
+		p.Identifier = append(p.Identifier, b.Identifier(cx))
+	}
+	if ssn := seg.Get(19).String(); ssn != "" {
+		p.Identifier = append(p.Identifier, Identifier{
+			Type:   codeableConcept(identifierTypeSystem, "SS", ""),
+			System: "http://hl7.org/fhir/sid/us-ssn",
+			Value:  ssn,
+		})
+	}
+	for _, xpn := range seg.Field(5) {
+		p.Name = append(p.Name, b.HumanName(xpn))
+	}
+	p.BirthDate = b.Date(seg.Get(7).Component(1).String())
+	p.Gender = genders[seg.Get(8).String()]
+	for _, xad := range seg.Field(11) {
+		p.Address = append(p.Address, b.Address(xad))
+	}
+	for _, xtn := range seg.Field(13) {
+		p.Telecom = append(p.Telecom, b.ContactPoint(xtn, "home"))
+	}
+	for _, xtn := range seg.Field(14) {
+		p.Telecom = append(p.Telecom, b.ContactPoint(xtn, "work"))
+	}
+	p.MaritalStatus = b.CodeableConcept(seg.Get(16))
+
+	if death := b.DateTime(seg.Get(29).Component(1).String()); death != "" {
+		p.DeceasedDateTime = death
+	} else if flag := seg.Get(30).String(); flag == "Y" || flag == "N" {
+		deceased := flag == "Y"
+		p.DeceasedBoolean = &deceased
+	}
+	b.Add(p)
+	return nil
+}
+
+// encounterClasses maps HL7 table 0004 patient classes to Encounter.class.
+var encounterClasses = map[string]Coding{
+	"E": {System: actCodeSystem, Code: "EMER", Display: "emergency"},
+	"I": {System: actCodeSystem, Code: "IMP", Display: "inpatient encounter"},
+	"O": {System: actCodeSystem, Code: "AMB", Display: "ambulatory"},
+	"P": {System: actCodeSystem, Code: "PRENC", Display: "pre-admission"},
+}
+
+// encounterParticipants are the PV1 fields holding practitioners, with
+// their participation types.
+var encounterParticipants = []struct {
+	field         int
+	code, display string
+}{
+	{7, "ATND", "attender"},
+	{8, "REF", "referrer"},
+	{9, "CON", "consultant"},
+	{17, "ADM", "admitter"},
+}
+
+func mapPV1(b *Builder, seg Segment) error {
+	e := &Encounter{Base: Base{ResourceType: "Encounter"}, Subject: b.subject()}
+
+	if class := seg.Get(2).String(); class != "" {
+		c, ok := encounterClasses[class]
+		if !ok {
+			c = Coding{System: patientClassSystem, Code: class}
+		}
+		e.Class = &c
+	}
+	if visit := seg.Get(19); !visit.Empty() {
+		e.Identifier = []Identifier{b.Identifier(visit)}
+	}
+	if pl := seg.Get(3); !pl.Empty() {
+		name := strings.Join(nonEmpty(pl.Component(1).String(), pl.Component(2).String(), pl.Component(3).String()), ", ")
+		e.Location = []EncounterLocation{{Location: Reference{Display: name}}}
+	}
+	for _, p := range encounterParticipants {
+		for _, xcn := range seg.Field(p.field) {
+			e.Participant = append(e.Participant, EncounterParticipant{
+				Type:       []CodeableConcept{*codeableConcept(participationSystem, p.code, p.display)},
+				Individual: b.Practitioner(xcn),
+			})
+		}
+	}
+	e.ServiceType = codeableConcept(hospitalServiceSystem, seg.Get(10).String(), "")
+
+	start := b.DateTime(seg.Get(44).Component(1).String())
+	end := b.DateTime(seg.Get(45).Component(1).String())
+	if start != "" || end != "" {
+		e.Period = &Period{Start: start, End: end}
+	}
+
+	trigger := b.msg.Value(hl7.Path{Segment: "MSH", FieldPath: hl7.FieldPath{Field: 9, Component: 2}})
+	switch {
+	case end != "":
+		e.Status = "finished"
+	case trigger == "A05" || trigger == "A14":
+		e.Status = "planned"
+	case trigger == "A11" || trigger == "A27" || trigger == "A38":
+		e.Status = "cancelled"
+	default:
+		e.Status = "in-progress"
+	}
+	b.Add(e)
+	return nil
+}
+
+func mapORC(b *Builder, seg Segment) error {
+	b.EndGroup()
+	return nil
+}
+
+// reportStatuses maps HL7 table 0123 result statuses to
+// DiagnosticReport.status.
+var reportStatuses = map[string]string{
+	"A": "partial",
+	"C": "corrected",
+	"F": "final",
+	"I": "registered",
+	"O": "registered",
+	"P": "preliminary",
+	"R": "partial",
+	"S": "partial",
+	"X": "cancelled",
+}
+
+func mapOBR(b *Builder, seg Segment) error {
+	r := &DiagnosticReport{
+		Base:      Base{ResourceType: "DiagnosticReport"},
+		Status:    statusOf(reportStatuses, seg.Get(25).String()),
+		Subject:   b.subject(),
+		Encounter: b.encounterRef(),
+	}
+	for _, id := range []struct {
+		field int
+		typ   string
+	}{{2, "PLAC"}, {3, "FILL"}} {
+		if ei := seg.Get(id.field); !ei.Empty() {
+			r.Identifier = append(r.Identifier, b.entityIdentifier(ei, id.typ))
+		}
+	}
+	if code := b.CodeableConcept(seg.Get(4)); code != nil {
+		r.Code = *code
+	}
+	r.EffectiveDateTime = b.DateTime(seg.Get(7).Component(1).String())
+	// DiagnosticReport.issued is an instant, which needs a time.
+	if issued := b.DateTime(seg.Get(22).Component(1).String()); strings.Contains(issued, "T") {
+		r.Issued = issued
+	}
+	b.Add(r)
+	return nil
+}
+
+// entityIdentifier converts an EI value with the given identifier type.
+func (b *Builder) entityIdentifier(ei Value, typ string) Identifier {
+	id := Identifier{
+		Type:  codeableConcept(identifierTypeSystem, typ, ""),
+		Value: ei.Component(1).String(),
+	}
+	if uid := ei.Component(3).String(); uid != "" && ei.Component(4).String() == "ISO" {
+		id.System = "urn:oid:" + uid
+	} else if ns := ei.Component(2).String(); ns != "" {
+		id.Assigner = &Reference{Display: ns}
+	}
+	return id
+}
+
+// observationStatuses maps HL7 table 0085 result statuses to
+// Observation.status.
+var observationStatuses = map[string]string{
+	"C": "corrected",
+	"D": "entered-in-error",
+	"F": "final",
+	"I": "registered",
+	"P": "preliminary",
+	"R": "preliminary",
+	"S": "preliminary",
+	"U": "final",
+	"W": "entered-in-error",
+	"X": "cancelled",
+}
+
+func mapOBX(b *Builder, seg Segment) error {
+	o := &Observation{
+		Base:      Base{ResourceType: "Observation"},
+		Status:    statusOf(observationStatuses, seg.Get(11).String()),
+		Subject:   b.subject(),
+		Encounter: b.encounterRef(),
+	}
+	if code := b.CodeableConcept(seg.Get(3)); code != nil {
+		o.Code = *code
+	}
+	b.observationValue(o, seg.Get(2).String(), seg.Field(5), seg.Get(6))
+
+	for _, flag := range seg.Field(8) {
+		if cc := codeableConcept(interpretationSystem, flag.Component(1).String(), ""); cc != nil {
+			o.Interpretation = append(o.Interpretation, *cc)
+		}
+	}
+	if rng := seg.Get(7).String(); rng != "" {
+		o.ReferenceRange = []ObservationReferenceRange{{Text: rng}}
+	}
+	o.EffectiveDateTime = b.DateTime(seg.Get(14).Component(1).String())
+	for _, xcn := range seg.Field(16) {
+		if ref := b.Practitioner(xcn); ref != nil {
+			o.Performer = append(o.Performer, *ref)
+		}
+	}
+
+	if r := b.Report(); r != nil && o.EffectiveDateTime == "" {
+		o.EffectiveDateTime = r.EffectiveDateTime
+	}
+	if im := b.Immunization(); im != nil {
+		o.PartOf = []Reference{*ReferenceTo(im)}
+	}
+	ref := b.Add(o)
+	if r := b.Report(); r != nil {
+		r.Result = append(r.Result, *ref)
+	}
+	return nil
+}
+
+// snComparators are the SN comparators that FHIR quantities support.
+var snComparators = map[string]string{"<": "<", "<=": "<=", ">": ">", ">=": ">="}
+
+// observationValue sets the value of o from the repetitions of OBX-5,
+// according to the value type in OBX-2 and the units in OBX-6. Values that
+// do not fit the declared type are kept as text.
+func (b *Builder) observationValue(o *Observation, valueType string, values []Value, units Value) {
+	if len(values) == 0 {
+		return
+	}
+	v := values[0]
+	switch valueType {
+	case "NM":
+		if o.ValueQuantity = b.Quantity(v.String(), units); o.ValueQuantity != nil {
+			return
+		}
+	case "SN":
+		comparator, sep := v.Component(1).String(), v.Component(3).String()
+		switch {
+		case sep == "" && (comparator == "" || comparator == "=" || snComparators[comparator] != ""):
+			if q := b.Quantity(v.Component(2).String(), units); q != nil {
+				q.Comparator = snComparators[comparator]
+				o.ValueQuantity = q
+				return
+			}
+		case sep == "-" && comparator == "":
+			low, high := b.Quantity(v.Component(2).String(), units), b.Quantity(v.Component(4).String(), units)
+			if low != nil && high != nil {
+				o.ValueRange = &Range{Low: low, High: high}
+				return
+			}
+		}
+		o.ValueString = strings.Join(nonEmpty(comparator, v.Component(2).String(), sep, v.Component(4).String()), "")
+		return
+	case "CE", "CF", "CNE", "CWE":
+		if o.ValueCodeableConcept = b.CodeableConcept(v); o.ValueCodeableConcept != nil {
+			return
+		}
+	case "DT", "DTM", "TS":
+		if o.ValueDateTime = b.DateTime(v.Component(1).String()); o.ValueDateTime != "" {
+			return
+		}
+	case "FT", "TX":
+		lines := make([]string, len(values))
+		for i, v := range values {
+			lines[i] = v.String()
+		}
+		o.ValueString = strings.Join(lines, "\n")
+		return
+	}
+	o.ValueString = v.String()
+}
+
+func mapRXA(b *Builder, seg Segment) error {
+	im := &Immunization{
+		Base:         Base{ResourceType: "Immunization"},
+		Status:       "completed",
+		StatusReason: b.CodeableConcept(seg.Get(18)),
+		Patient:      b.subject(),
+		Encounter:    b.encounterRef(),
+	}
+	switch seg.Get(20).String() {
+	case "NA", "RE":
+		im.Status = "not-done"
+	}
+	if seg.Get(21).String() == "D" {
+		im.Status = "entered-in-error"
+	}
+	if code := b.CodeableConcept(seg.Get(5)); code != nil {
+		im.VaccineCode = *code
+	}
+	im.OccurrenceDateTime = b.DateTime(seg.Get(3).Component(1).String())
+	// 999 is the HL7 code for an unknown amount.
+	if amount := seg.Get(6).String(); amount != "999" {
+		im.DoseQuantity = b.Quantity(amount, seg.Get(7))
+	}
+	if source := seg.Get(9).Component(1).String(); source != "" {
+		primary := source == "00"
+		im.PrimarySource = &primary
+	}
+	for _, xcn := range seg.Field(10) {
+		if ref := b.Practitioner(xcn); ref != nil {
+			im.Performer = append(im.Performer, ImmunizationPerformer{
+				Function: codeableConcept(providerRoleCodeSystem, "AP", "Administering Provider"),
+				Actor:    *ref,
+			})
+		}
+	}
+	im.LotNumber = seg.Get(15).String()
+	im.ExpirationDate = b.Date(seg.Get(16).Component(1).String())
+	if mvx := seg.Get(17); !mvx.Empty() {
+		name := mvx.Component(2).String()
+		if name == "" {
+			name = mvx.Component(1).String()
+		}
+		im.Manufacturer = &Reference{Display: name}
+	}
+	b.Add(im)
+	return nil
+}
+
+// statusOf returns the FHIR status of an HL7 status code, or "unknown".
+func statusOf(statuses map[string]string, code string) string {
+	if s, ok := statuses[code]; ok {
+		return s
+	}
+	return "unknown"
+}
@@ -0,0 +1,232 @@
+package fhir
+
+import "encoding/json"
+
+// Base holds the elements common to every resource. Resources defined
+// outside this package embed it to be added to a Bundle.
+type Base struct {
+	ResourceType string `json:"resourceType"`
+	ID           string `json:"id,omitempty"`
+}
+
+func (b *Base) base() *Base { return b }
+
+// A Resource is a FHIR resource: a struct embedding Base.
+type Resource interface {
+	base() *Base
+}
+
+// Bundle is a collection of resources.
+type Bundle struct {
+	ResourceType string        `json:"resourceType"`
+	ID           string        `json:"id,omitempty"`
+	Identifier   *Identifier   `json:"identifier,omitempty"`
+	Type         string        `json:"type"`
+	Timestamp    string        `json:"timestamp,omitempty"`
+	Entry        []BundleEntry `json:"entry,omitempty"`
+}
+
+// BundleEntry is one resource of a Bundle.
+type BundleEntry struct {
+	FullURL  string   `json:"fullUrl"`
+	Resource Resource `json:"resource"`
+}
+
+// Resources returns the resources of b with the given resource type, in
+// bundle order.
+func (b *Bundle) Resources(resourceType string) []Resource {
+	var rs []Resource
+	for _, e := range b.Entry {
+		if e.Resource.base().ResourceType == resourceType {
+			rs = append(rs, e.Resource)
+		}
+	}
+	return rs
+}
+
+// Identifier is an identifier of a resource, such as a medical record
+// number.
+type Identifier struct {
+	Use      string           `json:"use,omitempty"`
+	Type     *CodeableConcept `json:"type,omitempty"`
+	System   string           `json:"system,omitempty"`
+	Value    string           `json:"value,omitempty"`
+	Assigner *Reference       `json:"assigner,omitempty"`
+}
+
+// HumanName is the name of a person.
+type HumanName struct {
+	Use    string   `json:"use,omitempty"`
+	Text   string   `json:"text,omitempty"`
+	Family string   `json:"family,omitempty"`
+	Given  []string `json:"given,omitempty"`
+	Prefix []string `json:"prefix,omitempty"`
+	Suffix []string `json:"suffix,omitempty"`
+}
+
+// Address is a postal address.
+type Address struct {
+	Use        string   `json:"use,omitempty"`
+	Type       string   `json:"type,omitempty"`
+	Line       []string `json:"line,omitempty"`
+	City       string   `json:"city,omitempty"`
+	District   string   `json:"district,omitempty"`
+	State      string   `json:"state,omitempty"`
+	PostalCode string   `json:"postalCode,omitempty"`
+	Country    string   `json:"country,omitempty"`
+}
+
+// ContactPoint is a phone number, e-mail address or similar.
+type ContactPoint struct {
+	System string `json:"system,omitempty"`
+	Value  string `json:"value,omitempty"`
+	Use    string `json:"use,omitempty"`
+}
+
+// CodeableConcept is a concept given by codes and text.
+type CodeableConcept struct {
+	Coding []Coding `json:"coding,omitempty"`
+	Text   string   `json:"text,omitempty"`
+}
+
+// Coding is a code from a code system.
+type Coding struct {
+	System  string `json:"system,omitempty"`
+	Code    string `json:"code,omitempty"`
+	Display string `json:"display,omitempty"`
+}
+
+// Reference refers to another resource.
+type Reference struct {
+	Reference string `json:"reference,omitempty"`
+	Display   string `json:"display,omitempty"`
+}
+
+// Period is a time range. Either end may be missing.
+type Period struct {
+	Start string `json:"start,omitempty"`
+	End   string `json:"end,omitempty"`
+}
+
+// Quantity is a measured amount. Value keeps the digits of the HL7 value, so
+// precision such as trailing zeros is preserved.
+type Quantity struct {
+	Value      json.Number `json:"value,omitempty"`
+	Comparator string      `json:"comparator,omitempty"`
+	Unit       string      `json:"unit,omitempty"`
+	System     string      `json:"system,omitempty"`
+	Code       string      `json:"code,omitempty"`
+}
+
+// Range is a range between two quantities.
+type Range struct {
+	Low  *Quantity `json:"low,omitempty"`
+	High *Quantity `json:"high,omitempty"`
+}
+
+// Patient is a person receiving care.
+type Patient struct {
+	Base
+	Identifier       []Identifier     `json:"identifier,omitempty"`
+	Name             []HumanName      `json:"name,omitempty"`
+	Telecom          []ContactPoint   `json:"telecom,omitempty"`
+	Gender           string           `json:"gender,omitempty"`
+	BirthDate        string           `json:"birthDate,omitempty"`
+	DeceasedBoolean  *bool            `json:"deceasedBoolean,omitempty"`
+	DeceasedDateTime string           `json:"deceasedDateTime,omitempty"`
+	Address          []Address        `json:"address,omitempty"`
+	MaritalStatus    *CodeableConcept `json:"maritalStatus,omitempty"`
+}
+
+// Encounter is a visit of the patient.
+type Encounter struct {
+	Base
+	Identifier  []Identifier           `json:"identifier,omitempty"`
+	Status      string                 `json:"status"`
+	Class       *Coding                `json:"class,omitempty"`
+	Type        []CodeableConcept      `json:"type,omitempty"`
+	ServiceType *CodeableConcept       `json:"serviceType,omitempty"`
+	Subject     *Reference             `json:"subject,omitempty"`
+	Participant []EncounterParticipant `json:"participant,omitempty"`
+	Period      *Period                `json:"period,omitempty"`
+	Location    []EncounterLocation    `json:"location,omitempty"`
+}
+
+// EncounterParticipant is a practitioner involved in an Encounter.
+type EncounterParticipant struct {
+	Type       []CodeableConcept `json:"type,omitempty"`
+	Individual *Reference        `json:"individual,omitempty"`
+}
+
+// EncounterLocation is a location of an Encounter.
+type EncounterLocation struct {
+	Location Reference `json:"location"`
+}
+
+// Observation is a measurement or assertion, such as a lab result.
+type Observation struct {
+	Base
+	PartOf               []Reference                 `json:"partOf,omitempty"`
+	Status               string                      `json:"status"`
+	Code                 CodeableConcept             `json:"code"`
+	Subject              *Reference                  `json:"subject,omitempty"`
+	Encounter            *Reference                  `json:"encounter,omitempty"`
+	EffectiveDateTime    string                      `json:"effectiveDateTime,omitempty"`
+	Performer            []Reference                 `json:"performer,omitempty"`
+	ValueQuantity        *Quantity                   `json:"valueQuantity,omitempty"`
+	ValueCodeableConcept *CodeableConcept            `json:"valueCodeableConcept,omitempty"`
+	ValueString          string                      `json:"valueString,omitempty"`
+	ValueDateTime        string                      `json:"valueDateTime,omitempty"`
+	ValueRange           *Range                      `json:"valueRange,omitempty"`
+	Interpretation       []CodeableConcept           `json:"interpretation,omitempty"`
+	ReferenceRange       []ObservationReferenceRange `json:"referenceRange,omitempty"`
+}
+
+// ObservationReferenceRange is the normal range of an Observation.
+type ObservationReferenceRange struct {
+	Text string `json:"text,omitempty"`
+}
+
+// DiagnosticReport groups the results of an order.
+type DiagnosticReport struct {
+	Base
+	Identifier        []Identifier    `json:"identifier,omitempty"`
+	Status            string          `json:"status"`
+	Code              CodeableConcept `json:"code"`
+	Subject           *Reference      `json:"subject,omitempty"`
+	Encounter         *Reference      `json:"encounter,omitempty"`
+	EffectiveDateTime string          `json:"effectiveDateTime,omitempty"`
+	Issued            string          `json:"issued,omitempty"`
+	Performer         []Reference     `json:"performer,omitempty"`
+	Result            []Reference     `json:"result,omitempty"`
+}
+
+// Immunization is a vaccine administration.
+type Immunization struct {
+	Base
+	Status             string                  `json:"status"`
+	StatusReason       *CodeableConcept        `json:"statusReason,omitempty"`
+	VaccineCode        CodeableConcept         `json:"vaccineCode"`
+	Patient            *Reference              `json:"patient,omitempty"`
+	Encounter          *Reference              `json:"encounter,omitempty"`
+	OccurrenceDateTime string                  `json:"occurrenceDateTime,omitempty"`
+	PrimarySource      *bool                   `json:"primarySource,omitempty"`
+	Manufacturer       *Reference              `json:"manufacturer,omitempty"`
+	LotNumber          string                  `json:"lotNumber,omitempty"`
+	ExpirationDate     string                  `json:"expirationDate,omitempty"`
+	DoseQuantity       *Quantity               `json:"doseQuantity,omitempty"`
+	Performer          []ImmunizationPerformer `json:"performer,omitempty"`
+}
+
+// ImmunizationPerformer is a practitioner involved in an Immunization.
+type ImmunizationPerformer struct {
+	Function *CodeableConcept `json:"function,omitempty"`
+	Actor    Reference        `json:"actor"`
+}
+
+// Practitioner is a person providing care.
+type Practitioner struct {
+	Base
+	Identifier []Identifier `json:"identifier,omitempty"`
+	Name       []HumanName  `json:"name,omitempty"`
+}
@@ -0,0 +1,130 @@
+package hl7
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+)
+
+// messageFields is the precomputed segment layout of a message struct type.
+// It is computed once per type and cached, like encoding/json does for its
+// struct fields.
+type messageFields struct {
+	list   []messageField  // valid segment tags, in declaration order
+	byName map[Segment]int // segment name -> struct field number
+	err    error           // first invalid segment field; reported by Unmarshal
+}
+
+// messageField is a message struct field tagged `hl7:"segment:<name>"`.
+type messageField struct {
+	name Segment
+	num  int
+}
+
+// structFields is the precomputed field layout of a segment or component
+// struct type. It is computed once per type and cached.
+type structFields struct {
+	list    []structField // numeric hl7 tags, in declaration order
+	byIndex []int         // hl7 index -> struct field number, or -1
+	notes   int           // struct field number of the notes field, or -1
+	err     error         // first invalid field tag; reported by Unmarshal
+}
+
+// structField is a struct field tagged with a numeric hl7 index.
+type structField struct {
+	index int
+	num   int
+}
+
+var (
+	messageFieldsCache sync.Map // map[reflect.Type]*messageFields
+	structFieldsCache  sync.Map // map[reflect.Type]*structFields
+)
+
+// cachedMessageFields returns the segment layout of the message struct type t.
+func cachedMessageFields(t reflect.Type) *messageFields {
+	if f, ok := messageFieldsCache.Load(t); ok {
+		return f.(*messageFields)
+	}
+	f, _ := messageFieldsCache.LoadOrStore(t, typeMessageFields(t))
+	return f.(*messageFields)
+}
+
+// cachedStructFields returns the field layout of the struct type t.
+func cachedStructFields(t reflect.Type) *structFields {
+	if f, ok := structFieldsCache.Load(t); ok {
+		return f.(*structFields)
+	}
+	f, _ := structFieldsCache.LoadOrStore(t, typeStructFields(t))
+	return f.(*structFields)
+}
+
+func typeMessageFields(t reflect.Type) *messageFields {
+	fields := &messageFields{byName: make(map[Segment]int)}
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		name, err := getHL7SegmentTypeFromTag(sf.Tag.Get("hl7"))
+		if errors.Is(err, errTagEmpty) {
+			continue
+		}
+		if err != nil {
+			if fields.err == nil {
+				fields.err = err
+			}
+			continue
+		}
+		fields.list = append(fields.list, messageField{name: name, num: i})
+
+		// Ensure the segment field is a struct
+		if sf.Type.Kind() != reflect.Struct {
+			if fields.err == nil {
+				fields.err = fmt.Errorf("%w: %s", ErrSegmentTypeInvalid, sf.Type)
+			}
+			continue
+		}
+		fields.byName[name] = i
+	}
+	return fields
+}
+
+func typeStructFields(t reflect.Type) *structFields {
+	fields := &structFields{notes: -1}
+	maxIndex := 0
+	sawNotes := false
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		tag := sf.Tag.Get("hl7")
+		if tag == "notes" {
+			// Only the first notes field counts, and only if it is a slice of structs.
+			if !sawNotes && sf.Type.Kind() == reflect.Slice && sf.Type.Elem().Kind() == reflect.Struct {
+				fields.notes = i
+			}
+			sawNotes = true
+			continue
+		}
+		index, err := getHL7FieldIndexFromTag(tag)
+		if errors.Is(err, errTagEmpty) {
+			continue
+		}
+		if err != nil {
+			if fields.err == nil {
+				fields.err = fmt.Errorf("hl7: invalid field index tag %q: %w", tag, err)
+			}
+			continue
+		}
+		fields.list = append(fields.list, structField{index: index, num: i})
+		maxIndex = max(maxIndex, index)
+	}
+
+	fields.byIndex = make([]int, maxIndex+1)
+	for i := range fields.byIndex {
+		fields.byIndex[i] = -1
+	}
+	for _, f := range fields.list {
+		if f.index > 0 {
+			fields.byIndex[f.index] = f.num
+		}
+	}
+	return fields
+}
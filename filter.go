@@ -0,0 +1,487 @@
+package hl7
+
+import (
+	"cmp"
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Filter is a compiled filter expression that matches messages by content.
+// A Filter is safe for concurrent use.
+//
+// Expressions combine predicates on paths (see ParsePath) with AND, OR, NOT
+// and parentheses. Keywords are case-insensitive:
+//
+//	MSH-9.1 = "ORU" AND OBR-4.1 IN ("CBC", "BMP") AND PV1-2 != "O"
+//	PID-5.1 MATCHES "^SMI" OR PID-5.1 =~ "^SMY"
+//	EXISTS PID-19 AND NOT PID-8 IN ("F", "M")
+//	ALL OBX-8 = "N" AND ANY OBX-5 > 100
+//
+// A predicate compares every value at its path: each occurrence of the
+// segment, unless the path names one, and each repetition of the field,
+// unless the path names one. Values are unescaped before comparison; an
+// absent value compares as "". By default a predicate holds when ANY value
+// passes; prefix it with ALL to require every value to pass.
+//
+// The comparisons are =, !=, <, <=, > and >=, which compare numerically
+// when both sides are numbers and as strings otherwise (a value that is
+// not a number is never ordered against a number); IN and NOT IN with
+// a parenthesized list; and MATCHES (or =~) with a regular expression.
+// EXISTS path, or path EXISTS, holds when any value at the path is
+// non-empty.
+type Filter struct {
+	expr string
+	root filterNode
+}
+
+// Compile parses a filter expression.
+func Compile(expr string) (*Filter, error) {
+	p := &filterParser{expr: expr}
+	if err := p.lex(); err != nil {
+		return nil, err
+	}
+	root, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.kind != tokEOF {
+		return nil, p.errorf(t, "unexpected %q", t.text)
+	}
+	return &Filter{expr: expr, root: root}, nil
+}
+
+// MustCompile is like Compile but panics if the expression cannot be
+// parsed. It simplifies initialization of global filters.
+func MustCompile(expr string) *Filter {
+	f, err := Compile(expr)
+	if err != nil {
+		panic(err)
+	}
+	return f
+}
+
+// String returns the source expression of the filter.
+func (f *Filter) String() string {
+	return f.expr
+}
+
+// Match reports whether msg matches the filter.
+func (f *Filter) Match(msg *GenericMessage) bool {
+	return f.root.eval(msg, msg.Delimiters())
+}
+
+// MatchBytes parses an HL7 message with ParseGeneric and reports whether it
+// matches the filter.
+func (f *Filter) MatchBytes(data []byte) (bool, error) {
+	msg, err := ParseGeneric(data)
+	if err != nil {
+		return false, err
+	}
+	return f.Match(msg), nil
+}
+
+type filterNode interface {
+	eval(msg *GenericMessage, opts MarshalOptions) bool
+}
+
+type andNode struct{ left, right filterNode }
+
+func (n andNode) eval(msg *GenericMessage, opts MarshalOptions) bool {
+	return n.left.eval(msg, opts) && n.right.eval(msg, opts)
+}
+
+type orNode struct{ left, right filterNode }
+
+func (n orNode) eval(msg *GenericMessage, opts MarshalOptions) bool {
+	return n.left.eval(msg, opts) || n.right.eval(msg, opts)
+}
+
+type notNode struct{ node filterNode }
+
+func (n notNode) eval(msg *GenericMessage, opts MarshalOptions) bool {
+	return !n.node.eval(msg, opts)
+}
+
+type existsNode struct{ path Path }
+
+func (n existsNode) eval(msg *GenericMessage, opts MarshalOptions) bool {
+	return slices.ContainsFunc(pathValues(msg, n.path, opts), func(v string) bool { return v != "" })
+}
+
+// predicate tests the values at a path.
+type predicate struct {
+	all  bool
+	path Path
+	op   string // comparison operator, "in", "not in" or "matches"
+	args []string
+	re   *regexp.Regexp
+}
+
+func (n predicate) eval(msg *GenericMessage, opts MarshalOptions) bool {
+	for _, v := range pathValues(msg, n.path, opts) {
+		if n.test(v) != n.all {
+			return !n.all
+		}
+	}
+	return n.all
+}
+
+func (n predicate) test(v string) bool {
+	switch n.op {
+	case "in":
+		return slices.Contains(n.args, v)
+	case "not in":
+		return !slices.Contains(n.args, v)
+	case "matches":
+		return n.re.MatchString(v)
+	}
+
+	c, ok := compareValues(v, n.args[0])
+	switch n.op {
+	case "=":
+		return c == 0
+	case "!=":
+		return c != 0
+	}
+	if !ok {
+		return false
+	}
+	switch n.op {
+	case "<":
+		return c < 0
+	case "<=":
+		return c <= 0
+	case ">":
+		return c > 0
+	default: // ">="
+		return c >= 0
+	}
+}
+
+// compareValues compares a and b as numbers when both parse as one, and as
+// strings otherwise. It reports false when a value is compared to a number
+// it cannot be ordered against.
+func compareValues(a, b string) (int, bool) {
+	x, errA := strconv.ParseFloat(a, 64)
+	y, errB := strconv.ParseFloat(b, 64)
+	switch {
+	case errA == nil && errB == nil:
+		return cmp.Compare(x, y), true
+	case errB == nil:
+		return strings.Compare(a, b), false
+	default:
+		return strings.Compare(a, b), true
+	}
+}
+
+// pathValues returns the unescaped values at p in every matching segment
+// occurrence and field repetition, or a single "" when there are none.
+func pathValues(msg *GenericMessage, p Path, opts MarshalOptions) []string {
+	var values []string
+	n := 0
+	for i := range msg.Segments {
+		seg := &msg.Segments[i]
+		if seg.Name != p.Segment {
+			continue
+		}
+		if n++; p.Occurrence > 0 && n != p.Occurrence {
+			continue
+		}
+		raw := seg.Value(FieldPath{Field: p.Field}, opts)
+		reps := []string{raw}
+		if p.Repetition > 0 {
+			reps = []string{nthValue(raw, opts.RepetitionSeparator, p.Repetition)}
+		} else if raw != "" {
+			reps = strings.Split(raw, string(opts.RepetitionSeparator))
+		}
+		for _, rep := range reps {
+			if p.Component > 0 {
+				rep = nthValue(rep, opts.ComponentSeparator, p.Component)
+			}
+			if p.Subcomponent > 0 {
+				rep = nthValue(rep, opts.SubcomponentSeparator, p.Subcomponent)
+			}
+			values = append(values, opts.Unescape(rep))
+		}
+	}
+	if len(values) == 0 {
+		return []string{""}
+	}
+	return values
+}
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokWord
+	tokString
+	tokOp
+	tokLParen
+	tokRParen
+	tokComma
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	pos  int
+}
+
+// filterParser is a recursive descent parser for filter expressions.
+type filterParser struct {
+	expr   string
+	tokens []token
+	next   int
+}
+
+func (p *filterParser) errorf(t token, format string, args ...any) error {
+	return fmt.Errorf("hl7: invalid filter %q at offset %d: %s", p.expr, t.pos, fmt.Sprintf(format, args...))
+}
+
+func isWordByte(c byte) bool {
+	return c >= 'A' && c <= 'Z' || c >= 'a' && c <= 'z' || c >= '0' && c <= '9' ||
+		c == '-' || c == '.' || c == '[' || c == ']' || c == '_' || c == '+'
+}
+
+func (p *filterParser) lex() error {
+	s := p.expr
+	for i := 0; i < len(s); {
+		c := s[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\r' || c == '\n':
+			i++
+		case c == '(':
+			p.tokens = append(p.tokens, token{tokLParen, "(", i})
+			i++
+		case c == ')':
+			p.tokens = append(p.tokens, token{tokRParen, ")", i})
+			i++
+		case c == ',':
+			p.tokens = append(p.tokens, token{tokComma, ",", i})
+			i++
+		case c == '"' || c == '\'':
+			var b strings.Builder
+			j := i + 1
+			for ; j < len(s) && s[j] != c; j++ {
+				if s[j] == '\\' && j+1 < len(s) {
+					j++
+				}
+				b.WriteByte(s[j])
+			}
+			if j >= len(s) {
+				return p.errorf(token{pos: i}, "unterminated string")
+			}
+			p.tokens = append(p.tokens, token{tokString, b.String(), i})
+			i = j + 1
+		case strings.ContainsRune("=!<>", rune(c)):
+			j := i + 1
+			if j < len(s) && (s[j] == '=' || s[j] == '~') {
+				j++
+			}
+			op := s[i:j]
+			switch op {
+			case "=", "==", "!=", "<", "<=", ">", ">=", "=~":
+			default:
+				return p.errorf(token{pos: i}, "unknown operator %q", op)
+			}
+			p.tokens = append(p.tokens, token{tokOp, op, i})
+			i = j
+		case isWordByte(c):
+			j := i
+			for j < len(s) && isWordByte(s[j]) {
+				j++
+			}
+			p.tokens = append(p.tokens, token{tokWord, s[i:j], i})
+			i = j
+		default:
+			return p.errorf(token{pos: i}, "unexpected character %q", c)
+		}
+	}
+	p.tokens = append(p.tokens, token{tokEOF, "end of expression", len(s)})
+	return nil
+}
+
+func (p *filterParser) peek() token {
+	return p.tokens[p.next]
+}
+
+func (p *filterParser) advance() token {
+	t := p.tokens[p.next]
+	if t.kind != tokEOF {
+		p.next++
+	}
+	return t
+}
+
+// keyword consumes the next token if it is the given keyword.
+func (p *filterParser) keyword(kw string) bool {
+	if t := p.peek(); t.kind == tokWord && strings.EqualFold(t.text, kw) {
+		p.next++
+		return true
+	}
+	return false
+}
+
+func (p *filterParser) parseOr() (filterNode, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.keyword("OR") {
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = orNode{left, right}
+	}
+	return left, nil
+}
+
+func (p *filterParser) parseAnd() (filterNode, error) {
+	left, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	for p.keyword("AND") {
+		right, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		left = andNode{left, right}
+	}
+	return left, nil
+}
+
+func (p *filterParser) parseNot() (filterNode, error) {
+	if p.keyword("NOT") {
+		node, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return notNode{node}, nil
+	}
+	if p.peek().kind == tokLParen {
+		p.advance()
+		node, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if t := p.advance(); t.kind != tokRParen {
+			return nil, p.errorf(t, "expected ), got %q", t.text)
+		}
+		return node, nil
+	}
+	return p.parsePredicate()
+}
+
+func (p *filterParser) parsePath() (Path, error) {
+	t := p.advance()
+	if t.kind != tokWord {
+		return Path{}, p.errorf(t, "expected a path, got %q", t.text)
+	}
+	path, err := parseFieldPath(t.text)
+	if err != nil {
+		return Path{}, p.errorf(t, "%v", strings.TrimPrefix(err.Error(), "hl7: "))
+	}
+	return path, nil
+}
+
+func (p *filterParser) parsePredicate() (filterNode, error) {
+	if p.keyword("EXISTS") {
+		path, err := p.parsePath()
+		if err != nil {
+			return nil, err
+		}
+		return existsNode{path}, nil
+	}
+
+	var n predicate
+	if p.keyword("ALL") {
+		n.all = true
+	} else {
+		p.keyword("ANY")
+	}
+	var err error
+	if n.path, err = p.parsePath(); err != nil {
+		return nil, err
+	}
+
+	t := p.advance()
+	switch {
+	case t.kind == tokWord && strings.EqualFold(t.text, "EXISTS"):
+		if n.all {
+			return nil, p.errorf(t, "EXISTS cannot be quantified")
+		}
+		return existsNode{n.path}, nil
+	case t.kind == tokWord && strings.EqualFold(t.text, "IN"):
+		n.op = "in"
+	case t.kind == tokWord && strings.EqualFold(t.text, "NOT") && p.keyword("IN"):
+		n.op = "not in"
+	case t.kind == tokWord && strings.EqualFold(t.text, "MATCHES"), t.kind == tokOp && t.text == "=~":
+		n.op = "matches"
+	case t.kind == tokOp:
+		n.op = strings.Replace(t.text, "==", "=", 1)
+	default:
+		return nil, p.errorf(t, "expected an operator after %s, got %q", n.path, t.text)
+	}
+
+	switch n.op {
+	case "in", "not in":
+		n.args, err = p.parseList()
+	case "matches":
+		var pattern string
+		if pattern, err = p.parseValue(); err == nil {
+			if n.re, err = regexp.Compile(pattern); err != nil {
+				err = p.errorf(p.tokens[p.next-1], "%v", err)
+			}
+		}
+	default:
+		var v string
+		v, err = p.parseValue()
+		n.args = []string{v}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return n, nil
+}
+
+// parseValue parses a string or number literal.
+func (p *filterParser) parseValue() (string, error) {
+	t := p.advance()
+	switch t.kind {
+	case tokString:
+		return t.text, nil
+	case tokWord:
+		if _, err := strconv.ParseFloat(t.text, 64); err == nil {
+			return t.text, nil
+		}
+	}
+	return "", p.errorf(t, "expected a string or number, got %q", t.text)
+}
+
+// parseList parses a parenthesized, comma-separated list of literals.
+func (p *filterParser) parseList() ([]string, error) {
+	if t := p.advance(); t.kind != tokLParen {
+		return nil, p.errorf(t, "expected (, got %q", t.text)
+	}
+	var values []string
+	for {
+		v, err := p.parseValue()
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, v)
+		t := p.advance()
+		if t.kind == tokRParen {
+			return values, nil
+		}
+		if t.kind != tokComma {
+			return nil, p.errorf(t, "expected , or ), got %q", t.text)
+		}
+	}
+}
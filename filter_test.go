@@ -0,0 +1,97 @@
+package hl7_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/esequiel378/hl7"
+)
+
+const filterMessage = "MSH|^~\\&|LAB|GHH|||20250301||ORU^R01|1|P|2.5\r" +
+	"PID|1||123^^^HOSP~456^^^SSA||SMITH^JOHN||19800101|M\r" +
+	"PV1|1|I\r" +
+	"OBR|1|||CBC^Complete blood count\r" +
+	"OBX|1|NM|WBC||7.2|10*3/uL||N\r" +
+	"OBX|2|NM|HGB||13.5|g/dL||N\r" +
+	"OBX|3|ST|CMT||A\\T\\B||||"
+
+func TestFilterMatch(t *testing.T) {
+	msg, err := hl7.ParseGeneric([]byte(filterMessage))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		expr string
+		want bool
+	}{
+		{`MSH-9.1 = "ORU" AND OBR-4.1 IN ("CBC","BMP") AND PV1-2 != "O"`, true},
+		{`MSH-9.1 = "ADT" OR PV1-2 = "O"`, false},
+		{`MSH-9 = "ORU^R01"`, true},
+		{`PID-3.4 = "SSA"`, true},
+		{`ALL PID-3.4 = "SSA"`, false},
+		{`PID-3[2].1 = 456`, true},
+		{`ANY OBX-5 > 13`, true},
+		{`ANY OBX-5 > 100`, false},
+		{`OBX-5 >= 7.2 AND OBX-5 < 8`, true},
+		{`ALL OBX-8 = "N"`, false},
+		{`ALL OBX[1]-8 = "N"`, true},
+		{`OBX-5 = "A&B"`, true},
+		{`PID-5.1 MATCHES "^SMI"`, true},
+		{`PID-5.1 =~ '^JO'`, false},
+		{`EXISTS PID-19`, false},
+		{`NOT EXISTS PID-19 AND PID-8 EXISTS`, true},
+		{`PID-8 NOT IN ("F", "U")`, true},
+		{`ZZZ-1 = ""`, true},
+		{`NOT (MSH-9.1 = "ORU" AND PID-8 = "F")`, true},
+		{`MSH-9.1 = "ADT" OR MSH-9.1 = "ORU" AND PID-8 = "F"`, false},
+	}
+	for _, tt := range tests {
+		f, err := hl7.Compile(tt.expr)
+		if err != nil {
+			t.Errorf("Compile(%s): %v", tt.expr, err)
+			continue
+		}
+		if got := f.Match(msg); got != tt.want {
+			t.Errorf("%s: expected %v, got %v", tt.expr, tt.want, got)
+		}
+	}
+}
+
+func TestFilterSyntaxErrors(t *testing.T) {
+	tests := []string{
+		``,
+		`PID-3`,
+		`PID-3 = `,
+		`PID-3 = "unterminated`,
+		`PID-3 IN "A"`,
+		`PID-3 IN ("A" "B")`,
+		`PID-3 MATCHES "("`,
+		`(PID-3 = "A"`,
+		`PID-3 = "A" PID-4 = "B"`,
+		`PID-3 <> "A"`,
+		`ALL PID-3 EXISTS`,
+		`PID = "A"`,
+		`EXISTS OBX[2]`,
+		`pid-3 = "A"`,
+		`PID-3 = SMITH`,
+	}
+	for _, expr := range tests {
+		if _, err := hl7.Compile(expr); err == nil {
+			t.Errorf("Compile(%s): expected error", expr)
+		} else if !strings.Contains(err.Error(), "offset") {
+			t.Errorf("Compile(%s): expected error with offset, got %v", expr, err)
+		}
+	}
+}
+
+func TestFilterMatchBytes(t *testing.T) {
+	f := hl7.MustCompile(`MSH-9.2 = "R01"`)
+	ok, err := f.MatchBytes([]byte(filterMessage))
+	if err != nil || !ok {
+		t.Errorf("expected match, got %v, %v", ok, err)
+	}
+	if f.String() != `MSH-9.2 = "R01"` {
+		t.Errorf("unexpected String %q", f)
+	}
+}
@@ -1,6 +1,9 @@
 package hl7
 
-import "strings"
+import (
+	"fmt"
+	"strings"
+)
 
 // GenericMessage represents a fully parsed HL7 message without a predefined schema.
 type GenericMessage struct {
@@ -53,7 +56,12 @@ func ParseGenericMulti(data []byte) ([]*GenericMessage, error) {
 // a predefined schema or struct. All fields, components, and repetitions are
 // preserved in the output.
 func ParseGeneric(data []byte) (*GenericMessage, error) {
-	segments, err := parseMessage(data)
+	return parseGeneric(data, nil)
+}
+
+// parseGeneric is ParseGeneric reporting unparseable lines through d.
+func parseGeneric(data []byte, d *decodeState) (*GenericMessage, error) {
+	segments, err := parseMessage(data, d)
 	if err != nil {
 		return nil, err
 	}
@@ -137,3 +145,172 @@ func parseComponents(value, componentSep string) []GenericComponent {
 	}
 	return components
 }
+
+// Delimiters returns the separators declared by the message's MSH-1 and
+// MSH-2 fields, falling back to the defaults of DefaultMarshalOptions for
+// those that are missing. Charset is set to the MSH-18 character set when it
+// is one that is transcoded, such as 8859/1.
+func (m *GenericMessage) Delimiters() MarshalOptions {
+	opts := DefaultMarshalOptions()
+	for _, seg := range m.Segments {
+		if seg.Name != "MSH" {
+			continue
+		}
+		var charset string
+		for _, f := range seg.Fields {
+			switch f.Index {
+			case 1:
+				if f.Value != "" {
+					opts.FieldSeparator = f.Value[0]
+				}
+			case 2:
+				chars := []*byte{&opts.ComponentSeparator, &opts.RepetitionSeparator, &opts.EscapeCharacter, &opts.SubcomponentSeparator}
+				for i := 0; i < len(f.Value) && i < len(chars); i++ {
+					*chars[i] = f.Value[i]
+				}
+			case 18:
+				charset = f.Value
+			}
+		}
+		if i := strings.IndexAny(charset, opts.delimiters()); i >= 0 {
+			charset = charset[:i]
+		}
+		if c, ok := lookupCharset(charset); ok && c.high != nil {
+			opts.Charset = charset
+		}
+		break
+	}
+	return opts
+}
+
+// SetDelimiters re-encodes the message for the separators and escape
+// character of opts. Every field value is rewritten so that separators and
+// escape sequences use the new characters, and characters that become
+// delimiters are escaped. MSH-1 and MSH-2 are updated to declare the new
+// delimiters; a message without an MSH segment only has its values rewritten.
+func (m *GenericMessage) SetDelimiters(opts MarshalOptions) {
+	from := m.Delimiters()
+	for i := range m.Segments {
+		seg := &m.Segments[i]
+		for j := range seg.Fields {
+			f := &seg.Fields[j]
+			if seg.Name == "MSH" && f.Index <= 2 {
+				continue
+			}
+			f.SetValue(translateDelimiters(f.Value, from, opts), opts)
+		}
+		if seg.Name == "MSH" {
+			seg.field(1).Value = string(opts.FieldSeparator)
+			seg.field(2).Value = string([]byte{
+				opts.ComponentSeparator,
+				opts.RepetitionSeparator,
+				opts.EscapeCharacter,
+				opts.SubcomponentSeparator,
+			})
+		}
+	}
+}
+
+// translateDelimiters rewrites a raw value encoded with the delimiters of
+// from to use those of to.
+func translateDelimiters(v string, from, to MarshalOptions) string {
+	var b strings.Builder
+	b.Grow(len(v))
+	for i := 0; i < len(v); i++ {
+		c := v[i]
+		switch c {
+		case from.EscapeCharacter:
+			if j := strings.IndexByte(v[i+1:], c); j >= 0 {
+				b.WriteByte(to.EscapeCharacter)
+				b.WriteString(v[i+1 : i+1+j])
+				b.WriteByte(to.EscapeCharacter)
+				i += j + 1
+				continue
+			}
+			b.WriteString(to.Escape(string(c)))
+		case from.RepetitionSeparator:
+			b.WriteByte(to.RepetitionSeparator)
+		case from.ComponentSeparator:
+			b.WriteByte(to.ComponentSeparator)
+		case from.SubcomponentSeparator:
+			b.WriteByte(to.SubcomponentSeparator)
+		default:
+			b.WriteString(to.Escape(string(c)))
+		}
+	}
+	return b.String()
+}
+
+// SetValue replaces the raw value of the field and rebuilds its components
+// and repetitions using the separators of opts. value must already be
+// escaped; see MarshalOptions.Escape.
+func (f *GenericField) SetValue(value string, opts MarshalOptions) {
+	name := f.Name
+	*f = parseGenericField(f.Index, value, string(opts.ComponentSeparator), string(opts.RepetitionSeparator))
+	f.Name = name
+}
+
+// MarshalGeneric serializes a GenericMessage back into HL7, using the
+// separators and character set declared by its MSH segment and "\r" as the
+// segment terminator.
+// Each field is written from its raw Value and placed by its Index, so a
+// message returned by ParseGeneric round-trips byte for byte, escape
+// sequences included. Components and Repeats are ignored; use
+// GenericField.SetValue to keep them in sync when changing a field.
+func MarshalGeneric(msg *GenericMessage) ([]byte, error) {
+	return marshalGeneric(msg, msg.Delimiters())
+}
+
+// marshalGeneric writes msg with the line ending, MSH defaults and
+// character set of opts, whose delimiters must match those the message
+// declares.
+func marshalGeneric(msg *GenericMessage, opts MarshalOptions) ([]byte, error) {
+	var b strings.Builder
+	for i, seg := range msg.Segments {
+		if seg.Name == "" {
+			return nil, fmt.Errorf("hl7: segment %d has no name", i+1)
+		}
+
+		if i > 0 {
+			b.WriteString(opts.LineEnding)
+		}
+		if err := writeGenericSegment(&b, &seg, opts); err != nil {
+			return nil, err
+		}
+	}
+	return opts.transcode(opts.fillHeader([]byte(b.String())))
+}
+
+// writeGenericSegment writes one segment of MarshalGeneric, without a
+// terminator.
+func writeGenericSegment(b *strings.Builder, seg *GenericSegment, opts MarshalOptions) error {
+	fs := string(opts.FieldSeparator)
+
+	// MSH-1 is the field separator itself and MSH-2 starts right after it,
+	// so MSH fields are shifted one place to the left.
+	first := 1
+	if seg.Name == "MSH" {
+		first = 2
+	}
+
+	maxIndex := 0
+	for _, f := range seg.Fields {
+		if f.Index < 1 || (seg.Name == "MSH" && f.Index == 1 && f.Value != fs) {
+			return fmt.Errorf("hl7: invalid field %s-%d", seg.Name, f.Index)
+		}
+		maxIndex = max(maxIndex, f.Index)
+	}
+	values := make([]string, max(maxIndex-first+1, first-1))
+	for _, f := range seg.Fields {
+		if f.Index >= first {
+			values[f.Index-first] = f.Value
+		}
+	}
+
+	b.WriteString(seg.Name)
+	for _, v := range values {
+		b.WriteString(fs)
+		b.WriteString(v)
+	}
+	return nil
+}
@@ -152,3 +152,86 @@ func TestParseGeneric_EmptyMessage(t *testing.T) {
 		t.Errorf("expected 0 segments, got %d", len(msg.Segments))
 	}
 }
+
+func TestMarshalGeneric_RoundTrip(t *testing.T) {
+	input := "MSH|^~\\&|HIS|Fac|||202501151030||ADT^A01|1|P|2.5\r" +
+		"PID|1||123^^^HOSP~456^^^SSA||O\\T\\Brien^Pat\\S\\Jr||19850315\r" +
+		"NTE|1||line one\\.br\\line two\r" +
+		"ZPI|||"
+
+	msg, err := ParseGeneric([]byte(input))
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := MarshalGeneric(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(out) != input {
+		t.Errorf("round trip mismatch:\n got %q\nwant %q", out, input)
+	}
+}
+
+func TestMarshalGeneric_CustomDelimiters(t *testing.T) {
+	input := "MSH#*@!%#App\rPID#1##A*B@C*D"
+
+	msg, err := ParseGeneric([]byte(input))
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts := msg.Delimiters()
+	if opts.FieldSeparator != '#' || opts.ComponentSeparator != '*' || opts.RepetitionSeparator != '@' ||
+		opts.EscapeCharacter != '!' || opts.SubcomponentSeparator != '%' {
+		t.Errorf("unexpected delimiters %+v", opts)
+	}
+
+	pid := &msg.Segments[1]
+	pid.Fields[2].SetValue(opts.Escape("X#Y")+"*Z", opts)
+	if len(pid.Fields[2].Components) != 2 || pid.Fields[2].Components[0].Value != "X!F!Y" {
+		t.Errorf("expected components to be rebuilt, got %+v", pid.Fields[2])
+	}
+
+	out, err := MarshalGeneric(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "MSH#*@!%#App\rPID#1##X!F!Y*Z"; string(out) != want {
+		t.Errorf("expected %q, got %q", want, out)
+	}
+}
+
+func TestMarshalGeneric_InvalidField(t *testing.T) {
+	msg := &GenericMessage{Segments: []GenericSegment{
+		{Name: "PID", Fields: []GenericField{{Index: 0, Value: "x"}}},
+	}}
+	if _, err := MarshalGeneric(msg); err == nil {
+		t.Error("expected error for field index 0")
+	}
+}
+
+func TestGenericMessage_SetDelimiters(t *testing.T) {
+	input := "MSH|^~\\&|App|Fac\rPID|1||A^B&C~D||O\\T\\Brien#1^Pat\\.br\\"
+
+	msg, err := ParseGeneric([]byte(input))
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg.SetDelimiters(MarshalOptions{
+		FieldSeparator:        '#',
+		ComponentSeparator:    '*',
+		RepetitionSeparator:   '@',
+		EscapeCharacter:       '!',
+		SubcomponentSeparator: '%',
+	})
+
+	out, err := MarshalGeneric(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "MSH#*@!%#App#Fac\rPID#1##A*B%C@D##O!T!Brien!F!1*Pat!.br!"; string(out) != want {
+		t.Errorf("expected %q, got %q", want, out)
+	}
+	if c := msg.Segments[1].Fields[2].Repeats; len(c) != 2 || len(c[0].Components) != 2 {
+		t.Errorf("expected repeats to be rebuilt, got %+v", msg.Segments[1].Fields[2])
+	}
+}
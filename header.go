@@ -0,0 +1,113 @@
+package hl7
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// A ControlIDGenerator returns a new message control ID for MSH-10 on each
+// call. It must be safe for concurrent use. Any func() string can be
+// converted to one; SequenceControlIDs and ULIDControlIDs return common
+// ones.
+type ControlIDGenerator func() string
+
+// SequenceControlIDs returns a generator of the control IDs prefix+start,
+// prefix+(start+1) and so on. The counter is not persisted, so a process
+// that restarts should use a new prefix or start, such as one derived from
+// the start time.
+func SequenceControlIDs(prefix string, start uint64) ControlIDGenerator {
+	var n atomic.Uint64
+	n.Store(start)
+	return func() string {
+		return prefix + strconv.FormatUint(n.Add(1)-1, 10)
+	}
+}
+
+// crockford is the base 32 alphabet of ULIDs.
+const crockford = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+// ULIDControlIDs returns a generator of ULIDs: 26 characters holding the
+// current time in milliseconds and 80 random bits, which sort by the time
+// they were generated. MSH-10 allows 20 characters before v2.7, so receivers
+// of older versions may truncate or reject them.
+func ULIDControlIDs() ControlIDGenerator {
+	return func() string {
+		var id [16]byte
+		var ms [8]byte
+		binary.BigEndian.PutUint64(ms[:], uint64(time.Now().UnixMilli()))
+		copy(id[:6], ms[2:])
+		rand.Read(id[6:])
+
+		// 128 bits in 26 digits of 5 bits, the first of which holds only 3.
+		var out [26]byte
+		hi := binary.BigEndian.Uint64(id[:8])
+		lo := binary.BigEndian.Uint64(id[8:])
+		for i := 25; i >= 0; i-- {
+			out[i] = crockford[lo&31]
+			lo = lo>>5 | hi<<59
+			hi >>= 5
+		}
+		return string(out[:])
+	}
+}
+
+// newControlID returns a random message control ID of 20 hexadecimal
+// digits, the length MSH-10 allows.
+func newControlID() string {
+	var id [10]byte
+	rand.Read(id[:])
+	return strings.ToUpper(hex.EncodeToString(id[:]))
+}
+
+// fillHeader sets the empty MSH fields of data, an encoded message with the
+// delimiters and line ending of opts, to their defaults in opts. Data that
+// does not start with an MSH segment is returned unchanged.
+func (opts MarshalOptions) fillHeader(data []byte) []byte {
+	defaults := map[int]func() string{}
+	for field, v := range map[int]string{
+		3:  opts.SendingApplication,
+		4:  opts.SendingFacility,
+		5:  opts.ReceivingApplication,
+		6:  opts.ReceivingFacility,
+		11: opts.ProcessingID,
+		12: opts.Version,
+	} {
+		if v != "" {
+			defaults[field] = func() string { return v }
+		}
+	}
+	if opts.Now != nil {
+		defaults[7] = func() string { return opts.Now().Format("20060102150405") }
+	}
+	if opts.ControlID != nil {
+		defaults[10] = opts.ControlID
+	}
+	fs := []byte{opts.FieldSeparator}
+	if len(defaults) == 0 || !bytes.HasPrefix(data, append([]byte("MSH"), fs...)) {
+		return data
+	}
+
+	header, rest := data, []byte(nil)
+	if i := bytes.Index(data, []byte(opts.LineEnding)); opts.LineEnding != "" && i >= 0 {
+		header, rest = data[:i], data[i:]
+	}
+	// fields[i] is MSH-(i+1), as MSH-1 is the separator between "MSH" and
+	// MSH-2.
+	fields := bytes.Split(header, fs)
+	for field, value := range defaults {
+		for len(fields) <= field-1 {
+			fields = append(fields, nil)
+		}
+		if len(fields[field-1]) == 0 {
+			fields[field-1] = []byte(value())
+		}
+	}
+	out := bytes.Join(fields, fs)
+	return append(out, rest...)
+}
@@ -0,0 +1,152 @@
+package hl7_test
+
+import (
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/esequiel378/hl7"
+)
+
+type headerMessage struct {
+	MSH struct {
+		FieldSeparator     string `hl7:"1"`
+		EncodingCharacters string `hl7:"2"`
+		SendingApplication string `hl7:"3"`
+		MessageType        string `hl7:"9"`
+		ControlID          string `hl7:"10"`
+	} `hl7:"segment:MSH"`
+	PID struct {
+		ID string `hl7:"3"`
+	} `hl7:"segment:PID"`
+}
+
+func headerOptions() hl7.MarshalOptions {
+	opts := hl7.DefaultMarshalOptions()
+	opts.ControlID = hl7.SequenceControlIDs("T", 7)
+	opts.Now = func() time.Time { return time.Date(2025, 1, 14, 9, 30, 0, 0, time.UTC) }
+	opts.SendingApplication = "LAB"
+	opts.SendingFacility = "HOSP"
+	opts.ReceivingApplication = "EHR^1.2.3^ISO"
+	opts.ProcessingID = "T"
+	opts.Version = "2.5.1"
+	return opts
+}
+
+func TestMarshalHeaderDefaults(t *testing.T) {
+	var msg headerMessage
+	msg.MSH.FieldSeparator, msg.MSH.EncodingCharacters = "|", "^~\\&"
+	msg.MSH.SendingApplication = "ADT"
+	msg.MSH.MessageType = "ADT^A01"
+	msg.PID.ID = "42"
+
+	opts := headerOptions()
+	var got []string
+	for range 2 {
+		data, err := hl7.MarshalWithOptions(msg, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, string(data))
+	}
+	if want := "MSH|^~\\&|ADT|HOSP|EHR^1.2.3^ISO||20250114093000||ADT^A01|T7|T|2.5.1\rPID|||42"; got[0] != want {
+		t.Errorf("got  %q\nwant %q", got[0], want)
+	}
+	if !strings.Contains(got[1], "|T8|") {
+		t.Errorf("expected the next control ID, got %q", got[1])
+	}
+
+	msg.MSH.ControlID = "KEEP"
+	data, err := hl7.MarshalWithOptions(msg, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), "|KEEP|T|") {
+		t.Errorf("expected MSH-10 to be kept, got %q", data)
+	}
+
+	data, err = hl7.Marshal(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "MSH|^~\\&|ADT||||||ADT^A01|KEEP\rPID|||42"; string(data) != want {
+		t.Errorf("expected no defaults without options, got %q", data)
+	}
+}
+
+func TestMarshalWithSchemaHeaderDefaults(t *testing.T) {
+	schema := mustParseSchema(t, `{
+		"segments": {
+			"MSH": {
+				"fields": {
+					"fieldSeparator":     { "index": 1 },
+					"encodingCharacters": { "index": 2 },
+					"versionID":          { "index": 12 }
+				}
+			}
+		}
+	}`)
+	data := map[string]any{
+		"MSH": map[string]any{
+			"fieldSeparator":     "|",
+			"encodingCharacters": "^~\\&",
+			"versionID":          "2.3",
+		},
+	}
+
+	opts := headerOptions()
+	opts.LineEnding = "\n"
+	out, err := hl7.MarshalWithSchemaOptions(data, schema, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "MSH|^~\\&|LAB|HOSP|EHR^1.2.3^ISO||20250114093000|||T7|T|2.3"; string(out) != want {
+		t.Errorf("got  %q\nwant %q", out, want)
+	}
+}
+
+func TestNewMessageHeaderDefaults(t *testing.T) {
+	data, err := hl7.NewMessage("ADT", "A01", "2.5").Segment("PID").Set("3", "42").Marshal(headerOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "MSH|^~\\&|LAB|HOSP|EHR^1.2.3^ISO||20250114093000||ADT^A01|T7|T|2.5\rPID|||42"; string(data) != want {
+		t.Errorf("got  %q\nwant %q", data, want)
+	}
+}
+
+func TestControlIDGenerators(t *testing.T) {
+	seq := hl7.SequenceControlIDs("", 1)
+	var mu sync.Mutex
+	seen := map[string]bool{}
+	var wg sync.WaitGroup
+	for range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range 100 {
+				id := seq()
+				mu.Lock()
+				seen[id] = true
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	if len(seen) != 800 || !seen["1"] || !seen["800"] {
+		t.Errorf("expected IDs 1 to 800, got %d distinct", len(seen))
+	}
+
+	ulid := hl7.ULIDControlIDs()
+	first, second := ulid(), ulid()
+	ulidPattern := regexp.MustCompile(`^[0-7][0-9A-HJKMNP-TV-Z]{25}$`)
+	if !ulidPattern.MatchString(first) || !ulidPattern.MatchString(second) || first == second {
+		t.Errorf("unexpected ULIDs %q and %q", first, second)
+	}
+	time.Sleep(2 * time.Millisecond)
+	if later := ulid(); later[:10] <= first[:10] {
+		t.Errorf("expected %q to sort after %q", later, first)
+	}
+}
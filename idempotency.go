@@ -0,0 +1,401 @@
+package hl7
+
+import (
+	"bufio"
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Idempotency detects messages that were already received, such as those a
+// sender retransmits after losing the ACK. Messages are identified by a key
+// built from MSH fields and, optionally, a hash of their content:
+//
+//	seen := &hl7.Idempotency{Store: hl7.NewIdempotencyLRU(100000), TTL: 24 * time.Hour}
+//	handler := mllp.HandlerFunc(func(data []byte) []byte {
+//		msg, err := hl7.ParseGeneric(data)
+//		if err != nil {
+//			return nil
+//		}
+//		code := hl7.AckAccept
+//		if dup, err := seen.Seen(data); err != nil {
+//			code = hl7.AckError
+//		} else if !dup {
+//			if err := process(msg); err != nil {
+//				// Let the sender's retransmission be processed again.
+//				seen.Forget(data)
+//				code = hl7.AckError
+//			}
+//		}
+//		ack, _ := hl7.MarshalGeneric(hl7.NewAck(msg, code, ""))
+//		return ack
+//	})
+//
+// An Idempotency is safe for concurrent use if its Store is.
+type Idempotency struct {
+	// Store records the keys of the messages seen so far.
+	Store IdempotencyStore
+	// Fields are the MSH fields that identify a message
+	// (default: MSH-3, MSH-4 and MSH-10).
+	Fields []int
+	// ContentHash adds a hash of the segments after MSH to the key, so that
+	// a reused control ID with different content is not a duplicate.
+	ContentHash bool
+	// TTL is how long a message is remembered (default: until the Store
+	// evicts it).
+	TTL time.Duration
+	// Now returns the current time (default: time.Now).
+	Now func() time.Time
+}
+
+// defaultIdempotencyFields are the sending application, sending facility and
+// message control ID.
+var defaultIdempotencyFields = []int{3, 4, 10}
+
+// Seen reports whether a message with the same key as msg was seen within
+// the TTL, and records msg otherwise. A message without an MSH segment, or
+// without a control ID when MSH-10 is part of the key, is an error.
+func (i *Idempotency) Seen(msg []byte) (dup bool, err error) {
+	key, err := i.Key(msg)
+	if err != nil {
+		return false, err
+	}
+	now := time.Now()
+	if i.Now != nil {
+		now = i.Now()
+	}
+	var expires time.Time
+	if i.TTL > 0 {
+		expires = now.Add(i.TTL)
+	}
+	return i.Store.Add(key, now, expires)
+}
+
+// Forget removes the record of msg, so that it is no longer a duplicate.
+// Call it when a message that Seen recorded could not be processed.
+func (i *Idempotency) Forget(msg []byte) error {
+	key, err := i.Key(msg)
+	if err != nil {
+		return err
+	}
+	return i.Store.Remove(key)
+}
+
+// Key returns the key that Seen records for msg: the hexadecimal SHA-256
+// hash of its key fields and, with ContentHash, its content.
+func (i *Idempotency) Key(msg []byte) (string, error) {
+	segments, err := parseMessage(msg, nil)
+	if err != nil {
+		return "", err
+	}
+	msh := slices.IndexFunc(segments, func(s segmentLine) bool { return s.name == "MSH" })
+	if msh < 0 {
+		return "", fmt.Errorf("hl7: message has no MSH segment")
+	}
+
+	fields := i.Fields
+	if fields == nil {
+		fields = defaultIdempotencyFields
+	}
+	h := sha256.New()
+	for _, field := range fields {
+		// fields[0] is "MSH" and fields[1] is MSH-2, as MSH-1 is the
+		// separator between them.
+		var value string
+		if field >= 2 && field-1 < len(segments[msh].fields) {
+			value = segments[msh].fields[field-1]
+		}
+		if field == 10 && value == "" {
+			return "", fmt.Errorf("hl7: message has no control ID (MSH-10)")
+		}
+		fmt.Fprintf(h, "%d=%s\x00", field, value)
+	}
+	if i.ContentHash {
+		for _, seg := range segments[msh+1:] {
+			h.Write([]byte(strings.Join(seg.fields, seg.fieldSeparator)))
+			h.Write([]byte{'\r'})
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// An IdempotencyStore records the keys of the messages an Idempotency has
+// seen. Implementations must be safe for concurrent use.
+type IdempotencyStore interface {
+	// Add records key until expires, or for as long as the store keeps it
+	// when expires is zero, and reports whether key was already recorded
+	// and had not expired at now. An existing entry keeps its expiry.
+	Add(key string, now, expires time.Time) (seen bool, err error)
+	// Remove deletes key, if it is recorded.
+	Remove(key string) error
+}
+
+// expired reports whether an entry that expires at expires has expired at
+// now. The zero time never expires.
+func expired(expires, now time.Time) bool {
+	return !expires.IsZero() && !expires.After(now)
+}
+
+// IdempotencyLRU is an in-memory IdempotencyStore that keeps the most
+// recently added keys. Its keys are lost when the process exits.
+type IdempotencyLRU struct {
+	mu      sync.Mutex
+	size    int
+	order   *list.List // of *lruEntry, most recently added first
+	entries map[string]*list.Element
+}
+
+type lruEntry struct {
+	key     string
+	expires time.Time
+}
+
+// NewIdempotencyLRU returns a store that keeps at most size keys, evicting
+// the least recently added. A size of zero or less keeps every key until it
+// expires.
+func NewIdempotencyLRU(size int) *IdempotencyLRU {
+	return &IdempotencyLRU{size: size, order: list.New(), entries: make(map[string]*list.Element)}
+}
+
+// Add implements IdempotencyStore.
+func (s *IdempotencyLRU) Add(key string, now, expires time.Time) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if e, ok := s.entries[key]; ok {
+		entry := e.Value.(*lruEntry)
+		if !expired(entry.expires, now) {
+			return true, nil
+		}
+		entry.expires = expires
+		s.order.MoveToFront(e)
+		return false, nil
+	}
+	s.entries[key] = s.order.PushFront(&lruEntry{key: key, expires: expires})
+	for s.size > 0 && s.order.Len() > s.size {
+		oldest := s.order.Back()
+		s.order.Remove(oldest)
+		delete(s.entries, oldest.Value.(*lruEntry).key)
+	}
+	return false, nil
+}
+
+// Remove implements IdempotencyStore.
+func (s *IdempotencyLRU) Remove(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if e, ok := s.entries[key]; ok {
+		s.order.Remove(e)
+		delete(s.entries, key)
+	}
+	return nil
+}
+
+// Len returns the number of keys in the store, including expired ones that
+// have not been evicted yet.
+func (s *IdempotencyLRU) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.order.Len()
+}
+
+// IdempotencyFile is an IdempotencyStore backed by an append-only file, so
+// that keys survive a restart. Every Add is synced to disk before it
+// returns. The file is rewritten without expired keys when it is opened and
+// whenever it has doubled in size since; keys that never expire are kept
+// forever, so use a TTL.
+type IdempotencyFile struct {
+	mu    sync.Mutex
+	path  string
+	f     *os.File
+	keys  map[string]time.Time
+	lines int // in the file
+	// compactAt is the number of lines at which the file is rewritten.
+	compactAt int
+}
+
+// OpenIdempotencyFile opens the store at path, creating it if needed. An
+// incomplete last line, left by a crash during Add, is ignored.
+func OpenIdempotencyFile(path string) (*IdempotencyFile, error) {
+	s := &IdempotencyFile{path: path, keys: make(map[string]time.Time)}
+	f, err := os.Open(path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	if f != nil {
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			key, expires, removed, ok := parseIdempotencyLine(scanner.Text())
+			switch {
+			case !ok:
+			case removed:
+				delete(s.keys, key)
+			default:
+				s.keys[key] = expires
+			}
+		}
+		f.Close()
+		if err := scanner.Err(); err != nil {
+			return nil, fmt.Errorf("hl7: reading %s: %w", path, err)
+		}
+	}
+	if err := s.compact(time.Now()); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// parseIdempotencyLine parses a line of an IdempotencyFile: the expiry in
+// Unix nanoseconds, 0 for none, and the quoted key, or "-" and the quoted
+// key of a removed key.
+func parseIdempotencyLine(line string) (key string, expires time.Time, removed, ok bool) {
+	n, quoted, ok := strings.Cut(line, " ")
+	if !ok {
+		return "", time.Time{}, false, false
+	}
+	key, err := strconv.Unquote(quoted)
+	if err != nil {
+		return "", time.Time{}, false, false
+	}
+	if n == "-" {
+		return key, time.Time{}, true, true
+	}
+	ns, err := strconv.ParseInt(n, 10, 64)
+	if err != nil {
+		return "", time.Time{}, false, false
+	}
+	if ns != 0 {
+		expires = time.Unix(0, ns)
+	}
+	return key, expires, false, true
+}
+
+func formatIdempotencyLine(key string, expires time.Time) string {
+	var ns int64
+	if !expires.IsZero() {
+		ns = expires.UnixNano()
+	}
+	return strconv.FormatInt(ns, 10) + " " + strconv.Quote(key) + "\n"
+}
+
+// compact drops the keys expired at now and rewrites the file with the
+// rest, replacing it atomically.
+func (s *IdempotencyFile) compact(now time.Time) error {
+	var b strings.Builder
+	for key, expires := range s.keys {
+		if expired(expires, now) {
+			delete(s.keys, key)
+			continue
+		}
+		b.WriteString(formatIdempotencyLine(key, expires))
+	}
+
+	tmp := s.path + ".tmp"
+	if err := writeFileSync(tmp, []byte(b.String())); err != nil {
+		return err
+	}
+	if s.f != nil {
+		s.f.Close()
+		s.f = nil
+	}
+	if err := os.Rename(tmp, s.path); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(s.path, os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return err
+	}
+	s.f, s.lines = f, len(s.keys)
+	s.compactAt = 2*s.lines + 1024
+	return nil
+}
+
+// writeFileSync writes data to a new file at path and syncs it.
+func writeFileSync(path string, data []byte) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// Add implements IdempotencyStore.
+func (s *IdempotencyFile) Add(key string, now, expires time.Time) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.f == nil {
+		return false, fmt.Errorf("hl7: idempotency file %s is closed", s.path)
+	}
+	if old, ok := s.keys[key]; ok && !expired(old, now) {
+		return true, nil
+	}
+	if _, err := s.f.WriteString(formatIdempotencyLine(key, expires)); err != nil {
+		return false, err
+	}
+	if err := s.f.Sync(); err != nil {
+		return false, err
+	}
+	s.keys[key] = expires
+	s.lines++
+	if s.lines >= s.compactAt {
+		if err := s.compact(now); err != nil {
+			return false, err
+		}
+	}
+	return false, nil
+}
+
+// Remove implements IdempotencyStore. The removal is synced to disk before
+// it returns.
+func (s *IdempotencyFile) Remove(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.f == nil {
+		return fmt.Errorf("hl7: idempotency file %s is closed", s.path)
+	}
+	if _, ok := s.keys[key]; !ok {
+		return nil
+	}
+	if _, err := s.f.WriteString("- " + strconv.Quote(key) + "\n"); err != nil {
+		return err
+	}
+	if err := s.f.Sync(); err != nil {
+		return err
+	}
+	delete(s.keys, key)
+	s.lines++
+	if s.lines >= s.compactAt {
+		return s.compact(time.Now())
+	}
+	return nil
+}
+
+// Close closes the file. Add and Remove fail once the store is closed.
+func (s *IdempotencyFile) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.f == nil {
+		return nil
+	}
+	err := s.f.Close()
+	s.f = nil
+	return err
+}
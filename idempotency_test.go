@@ -0,0 +1,168 @@
+package hl7_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/esequiel378/hl7"
+)
+
+const idempotencyMessage = "MSH|^~\\&|LAB|HOSP|EHR|HOSP|20250114||ORU^R01|MSG001|P|2.5.1\rPID|1||42\rOBX|1|NM|718-7||13.5\r"
+
+func TestIdempotencySeen(t *testing.T) {
+	now := time.Date(2025, 1, 14, 9, 0, 0, 0, time.UTC)
+	seen := &hl7.Idempotency{Store: hl7.NewIdempotencyLRU(10), TTL: time.Hour, Now: func() time.Time { return now }}
+
+	for i, tc := range []struct {
+		msg  string
+		want bool
+	}{
+		{idempotencyMessage, false},
+		{idempotencyMessage, true},
+		// A retransmission with a new MSH-7 and the same control ID.
+		{strings.Replace(idempotencyMessage, "20250114", "20250115", 1), true},
+		{strings.Replace(idempotencyMessage, "MSG001", "MSG002", 1), false},
+		{strings.Replace(idempotencyMessage, "|HOSP|EHR", "|CLINIC|EHR", 1), false},
+	} {
+		dup, err := seen.Seen([]byte(tc.msg))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if dup != tc.want {
+			t.Errorf("message %d: got %v, want %v", i+1, dup, tc.want)
+		}
+	}
+
+	now = now.Add(time.Hour)
+	if dup, _ := seen.Seen([]byte(idempotencyMessage)); dup {
+		t.Error("expected the message to expire after the TTL")
+	}
+	if dup, _ := seen.Seen([]byte(idempotencyMessage)); !dup {
+		t.Error("expected the message to be recorded again")
+	}
+}
+
+func TestIdempotencyForget(t *testing.T) {
+	seen := &hl7.Idempotency{Store: hl7.NewIdempotencyLRU(10)}
+	if dup, err := seen.Seen([]byte(idempotencyMessage)); err != nil || dup {
+		t.Fatalf("got %v, %v, want a new message", dup, err)
+	}
+	if err := seen.Forget([]byte(idempotencyMessage)); err != nil {
+		t.Fatal(err)
+	}
+	if dup, err := seen.Seen([]byte(idempotencyMessage)); err != nil || dup {
+		t.Errorf("got %v, %v, want a forgotten message to be new", dup, err)
+	}
+	if dup, _ := seen.Seen([]byte(idempotencyMessage)); !dup {
+		t.Error("expected the message to be recorded again")
+	}
+}
+
+func TestIdempotencyKey(t *testing.T) {
+	byID := &hl7.Idempotency{Fields: []int{10}}
+	hashed := &hl7.Idempotency{ContentHash: true}
+	other := strings.Replace(idempotencyMessage, "13.5", "14.1", 1)
+
+	key := func(i *hl7.Idempotency, msg string) string {
+		t.Helper()
+		k, err := i.Key([]byte(msg))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return k
+	}
+	if key(byID, idempotencyMessage) != key(byID, strings.Replace(idempotencyMessage, "LAB", "RIS", 1)) {
+		t.Error("expected MSH-3 not to be part of the key")
+	}
+	if key(hashed, idempotencyMessage) == key(hashed, other) {
+		t.Error("expected the content hash to tell the messages apart")
+	}
+	if key(hashed, idempotencyMessage) != key(hashed, strings.ReplaceAll(idempotencyMessage, "\r", "\n")) {
+		t.Error("expected the content hash to ignore line endings")
+	}
+
+	for name, msg := range map[string]string{
+		"no MSH":        "PID|1||42\r",
+		"no control ID": "MSH|^~\\&|LAB|HOSP\r",
+	} {
+		if _, err := hashed.Key([]byte(msg)); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestIdempotencyLRUEviction(t *testing.T) {
+	store := hl7.NewIdempotencyLRU(2)
+	now := time.Now()
+	for _, key := range []string{"a", "b", "c"} {
+		store.Add(key, now, time.Time{})
+	}
+	if store.Len() != 2 {
+		t.Errorf("expected 2 keys, got %d", store.Len())
+	}
+	if seen, _ := store.Add("a", now, time.Time{}); seen {
+		t.Error("expected the oldest key to be evicted")
+	}
+	if seen, _ := store.Add("c", now, time.Time{}); !seen {
+		t.Error("expected the newest key to be kept")
+	}
+}
+
+func TestIdempotencyFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "seen")
+	store, err := hl7.OpenIdempotencyFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	store.Add("kept", now, now.Add(time.Hour))
+	store.Add("forever", now, time.Time{})
+	store.Add("expired", now.Add(-2*time.Hour), now.Add(-time.Hour))
+	store.Add("with \"quotes\"\nand lines", now, time.Time{})
+	if seen, err := store.Add("kept", now, now.Add(time.Hour)); err != nil || !seen {
+		t.Errorf("expected a duplicate, got %v, %v", seen, err)
+	}
+	store.Add("removed", now, time.Time{})
+	if err := store.Remove("removed"); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Add("closed", now, time.Time{}); err == nil {
+		t.Error("expected an error after Close")
+	}
+
+	// A crash in the middle of a write leaves an incomplete line.
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString(`0 "torn`)
+	f.Close()
+
+	store, err = hl7.OpenIdempotencyFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	for key, want := range map[string]bool{
+		"kept":                       true,
+		"forever":                    true,
+		"with \"quotes\"\nand lines": true,
+		"expired":                    false,
+		"removed":                    false,
+		"torn":                       false,
+	} {
+		if seen, err := store.Add(key, now, time.Time{}); err != nil || seen != want {
+			t.Errorf("%q: got %v, %v, want %v", key, seen, err, want)
+		}
+	}
+	data, _ := os.ReadFile(path)
+	if strings.Count(string(data), "\n") != 6 {
+		t.Errorf("expected the file to be compacted, got %q", data)
+	}
+}
@@ -0,0 +1,1233 @@
+// Code generated by hl7 gen-codec. DO NOT EDIT.
+
+package codectest
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/esequiel378/hl7"
+)
+
+// UnmarshalHL7Message implements hl7.MessageUnmarshaler.
+func (m *ADTMessage) UnmarshalHL7Message(data []byte) error {
+	segments, err := hl7.SplitSegments(data)
+	if err != nil {
+		return err
+	}
+	last := -1
+	for k := range segments {
+		seg := &segments[k]
+		if seg.Name == "NTE" {
+			switch last {
+			case 1:
+				var note Note
+				if err := hl7DecodeNote(seg, &note, seg.Fields, 0, hl7.FieldPath{}); err != nil {
+					return err
+				}
+				m.PID.Notes = append(m.PID.Notes, note)
+			}
+			continue
+		}
+		switch seg.Name {
+		case "MSH":
+			if err := hl7DecodeMSHSegment(seg, &m.MSH, seg.Fields, 0, hl7.FieldPath{}); err != nil {
+				return err
+			}
+			last = 0
+		case "PID":
+			if err := hl7DecodePIDSegment(seg, &m.PID, seg.Fields, 0, hl7.FieldPath{}); err != nil {
+				return err
+			}
+			last = 1
+		case "PV1":
+			if err := hl7DecodePV1Segment(seg, &m.PV1, seg.Fields, 0, hl7.FieldPath{}); err != nil {
+				return err
+			}
+			last = 2
+		}
+	}
+	return nil
+}
+
+// MarshalHL7Message implements hl7.MessageMarshaler.
+func (m ADTMessage) MarshalHL7Message(opts hl7.MarshalOptions) ([]byte, error) {
+	ec := string([]byte{opts.ComponentSeparator, opts.RepetitionSeparator, opts.EscapeCharacter, opts.SubcomponentSeparator})
+	var lines [][]byte
+	{
+		line, err := hl7EncodeSegmentMSHSegment("MSH", &m.MSH, opts, ec)
+		if err != nil {
+			return nil, err
+		}
+		lines = append(lines, line)
+	}
+	{
+		line, err := hl7EncodeSegmentPIDSegment("PID", &m.PID, opts, ec)
+		if err != nil {
+			return nil, err
+		}
+		lines = append(lines, line)
+		for k := range m.PID.Notes {
+			line, err := hl7EncodeSegmentNote("NTE", &m.PID.Notes[k], opts, ec)
+			if err != nil {
+				return nil, err
+			}
+			lines = append(lines, line)
+		}
+	}
+	{
+		line, err := hl7EncodeSegmentPV1Segment("PV1", &m.PV1, opts, ec)
+		if err != nil {
+			return nil, err
+		}
+		lines = append(lines, line)
+	}
+	return bytes.Join(lines, []byte(opts.LineEnding)), nil
+}
+
+// UnmarshalHL7Message implements hl7.MessageUnmarshaler.
+func (m *ORUMessage) UnmarshalHL7Message(data []byte) error {
+	segments, err := hl7.SplitSegments(data)
+	if err != nil {
+		return err
+	}
+	last := -1
+	for k := range segments {
+		seg := &segments[k]
+		if seg.Name == "NTE" {
+			switch last {
+			case 1:
+				var note Note
+				if err := hl7DecodeNote(seg, &note, seg.Fields, 0, hl7.FieldPath{}); err != nil {
+					return err
+				}
+				m.PID.Notes = append(m.PID.Notes, note)
+			case 2:
+				var note Note
+				if err := hl7DecodeNote(seg, &note, seg.Fields, 0, hl7.FieldPath{}); err != nil {
+					return err
+				}
+				m.OBX.Notes = append(m.OBX.Notes, note)
+			}
+			continue
+		}
+		switch seg.Name {
+		case "MSH":
+			if err := hl7DecodeMSHSegment(seg, &m.MSH, seg.Fields, 0, hl7.FieldPath{}); err != nil {
+				return err
+			}
+			last = 0
+		case "PID":
+			if err := hl7DecodePIDSegment(seg, &m.PID, seg.Fields, 0, hl7.FieldPath{}); err != nil {
+				return err
+			}
+			last = 1
+		case "OBX":
+			if err := hl7DecodeOBXSegment(seg, &m.OBX, seg.Fields, 0, hl7.FieldPath{}); err != nil {
+				return err
+			}
+			last = 2
+		}
+	}
+	return nil
+}
+
+// MarshalHL7Message implements hl7.MessageMarshaler.
+func (m ORUMessage) MarshalHL7Message(opts hl7.MarshalOptions) ([]byte, error) {
+	ec := string([]byte{opts.ComponentSeparator, opts.RepetitionSeparator, opts.EscapeCharacter, opts.SubcomponentSeparator})
+	var lines [][]byte
+	{
+		line, err := hl7EncodeSegmentMSHSegment("MSH", &m.MSH, opts, ec)
+		if err != nil {
+			return nil, err
+		}
+		lines = append(lines, line)
+	}
+	{
+		line, err := hl7EncodeSegmentPIDSegment("PID", &m.PID, opts, ec)
+		if err != nil {
+			return nil, err
+		}
+		lines = append(lines, line)
+		for k := range m.PID.Notes {
+			line, err := hl7EncodeSegmentNote("NTE", &m.PID.Notes[k], opts, ec)
+			if err != nil {
+				return nil, err
+			}
+			lines = append(lines, line)
+		}
+	}
+	{
+		line, err := hl7EncodeSegmentOBXSegment("OBX", &m.OBX, opts, ec)
+		if err != nil {
+			return nil, err
+		}
+		lines = append(lines, line)
+		for k := range m.OBX.Notes {
+			line, err := hl7EncodeSegmentNote("NTE", &m.OBX.Notes[k], opts, ec)
+			if err != nil {
+				return nil, err
+			}
+			lines = append(lines, line)
+		}
+	}
+	return bytes.Join(lines, []byte(opts.LineEnding)), nil
+}
+
+func hl7DecodeNote(seg *hl7.RawSegment, v *Note, fields []string, level uint, at hl7.FieldPath) error {
+	off := 0
+	if seg.Name == "MSH" || level > 0 {
+		off = 1
+	}
+	if i := 1 - off; i >= 0 && i < len(fields) {
+		raw := fields[i]
+		if seg.Name == "MSH" && level == 0 && i == 0 {
+			raw = seg.FieldSeparator
+		}
+		if n1, err := hl7.DecodeInt(raw, 0); err != nil {
+			return seg.FieldError(at.Child(level, 1), raw, err)
+		} else {
+			v.SetID = int(n1)
+		}
+	}
+	if i := 2 - off; i >= 0 && i < len(fields) {
+		raw := fields[i]
+		if seg.Name == "MSH" && level == 0 && i == 0 {
+			raw = seg.FieldSeparator
+		}
+		v.Source = raw
+	}
+	if i := 3 - off; i >= 0 && i < len(fields) {
+		raw := fields[i]
+		if seg.Name == "MSH" && level == 0 && i == 0 {
+			raw = seg.FieldSeparator
+		}
+		v.Comment = raw
+	}
+	return nil
+}
+
+func hl7EncodeNote(v *Note, cs string) (string, error) {
+	parts := make([]string, 3)
+	parts[0] = strconv.FormatInt(int64(v.SetID), 10)
+	parts[1] = string(v.Source)
+	parts[2] = string(v.Comment)
+	for len(parts) > 0 && parts[len(parts)-1] == "" {
+		parts = parts[:len(parts)-1]
+	}
+	return strings.Join(parts, cs), nil
+}
+
+func hl7EncodeSegmentNote(name string, v *Note, opts hl7.MarshalOptions, ec string) ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteString(name)
+	fs := string(opts.FieldSeparator)
+	isMSH := name == "MSH"
+	for idx := 1; idx <= 3; idx++ {
+		if isMSH && idx == 1 {
+			buf.WriteByte(opts.FieldSeparator)
+			continue
+		}
+		if !(isMSH && idx == 2) {
+			buf.WriteString(fs)
+		}
+		switch idx {
+		case 1:
+			var str string
+			str = strconv.FormatInt(int64(v.SetID), 10)
+			buf.WriteString(str)
+		case 2:
+			if isMSH {
+				buf.WriteString(ec)
+				continue
+			}
+			var str string
+			str = string(v.Source)
+			buf.WriteString(str)
+		case 3:
+			var str string
+			str = string(v.Comment)
+			buf.WriteString(str)
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+func hl7DecodeMSHSegment(seg *hl7.RawSegment, v *MSHSegment, fields []string, level uint, at hl7.FieldPath) error {
+	ec := seg.EncodingCharacters
+	cs := "^"
+	if len(ec) > 0 {
+		cs = string(ec[0])
+	}
+	off := 0
+	if seg.Name == "MSH" || level > 0 {
+		off = 1
+	}
+	if i := 1 - off; i >= 0 && i < len(fields) {
+		raw := fields[i]
+		if seg.Name == "MSH" && level == 0 && i == 0 {
+			raw = seg.FieldSeparator
+		}
+		v.FieldSeparator = raw
+	}
+	if i := 2 - off; i >= 0 && i < len(fields) {
+		raw := fields[i]
+		if seg.Name == "MSH" && level == 0 && i == 0 {
+			raw = seg.FieldSeparator
+		}
+		v.EncodingCharacters = raw
+	}
+	if i := 3 - off; i >= 0 && i < len(fields) {
+		raw := fields[i]
+		if seg.Name == "MSH" && level == 0 && i == 0 {
+			raw = seg.FieldSeparator
+		}
+		v.SendingApplication = raw
+	}
+	if i := 4 - off; i >= 0 && i < len(fields) {
+		raw := fields[i]
+		if seg.Name == "MSH" && level == 0 && i == 0 {
+			raw = seg.FieldSeparator
+		}
+		v.SendingFacility = raw
+	}
+	if i := 5 - off; i >= 0 && i < len(fields) {
+		raw := fields[i]
+		if seg.Name == "MSH" && level == 0 && i == 0 {
+			raw = seg.FieldSeparator
+		}
+		v.ReceivingApplication = raw
+	}
+	if i := 6 - off; i >= 0 && i < len(fields) {
+		raw := fields[i]
+		if seg.Name == "MSH" && level == 0 && i == 0 {
+			raw = seg.FieldSeparator
+		}
+		v.ReceivingFacility = raw
+	}
+	if i := 7 - off; i >= 0 && i < len(fields) {
+		raw := fields[i]
+		if seg.Name == "MSH" && level == 0 && i == 0 {
+			raw = seg.FieldSeparator
+		}
+		if comps := strings.Split(raw, cs); len(comps) > 1 {
+			if err := hl7DecodeHl7Timestamp(seg, &v.DateTimeOfMessage, comps, level+1, at.Child(level, 7)); err != nil {
+				return err
+			}
+		} else {
+			if err := v.DateTimeOfMessage.Unmarshal([]byte(raw)); err != nil {
+				return seg.FieldError(at.Child(level, 7), raw, err)
+			}
+		}
+	}
+	if i := 9 - off; i >= 0 && i < len(fields) {
+		raw := fields[i]
+		if seg.Name == "MSH" && level == 0 && i == 0 {
+			raw = seg.FieldSeparator
+		}
+		if comps := strings.Split(raw, cs); len(comps) > 1 {
+			if err := hl7DecodeMessageType(seg, &v.MessageType, comps, level+1, at.Child(level, 9)); err != nil {
+				return err
+			}
+		}
+	}
+	if i := 10 - off; i >= 0 && i < len(fields) {
+		raw := fields[i]
+		if seg.Name == "MSH" && level == 0 && i == 0 {
+			raw = seg.FieldSeparator
+		}
+		v.MessageControlID = raw
+	}
+	if i := 11 - off; i >= 0 && i < len(fields) {
+		raw := fields[i]
+		if seg.Name == "MSH" && level == 0 && i == 0 {
+			raw = seg.FieldSeparator
+		}
+		v.ProcessingID = raw
+	}
+	if i := 12 - off; i >= 0 && i < len(fields) {
+		raw := fields[i]
+		if seg.Name == "MSH" && level == 0 && i == 0 {
+			raw = seg.FieldSeparator
+		}
+		v.VersionID = raw
+	}
+	if i := 13 - off; i >= 0 && i < len(fields) {
+		raw := fields[i]
+		if seg.Name == "MSH" && level == 0 && i == 0 {
+			raw = seg.FieldSeparator
+		}
+		if v.SequenceNumber == nil {
+			v.SequenceNumber = new(int)
+		}
+		if n2, err := hl7.DecodeInt(raw, 0); err != nil {
+			return seg.FieldError(at.Child(level, 13), raw, err)
+		} else {
+			(*v.SequenceNumber) = int(n2)
+		}
+		if *v.SequenceNumber == 0 {
+			v.SequenceNumber = nil
+		}
+	}
+	return nil
+}
+
+func hl7EncodeMSHSegment(v *MSHSegment, cs string) (string, error) {
+	parts := make([]string, 13)
+	parts[0] = string(v.FieldSeparator)
+	parts[1] = string(v.EncodingCharacters)
+	parts[2] = string(v.SendingApplication)
+	parts[3] = string(v.SendingFacility)
+	parts[4] = string(v.ReceivingApplication)
+	parts[5] = string(v.ReceivingFacility)
+	if b3, err := v.DateTimeOfMessage.MarshalHL7(); err != nil {
+		return "", err
+	} else {
+		parts[6] = string(b3)
+	}
+	if s4, err := hl7EncodeMessageType(&v.MessageType, ""); err != nil {
+		return "", err
+	} else {
+		parts[8] = s4
+	}
+	parts[9] = string(v.MessageControlID)
+	parts[10] = string(v.ProcessingID)
+	parts[11] = string(v.VersionID)
+	if v.SequenceNumber != nil {
+		parts[12] = strconv.FormatInt(int64((*v.SequenceNumber)), 10)
+	}
+	for len(parts) > 0 && parts[len(parts)-1] == "" {
+		parts = parts[:len(parts)-1]
+	}
+	return strings.Join(parts, cs), nil
+}
+
+func hl7EncodeSegmentMSHSegment(name string, v *MSHSegment, opts hl7.MarshalOptions, ec string) ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteString(name)
+	fs := string(opts.FieldSeparator)
+	cs := string(opts.ComponentSeparator)
+	isMSH := name == "MSH"
+	for idx := 1; idx <= 13; idx++ {
+		if isMSH && idx == 1 {
+			buf.WriteByte(opts.FieldSeparator)
+			continue
+		}
+		if !(isMSH && idx == 2) {
+			buf.WriteString(fs)
+		}
+		switch idx {
+		case 1:
+			var str string
+			str = string(v.FieldSeparator)
+			buf.WriteString(str)
+		case 2:
+			if isMSH {
+				buf.WriteString(ec)
+				continue
+			}
+			var str string
+			str = string(v.EncodingCharacters)
+			buf.WriteString(str)
+		case 3:
+			var str string
+			str = string(v.SendingApplication)
+			buf.WriteString(str)
+		case 4:
+			var str string
+			str = string(v.SendingFacility)
+			buf.WriteString(str)
+		case 5:
+			var str string
+			str = string(v.ReceivingApplication)
+			buf.WriteString(str)
+		case 6:
+			var str string
+			str = string(v.ReceivingFacility)
+			buf.WriteString(str)
+		case 7:
+			var str string
+			if b5, err := v.DateTimeOfMessage.MarshalHL7(); err != nil {
+				return nil, fmt.Errorf("hl7: %s.%d: %w", name, idx, err)
+			} else {
+				str = string(b5)
+			}
+			buf.WriteString(str)
+		case 9:
+			var str string
+			if s6, err := hl7EncodeMessageType(&v.MessageType, cs); err != nil {
+				return nil, fmt.Errorf("hl7: %s.%d: %w", name, idx, err)
+			} else {
+				str = s6
+			}
+			buf.WriteString(str)
+		case 10:
+			var str string
+			str = string(v.MessageControlID)
+			buf.WriteString(str)
+		case 11:
+			var str string
+			str = string(v.ProcessingID)
+			buf.WriteString(str)
+		case 12:
+			var str string
+			str = string(v.VersionID)
+			buf.WriteString(str)
+		case 13:
+			var str string
+			if v.SequenceNumber != nil {
+				str = strconv.FormatInt(int64((*v.SequenceNumber)), 10)
+			}
+			buf.WriteString(str)
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+func hl7DecodePIDSegment(seg *hl7.RawSegment, v *PIDSegment, fields []string, level uint, at hl7.FieldPath) error {
+	ec := seg.EncodingCharacters
+	cs := "^"
+	if len(ec) > 0 {
+		cs = string(ec[0])
+	}
+	rs := ""
+	if len(ec) > 1 {
+		rs = string(ec[1])
+	}
+	off := 0
+	if seg.Name == "MSH" || level > 0 {
+		off = 1
+	}
+	if i := 1 - off; i >= 0 && i < len(fields) {
+		raw := fields[i]
+		if seg.Name == "MSH" && level == 0 && i == 0 {
+			raw = seg.FieldSeparator
+		}
+		if n7, err := hl7.DecodeUint(raw, 0); err != nil {
+			return seg.FieldError(at.Child(level, 1), raw, err)
+		} else {
+			v.SetID = uint(n7)
+		}
+	}
+	if i := 3 - off; i >= 0 && i < len(fields) {
+		raw := fields[i]
+		if seg.Name == "MSH" && level == 0 && i == 0 {
+			raw = seg.FieldSeparator
+		}
+		if rs != "" {
+			reps := strings.Split(raw, rs)
+			s := make([]string, len(reps))
+			for ri, rep := range reps {
+				s[ri] = rep
+			}
+			v.Identifiers = s
+		} else {
+			if err := fmt.Errorf("%w: %s", hl7.ErrUnsupportedKind, "slice"); err != nil {
+				return seg.FieldError(at.Child(level, 3), raw, err)
+			}
+		}
+	}
+	if i := 5 - off; i >= 0 && i < len(fields) {
+		raw := fields[i]
+		if seg.Name == "MSH" && level == 0 && i == 0 {
+			raw = seg.FieldSeparator
+		}
+		if rs != "" {
+			reps := strings.Split(raw, rs)
+			s := make([]PatientName, len(reps))
+			for ri, rep := range reps {
+				if comps := strings.Split(rep, cs); len(comps) > 1 {
+					if err := hl7DecodePatientName(seg, &s[ri], comps, level+1, at.Child(level, 5).Repeat(level, ri+1)); err != nil {
+						return err
+					}
+					continue
+				}
+				if err := fmt.Errorf("%w: %s", hl7.ErrUnsupportedKind, "struct"); err != nil {
+					return seg.FieldError(at.Child(level, 5).Repeat(level, ri+1), rep, err)
+				}
+			}
+			v.Names = s
+		} else {
+			if err := fmt.Errorf("%w: %s", hl7.ErrUnsupportedKind, "slice"); err != nil {
+				return seg.FieldError(at.Child(level, 5), raw, err)
+			}
+		}
+	}
+	if i := 7 - off; i >= 0 && i < len(fields) {
+		raw := fields[i]
+		if seg.Name == "MSH" && level == 0 && i == 0 {
+			raw = seg.FieldSeparator
+		}
+		if comps := strings.Split(raw, cs); len(comps) > 1 {
+			if err := hl7DecodeHl7Timestamp(seg, &v.DateOfBirth, comps, level+1, at.Child(level, 7)); err != nil {
+				return err
+			}
+		} else {
+			if err := v.DateOfBirth.Unmarshal([]byte(raw)); err != nil {
+				return seg.FieldError(at.Child(level, 7), raw, err)
+			}
+		}
+	}
+	if i := 8 - off; i >= 0 && i < len(fields) {
+		raw := fields[i]
+		if seg.Name == "MSH" && level == 0 && i == 0 {
+			raw = seg.FieldSeparator
+		}
+		v.Sex = raw
+	}
+	if i := 30 - off; i >= 0 && i < len(fields) {
+		raw := fields[i]
+		if seg.Name == "MSH" && level == 0 && i == 0 {
+			raw = seg.FieldSeparator
+		}
+		if v.Deceased == nil {
+			v.Deceased = new(bool)
+		}
+		if b8, err := hl7.DecodeBool(raw); err != nil {
+			return seg.FieldError(at.Child(level, 30), raw, err)
+		} else {
+			(*v.Deceased) = bool(b8)
+		}
+		if *v.Deceased == false {
+			v.Deceased = nil
+		}
+	}
+	return nil
+}
+
+func hl7EncodePIDSegment(v *PIDSegment, cs string) (string, error) {
+	parts := make([]string, 30)
+	parts[0] = strconv.FormatUint(uint64(v.SetID), 10)
+	parts9 := make([]string, 0, len(v.Identifiers))
+	for k10 := range v.Identifiers {
+		var item11 string
+		item11 = string(v.Identifiers[k10])
+		parts9 = append(parts9, item11)
+	}
+	parts[2] = strings.Join(parts9, "")
+	parts12 := make([]string, 0, len(v.Names))
+	for k13 := range v.Names {
+		var item14 string
+		if s15, err := hl7EncodePatientName(&v.Names[k13], ""); err != nil {
+			return "", err
+		} else {
+			item14 = s15
+		}
+		parts12 = append(parts12, item14)
+	}
+	parts[4] = strings.Join(parts12, "")
+	if b16, err := v.DateOfBirth.MarshalHL7(); err != nil {
+		return "", err
+	} else {
+		parts[6] = string(b16)
+	}
+	parts[7] = string(v.Sex)
+	if v.Deceased != nil {
+		if *v.Deceased {
+			parts[29] = "Y"
+		} else {
+			parts[29] = "N"
+		}
+	}
+	for len(parts) > 0 && parts[len(parts)-1] == "" {
+		parts = parts[:len(parts)-1]
+	}
+	return strings.Join(parts, cs), nil
+}
+
+func hl7EncodeSegmentPIDSegment(name string, v *PIDSegment, opts hl7.MarshalOptions, ec string) ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteString(name)
+	fs := string(opts.FieldSeparator)
+	cs := string(opts.ComponentSeparator)
+	rs := string(opts.RepetitionSeparator)
+	isMSH := name == "MSH"
+	for idx := 1; idx <= 30; idx++ {
+		if isMSH && idx == 1 {
+			buf.WriteByte(opts.FieldSeparator)
+			continue
+		}
+		if !(isMSH && idx == 2) {
+			buf.WriteString(fs)
+		}
+		switch idx {
+		case 1:
+			var str string
+			str = strconv.FormatUint(uint64(v.SetID), 10)
+			buf.WriteString(str)
+		case 3:
+			var str string
+			parts17 := make([]string, 0, len(v.Identifiers))
+			for k18 := range v.Identifiers {
+				var item19 string
+				item19 = string(v.Identifiers[k18])
+				parts17 = append(parts17, item19)
+			}
+			str = strings.Join(parts17, rs)
+			buf.WriteString(str)
+		case 5:
+			var str string
+			parts20 := make([]string, 0, len(v.Names))
+			for k21 := range v.Names {
+				var item22 string
+				if s23, err := hl7EncodePatientName(&v.Names[k21], cs); err != nil {
+					return nil, fmt.Errorf("hl7: %s.%d: %w", name, idx, err)
+				} else {
+					item22 = s23
+				}
+				parts20 = append(parts20, item22)
+			}
+			str = strings.Join(parts20, rs)
+			buf.WriteString(str)
+		case 7:
+			var str string
+			if b24, err := v.DateOfBirth.MarshalHL7(); err != nil {
+				return nil, fmt.Errorf("hl7: %s.%d: %w", name, idx, err)
+			} else {
+				str = string(b24)
+			}
+			buf.WriteString(str)
+		case 8:
+			var str string
+			str = string(v.Sex)
+			buf.WriteString(str)
+		case 30:
+			var str string
+			if v.Deceased != nil {
+				if *v.Deceased {
+					str = "Y"
+				} else {
+					str = "N"
+				}
+			}
+			buf.WriteString(str)
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+func hl7DecodePV1Segment(seg *hl7.RawSegment, v *PV1Segment, fields []string, level uint, at hl7.FieldPath) error {
+	ec := seg.EncodingCharacters
+	cs := "^"
+	if len(ec) > 0 {
+		cs = string(ec[0])
+	}
+	off := 0
+	if seg.Name == "MSH" || level > 0 {
+		off = 1
+	}
+	if i := 1 - off; i >= 0 && i < len(fields) {
+		raw := fields[i]
+		if seg.Name == "MSH" && level == 0 && i == 0 {
+			raw = seg.FieldSeparator
+		}
+		if n25, err := hl7.DecodeInt(raw, 8); err != nil {
+			return seg.FieldError(at.Child(level, 1), raw, err)
+		} else {
+			v.SetID = int8(n25)
+		}
+	}
+	if i := 2 - off; i >= 0 && i < len(fields) {
+		raw := fields[i]
+		if seg.Name == "MSH" && level == 0 && i == 0 {
+			raw = seg.FieldSeparator
+		}
+		v.PatientClass = raw
+	}
+	if i := 3 - off; i >= 0 && i < len(fields) {
+		raw := fields[i]
+		if seg.Name == "MSH" && level == 0 && i == 0 {
+			raw = seg.FieldSeparator
+		}
+		if comps := strings.Split(raw, cs); len(comps) > 1 {
+			if err := hl7DecodeAnon1(seg, &v.Location, comps, level+1, at.Child(level, 3)); err != nil {
+				return err
+			}
+		}
+	}
+	if i := 19 - off; i >= 0 && i < len(fields) {
+		raw := fields[i]
+		if seg.Name == "MSH" && level == 0 && i == 0 {
+			raw = seg.FieldSeparator
+		}
+		if n26, err := hl7.DecodeInt(raw, 64); err != nil {
+			return seg.FieldError(at.Child(level, 19), raw, err)
+		} else {
+			v.VisitNumber = int64(n26)
+		}
+	}
+	return nil
+}
+
+func hl7EncodePV1Segment(v *PV1Segment, cs string) (string, error) {
+	parts := make([]string, 19)
+	parts[0] = strconv.FormatInt(int64(v.SetID), 10)
+	parts[1] = string(v.PatientClass)
+	if s27, err := hl7EncodeAnon1(&v.Location, ""); err != nil {
+		return "", err
+	} else {
+		parts[2] = s27
+	}
+	parts[18] = strconv.FormatInt(int64(v.VisitNumber), 10)
+	for len(parts) > 0 && parts[len(parts)-1] == "" {
+		parts = parts[:len(parts)-1]
+	}
+	return strings.Join(parts, cs), nil
+}
+
+func hl7EncodeSegmentPV1Segment(name string, v *PV1Segment, opts hl7.MarshalOptions, ec string) ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteString(name)
+	fs := string(opts.FieldSeparator)
+	cs := string(opts.ComponentSeparator)
+	isMSH := name == "MSH"
+	for idx := 1; idx <= 19; idx++ {
+		if isMSH && idx == 1 {
+			buf.WriteByte(opts.FieldSeparator)
+			continue
+		}
+		if !(isMSH && idx == 2) {
+			buf.WriteString(fs)
+		}
+		switch idx {
+		case 1:
+			var str string
+			str = strconv.FormatInt(int64(v.SetID), 10)
+			buf.WriteString(str)
+		case 2:
+			if isMSH {
+				buf.WriteString(ec)
+				continue
+			}
+			var str string
+			str = string(v.PatientClass)
+			buf.WriteString(str)
+		case 3:
+			var str string
+			if s28, err := hl7EncodeAnon1(&v.Location, cs); err != nil {
+				return nil, fmt.Errorf("hl7: %s.%d: %w", name, idx, err)
+			} else {
+				str = s28
+			}
+			buf.WriteString(str)
+		case 19:
+			var str string
+			str = strconv.FormatInt(int64(v.VisitNumber), 10)
+			buf.WriteString(str)
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+func hl7DecodeOBXSegment(seg *hl7.RawSegment, v *OBXSegment, fields []string, level uint, at hl7.FieldPath) error {
+	ec := seg.EncodingCharacters
+	rs := ""
+	if len(ec) > 1 {
+		rs = string(ec[1])
+	}
+	off := 0
+	if seg.Name == "MSH" || level > 0 {
+		off = 1
+	}
+	if i := 1 - off; i >= 0 && i < len(fields) {
+		raw := fields[i]
+		if seg.Name == "MSH" && level == 0 && i == 0 {
+			raw = seg.FieldSeparator
+		}
+		if n29, err := hl7.DecodeInt(raw, 16); err != nil {
+			return seg.FieldError(at.Child(level, 1), raw, err)
+		} else {
+			v.SetID = int16(n29)
+		}
+	}
+	if i := 2 - off; i >= 0 && i < len(fields) {
+		raw := fields[i]
+		if seg.Name == "MSH" && level == 0 && i == 0 {
+			raw = seg.FieldSeparator
+		}
+		v.ValueType = raw
+	}
+	if i := 3 - off; i >= 0 && i < len(fields) {
+		raw := fields[i]
+		if seg.Name == "MSH" && level == 0 && i == 0 {
+			raw = seg.FieldSeparator
+		}
+		if rs != "" {
+			reps := strings.Split(raw, rs)
+			s := make([]string, len(reps))
+			for ri, rep := range reps {
+				s[ri] = rep
+			}
+			v.Identifier = s
+		} else {
+			if err := fmt.Errorf("%w: %s", hl7.ErrUnsupportedKind, "slice"); err != nil {
+				return seg.FieldError(at.Child(level, 3), raw, err)
+			}
+		}
+	}
+	if i := 5 - off; i >= 0 && i < len(fields) {
+		raw := fields[i]
+		if seg.Name == "MSH" && level == 0 && i == 0 {
+			raw = seg.FieldSeparator
+		}
+		if n30, err := hl7.DecodeFloat(raw, 64); err != nil {
+			return seg.FieldError(at.Child(level, 5), raw, err)
+		} else {
+			v.Value = float64(n30)
+		}
+	}
+	if i := 6 - off; i >= 0 && i < len(fields) {
+		raw := fields[i]
+		if seg.Name == "MSH" && level == 0 && i == 0 {
+			raw = seg.FieldSeparator
+		}
+		v.Units = raw
+	}
+	if i := 7 - off; i >= 0 && i < len(fields) {
+		raw := fields[i]
+		if seg.Name == "MSH" && level == 0 && i == 0 {
+			raw = seg.FieldSeparator
+		}
+		v.ReferenceRange = raw
+	}
+	if i := 10 - off; i >= 0 && i < len(fields) {
+		raw := fields[i]
+		if seg.Name == "MSH" && level == 0 && i == 0 {
+			raw = seg.FieldSeparator
+		}
+		if b31, err := hl7.DecodeBool(raw); err != nil {
+			return seg.FieldError(at.Child(level, 10), raw, err)
+		} else {
+			v.Normal = bool(b31)
+		}
+	}
+	return nil
+}
+
+func hl7EncodeOBXSegment(v *OBXSegment, cs string) (string, error) {
+	parts := make([]string, 10)
+	parts[0] = strconv.FormatInt(int64(v.SetID), 10)
+	parts[1] = string(v.ValueType)
+	parts32 := make([]string, 0, len(v.Identifier))
+	for k33 := range v.Identifier {
+		var item34 string
+		item34 = string(v.Identifier[k33])
+		parts32 = append(parts32, item34)
+	}
+	parts[2] = strings.Join(parts32, "")
+	parts[4] = strconv.FormatFloat(float64(v.Value), 'f', -1, 64)
+	parts[5] = string(v.Units)
+	parts[6] = string(v.ReferenceRange)
+	if v.Normal {
+		parts[9] = "Y"
+	} else {
+		parts[9] = "N"
+	}
+	for len(parts) > 0 && parts[len(parts)-1] == "" {
+		parts = parts[:len(parts)-1]
+	}
+	return strings.Join(parts, cs), nil
+}
+
+func hl7EncodeSegmentOBXSegment(name string, v *OBXSegment, opts hl7.MarshalOptions, ec string) ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteString(name)
+	fs := string(opts.FieldSeparator)
+	rs := string(opts.RepetitionSeparator)
+	isMSH := name == "MSH"
+	for idx := 1; idx <= 10; idx++ {
+		if isMSH && idx == 1 {
+			buf.WriteByte(opts.FieldSeparator)
+			continue
+		}
+		if !(isMSH && idx == 2) {
+			buf.WriteString(fs)
+		}
+		switch idx {
+		case 1:
+			var str string
+			str = strconv.FormatInt(int64(v.SetID), 10)
+			buf.WriteString(str)
+		case 2:
+			if isMSH {
+				buf.WriteString(ec)
+				continue
+			}
+			var str string
+			str = string(v.ValueType)
+			buf.WriteString(str)
+		case 3:
+			var str string
+			parts35 := make([]string, 0, len(v.Identifier))
+			for k36 := range v.Identifier {
+				var item37 string
+				item37 = string(v.Identifier[k36])
+				parts35 = append(parts35, item37)
+			}
+			str = strings.Join(parts35, rs)
+			buf.WriteString(str)
+		case 5:
+			var str string
+			str = strconv.FormatFloat(float64(v.Value), 'f', -1, 64)
+			buf.WriteString(str)
+		case 6:
+			var str string
+			str = string(v.Units)
+			buf.WriteString(str)
+		case 7:
+			var str string
+			str = string(v.ReferenceRange)
+			buf.WriteString(str)
+		case 10:
+			var str string
+			if v.Normal {
+				str = "Y"
+			} else {
+				str = "N"
+			}
+			buf.WriteString(str)
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+func hl7DecodeHl7Timestamp(seg *hl7.RawSegment, v *hl7.Timestamp, fields []string, level uint, at hl7.FieldPath) error {
+	return nil
+}
+
+func hl7EncodeHl7Timestamp(v *hl7.Timestamp, cs string) (string, error) {
+	return "", nil
+}
+
+func hl7EncodeSegmentHl7Timestamp(name string, v *hl7.Timestamp, opts hl7.MarshalOptions, ec string) ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteString(name)
+	return buf.Bytes(), nil
+}
+
+func hl7DecodeMessageType(seg *hl7.RawSegment, v *MessageType, fields []string, level uint, at hl7.FieldPath) error {
+	off := 0
+	if seg.Name == "MSH" || level > 0 {
+		off = 1
+	}
+	if i := 1 - off; i >= 0 && i < len(fields) {
+		raw := fields[i]
+		if seg.Name == "MSH" && level == 0 && i == 0 {
+			raw = seg.FieldSeparator
+		}
+		v.Code = raw
+	}
+	if i := 2 - off; i >= 0 && i < len(fields) {
+		raw := fields[i]
+		if seg.Name == "MSH" && level == 0 && i == 0 {
+			raw = seg.FieldSeparator
+		}
+		v.Trigger = raw
+	}
+	return nil
+}
+
+func hl7EncodeMessageType(v *MessageType, cs string) (string, error) {
+	parts := make([]string, 2)
+	parts[0] = string(v.Code)
+	parts[1] = string(v.Trigger)
+	for len(parts) > 0 && parts[len(parts)-1] == "" {
+		parts = parts[:len(parts)-1]
+	}
+	return strings.Join(parts, cs), nil
+}
+
+func hl7EncodeSegmentMessageType(name string, v *MessageType, opts hl7.MarshalOptions, ec string) ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteString(name)
+	fs := string(opts.FieldSeparator)
+	isMSH := name == "MSH"
+	for idx := 1; idx <= 2; idx++ {
+		if isMSH && idx == 1 {
+			buf.WriteByte(opts.FieldSeparator)
+			continue
+		}
+		if !(isMSH && idx == 2) {
+			buf.WriteString(fs)
+		}
+		switch idx {
+		case 1:
+			var str string
+			str = string(v.Code)
+			buf.WriteString(str)
+		case 2:
+			if isMSH {
+				buf.WriteString(ec)
+				continue
+			}
+			var str string
+			str = string(v.Trigger)
+			buf.WriteString(str)
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+func hl7DecodePatientName(seg *hl7.RawSegment, v *PatientName, fields []string, level uint, at hl7.FieldPath) error {
+	off := 0
+	if seg.Name == "MSH" || level > 0 {
+		off = 1
+	}
+	if i := 1 - off; i >= 0 && i < len(fields) {
+		raw := fields[i]
+		if seg.Name == "MSH" && level == 0 && i == 0 {
+			raw = seg.FieldSeparator
+		}
+		v.Family = raw
+	}
+	if i := 2 - off; i >= 0 && i < len(fields) {
+		raw := fields[i]
+		if seg.Name == "MSH" && level == 0 && i == 0 {
+			raw = seg.FieldSeparator
+		}
+		v.Given = raw
+	}
+	if i := 3 - off; i >= 0 && i < len(fields) {
+		raw := fields[i]
+		if seg.Name == "MSH" && level == 0 && i == 0 {
+			raw = seg.FieldSeparator
+		}
+		v.Middle = raw
+	}
+	return nil
+}
+
+func hl7EncodePatientName(v *PatientName, cs string) (string, error) {
+	parts := make([]string, 3)
+	parts[0] = string(v.Family)
+	parts[1] = string(v.Given)
+	parts[2] = string(v.Middle)
+	for len(parts) > 0 && parts[len(parts)-1] == "" {
+		parts = parts[:len(parts)-1]
+	}
+	return strings.Join(parts, cs), nil
+}
+
+func hl7EncodeSegmentPatientName(name string, v *PatientName, opts hl7.MarshalOptions, ec string) ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteString(name)
+	fs := string(opts.FieldSeparator)
+	isMSH := name == "MSH"
+	for idx := 1; idx <= 3; idx++ {
+		if isMSH && idx == 1 {
+			buf.WriteByte(opts.FieldSeparator)
+			continue
+		}
+		if !(isMSH && idx == 2) {
+			buf.WriteString(fs)
+		}
+		switch idx {
+		case 1:
+			var str string
+			str = string(v.Family)
+			buf.WriteString(str)
+		case 2:
+			if isMSH {
+				buf.WriteString(ec)
+				continue
+			}
+			var str string
+			str = string(v.Given)
+			buf.WriteString(str)
+		case 3:
+			var str string
+			str = string(v.Middle)
+			buf.WriteString(str)
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+func hl7DecodeAnon1(seg *hl7.RawSegment, v *struct {
+	PointOfCare string "hl7:\"1\""
+	Room        string "hl7:\"2\""
+	Bed         string "hl7:\"3\""
+}, fields []string, level uint, at hl7.FieldPath) error {
+	off := 0
+	if seg.Name == "MSH" || level > 0 {
+		off = 1
+	}
+	if i := 1 - off; i >= 0 && i < len(fields) {
+		raw := fields[i]
+		if seg.Name == "MSH" && level == 0 && i == 0 {
+			raw = seg.FieldSeparator
+		}
+		v.PointOfCare = raw
+	}
+	if i := 2 - off; i >= 0 && i < len(fields) {
+		raw := fields[i]
+		if seg.Name == "MSH" && level == 0 && i == 0 {
+			raw = seg.FieldSeparator
+		}
+		v.Room = raw
+	}
+	if i := 3 - off; i >= 0 && i < len(fields) {
+		raw := fields[i]
+		if seg.Name == "MSH" && level == 0 && i == 0 {
+			raw = seg.FieldSeparator
+		}
+		v.Bed = raw
+	}
+	return nil
+}
+
+func hl7EncodeAnon1(v *struct {
+	PointOfCare string "hl7:\"1\""
+	Room        string "hl7:\"2\""
+	Bed         string "hl7:\"3\""
+}, cs string) (string, error) {
+	parts := make([]string, 3)
+	parts[0] = string(v.PointOfCare)
+	parts[1] = string(v.Room)
+	parts[2] = string(v.Bed)
+	for len(parts) > 0 && parts[len(parts)-1] == "" {
+		parts = parts[:len(parts)-1]
+	}
+	return strings.Join(parts, cs), nil
+}
+
+func hl7EncodeSegmentAnon1(name string, v *struct {
+	PointOfCare string "hl7:\"1\""
+	Room        string "hl7:\"2\""
+	Bed         string "hl7:\"3\""
+}, opts hl7.MarshalOptions, ec string) ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteString(name)
+	fs := string(opts.FieldSeparator)
+	isMSH := name == "MSH"
+	for idx := 1; idx <= 3; idx++ {
+		if isMSH && idx == 1 {
+			buf.WriteByte(opts.FieldSeparator)
+			continue
+		}
+		if !(isMSH && idx == 2) {
+			buf.WriteString(fs)
+		}
+		switch idx {
+		case 1:
+			var str string
+			str = string(v.PointOfCare)
+			buf.WriteString(str)
+		case 2:
+			if isMSH {
+				buf.WriteString(ec)
+				continue
+			}
+			var str string
+			str = string(v.Room)
+			buf.WriteString(str)
+		case 3:
+			var str string
+			str = string(v.Bed)
+			buf.WriteString(str)
+		}
+	}
+	return buf.Bytes(), nil
+}
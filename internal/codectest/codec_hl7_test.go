@@ -0,0 +1,49 @@
+// Code generated by hl7 gen-codec. DO NOT EDIT.
+
+package codectest
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/esequiel378/hl7"
+)
+
+func TestADTMessageHL7Codec(t *testing.T) {
+	files, err := filepath.Glob(filepath.Join("testdata", "*.hl7"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) == 0 {
+		t.Skip("no testdata/*.hl7 sample messages")
+	}
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := hl7.VerifyCodec(data, new(ADTMessage)); err != nil {
+			t.Errorf("%s: %v", file, err)
+		}
+	}
+}
+
+func TestORUMessageHL7Codec(t *testing.T) {
+	files, err := filepath.Glob(filepath.Join("testdata", "*.hl7"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) == 0 {
+		t.Skip("no testdata/*.hl7 sample messages")
+	}
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := hl7.VerifyCodec(data, new(ORUMessage)); err != nil {
+			t.Errorf("%s: %v", file, err)
+		}
+	}
+}
@@ -0,0 +1,84 @@
+// Package codectest holds message types with generated codecs. Its tests
+// check that the code written by `hl7 gen-codec` behaves exactly like the
+// reflection-based Unmarshal and Marshal.
+package codectest
+
+import "github.com/esequiel378/hl7"
+
+//go:generate go run ../../cmd/hl7 gen-codec -type ADTMessage,ORUMessage -output codec_hl7.go -test
+
+type MessageType struct {
+	Code    string `hl7:"1"`
+	Trigger string `hl7:"2"`
+}
+
+type MSHSegment struct {
+	FieldSeparator       string        `hl7:"1"`
+	EncodingCharacters   string        `hl7:"2"`
+	SendingApplication   string        `hl7:"3"`
+	SendingFacility      string        `hl7:"4"`
+	ReceivingApplication string        `hl7:"5"`
+	ReceivingFacility    string        `hl7:"6"`
+	DateTimeOfMessage    hl7.Timestamp `hl7:"7"`
+	MessageType          MessageType   `hl7:"9"`
+	MessageControlID     string        `hl7:"10"`
+	ProcessingID         string        `hl7:"11"`
+	VersionID            string        `hl7:"12"`
+	SequenceNumber       *int          `hl7:"13"`
+}
+
+type PatientName struct {
+	Family string `hl7:"1"`
+	Given  string `hl7:"2"`
+	Middle string `hl7:"3"`
+}
+
+type Note struct {
+	SetID   int    `hl7:"1"`
+	Source  string `hl7:"2"`
+	Comment string `hl7:"3"`
+}
+
+type PIDSegment struct {
+	SetID       uint          `hl7:"1"`
+	Identifiers []string      `hl7:"3"`
+	Names       []PatientName `hl7:"5"`
+	DateOfBirth hl7.Timestamp `hl7:"7"`
+	Sex         string        `hl7:"8"`
+	Deceased    *bool         `hl7:"30"`
+	Notes       []Note        `hl7:"notes"`
+}
+
+type PV1Segment struct {
+	SetID        int8   `hl7:"1"`
+	PatientClass string `hl7:"2"`
+	Location     struct {
+		PointOfCare string `hl7:"1"`
+		Room        string `hl7:"2"`
+		Bed         string `hl7:"3"`
+	} `hl7:"3"`
+	VisitNumber int64 `hl7:"19"`
+}
+
+type ADTMessage struct {
+	MSH MSHSegment `hl7:"segment:MSH"`
+	PID PIDSegment `hl7:"segment:PID"`
+	PV1 PV1Segment `hl7:"segment:PV1"`
+}
+
+type OBXSegment struct {
+	SetID          int16    `hl7:"1"`
+	ValueType      string   `hl7:"2"`
+	Identifier     []string `hl7:"3"`
+	Value          float64  `hl7:"5"`
+	Units          string   `hl7:"6"`
+	ReferenceRange string   `hl7:"7"`
+	Normal         bool     `hl7:"10"`
+	Notes          []Note   `hl7:"notes"`
+}
+
+type ORUMessage struct {
+	MSH MSHSegment `hl7:"segment:MSH"`
+	PID PIDSegment `hl7:"segment:PID"`
+	OBX OBXSegment `hl7:"segment:OBX"`
+}
@@ -0,0 +1,112 @@
+package codectest
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/esequiel378/hl7"
+)
+
+// reflectADT has the layout of ADTMessage without its generated methods, so
+// hl7.Unmarshal and hl7.Marshal take the reflection path for it.
+type reflectADT ADTMessage
+
+func readSample(tb testing.TB, name string) []byte {
+	tb.Helper()
+	data, err := os.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		tb.Fatal(err)
+	}
+	return data
+}
+
+func TestUnmarshalUsesGeneratedCodec(t *testing.T) {
+	data := readSample(t, "adt_a01.hl7")
+
+	var generated ADTMessage
+	if err := hl7.Unmarshal(data, &generated); err != nil {
+		t.Fatalf("Unmarshal failed: %v", err)
+	}
+	var reflected reflectADT
+	if err := hl7.Unmarshal(data, &reflected); err != nil {
+		t.Fatalf("Unmarshal failed: %v", err)
+	}
+	if !reflect.DeepEqual(generated, ADTMessage(reflected)) {
+		t.Errorf("generated %+v, want %+v", generated, reflected)
+	}
+
+	if len(generated.PID.Notes) != 2 {
+		t.Errorf("expected 2 notes, got %d", len(generated.PID.Notes))
+	}
+	if len(generated.PID.Names) != 2 || generated.PID.Names[1].Family != "SMITH" {
+		t.Errorf("unexpected names: %+v", generated.PID.Names)
+	}
+	if generated.MSH.SequenceNumber == nil || *generated.MSH.SequenceNumber != 42 {
+		t.Errorf("unexpected sequence number: %v", generated.MSH.SequenceNumber)
+	}
+	if generated.MSH.DateTimeOfMessage.String() != "20250205120000" {
+		t.Errorf("unexpected timestamp: %s", generated.MSH.DateTimeOfMessage)
+	}
+
+	out, err := hl7.Marshal(generated)
+	if err != nil {
+		t.Fatalf("Marshal failed: %v", err)
+	}
+	want, err := hl7.Marshal(reflected)
+	if err != nil {
+		t.Fatalf("Marshal failed: %v", err)
+	}
+	if string(out) != string(want) {
+		t.Errorf("Marshal output %q, want %q", out, want)
+	}
+}
+
+func BenchmarkUnmarshalGenerated(b *testing.B) {
+	data := readSample(b, "adt_a01.hl7")
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		var msg ADTMessage
+		if err := hl7.Unmarshal(data, &msg); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkUnmarshalReflection(b *testing.B) {
+	data := readSample(b, "adt_a01.hl7")
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		var msg reflectADT
+		if err := hl7.Unmarshal(data, &msg); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkMarshalGenerated(b *testing.B) {
+	var msg ADTMessage
+	if err := hl7.Unmarshal(readSample(b, "adt_a01.hl7"), &msg); err != nil {
+		b.Fatal(err)
+	}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := hl7.Marshal(msg); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkMarshalReflection(b *testing.B) {
+	var msg reflectADT
+	if err := hl7.Unmarshal(readSample(b, "adt_a01.hl7"), &msg); err != nil {
+		b.Fatal(err)
+	}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := hl7.Marshal(msg); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,430 @@
+package hl7
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Mapping describes how to translate a message from one layout to another.
+// Segment rules run first, in order, followed by the field rules, in order.
+// Define it in JSON and load it with ParseMapping or LoadMappingFile:
+//
+//	{
+//	  "segments": [
+//	    { "segment": "ZPI", "action": "drop" },
+//	    { "segment": "PV2", "action": "rename", "to": "ZV2" }
+//	  ],
+//	  "fields": [
+//	    { "from": "PID-2", "to": "PID-3", "move": true },
+//	    { "to": "MSH-5", "value": "VENDORB" },
+//	    { "from": "PV1-3.1", "to": "PV1-3", "transform": ["trim", "upper"] },
+//	    { "from": "PID-8", "to": "PID-8", "map": { "1": "M", "2": "F" }, "default": "U" },
+//	    { "to": "MSH-6", "value": "EAST", "when": { "path": "MSH-4", "in": ["GHH", "GHN"] } }
+//	  ]
+//	}
+type Mapping struct {
+	Segments []SegmentMapping `json:"segments,omitempty"`
+	Fields   []FieldMapping   `json:"fields,omitempty"`
+}
+
+// SegmentAction is what a SegmentMapping does to the segments it selects.
+type SegmentAction string
+
+const (
+	// SegmentDrop removes the segment.
+	SegmentDrop SegmentAction = "drop"
+	// SegmentRename changes the segment name to To.
+	SegmentRename SegmentAction = "rename"
+	// SegmentCopy inserts a copy of the segment named To right after it.
+	SegmentCopy SegmentAction = "copy"
+)
+
+// SegmentMapping drops, renames or copies every segment named Segment for
+// which When holds.
+type SegmentMapping struct {
+	Segment string        `json:"segment"`
+	Action  SegmentAction `json:"action"`
+	To      string        `json:"to,omitempty"`
+	When    *Condition    `json:"when,omitempty"`
+}
+
+// FieldMapping writes a value to the path To. The value is read from the
+// path From, or is the constant Value, which is written as raw HL7 so it may
+// contain separators (e.g. "ADT^A08"). Paths use the syntax of ParsePath
+// and must name a field.
+//
+// When From and To name the same segment without an occurrence, the rule
+// runs once per occurrence of that segment, reading and writing the same
+// occurrence. Otherwise From reads the first occurrence and To writes to
+// every occurrence, appending the segment when the message has none.
+//
+// A rule whose source value is empty, after Transform, Map and Default, is
+// skipped, so moving an absent field does not clear the target.
+type FieldMapping struct {
+	From  string  `json:"from,omitempty"`
+	To    string  `json:"to"`
+	Value *string `json:"value,omitempty"`
+
+	// Move clears From after copying it.
+	Move bool `json:"move,omitempty"`
+
+	// Transform lists text transforms applied to every component of the
+	// value in order: "trim", "upper" or "lower".
+	Transform []string `json:"transform,omitempty"`
+
+	// Map replaces a value found among its keys; other values are kept.
+	Map map[string]string `json:"map,omitempty"`
+
+	// Default is used when the value is empty.
+	Default string `json:"default,omitempty"`
+
+	When *Condition `json:"when,omitempty"`
+}
+
+// Condition restricts a rule to messages, or segment occurrences, where
+// the unescaped value at Path passes every test that is set. When Path
+// names the segment the rule applies to without an occurrence, the value is
+// read from the same occurrence.
+type Condition struct {
+	Path    string   `json:"path"`
+	Equals  *string  `json:"equals,omitempty"`
+	In      []string `json:"in,omitempty"`
+	Matches string   `json:"matches,omitempty"` // regular expression
+	Exists  *bool    `json:"exists,omitempty"`  // whether the value is non-empty
+}
+
+var mappingTransforms = map[string]func(string) string{
+	"trim":  strings.TrimSpace,
+	"upper": strings.ToUpper,
+	"lower": strings.ToLower,
+}
+
+// ParseMapping parses a JSON mapping definition.
+func ParseMapping(data []byte) (*Mapping, error) {
+	var m Mapping
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("hl7: failed to parse mapping: %w", err)
+	}
+	if err := m.Validate(); err != nil {
+		return nil, err
+	}
+	return &m, nil
+}
+
+// LoadMappingFile reads a JSON mapping file and parses it into a Mapping.
+func LoadMappingFile(path string) (*Mapping, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("hl7: failed to read mapping file: %w", err)
+	}
+	return ParseMapping(data)
+}
+
+// Validate checks the paths, actions, transforms and patterns of the
+// mapping. Errors are reported as *SchemaError.
+func (m *Mapping) Validate() error {
+	_, err := compileMapping(m)
+	return err
+}
+
+// Transform parses an HL7 message generically, applies the mapping to it
+// and returns it re-encoded with MarshalGeneric. Fields the mapping does not
+// touch keep their raw bytes.
+func Transform(data []byte, mapping *Mapping) ([]byte, error) {
+	msg, err := ParseGeneric(data)
+	if err != nil {
+		return nil, err
+	}
+	if err := mapping.Apply(msg); err != nil {
+		return nil, err
+	}
+	return MarshalGeneric(msg)
+}
+
+// Apply runs the mapping on msg in place.
+func (m *Mapping) Apply(msg *GenericMessage) error {
+	c, err := compileMapping(m)
+	if err != nil {
+		return err
+	}
+	opts := msg.Delimiters()
+	for i := range c.segments {
+		c.segments[i].apply(msg, opts)
+	}
+	for i := range c.fields {
+		c.fields[i].apply(msg, opts)
+	}
+	return nil
+}
+
+// compiledMapping is a Mapping with its paths parsed and patterns compiled.
+type compiledMapping struct {
+	segments []segmentRule
+	fields   []fieldRule
+}
+
+type segmentRule struct {
+	*SegmentMapping
+	when *condition
+}
+
+type fieldRule struct {
+	*FieldMapping
+	from, to  Path
+	transform []func(string) string
+	when      *condition
+}
+
+type condition struct {
+	*Condition
+	path    Path
+	matches *regexp.Regexp
+}
+
+func compileMapping(m *Mapping) (*compiledMapping, error) {
+	c := &compiledMapping{}
+	for i := range m.Segments {
+		sm := &m.Segments[i]
+		at := "segments[" + strconv.Itoa(i) + "]"
+		if !isSegmentName(sm.Segment) {
+			return nil, &SchemaError{Path: at + ".segment", Err: fmt.Errorf("invalid segment name %q", sm.Segment)}
+		}
+		switch sm.Action {
+		case SegmentDrop:
+		case SegmentRename, SegmentCopy:
+			if !isSegmentName(sm.To) {
+				return nil, &SchemaError{Path: at + ".to", Err: fmt.Errorf("invalid segment name %q", sm.To)}
+			}
+		default:
+			return nil, &SchemaError{Path: at + ".action", Err: fmt.Errorf("invalid action %q", sm.Action)}
+		}
+		if sm.Segment == "MSH" || sm.To == "MSH" {
+			return nil, &SchemaError{Path: at, Err: errors.New("MSH segments cannot be dropped, renamed or copied")}
+		}
+		when, err := compileCondition(at+".when", sm.When)
+		if err != nil {
+			return nil, err
+		}
+		c.segments = append(c.segments, segmentRule{SegmentMapping: sm, when: when})
+	}
+
+	for i := range m.Fields {
+		fm := &m.Fields[i]
+		at := "fields[" + strconv.Itoa(i) + "]"
+		r := fieldRule{FieldMapping: fm}
+		var err error
+		if r.to, err = parseFieldPath(fm.To); err != nil {
+			return nil, &SchemaError{Path: at + ".to", Err: err}
+		}
+		if r.to.Segment == "MSH" && r.to.Field <= 2 {
+			return nil, &SchemaError{Path: at + ".to", Err: errors.New("MSH-1 and MSH-2 hold the message delimiters")}
+		}
+		switch {
+		case fm.From != "" && fm.Value != nil:
+			return nil, &SchemaError{Path: at, Err: errors.New("from and value are mutually exclusive")}
+		case fm.From != "":
+			if r.from, err = parseFieldPath(fm.From); err != nil {
+				return nil, &SchemaError{Path: at + ".from", Err: err}
+			}
+		case fm.Value == nil:
+			return nil, &SchemaError{Path: at, Err: errors.New("one of from or value is required")}
+		}
+		if fm.Move && fm.From == "" {
+			return nil, &SchemaError{Path: at + ".move", Err: errors.New("move requires from")}
+		}
+		for _, name := range fm.Transform {
+			fn, ok := mappingTransforms[name]
+			if !ok {
+				return nil, &SchemaError{Path: at + ".transform", Err: fmt.Errorf("unknown transform %q", name)}
+			}
+			r.transform = append(r.transform, fn)
+		}
+		if r.when, err = compileCondition(at+".when", fm.When); err != nil {
+			return nil, err
+		}
+		c.fields = append(c.fields, r)
+	}
+	return c, nil
+}
+
+func compileCondition(at string, cond *Condition) (*condition, error) {
+	if cond == nil {
+		return nil, nil
+	}
+	c := &condition{Condition: cond}
+	var err error
+	if c.path, err = parseFieldPath(cond.Path); err != nil {
+		return nil, &SchemaError{Path: at + ".path", Err: err}
+	}
+	if cond.Matches != "" {
+		if c.matches, err = regexp.Compile(cond.Matches); err != nil {
+			return nil, &SchemaError{Path: at + ".matches", Err: err}
+		}
+	}
+	return c, nil
+}
+
+// holds reports whether the condition passes, reading a path on the
+// segment the rule applies to from that segment.
+func (c *condition) holds(msg *GenericMessage, seg *GenericSegment, opts MarshalOptions) bool {
+	if c == nil {
+		return true
+	}
+	var v string
+	if seg != nil && c.path.Segment == seg.Name && c.path.Occurrence == 0 {
+		v = seg.Value(c.path.FieldPath, opts)
+	} else {
+		v = msg.Value(c.path)
+	}
+	v = opts.Unescape(v)
+
+	if c.Exists != nil && *c.Exists != (v != "") {
+		return false
+	}
+	if c.Equals != nil && v != *c.Equals {
+		return false
+	}
+	if c.In != nil && !slices.Contains(c.In, v) {
+		return false
+	}
+	if c.matches != nil && !c.matches.MatchString(v) {
+		return false
+	}
+	return true
+}
+
+func (r *segmentRule) apply(msg *GenericMessage, opts MarshalOptions) {
+	segments := make([]GenericSegment, 0, len(msg.Segments))
+	for i := range msg.Segments {
+		seg := msg.Segments[i]
+		if seg.Name != r.Segment || !r.when.holds(msg, &seg, opts) {
+			segments = append(segments, seg)
+			continue
+		}
+		switch r.Action {
+		case SegmentRename:
+			seg.Name = r.To
+			segments = append(segments, seg)
+		case SegmentCopy:
+			dup := GenericSegment{Name: r.To, Fields: make([]GenericField, len(seg.Fields))}
+			for j, f := range seg.Fields {
+				dup.Fields[j] = f
+				dup.Fields[j].SetValue(f.Value, opts)
+			}
+			segments = append(segments, seg, dup)
+		}
+	}
+	msg.Segments = segments
+}
+
+func (r *fieldRule) apply(msg *GenericMessage, opts MarshalOptions) {
+	if r.From != "" && r.from.Segment == r.to.Segment && r.from.Occurrence == 0 && r.to.Occurrence == 0 {
+		for i := range msg.Segments {
+			if seg := &msg.Segments[i]; seg.Name == r.to.Segment {
+				if v, ok := r.value(msg, seg, seg, opts); ok {
+					if r.Move {
+						seg.SetValue(r.from.FieldPath, "", opts)
+					}
+					seg.SetValue(r.to.FieldPath, v, opts)
+				}
+			}
+		}
+		return
+	}
+
+	var source *GenericSegment
+	if r.From != "" {
+		if source = msg.segment(r.from.Segment, max(r.from.Occurrence, 1)); source == nil {
+			source = &GenericSegment{}
+		}
+	}
+	// Every target reads the source before it is cleared.
+	moved := false
+	write := func(target *GenericSegment) {
+		if v, ok := r.value(msg, source, target, opts); ok {
+			target.SetValue(r.to.FieldPath, v, opts)
+			moved = source != nil
+		}
+	}
+	if r.to.Occurrence > 0 {
+		if seg := msg.segment(r.to.Segment, r.to.Occurrence); seg != nil {
+			write(seg)
+		}
+	} else {
+		found := false
+		for i := range msg.Segments {
+			if seg := &msg.Segments[i]; seg.Name == r.to.Segment {
+				found = true
+				write(seg)
+			}
+		}
+		if !found {
+			msg.Segments = append(msg.Segments, GenericSegment{Name: r.to.Segment, Fields: []GenericField{}})
+			seg := &msg.Segments[len(msg.Segments)-1]
+			write(seg)
+			if len(seg.Fields) == 0 {
+				msg.Segments = msg.Segments[:len(msg.Segments)-1]
+			}
+		}
+	}
+	if r.Move && moved {
+		// Appending a target may have moved the segments, so look the
+		// source up again.
+		if source = msg.segment(r.from.Segment, max(r.from.Occurrence, 1)); source != nil {
+			source.SetValue(r.from.FieldPath, "", opts)
+		}
+	}
+}
+
+// value returns the rule's value for target: the value at From in source,
+// or the rule's constant when source is nil. ok is false when the rule does
+// not apply to target or there is nothing to copy.
+func (r *fieldRule) value(msg *GenericMessage, source, target *GenericSegment, opts MarshalOptions) (v string, ok bool) {
+	if !r.when.holds(msg, target, opts) {
+		return "", false
+	}
+
+	if source != nil {
+		v = source.Value(r.from.FieldPath, opts)
+	} else {
+		v = *r.Value
+	}
+	for _, fn := range r.transform {
+		v = mapLeaves(v, opts, fn)
+	}
+	if mapped, ok := r.Map[opts.Unescape(v)]; ok {
+		v = mapped
+	}
+	if v == "" {
+		v = r.Default
+	}
+	if v == "" && source != nil {
+		return "", false
+	}
+	return v, true
+}
+
+// mapLeaves applies fn to the unescaped text of every subcomponent of a raw
+// value, keeping its separators.
+func mapLeaves(v string, opts MarshalOptions, fn func(string) string) string {
+	return splitMap(v, []byte{opts.RepetitionSeparator, opts.ComponentSeparator, opts.SubcomponentSeparator}, func(leaf string) string {
+		return opts.Escape(fn(opts.Unescape(leaf)))
+	})
+}
+
+func splitMap(v string, seps []byte, fn func(string) string) string {
+	if len(seps) == 0 {
+		return fn(v)
+	}
+	parts := strings.Split(v, string(seps[0]))
+	for i, part := range parts {
+		parts[i] = splitMap(part, seps[1:], fn)
+	}
+	return strings.Join(parts, string(seps[0]))
+}
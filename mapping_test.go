@@ -0,0 +1,288 @@
+package hl7_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/esequiel378/hl7"
+)
+
+const mappingMessage = "MSH|^~\\&|LAB|GHH|||20250301||ADT^A01|1|P|2.5\r" +
+	"PID|1|OLD1|123^^^HOSP||  smith ^ john ||19800101|1\r" +
+	"PV1|1|I|w1^101\r" +
+	"ZPI|1|secret\r" +
+	"OBX|1|NM|WBC||7.2\r" +
+	"OBX|2|ST|CMT||A\\T\\B"
+
+func TestTransform(t *testing.T) {
+	tests := []struct {
+		name    string
+		mapping string
+		want    string // see changedSegments
+	}{
+		{
+			"move",
+			`{"fields": [{"from": "PID-2", "to": "PID-3", "move": true}]}`,
+			"-PID|1|OLD1|123^^^HOSP||  smith ^ john ||19800101|1\rPID|1||OLD1||  smith ^ john ||19800101|1",
+		},
+		{
+			"move to every occurrence",
+			`{"fields": [{"from": "ZPI-2", "to": "OBX-6", "move": true}]}`,
+			"-ZPI|1|secret\r-OBX|1|NM|WBC||7.2\r-OBX|2|ST|CMT||A\\T\\B\r" +
+				"ZPI|1|\rOBX|1|NM|WBC||7.2|secret\rOBX|2|ST|CMT||A\\T\\B|secret",
+		},
+		{
+			"move into a missing segment",
+			`{"fields": [{"from": "ZPI-2", "to": "ZPX-1", "move": true}]}`,
+			"-ZPI|1|secret\rZPI|1|\rZPX|secret",
+		},
+		{
+			"copy without move",
+			`{"fields": [{"from": "PV1-3.2", "to": "PV1-11"}]}`,
+			"-PV1|1|I|w1^101\rPV1|1|I|w1^101||||||||101",
+		},
+		{
+			"constant with separators",
+			`{"fields": [{"to": "MSH-9", "value": "ADT^A08"}]}`,
+			"-MSH|^~\\&|LAB|GHH|||20250301||ADT^A01|1|P|2.5\rMSH|^~\\&|LAB|GHH|||20250301||ADT^A08|1|P|2.5",
+		},
+		{
+			"constant into a missing segment",
+			`{"fields": [{"to": "PD1-4", "value": "DR"}]}`,
+			"PD1||||DR",
+		},
+		{
+			"map",
+			`{"fields": [{"from": "PID-8", "to": "PID-8", "map": {"1": "M", "2": "F"}, "default": "U"}]}`,
+			"-PID|1|OLD1|123^^^HOSP||  smith ^ john ||19800101|1\rPID|1|OLD1|123^^^HOSP||  smith ^ john ||19800101|M",
+		},
+		{
+			"unmapped values are kept",
+			`{"fields": [{"from": "PID-8", "to": "PID-8", "map": {"2": "F"}, "default": "U"}]}`,
+			"",
+		},
+		{
+			"default for an empty source",
+			`{"fields": [{"from": "PID-9", "to": "PID-9", "default": "NONE"}]}`,
+			"-PID|1|OLD1|123^^^HOSP||  smith ^ john ||19800101|1\rPID|1|OLD1|123^^^HOSP||  smith ^ john ||19800101|1|NONE",
+		},
+		{
+			"empty source is skipped",
+			`{"fields": [{"from": "PID-9", "to": "PID-2"}]}`,
+			"",
+		},
+		{
+			"transforms apply to every component",
+			`{"fields": [{"from": "PID-5", "to": "PID-5", "transform": ["trim", "upper"]}]}`,
+			"-PID|1|OLD1|123^^^HOSP||  smith ^ john ||19800101|1\rPID|1|OLD1|123^^^HOSP||SMITH^JOHN||19800101|1",
+		},
+		{
+			"transform on a component",
+			`{"fields": [{"from": "PV1-3.1", "to": "PV1-3.1", "transform": ["upper"]}]}`,
+			"-PV1|1|I|w1^101\rPV1|1|I|W1^101",
+		},
+		{
+			"per occurrence",
+			`{"fields": [{"from": "OBX-3", "to": "OBX-4", "transform": ["lower"]}]}`,
+			"-OBX|1|NM|WBC||7.2\r-OBX|2|ST|CMT||A\\T\\B\rOBX|1|NM|WBC|wbc|7.2\rOBX|2|ST|CMT|cmt|A\\T\\B",
+		},
+		{
+			"occurrence",
+			`{"fields": [{"to": "OBX[2]-8", "value": "N"}]}`,
+			"-OBX|2|ST|CMT||A\\T\\B\rOBX|2|ST|CMT||A\\T\\B|||N",
+		},
+		{
+			"condition equals",
+			`{"fields": [{"to": "MSH-6", "value": "EAST", "when": {"path": "MSH-4", "equals": "GHH"}}]}`,
+			"-MSH|^~\\&|LAB|GHH|||20250301||ADT^A01|1|P|2.5\rMSH|^~\\&|LAB|GHH||EAST|20250301||ADT^A01|1|P|2.5",
+		},
+		{
+			"condition in",
+			`{"fields": [{"to": "MSH-6", "value": "EAST", "when": {"path": "MSH-4", "in": ["XYZ", "ABC"]}}]}`,
+			"",
+		},
+		{
+			"condition matches",
+			`{"fields": [{"to": "PID-8", "value": "U", "when": {"path": "PID-7", "matches": "^19"}}]}`,
+			"-PID|1|OLD1|123^^^HOSP||  smith ^ john ||19800101|1\rPID|1|OLD1|123^^^HOSP||  smith ^ john ||19800101|U",
+		},
+		{
+			"condition exists",
+			`{"fields": [{"to": "PID-8", "value": "U", "when": {"path": "PID-19", "exists": true}}]}`,
+			"",
+		},
+		{
+			"condition on the same occurrence",
+			`{"fields": [{"to": "OBX-8", "value": "A", "when": {"path": "OBX-2", "equals": "NM"}}]}`,
+			"-OBX|1|NM|WBC||7.2\rOBX|1|NM|WBC||7.2|||A",
+		},
+		{
+			"condition on an unescaped value",
+			`{"fields": [{"to": "OBX-8", "value": "A", "when": {"path": "OBX-5", "equals": "A&B"}}]}`,
+			"-OBX|2|ST|CMT||A\\T\\B\rOBX|2|ST|CMT||A\\T\\B|||A",
+		},
+		{
+			"drop",
+			`{"segments": [{"segment": "ZPI", "action": "drop"}]}`,
+			"-ZPI|1|secret",
+		},
+		{
+			"drop with a condition",
+			`{"segments": [{"segment": "OBX", "action": "drop", "when": {"path": "OBX-2", "equals": "ST"}}]}`,
+			"-OBX|2|ST|CMT||A\\T\\B",
+		},
+		{
+			"rename",
+			`{"segments": [{"segment": "ZPI", "action": "rename", "to": "ZP2"}]}`,
+			"-ZPI|1|secret\rZP2|1|secret",
+		},
+		{
+			"copy",
+			`{"segments": [{"segment": "PV1", "action": "copy", "to": "ZV1"}]}`,
+			"ZV1|1|I|w1^101",
+		},
+	}
+	for _, tt := range tests {
+		m, err := hl7.ParseMapping([]byte(tt.mapping))
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		out, err := hl7.Transform([]byte(mappingMessage), m)
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if got := changedSegments(string(out)); got != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+// changedSegments returns the segments of mappingMessage missing from out,
+// prefixed with "-", followed by the segments of out that are not in
+// mappingMessage.
+func changedSegments(out string) string {
+	before := strings.Split(mappingMessage, "\r")
+	after := strings.Split(strings.TrimSpace(out), "\r")
+	var lines []string
+	for _, line := range before {
+		if !slices.Contains(after, line) {
+			lines = append(lines, "-"+line)
+		}
+	}
+	for _, line := range after {
+		if !slices.Contains(before, line) {
+			lines = append(lines, line)
+		}
+	}
+	return strings.Join(lines, "\r")
+}
+
+func TestTransformOrder(t *testing.T) {
+	// Segment rules run before field rules, and field rules in order.
+	m, err := hl7.ParseMapping([]byte(`{
+		"segments": [{"segment": "ZPI", "action": "rename", "to": "ZP2"}],
+		"fields": [
+			{"from": "ZP2-2", "to": "ZP2-3", "move": true},
+			{"from": "ZP2-3", "to": "ZP2-4", "transform": ["upper"]}
+		]
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := hl7.Transform([]byte(mappingMessage), m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(out), "\rZP2|1||secret|SECRET\r") {
+		t.Errorf("unexpected result %q", out)
+	}
+}
+
+func TestTransformEscapes(t *testing.T) {
+	m, err := hl7.ParseMapping([]byte(`{"fields": [
+		{"from": "OBX-5", "to": "OBX-5", "transform": ["lower"]},
+		{"from": "OBX[2]-5", "to": "OBX[2]-6"},
+		{"from": "PID-5", "to": "PID-5", "map": {"A|B": "X\\F\\Y"}}
+	]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	in := "MSH|^~\\&|LAB\rPID|1||||A\\F\\B\rOBX|1|ST|||\\T\\Q^R\\S\\S\rOBX|2|ST|||a\\E\\b\r"
+	out, err := hl7.Transform([]byte(in), m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "MSH|^~\\&|LAB\rPID|1||||X\\F\\Y\rOBX|1|ST|||\\T\\q^r\\S\\s\rOBX|2|ST|||a\\E\\b|a\\E\\b"
+	if string(out) != want {
+		t.Errorf("got  %q\nwant %q", out, want)
+	}
+
+	msg, err := hl7.ParseGeneric(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts := msg.Delimiters()
+	if got := opts.Unescape(msg.Value(mustPath(t, "OBX-5.1"))); got != "&q" {
+		t.Errorf("OBX-5.1 = %q, want %q", got, "&q")
+	}
+}
+
+func TestMappingValidate(t *testing.T) {
+	tests := []struct {
+		mapping string
+		path    string
+	}{
+		{`{"segments": [{"segment": "zpi", "action": "drop"}]}`, "segments[0].segment"},
+		{`{"segments": [{"segment": "ZPI", "action": "hide"}]}`, "segments[0].action"},
+		{`{"segments": [{"segment": "ZPI", "action": "rename"}]}`, "segments[0].to"},
+		{`{"segments": [{"segment": "MSH", "action": "drop"}]}`, "segments[0]"},
+		{`{"segments": [{"segment": "ZPI", "action": "copy", "to": "MSH"}]}`, "segments[0]"},
+		{`{"segments": [{"segment": "ZPI", "action": "drop", "when": {"path": "ZPI"}}]}`, "segments[0].when.path"},
+		{`{"fields": [{"to": "PID"}]}`, "fields[0].to"},
+		{`{"fields": [{"to": "MSH-2", "value": "^~\\&"}]}`, "fields[0].to"},
+		{`{"fields": [{"to": "PID-3"}]}`, "fields[0]"},
+		{`{"fields": [{"from": "PID-2", "to": "PID-3", "value": "x"}]}`, "fields[0]"},
+		{`{"fields": [{"from": "PID-", "to": "PID-3"}]}`, "fields[0].from"},
+		{`{"fields": [{"to": "PID-3", "value": "x", "move": true}]}`, "fields[0].move"},
+		{`{"fields": [{"from": "PID-2", "to": "PID-3", "transform": ["reverse"]}]}`, "fields[0].transform"},
+		{`{"fields": [{"to": "PID-3", "value": "x"}, {"to": "PID-3", "value": "x", "when": {"path": "PID-1", "matches": "("}}]}`, "fields[1].when.matches"},
+	}
+	for _, tt := range tests {
+		_, err := hl7.ParseMapping([]byte(tt.mapping))
+		var se *hl7.SchemaError
+		if !errors.As(err, &se) {
+			t.Errorf("%s: expected a *SchemaError, got %v", tt.mapping, err)
+			continue
+		}
+		if se.Path != tt.path {
+			t.Errorf("%s: expected the error at %s, got %v", tt.mapping, tt.path, err)
+		}
+	}
+
+	if _, err := hl7.ParseMapping([]byte(`{"fields": [`)); err == nil {
+		t.Error("expected an error for invalid JSON")
+	}
+}
+
+func TestLoadMappingFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "mapping.json")
+	if err := os.WriteFile(path, []byte(`{"fields": [{"to": "MSH-5", "value": "VENDORB"}]}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	m, err := hl7.LoadMappingFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(m.Fields) != 1 || *m.Fields[0].Value != "VENDORB" {
+		t.Errorf("unexpected mapping %+v", m)
+	}
+	if _, err := hl7.LoadMappingFile(filepath.Join(t.TempDir(), "missing.json")); err == nil {
+		t.Error("expected an error for a missing file")
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"reflect"
 	"strconv"
+	"time"
 )
 
 // Marshaler is the interface implemented by types that can marshal themselves
@@ -29,6 +30,31 @@ type MarshalOptions struct {
 	SubcomponentSeparator byte
 	// LineEnding is the line terminator for segments (default: \r)
 	LineEnding string
+	// Charset is the character set the message is written in, named as in
+	// MSH-18, e.g. CharsetLatin1. Values are UTF-8 and are transcoded to
+	// it; characters it cannot represent are an error. Empty writes UTF-8.
+	// MSH-18 itself is not set.
+	Charset string
+
+	// The following fill in MSH fields that the message leaves empty;
+	// fields that already have a value are kept. Values are written as is,
+	// so they may hold components, e.g. "LAB^1.2.3^ISO".
+
+	// ControlID generates MSH-10 (default: left empty).
+	ControlID ControlIDGenerator
+	// Now returns the time written to MSH-7; tests can fix it
+	// (default: left empty).
+	Now func() time.Time
+	// SendingApplication is MSH-3, SendingFacility MSH-4,
+	// ReceivingApplication MSH-5 and ReceivingFacility MSH-6.
+	SendingApplication   string
+	SendingFacility      string
+	ReceivingApplication string
+	ReceivingFacility    string
+	// ProcessingID is MSH-11, such as "P" or "T".
+	ProcessingID string
+	// Version is MSH-12, such as "2.5.1".
+	Version string
 }
 
 // DefaultMarshalOptions returns the standard HL7 encoding options.
@@ -51,6 +77,7 @@ func Marshal(v any) ([]byte, error) {
 }
 
 // MarshalWithOptions serializes a struct into HL7 format using the provided options.
+// If v implements MessageMarshaler, its MarshalHL7Message method is used instead.
 func MarshalWithOptions(v any, opts MarshalOptions) ([]byte, error) {
 	rv := reflect.ValueOf(v)
 
@@ -62,6 +89,21 @@ func MarshalWithOptions(v any, opts MarshalOptions) ([]byte, error) {
 		rv = rv.Elem()
 	}
 
+	var data []byte
+	var err error
+	if m, ok := v.(MessageMarshaler); ok {
+		data, err = m.MarshalHL7Message(opts)
+	} else {
+		data, err = marshalReflect(rv, opts)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return opts.transcode(opts.fillHeader(data))
+}
+
+// marshalReflect is the reflection path of MarshalWithOptions.
+func marshalReflect(rv reflect.Value, opts MarshalOptions) ([]byte, error) {
 	if rv.Kind() != reflect.Struct {
 		return nil, fmt.Errorf("hl7: Marshal requires a struct, got %s", rv.Kind())
 	}
@@ -76,14 +118,11 @@ func MarshalWithOptions(v any, opts MarshalOptions) ([]byte, error) {
 
 	var allLines [][]byte
 
-	for i := 0; i < rv.NumField(); i++ {
-		field := rv.Field(i)
-		tag, err := getHL7SegmentTypeFromTag(rv.Type().Field(i).Tag.Get("hl7"))
-		if err != nil {
-			continue // Skip fields without valid segment tags
-		}
+	// Fields without valid segment tags are skipped.
+	for _, seg := range cachedMessageFields(rv.Type()).list {
+		field := rv.Field(seg.num)
 
-		line, err := marshalSegment(string(tag), field, opts, encodingChars)
+		line, err := marshalSegment(string(seg.name), field, opts, encodingChars)
 		if err != nil {
 			return nil, err
 		}
@@ -118,26 +157,10 @@ func marshalSegment(name string, v reflect.Value, opts MarshalOptions, ec string
 	cs := string(opts.ComponentSeparator)
 	rs := string(opts.RepetitionSeparator)
 
-	// Find the maximum field index to determine field count
-	maxIndex := 0
-	fieldMap := make(map[int]reflect.Value)
-	fieldTypeMap := make(map[int]reflect.StructField)
-
-	for i := 0; i < v.NumField(); i++ {
-		tag := v.Type().Field(i).Tag.Get("hl7")
-		if tag == "" {
-			continue
-		}
-		idx, err := strconv.Atoi(tag)
-		if err != nil {
-			continue
-		}
-		if idx > maxIndex {
-			maxIndex = idx
-		}
-		fieldMap[idx] = v.Field(i)
-		fieldTypeMap[idx] = v.Type().Field(i)
-	}
+	// Fields are looked up by their hl7 index; the highest index determines
+	// the field count.
+	byIndex := cachedStructFields(v.Type()).byIndex
+	maxIndex := len(byIndex) - 1
 
 	// Build the segment
 	var buf bytes.Buffer
@@ -159,10 +182,11 @@ func marshalSegment(name string, v reflect.Value, opts MarshalOptions, ec string
 			buf.WriteString(fs)
 		}
 
-		field, exists := fieldMap[idx]
-		if !exists {
+		num := byIndex[idx]
+		if num < 0 {
 			continue
 		}
+		field := v.Field(num)
 
 		// For MSH-2, write encoding characters
 		if isMSH && idx == 2 {
@@ -248,38 +272,21 @@ func marshalValue(v reflect.Value, componentSep, repetitionSep string) (string,
 
 // marshalStruct converts a struct to component-separated string.
 func marshalStruct(v reflect.Value, componentSep string) (string, error) {
-	// Find max component index
-	maxIndex := 0
-	compMap := make(map[int]reflect.Value)
-
-	for i := 0; i < v.NumField(); i++ {
-		tag := v.Type().Field(i).Tag.Get("hl7")
-		if tag == "" {
-			continue
-		}
-		idx, err := strconv.Atoi(tag)
-		if err != nil {
-			continue
-		}
-		if idx > maxIndex {
-			maxIndex = idx
-		}
-		compMap[idx] = v.Field(i)
-	}
-
-	if maxIndex == 0 {
+	byIndex := cachedStructFields(v.Type()).byIndex
+	maxIndex := len(byIndex) - 1
+	if maxIndex <= 0 {
 		return "", nil
 	}
 
-	var parts []string
+	parts := make([]string, 0, maxIndex)
 	for idx := 1; idx <= maxIndex; idx++ {
-		field, exists := compMap[idx]
-		if !exists {
+		num := byIndex[idx]
+		if num < 0 {
 			parts = append(parts, "")
 			continue
 		}
 
-		str, err := marshalValue(field, "", "") // No nested components for now
+		str, err := marshalValue(v.Field(num), "", "") // No nested components for now
 		if err != nil {
 			return "", err
 		}
@@ -0,0 +1,54 @@
+package mllp
+
+import (
+	"net"
+	"time"
+)
+
+// A Client sends messages over one MLLP connection and reads the reply to
+// each. It is not safe for concurrent use.
+type Client struct {
+	// Timeout bounds each Send, from writing the message to reading the
+	// reply. Zero means no timeout.
+	Timeout time.Duration
+
+	conn net.Conn
+	r    *Reader
+	w    *Writer
+}
+
+// Dial connects to the MLLP server at addr, waiting at most timeout for the
+// connection. The timeout is also used for every Send.
+func Dial(addr string, timeout time.Duration) (*Client, error) {
+	conn, err := net.DialTimeout("tcp", addr, timeout)
+	if err != nil {
+		return nil, err
+	}
+	c := NewClient(conn)
+	c.Timeout = timeout
+	return c, nil
+}
+
+// NewClient returns a Client using an established connection.
+func NewClient(conn net.Conn) *Client {
+	return &Client{conn: conn, r: NewReader(conn), w: NewWriter(conn)}
+}
+
+// Send writes msg and returns the reply, usually an ACK.
+func (c *Client) Send(msg []byte) ([]byte, error) {
+	if c.Timeout > 0 {
+		if err := c.conn.SetDeadline(time.Now().Add(c.Timeout)); err != nil {
+			return nil, err
+		}
+		defer c.conn.SetDeadline(time.Time{})
+	}
+	if err := c.w.WriteMessage(msg); err != nil {
+		return nil, err
+	}
+	return c.r.ReadMessage()
+}
+
+// Close closes the connection.
+func (c *Client) Close() error {
+	return c.conn.Close()
+}
@@ -0,0 +1,130 @@
+// Package mllp implements the Minimal Lower Layer Protocol used to exchange
+// HL7 v2 messages over TCP.
+//
+// Each message is framed as a start block (0x0B), the message bytes, an end
+// block (0x1C) and a carriage return (0x0D). A Reader and Writer handle the
+// framing on any stream, a Client sends messages and waits for their
+// acknowledgments, and a Server calls a Handler for every message it
+// receives and writes back the reply:
+//
+//	srv := &mllp.Server{Addr: ":2575", Handler: mllp.HandlerFunc(func(msg []byte) []byte {
+//		parsed, err := hl7.ParseGeneric(msg)
+//		...
+//	})}
+//	err := srv.ListenAndServe()
+//
+// The package only moves bytes; parsing and acknowledgment building are done
+// with package hl7.
+package mllp
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Framing bytes.
+const (
+	StartBlock     = 0x0B
+	EndBlock       = 0x1C
+	CarriageReturn = 0x0D
+)
+
+// DefaultMaxMessageSize bounds the messages read by a Reader whose
+// MaxMessageSize is zero.
+const DefaultMaxMessageSize = 16 << 20
+
+var (
+	// ErrInvalidFrame is returned for data outside a start and end block.
+	ErrInvalidFrame = errors.New("mllp: invalid frame")
+	// ErrMessageTooLarge is returned for a message above the size limit.
+	ErrMessageTooLarge = errors.New("mllp: message too large")
+)
+
+// A Reader reads framed messages from a stream.
+type Reader struct {
+	// MaxMessageSize bounds a single message. Zero means
+	// DefaultMaxMessageSize.
+	MaxMessageSize int
+
+	r *bufio.Reader
+}
+
+// NewReader returns a Reader reading from r.
+func NewReader(r io.Reader) *Reader {
+	return &Reader{r: bufio.NewReader(r)}
+}
+
+// ReadMessage returns the next message without its framing bytes. Whitespace
+// between frames is skipped. It returns io.EOF when the stream ends between
+// frames, and io.ErrUnexpectedEOF when it ends inside one.
+func (r *Reader) ReadMessage() ([]byte, error) {
+	for {
+		b, err := r.r.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		if b == StartBlock {
+			break
+		}
+		if b != '\r' && b != '\n' && b != ' ' && b != '\t' {
+			return nil, fmt.Errorf("%w: unexpected byte 0x%02X before start block", ErrInvalidFrame, b)
+		}
+	}
+
+	limit := r.MaxMessageSize
+	if limit <= 0 {
+		limit = DefaultMaxMessageSize
+	}
+	var msg []byte
+	for {
+		chunk, err := r.r.ReadSlice(EndBlock)
+		if len(msg)+len(chunk) > limit+1 {
+			return nil, ErrMessageTooLarge
+		}
+		msg = append(msg, chunk...)
+		if err == bufio.ErrBufferFull {
+			continue
+		}
+		if err == io.EOF {
+			return nil, io.ErrUnexpectedEOF
+		}
+		if err != nil {
+			return nil, err
+		}
+		break
+	}
+	msg = msg[:len(msg)-1]
+	if bytes.IndexByte(msg, StartBlock) >= 0 {
+		return nil, fmt.Errorf("%w: start block inside message", ErrInvalidFrame)
+	}
+	// The carriage return after the end block is skipped with the
+	// whitespace before the next frame, so that a reply can be read without
+	// waiting for more data, and senders that omit it are accepted.
+	return msg, nil
+}
+
+// A Writer writes framed messages to a stream.
+type Writer struct {
+	w io.Writer
+}
+
+// NewWriter returns a Writer writing to w.
+func NewWriter(w io.Writer) *Writer {
+	return &Writer{w: w}
+}
+
+// WriteMessage writes msg in a single frame with a single Write call.
+func (w *Writer) WriteMessage(msg []byte) error {
+	if bytes.IndexByte(msg, StartBlock) >= 0 || bytes.IndexByte(msg, EndBlock) >= 0 {
+		return fmt.Errorf("%w: message contains a framing byte", ErrInvalidFrame)
+	}
+	frame := make([]byte, 0, len(msg)+3)
+	frame = append(frame, StartBlock)
+	frame = append(frame, msg...)
+	frame = append(frame, EndBlock, CarriageReturn)
+	_, err := w.w.Write(frame)
+	return err
+}
@@ -0,0 +1,105 @@
+package mllp_test
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/esequiel378/hl7/mllp"
+)
+
+func TestReadWriteMessage(t *testing.T) {
+	var buf bytes.Buffer
+	w := mllp.NewWriter(&buf)
+	for _, msg := range []string{"MSH|^~\\&|A\rPID|1", "MSH|^~\\&|B"} {
+		if err := w.WriteMessage([]byte(msg)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if !strings.HasPrefix(buf.String(), "\x0bMSH|^~\\&|A\rPID|1\x1c\r\x0b") {
+		t.Errorf("unexpected frames %q", buf.String())
+	}
+
+	r := mllp.NewReader(&buf)
+	for _, want := range []string{"MSH|^~\\&|A\rPID|1", "MSH|^~\\&|B"} {
+		msg, err := r.ReadMessage()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(msg) != want {
+			t.Errorf("expected %q, got %q", want, msg)
+		}
+	}
+	if _, err := r.ReadMessage(); err != io.EOF {
+		t.Errorf("expected io.EOF, got %v", err)
+	}
+}
+
+func TestReadMessageErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  error
+	}{
+		{"garbage", "MSH|\x1c\r", mllp.ErrInvalidFrame},
+		{"unterminated", "\x0bMSH|^~\\&", io.ErrUnexpectedEOF},
+		{"too large", "\x0b" + strings.Repeat("x", 20) + "\x1c\r", mllp.ErrMessageTooLarge},
+	}
+	for _, tt := range tests {
+		r := mllp.NewReader(strings.NewReader(tt.input))
+		r.MaxMessageSize = 10
+		if _, err := r.ReadMessage(); !errors.Is(err, tt.want) {
+			t.Errorf("%s: expected %v, got %v", tt.name, tt.want, err)
+		}
+	}
+
+	if err := mllp.NewWriter(io.Discard).WriteMessage([]byte("a\x1cb")); !errors.Is(err, mllp.ErrInvalidFrame) {
+		t.Errorf("expected ErrInvalidFrame for a framing byte, got %v", err)
+	}
+}
+
+func TestClientServer(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := &mllp.Server{Handler: mllp.HandlerFunc(func(msg []byte) []byte {
+		if bytes.HasPrefix(msg, []byte("QUIET")) {
+			return nil
+		}
+		return append([]byte("ACK:"), msg...)
+	})}
+	done := make(chan error, 1)
+	go func() { done <- srv.Serve(l) }()
+
+	c, err := mllp.Dial(l.Addr().String(), 5*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	for _, msg := range []string{"one", "two"} {
+		reply, err := c.Send([]byte(msg))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(reply) != "ACK:"+msg {
+			t.Errorf("expected reply to %q, got %q", msg, reply)
+		}
+	}
+
+	c.Timeout = 50 * time.Millisecond
+	if _, err := c.Send([]byte("QUIET")); err == nil {
+		t.Error("expected a timeout without a reply")
+	}
+
+	if err := srv.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-done; !errors.Is(err, mllp.ErrServerClosed) {
+		t.Errorf("expected ErrServerClosed, got %v", err)
+	}
+}
@@ -0,0 +1,183 @@
+package mllp
+
+import (
+	"errors"
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+// ErrServerClosed is returned by Serve and ListenAndServe after Close.
+var ErrServerClosed = errors.New("mllp: server closed")
+
+// A Handler handles the messages received by a Server.
+type Handler interface {
+	// ServeMLLP returns the reply to msg, usually an ACK, or nil to send
+	// nothing. It may be called concurrently for different connections.
+	ServeMLLP(msg []byte) []byte
+}
+
+// HandlerFunc adapts a function to a Handler.
+type HandlerFunc func(msg []byte) []byte
+
+// ServeMLLP calls f(msg).
+func (f HandlerFunc) ServeMLLP(msg []byte) []byte {
+	return f(msg)
+}
+
+// A Server accepts MLLP connections and passes each message to Handler.
+// Messages on one connection are handled in order; each connection is
+// served by its own goroutine.
+type Server struct {
+	Addr    string  // TCP address to listen on, e.g. ":2575"
+	Handler Handler // handler for every message
+
+	// IdleTimeout closes a connection that sends nothing for this long.
+	// Zero means no timeout.
+	IdleTimeout time.Duration
+
+	// MaxMessageSize bounds a single message. Zero means
+	// DefaultMaxMessageSize.
+	MaxMessageSize int
+
+	// ErrorLog is called with connection errors other than a clean close.
+	// Nil discards them.
+	ErrorLog func(err error)
+
+	mu        sync.Mutex
+	listeners map[net.Listener]struct{}
+	conns     map[net.Conn]struct{}
+	closed    bool
+	wg        sync.WaitGroup
+}
+
+// ListenAndServe listens on Addr and serves connections until Close.
+func (s *Server) ListenAndServe() error {
+	l, err := net.Listen("tcp", s.Addr)
+	if err != nil {
+		return err
+	}
+	return s.Serve(l)
+}
+
+// Serve accepts connections on l until Close, and then returns
+// ErrServerClosed. It closes l when it returns.
+func (s *Server) Serve(l net.Listener) error {
+	if !s.track(l, nil) {
+		l.Close()
+		return ErrServerClosed
+	}
+	defer s.untrack(l, nil)
+	defer l.Close()
+
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			if s.isClosed() {
+				return ErrServerClosed
+			}
+			return err
+		}
+		if !s.track(nil, conn) {
+			conn.Close()
+			return ErrServerClosed
+		}
+		go func() {
+			defer s.untrack(nil, conn)
+			s.serveConn(conn)
+		}()
+	}
+}
+
+// serveConn reads and handles messages until the connection fails or closes.
+func (s *Server) serveConn(conn net.Conn) {
+	defer conn.Close()
+	r := NewReader(conn)
+	r.MaxMessageSize = s.MaxMessageSize
+	w := NewWriter(conn)
+	for {
+		if s.IdleTimeout > 0 {
+			conn.SetReadDeadline(time.Now().Add(s.IdleTimeout))
+		}
+		msg, err := r.ReadMessage()
+		if err != nil {
+			if err != io.EOF && !s.isClosed() {
+				s.logError(err)
+			}
+			return
+		}
+		if reply := s.Handler.ServeMLLP(msg); reply != nil {
+			if err := w.WriteMessage(reply); err != nil {
+				s.logError(err)
+				return
+			}
+		}
+	}
+}
+
+// Close stops the listeners, closes every connection and waits for their
+// handlers to return.
+func (s *Server) Close() error {
+	s.mu.Lock()
+	s.closed = true
+	var err error
+	for l := range s.listeners {
+		if cerr := l.Close(); cerr != nil && err == nil {
+			err = cerr
+		}
+	}
+	for c := range s.conns {
+		c.Close()
+	}
+	s.mu.Unlock()
+	s.wg.Wait()
+	return err
+}
+
+// track registers a listener or connection so that Close can stop it. It
+// reports false when the server is already closed.
+func (s *Server) track(l net.Listener, c net.Conn) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return false
+	}
+	if l != nil {
+		if s.listeners == nil {
+			s.listeners = make(map[net.Listener]struct{})
+		}
+		s.listeners[l] = struct{}{}
+	}
+	if c != nil {
+		if s.conns == nil {
+			s.conns = make(map[net.Conn]struct{})
+		}
+		s.conns[c] = struct{}{}
+		s.wg.Add(1)
+	}
+	return true
+}
+
+// untrack removes what track registered.
+func (s *Server) untrack(l net.Listener, c net.Conn) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.listeners, l)
+	if c != nil {
+		delete(s.conns, c)
+		s.wg.Done()
+	}
+}
+
+func (s *Server) isClosed() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.closed
+}
+
+func (s *Server) logError(err error) {
+	if s.ErrorLog != nil {
+		s.ErrorLog(err)
+	}
+}
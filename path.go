@@ -0,0 +1,271 @@
+package hl7
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Path addresses a value in a message, written as SEG[occurrence]-field
+// [repetition].component.subcomponent, e.g. PID-5, PID-3[2].1 or OBX[3]-5.
+// A path without a field, such as PID or OBX[3], addresses a whole segment.
+// Zero Occurrence and Repetition mean they were not given; their meaning is
+// up to the function using the path.
+type Path struct {
+	Segment    string
+	Occurrence int // 1-based segment occurrence, or 0
+	FieldPath
+}
+
+// ParsePath parses a path such as PID-3, PID-3.1, PID-3[2].1.2 or OBX[2]-5,
+// or a whole-segment path such as OBX or OBX[2], which has no Field.
+func ParsePath(s string) (Path, error) {
+	var p Path
+	seg, rest, hasField := strings.Cut(s, "-")
+
+	var err error
+	if p.Segment, p.Occurrence, err = cutIndex(seg); err != nil || !isSegmentName(p.Segment) {
+		return Path{}, fmt.Errorf("hl7: invalid path %q: bad segment %q", s, seg)
+	}
+	if !hasField {
+		return p, nil
+	}
+
+	parts := strings.Split(rest, ".")
+	if len(parts) > 3 {
+		return Path{}, fmt.Errorf("hl7: invalid path %q: too many components", s)
+	}
+	field, rep, err := cutIndex(parts[0])
+	if err == nil {
+		p.Field, err = strconv.Atoi(field)
+	}
+	if err != nil || p.Field < 1 {
+		return Path{}, fmt.Errorf("hl7: invalid path %q: bad field %q", s, parts[0])
+	}
+	p.Repetition = rep
+	for i, part := range parts[1:] {
+		n, err := strconv.Atoi(part)
+		if err != nil || n < 1 {
+			return Path{}, fmt.Errorf("hl7: invalid path %q: bad index %q", s, part)
+		}
+		if i == 0 {
+			p.Component = n
+		} else {
+			p.Subcomponent = n
+		}
+	}
+	return p, nil
+}
+
+// parseFieldPath parses a path like ParsePath, rejecting whole-segment
+// paths.
+func parseFieldPath(s string) (Path, error) {
+	p, err := ParsePath(s)
+	if err == nil && p.Field == 0 {
+		err = fmt.Errorf("hl7: invalid path %q: expected SEG-field", s)
+	}
+	return p, err
+}
+
+// cutIndex splits "name[n]" into name and n, returning 0 when there is no
+// index.
+func cutIndex(s string) (string, int, error) {
+	name, index, ok := strings.Cut(s, "[")
+	if !ok {
+		return s, 0, nil
+	}
+	index, ok = strings.CutSuffix(index, "]")
+	n, err := strconv.Atoi(index)
+	if !ok || err != nil || n < 1 {
+		return "", 0, fmt.Errorf("bad index in %q", s)
+	}
+	return name, n, nil
+}
+
+// isSegmentName reports whether s is a plausible segment name: three
+// upper-case letters or digits, starting with a letter.
+func isSegmentName(s string) bool {
+	if len(s) != 3 || s[0] < 'A' || s[0] > 'Z' {
+		return false
+	}
+	for i := 1; i < len(s); i++ {
+		if (s[i] < 'A' || s[i] > 'Z') && (s[i] < '0' || s[i] > '9') {
+			return false
+		}
+	}
+	return true
+}
+
+// String returns the path in the form accepted by ParsePath. A path with
+// no Field is written without one, e.g. OBX[2].
+func (p Path) String() string {
+	var b strings.Builder
+	b.WriteString(p.Segment)
+	if p.Occurrence > 0 {
+		b.WriteString("[" + strconv.Itoa(p.Occurrence) + "]")
+	}
+	if p.Field == 0 {
+		return b.String()
+	}
+	b.WriteString("-" + strconv.Itoa(p.Field))
+	if p.Repetition > 0 {
+		b.WriteString("[" + strconv.Itoa(p.Repetition) + "]")
+	}
+	if p.Component > 0 {
+		b.WriteString("." + strconv.Itoa(p.Component))
+	}
+	if p.Subcomponent > 0 {
+		b.WriteString("." + strconv.Itoa(p.Subcomponent))
+	}
+	return b.String()
+}
+
+// MarshalText implements encoding.TextMarshaler using String.
+func (p Path) MarshalText() ([]byte, error) {
+	return []byte(p.String()), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler using ParsePath.
+func (p *Path) UnmarshalText(text []byte) error {
+	path, err := ParsePath(string(text))
+	if err != nil {
+		return err
+	}
+	*p = path
+	return nil
+}
+
+// Value returns the raw value at p, or "" when it is absent. Without an
+// Occurrence the first segment named p.Segment is used. Without a
+// Repetition, a field path returns the whole field and a component path
+// reads the first repetition.
+func (m *GenericMessage) Value(p Path) string {
+	seg := m.segment(p.Segment, max(p.Occurrence, 1))
+	if seg == nil {
+		return ""
+	}
+	return seg.Value(p.FieldPath, m.Delimiters())
+}
+
+// SetValue sets the raw value at p, which must already be escaped. Without
+// an Occurrence the first segment named p.Segment is used, and it is
+// appended to the message when there is none. Without a Repetition, a
+// field path replaces the whole field and a component path writes to the
+// first repetition.
+func (m *GenericMessage) SetValue(p Path, value string) {
+	opts := m.Delimiters()
+	seg := m.segment(p.Segment, max(p.Occurrence, 1))
+	if seg == nil {
+		m.Segments = append(m.Segments, GenericSegment{Name: p.Segment, Fields: []GenericField{}})
+		seg = &m.Segments[len(m.Segments)-1]
+	}
+	seg.SetValue(p.FieldPath, value, opts)
+}
+
+// segment returns the nth segment named name, or nil.
+func (m *GenericMessage) segment(name string, n int) *GenericSegment {
+	for i := range m.Segments {
+		if m.Segments[i].Name == name {
+			if n--; n == 0 {
+				return &m.Segments[i]
+			}
+		}
+	}
+	return nil
+}
+
+// Value returns the raw value at p, or "" when it is absent. See
+// GenericMessage.Value.
+func (s *GenericSegment) Value(p FieldPath, opts MarshalOptions) string {
+	for _, f := range s.Fields {
+		if f.Index == p.Field {
+			return subValue(f.Value, p, opts)
+		}
+	}
+	return ""
+}
+
+// SetValue sets the raw value at p, which must already be escaped, adding
+// empty fields, repetitions and components as needed. See
+// GenericMessage.SetValue.
+func (s *GenericSegment) SetValue(p FieldPath, value string, opts MarshalOptions) {
+	if p.Field < 1 {
+		return
+	}
+	f := s.field(p.Field)
+	f.SetValue(setSubValue(f.Value, p, value, opts), opts)
+}
+
+// field returns the field with the given index, adding it and any missing
+// fields before it.
+func (s *GenericSegment) field(index int) *GenericField {
+	for i := range s.Fields {
+		if s.Fields[i].Index == index {
+			return &s.Fields[i]
+		}
+	}
+	next := 1
+	if n := len(s.Fields); n > 0 {
+		next = s.Fields[n-1].Index + 1
+	}
+	for ; next <= index; next++ {
+		s.Fields = append(s.Fields, GenericField{Index: next})
+	}
+	return &s.Fields[len(s.Fields)-1]
+}
+
+// subValue returns the part of a raw field value addressed by p.
+func subValue(v string, p FieldPath, opts MarshalOptions) string {
+	if p.Repetition == 0 && p.Component == 0 {
+		return v
+	}
+	v = nthValue(v, opts.RepetitionSeparator, max(p.Repetition, 1))
+	if p.Component > 0 {
+		v = nthValue(v, opts.ComponentSeparator, p.Component)
+	}
+	if p.Subcomponent > 0 {
+		v = nthValue(v, opts.SubcomponentSeparator, p.Subcomponent)
+	}
+	return v
+}
+
+// nthValue returns the 1-based nth part of v split by sep, or "".
+func nthValue(v string, sep byte, n int) string {
+	for ; n > 1; n-- {
+		i := strings.IndexByte(v, sep)
+		if i < 0 {
+			return ""
+		}
+		v = v[i+1:]
+	}
+	if i := strings.IndexByte(v, sep); i >= 0 {
+		v = v[:i]
+	}
+	return v
+}
+
+// setSubValue returns the raw field value v with the part addressed by p
+// replaced by value.
+func setSubValue(v string, p FieldPath, value string, opts MarshalOptions) string {
+	if p.Repetition == 0 && p.Component == 0 {
+		return value
+	}
+	seps := []byte{opts.RepetitionSeparator, opts.ComponentSeparator, opts.SubcomponentSeparator}
+	indexes := []int{max(p.Repetition, 1), p.Component, p.Subcomponent}
+	return setPart(v, seps, indexes, value)
+}
+
+// setPart replaces the part of v at indexes[0], split by seps[0], recursing
+// into the following levels while their index is set.
+func setPart(v string, seps []byte, indexes []int, value string) string {
+	if len(indexes) == 0 || indexes[0] == 0 {
+		return value
+	}
+	parts := strings.Split(v, string(seps[0]))
+	for len(parts) < indexes[0] {
+		parts = append(parts, "")
+	}
+	i := indexes[0] - 1
+	parts[i] = setPart(parts[i], seps[1:], indexes[1:], value)
+	return strings.Join(parts, string(seps[0]))
+}
@@ -0,0 +1,167 @@
+package hl7_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/esequiel378/hl7"
+)
+
+func TestParsePath(t *testing.T) {
+	tests := []struct {
+		in   string
+		want hl7.Path
+	}{
+		{"PID-5", hl7.Path{Segment: "PID", FieldPath: hl7.FieldPath{Field: 5}}},
+		{"PID-3.1", hl7.Path{Segment: "PID", FieldPath: hl7.FieldPath{Field: 3, Component: 1}}},
+		{"PID-3[2].1.2", hl7.Path{Segment: "PID", FieldPath: hl7.FieldPath{Field: 3, Repetition: 2, Component: 1, Subcomponent: 2}}},
+		{"OBX[2]-5", hl7.Path{Segment: "OBX", Occurrence: 2, FieldPath: hl7.FieldPath{Field: 5}}},
+		{"ZB1-10", hl7.Path{Segment: "ZB1", FieldPath: hl7.FieldPath{Field: 10}}},
+		{"PID", hl7.Path{Segment: "PID"}},
+		{"OBX[2]", hl7.Path{Segment: "OBX", Occurrence: 2}},
+	}
+	for _, tt := range tests {
+		got, err := hl7.ParsePath(tt.in)
+		if err != nil {
+			t.Errorf("ParsePath(%q): %v", tt.in, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ParsePath(%q) = %+v, want %+v", tt.in, got, tt.want)
+		}
+		if got.String() != tt.in {
+			t.Errorf("%+v.String() = %q, want %q", got, got.String(), tt.in)
+		}
+	}
+}
+
+func TestParsePathErrors(t *testing.T) {
+	for _, in := range []string{
+		"",
+		"PID-",
+		"PID-0",
+		"PID-x",
+		"pid-3",
+		"PI-3",
+		"1ID-3",
+		"PID[0]-3",
+		"PID[0]",
+		"PID[2-3",
+		"PID-3[x]",
+		"PID-3.0",
+		"PID-3.1.2.3",
+		"PID-3..1",
+	} {
+		if p, err := hl7.ParsePath(in); err == nil {
+			t.Errorf("ParsePath(%q) = %+v, expected an error", in, p)
+		}
+	}
+}
+
+func TestPathTextRoundTrip(t *testing.T) {
+	for _, p := range []hl7.Path{
+		{Segment: "OBX", Occurrence: 2},
+		{Segment: "PID"},
+		{Segment: "PID", FieldPath: hl7.FieldPath{Field: 3, Repetition: 2, Component: 4, Subcomponent: 1}},
+		{Segment: "OBX", Occurrence: 3, FieldPath: hl7.FieldPath{Field: 5}},
+	} {
+		text, err := p.MarshalText()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var back hl7.Path
+		if err := back.UnmarshalText(text); err != nil {
+			t.Errorf("UnmarshalText(%q): %v", text, err)
+			continue
+		}
+		if back != p {
+			t.Errorf("%q round-tripped to %+v, want %+v", text, back, p)
+		}
+	}
+}
+
+func TestGenericValue(t *testing.T) {
+	msg, err := hl7.ParseGeneric([]byte("MSH|^~\\&|LAB|HOSP|||20250114||ADT^A01|1|P|2.5\r" +
+		"PID|1||123^^^H~456^^^X&Y&ISO||DOE^JOHN^Q\\T\\R\r" +
+		"OBX|1|NM|A\rOBX|2|ST|B\r"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		path string
+		want string
+	}{
+		{"MSH-3", "LAB"},
+		{"MSH-9.2", "A01"},
+		{"PID-3", "123^^^H~456^^^X&Y&ISO"},
+		{"PID-3.1", "123"},
+		{"PID-3[2]", "456^^^X&Y&ISO"},
+		{"PID-3[2].4", "X&Y&ISO"},
+		{"PID-3[2].4.2", "Y"},
+		{"PID-3[3].1", ""},
+		{"PID-5.3", "Q\\T\\R"},
+		{"PID-5.9", ""},
+		{"PID-30", ""},
+		{"OBX-3", "A"},
+		{"OBX[2]-3", "B"},
+		{"OBX[3]-3", ""},
+		{"PV1-2", ""},
+	}
+	for _, tt := range tests {
+		if got := msg.Value(mustPath(t, tt.path)); got != tt.want {
+			t.Errorf("Value(%s) = %q, want %q", tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestGenericSetValue(t *testing.T) {
+	tests := []struct {
+		path, value string
+		want        string // the PID or OBX segments after the change
+	}{
+		{"PID-5", "ROE^JANE", "PID|1||123^^^H~456||ROE^JANE"},
+		{"PID-5.2", "JANE", "PID|1||123^^^H~456||DOE^JANE"},
+		{"PID-5.4", "JR", "PID|1||123^^^H~456||DOE^JOHN^^JR"},
+		{"PID-3[2].4", "X", "PID|1||123^^^H~456^^^X||DOE^JOHN"},
+		{"PID-3[3]", "789", "PID|1||123^^^H~456~789||DOE^JOHN"},
+		{"PID-3.4.2", "ISO", "PID|1||123^^^H&ISO~456||DOE^JOHN"},
+		{"PID-8", "M", "PID|1||123^^^H~456||DOE^JOHN|||M"},
+		{"PID-3", "", "PID|1||||DOE^JOHN"},
+		{"OBX[2]-5", "7", "OBX|1|NM\rOBX|2|NM|||7"},
+		{"OBX-5", "6", "OBX|1|NM|||6\rOBX|2|NM"},
+		{"PV1-2", "I", "PV1||I"},
+	}
+	for _, tt := range tests {
+		msg, err := hl7.ParseGeneric([]byte("MSH|^~\\&|LAB\rPID|1||123^^^H~456||DOE^JOHN\rOBX|1|NM\rOBX|2|NM\r"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		p := mustPath(t, tt.path)
+		msg.SetValue(p, tt.value)
+		if got := msg.Value(p); got != tt.value {
+			t.Errorf("%s: Value after SetValue = %q, want %q", tt.path, got, tt.value)
+		}
+		out, err := hl7.MarshalGeneric(msg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var segs []string
+		for line := range strings.SplitSeq(strings.TrimSpace(string(out)), "\r") {
+			if strings.HasPrefix(line, p.Segment) {
+				segs = append(segs, line)
+			}
+		}
+		if got := strings.Join(segs, "\r"); got != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.path, got, tt.want)
+		}
+	}
+}
+
+func mustPath(t *testing.T, s string) hl7.Path {
+	t.Helper()
+	p, err := hl7.ParsePath(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
@@ -0,0 +1,454 @@
+// Package queue implements a persistent store-and-forward queue for
+// outbound HL7 v2 messages.
+//
+// A Queue keeps messages in an append-only log file, synced to disk on
+// every change, so that messages enqueued before a crash or restart are
+// still delivered. Messages for one destination are delivered one at a
+// time, in the order they were enqueued; destinations do not wait for each
+// other. A Worker delivers them through a Transport, such as MLLPTransport,
+// and uses the MSA-1 code of each acknowledgment to commit the message,
+// retry it later, or set it aside as a dead letter:
+//
+//	q, err := queue.Open("/var/lib/myapp/outbound")
+//	...
+//	w := &queue.Worker{Queue: q, Transport: &queue.MLLPTransport{Timeout: 30 * time.Second}}
+//	go w.Run(ctx)
+//
+//	_, err = q.Enqueue("lab.example.org:2575", data)
+//
+// Delivery is at least once: a message sent just before a crash, whose ACK
+// was not recorded, is sent again after the restart. Receivers can detect
+// such duplicates with hl7.Idempotency.
+package queue
+
+import (
+	"bufio"
+	"cmp"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+)
+
+// ErrClosed is returned by the methods of a Queue after Close.
+var ErrClosed = errors.New("queue: closed")
+
+// A Message is a message in a Queue.
+type Message struct {
+	ID          uint64    // assigned by Enqueue, increasing
+	Destination string    // as passed to Enqueue
+	Data        []byte    // the encoded message
+	Enqueued    time.Time // when Enqueue was called
+	Reason      string    // why the message is a dead letter
+}
+
+// Record types of the log.
+const (
+	recordEnqueue = 'E' // a new message
+	recordCommit  = 'C' // a message was delivered or a dead letter removed
+	recordDead    = 'D' // a message became a dead letter
+	recordNextID  = 'N' // the ID of the next message, at the start of a compacted log
+)
+
+// logName is the name of the log file in the queue directory.
+const logName = "queue.log"
+
+// A Queue is a persistent queue of outbound messages, each addressed to a
+// destination. It is safe for concurrent use.
+type Queue struct {
+	mu      sync.Mutex
+	dir     string
+	f       *os.File
+	nextID  uint64
+	pending map[string][]*Message // by destination, oldest first
+	dead    []*Message
+	records int   // in the log
+	size    int64 // of the log
+	// compactAt is the number of records at which the log is rewritten.
+	compactAt int
+	// changed is closed and replaced whenever a message is enqueued, and
+	// closed by Close.
+	changed chan struct{}
+	closed  bool
+}
+
+// Open opens the queue stored in dir, creating the directory if needed. A
+// record left incomplete by a crash is discarded.
+func Open(dir string) (*Queue, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, err
+	}
+	q := &Queue{
+		dir:     dir,
+		nextID:  1,
+		pending: make(map[string][]*Message),
+		changed: make(chan struct{}),
+	}
+
+	f, err := os.OpenFile(filepath.Join(dir, logName), os.O_RDWR|os.O_CREATE, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	good, err := q.replay(f)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	// Drop what follows the last complete record, so that new records are
+	// not appended to a torn one.
+	if err := f.Truncate(good); err != nil {
+		f.Close()
+		return nil, err
+	}
+	if _, err := f.Seek(good, io.SeekStart); err != nil {
+		f.Close()
+		return nil, err
+	}
+	q.f, q.size = f, good
+	q.compactAt = 2*q.records + 1024
+	return q, nil
+}
+
+// replay applies the records of the log to q and returns the offset just
+// after the last complete one.
+func (q *Queue) replay(f *os.File) (int64, error) {
+	info, err := f.Stat()
+	if err != nil {
+		return 0, err
+	}
+	r := bufio.NewReader(f)
+	var good int64
+	for {
+		var header [8]byte
+		if _, err := io.ReadFull(r, header[:]); err != nil {
+			return good, nil
+		}
+		// The length of a torn header may be garbage; do not allocate more
+		// than the file holds.
+		n := int64(binary.BigEndian.Uint32(header[:4]))
+		if n > info.Size()-good-int64(len(header)) {
+			return good, nil
+		}
+		payload := make([]byte, n)
+		if _, err := io.ReadFull(r, payload); err != nil {
+			return good, nil
+		}
+		if crc32.ChecksumIEEE(payload) != binary.BigEndian.Uint32(header[4:]) {
+			return good, nil
+		}
+		if err := q.apply(payload); err != nil {
+			return 0, fmt.Errorf("queue: record at offset %d: %w", good, err)
+		}
+		good += int64(len(header) + len(payload))
+		q.records++
+	}
+}
+
+// apply applies one record of the log to q.
+func (q *Queue) apply(payload []byte) error {
+	if len(payload) == 0 {
+		return errors.New("empty record")
+	}
+	typ, rest := payload[0], payload[1:]
+	id, n := binary.Uvarint(rest)
+	if n <= 0 {
+		return errors.New("invalid message ID")
+	}
+	rest = rest[n:]
+
+	switch typ {
+	case recordEnqueue:
+		enqueued, n := binary.Varint(rest)
+		if n <= 0 {
+			return errors.New("invalid time")
+		}
+		rest = rest[n:]
+		destLen, n := binary.Uvarint(rest)
+		if n <= 0 || uint64(len(rest)-n) < destLen {
+			return errors.New("invalid destination")
+		}
+		rest = rest[n:]
+		m := &Message{
+			ID:          id,
+			Destination: string(rest[:destLen]),
+			Data:        rest[destLen:],
+			Enqueued:    time.Unix(0, enqueued),
+		}
+		q.pending[m.Destination] = append(q.pending[m.Destination], m)
+		q.nextID = max(q.nextID, id+1)
+	case recordCommit:
+		if _, ok := q.removePending(id); !ok {
+			q.dead = slices.DeleteFunc(q.dead, func(m *Message) bool { return m.ID == id })
+		}
+	case recordDead:
+		if m, ok := q.removePending(id); ok {
+			m.Reason = string(rest)
+			q.dead = append(q.dead, m)
+		}
+	case recordNextID:
+		q.nextID = max(q.nextID, id)
+	default:
+		return fmt.Errorf("unknown record type %q", typ)
+	}
+	return nil
+}
+
+// removePending removes the pending message with the given ID.
+func (q *Queue) removePending(id uint64) (*Message, bool) {
+	for dest, msgs := range q.pending {
+		for i, m := range msgs {
+			if m.ID != id {
+				continue
+			}
+			if len(msgs) == 1 {
+				delete(q.pending, dest)
+			} else {
+				q.pending[dest] = slices.Delete(msgs, i, i+1)
+			}
+			return m, true
+		}
+	}
+	return nil, false
+}
+
+// appendRecords writes records to the log and syncs it. A failed write is
+// truncated away, so that later records do not follow a torn one.
+func (q *Queue) appendRecords(payloads ...[]byte) error {
+	buf := frameRecords(payloads...)
+	if _, err := q.f.Write(buf); err != nil {
+		q.f.Truncate(q.size)
+		q.f.Seek(q.size, io.SeekStart)
+		return err
+	}
+	if err := q.f.Sync(); err != nil {
+		return err
+	}
+	q.records += len(payloads)
+	q.size += int64(len(buf))
+	return nil
+}
+
+// frameRecords frames each payload with its length and CRC-32.
+func frameRecords(payloads ...[]byte) []byte {
+	var buf []byte
+	for _, p := range payloads {
+		buf = binary.BigEndian.AppendUint32(buf, uint32(len(p)))
+		buf = binary.BigEndian.AppendUint32(buf, crc32.ChecksumIEEE(p))
+		buf = append(buf, p...)
+	}
+	return buf
+}
+
+func enqueueRecord(m *Message) []byte {
+	p := binary.AppendUvarint([]byte{recordEnqueue}, m.ID)
+	p = binary.AppendVarint(p, m.Enqueued.UnixNano())
+	p = binary.AppendUvarint(p, uint64(len(m.Destination)))
+	p = append(p, m.Destination...)
+	return append(p, m.Data...)
+}
+
+func nextIDRecord(id uint64) []byte {
+	return binary.AppendUvarint([]byte{recordNextID}, id)
+}
+
+func commitRecord(id uint64) []byte {
+	return binary.AppendUvarint([]byte{recordCommit}, id)
+}
+
+func deadRecord(id uint64, reason string) []byte {
+	return append(binary.AppendUvarint([]byte{recordDead}, id), reason...)
+}
+
+// Enqueue appends a copy of msg to the messages for dest and returns its
+// ID. The message is on disk when Enqueue returns.
+func (q *Queue) Enqueue(dest string, msg []byte) (uint64, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.closed {
+		return 0, ErrClosed
+	}
+	m := &Message{ID: q.nextID, Destination: dest, Data: slices.Clone(msg), Enqueued: time.Now()}
+	if err := q.appendRecords(enqueueRecord(m)); err != nil {
+		return 0, err
+	}
+	q.nextID++
+	q.pending[dest] = append(q.pending[dest], m)
+	close(q.changed)
+	q.changed = make(chan struct{})
+	return m.ID, nil
+}
+
+// Pending returns the messages waiting to be delivered to dest, oldest
+// first.
+func (q *Queue) Pending(dest string) []Message {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return copyMessages(q.pending[dest])
+}
+
+// DeadLetters returns the messages that could not be delivered, in the
+// order they were set aside.
+func (q *Queue) DeadLetters() []Message {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return copyMessages(q.dead)
+}
+
+func copyMessages(msgs []*Message) []Message {
+	out := make([]Message, len(msgs))
+	for i, m := range msgs {
+		out[i] = *m
+	}
+	return out
+}
+
+// RemoveDeadLetter removes the dead letter with the given ID, for instance
+// once it has been handled by hand or enqueued again.
+func (q *Queue) RemoveDeadLetter(id uint64) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.closed {
+		return ErrClosed
+	}
+	i := slices.IndexFunc(q.dead, func(m *Message) bool { return m.ID == id })
+	if i < 0 {
+		return fmt.Errorf("queue: no dead letter %d", id)
+	}
+	if err := q.appendRecords(commitRecord(id)); err != nil {
+		return err
+	}
+	q.dead = slices.Delete(q.dead, i, i+1)
+	return q.maybeCompact()
+}
+
+// destinations returns the destinations with pending messages, and a
+// channel that is closed when a message is enqueued.
+func (q *Queue) destinations() ([]string, <-chan struct{}, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.closed {
+		return nil, nil, ErrClosed
+	}
+	dests := make([]string, 0, len(q.pending))
+	for dest := range q.pending {
+		dests = append(dests, dest)
+	}
+	return dests, q.changed, nil
+}
+
+// head returns the oldest pending message for dest. When there is none, it
+// returns a channel that is closed when a message is enqueued.
+func (q *Queue) head(dest string) (*Message, <-chan struct{}, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.closed {
+		return nil, nil, ErrClosed
+	}
+	if msgs := q.pending[dest]; len(msgs) > 0 {
+		return msgs[0], nil, nil
+	}
+	return nil, q.changed, nil
+}
+
+// commit removes m, which was delivered, from the pending messages.
+func (q *Queue) commit(m *Message) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.closed {
+		return ErrClosed
+	}
+	if err := q.appendRecords(commitRecord(m.ID)); err != nil {
+		return err
+	}
+	q.removePending(m.ID)
+	return q.maybeCompact()
+}
+
+// deadLetter moves m from the pending messages to the dead letters.
+func (q *Queue) deadLetter(m *Message, reason string) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.closed {
+		return ErrClosed
+	}
+	if err := q.appendRecords(deadRecord(m.ID, reason)); err != nil {
+		return err
+	}
+	if m, ok := q.removePending(m.ID); ok {
+		m.Reason = reason
+		q.dead = append(q.dead, m)
+	}
+	return q.maybeCompact()
+}
+
+// maybeCompact rewrites the log with only the messages still in the queue
+// once it has doubled in size since it was last rewritten. The new log
+// replaces the old one atomically. It starts with the next message ID, so
+// IDs keep increasing when no message is left.
+func (q *Queue) maybeCompact() error {
+	if q.records < q.compactAt {
+		return nil
+	}
+
+	var live []*Message
+	for _, msgs := range q.pending {
+		live = append(live, msgs...)
+	}
+	live = append(live, q.dead...)
+	slices.SortFunc(live, func(a, b *Message) int { return cmp.Compare(a.ID, b.ID) })
+	payloads := [][]byte{nextIDRecord(q.nextID)}
+	for _, m := range live {
+		payloads = append(payloads, enqueueRecord(m))
+	}
+	for _, m := range q.dead {
+		payloads = append(payloads, deadRecord(m.ID, m.Reason))
+	}
+
+	path := filepath.Join(q.dir, logName)
+	tmp := path + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0o600)
+	if err != nil {
+		return err
+	}
+	buf := frameRecords(payloads...)
+	if _, err := f.Write(buf); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		f.Close()
+		return err
+	}
+	if dir, err := os.Open(q.dir); err == nil {
+		dir.Sync()
+		dir.Close()
+	}
+	q.f.Close()
+	q.f = f
+	q.records, q.size = len(payloads), int64(len(buf))
+	q.compactAt = 2*q.records + 1024
+	return nil
+}
+
+// Close closes the log. Workers running on the queue stop, and other
+// methods return ErrClosed.
+func (q *Queue) Close() error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.closed {
+		return nil
+	}
+	q.closed = true
+	close(q.changed)
+	return q.f.Close()
+}
@@ -0,0 +1,375 @@
+package queue_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/esequiel378/hl7"
+	"github.com/esequiel378/hl7/mllp"
+	"github.com/esequiel378/hl7/queue"
+)
+
+func message(id string) []byte {
+	return []byte("MSH|^~\\&|APP|FAC|||20250114||ADT^A01|" + id + "|P|2.5\rPID|1||42\r")
+}
+
+// ack returns an acknowledgment for msg with the given MSA-1 code.
+func ack(t *testing.T, msg []byte, code string) []byte {
+	t.Helper()
+	parsed, err := hl7.ParseGeneric(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := hl7.MarshalGeneric(hl7.NewAck(parsed, code, ""))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func controlID(msg []byte) string {
+	parsed, _ := hl7.ParseGeneric(msg)
+	return parsed.Value(hl7.Path{Segment: "MSH", FieldPath: hl7.FieldPath{Field: 10}})
+}
+
+// transportFunc adapts a function to a Transport.
+type transportFunc func(ctx context.Context, dest string, msg []byte) ([]byte, error)
+
+func (f transportFunc) Send(ctx context.Context, dest string, msg []byte) ([]byte, error) {
+	return f(ctx, dest, msg)
+}
+
+// waitFor polls cond until it holds or a deadline passes.
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func ids(msgs []queue.Message) string {
+	var s []string
+	for _, m := range msgs {
+		s = append(s, controlID(m.Data))
+	}
+	return strings.Join(s, " ")
+}
+
+func TestQueueReopen(t *testing.T) {
+	dir := t.TempDir()
+	q, err := queue.Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range []struct{ dest, id string }{{"a", "1"}, {"b", "2"}, {"a", "3"}} {
+		if _, err := q.Enqueue(e.dest, message(e.id)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := q.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := q.Enqueue("a", message("4")); !errors.Is(err, queue.ErrClosed) {
+		t.Errorf("expected ErrClosed, got %v", err)
+	}
+
+	// A crash in the middle of an append leaves a torn record.
+	f, err := os.OpenFile(filepath.Join(dir, "queue.log"), os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Write([]byte{0, 0, 1, 0, 1, 2})
+	f.Close()
+
+	q, err = queue.Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := ids(q.Pending("a")); got != "1 3" {
+		t.Errorf("expected messages 1 3 for a, got %q", got)
+	}
+	if got := ids(q.Pending("b")); got != "2" {
+		t.Errorf("expected message 2 for b, got %q", got)
+	}
+	id, err := q.Enqueue("b", message("5"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id != 4 {
+		t.Errorf("expected ID 4, got %d", id)
+	}
+	q.Close()
+
+	// Message 5 was written after the torn record had been dropped.
+	q, err = queue.Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer q.Close()
+	if got := ids(q.Pending("b")); got != "2 5" {
+		t.Errorf("expected messages 2 5 for b, got %q", got)
+	}
+}
+
+func TestQueueIDsAfterCompaction(t *testing.T) {
+	dir := t.TempDir()
+	q, err := queue.Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Delivering them all compacts the log down to no message at all.
+	const n = 512
+	for i := range n {
+		if _, err := q.Enqueue("a", message(fmt.Sprint(i))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	transport := transportFunc(func(ctx context.Context, dest string, msg []byte) ([]byte, error) {
+		return ack(t, msg, hl7.AckAccept), nil
+	})
+	go (&queue.Worker{Queue: q, Transport: transport}).Run(ctx)
+	waitFor(t, "delivery", func() bool { return len(q.Pending("a")) == 0 })
+	cancel()
+	q.Close()
+
+	q, err = queue.Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer q.Close()
+	id, err := q.Enqueue("a", message("next"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id != n+1 {
+		t.Errorf("expected ID %d, got %d", n+1, id)
+	}
+}
+
+func TestQueueGarbageLength(t *testing.T) {
+	dir := t.TempDir()
+	q, err := queue.Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := q.Enqueue("a", message("1")); err != nil {
+		t.Fatal(err)
+	}
+	q.Close()
+
+	// A torn header may claim a record far larger than the file.
+	f, err := os.OpenFile(filepath.Join(dir, "queue.log"), os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Write([]byte{0xff, 0xff, 0xff, 0xff, 0, 0, 0, 0, 'E'})
+	f.Close()
+
+	q, err = queue.Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer q.Close()
+	if got := ids(q.Pending("a")); got != "1" {
+		t.Errorf("expected message 1 for a, got %q", got)
+	}
+}
+
+func TestWorker(t *testing.T) {
+	q, err := queue.Open(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer q.Close()
+
+	var mu sync.Mutex
+	var sent []string
+	tries := map[string]int{}
+	transport := transportFunc(func(ctx context.Context, dest string, msg []byte) ([]byte, error) {
+		id := controlID(msg)
+		mu.Lock()
+		defer mu.Unlock()
+		sent = append(sent, dest+":"+id)
+		tries[id]++
+		switch {
+		case id == "DOWN" && tries[id] < 3:
+			return nil, errors.New("connection refused")
+		case id == "STALE" && tries[id] < 2:
+			// A late reply to another message.
+			return ack(t, message("R0"), hl7.AckAccept), nil
+		case id == "BAD":
+			return ack(t, msg, hl7.AckError), nil
+		case id == "BUSY" && tries[id] < 2:
+			return ack(t, msg, hl7.AckReject), nil
+		}
+		return ack(t, msg, hl7.AckAccept), nil
+	})
+
+	for _, e := range []struct{ dest, id string }{
+		{"lab", "DOWN"}, {"lab", "L2"}, {"lab", "BAD"}, {"lab", "L4"},
+		{"ris", "STALE"}, {"ris", "BUSY"}, {"ris", "R3"},
+	} {
+		q.Enqueue(e.dest, message(e.id))
+	}
+
+	var logged []error
+	w := &queue.Worker{
+		Queue:     q,
+		Transport: transport,
+		Backoff:   func(int) time.Duration { return time.Millisecond },
+		ErrorLog: func(err error) {
+			mu.Lock()
+			logged = append(logged, err)
+			mu.Unlock()
+		},
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- w.Run(ctx) }()
+
+	waitFor(t, "delivery", func() bool { return len(q.Pending("lab"))+len(q.Pending("ris")) == 0 })
+	q.Enqueue("pacs", message("P1"))
+	waitFor(t, "a new destination", func() bool { return len(q.Pending("pacs")) == 0 })
+	cancel()
+	if err := <-done; !errors.Is(err, context.Canceled) {
+		t.Errorf("expected context.Canceled, got %v", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	var lab, ris []string
+	for _, s := range sent {
+		dest, id, _ := strings.Cut(s, ":")
+		switch dest {
+		case "lab":
+			lab = append(lab, id)
+		case "ris":
+			ris = append(ris, id)
+		}
+	}
+	if got := strings.Join(lab, " "); got != "DOWN DOWN DOWN L2 BAD L4" {
+		t.Errorf("lab: got %q", got)
+	}
+	if got := strings.Join(ris, " "); got != "STALE STALE BUSY BUSY R3" {
+		t.Errorf("ris: got %q", got)
+	}
+	dead := q.DeadLetters()
+	if len(dead) != 1 || controlID(dead[0].Data) != "BAD" || !strings.Contains(dead[0].Reason, "MSA|AE|BAD") {
+		t.Fatalf("expected BAD as the only dead letter, got %+v", dead)
+	}
+	if len(logged) != 5 || !strings.Contains(fmt.Sprint(logged), `acknowledges message "R0", not "STALE"`) {
+		t.Errorf("expected 2 failed sends, 1 stale reply, 1 reject and 1 dead letter to be logged, got %v", logged)
+	}
+
+	if err := q.RemoveDeadLetter(dead[0].ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := q.RemoveDeadLetter(dead[0].ID); err == nil {
+		t.Error("expected an error removing a dead letter twice")
+	}
+}
+
+func TestWorkerMaxAttempts(t *testing.T) {
+	q, err := queue.Open(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	q.Enqueue("lab", message("1"))
+	q.Enqueue("lab", message("2"))
+
+	var attempts int
+	w := &queue.Worker{
+		Queue: q,
+		Transport: transportFunc(func(ctx context.Context, dest string, msg []byte) ([]byte, error) {
+			attempts++
+			return []byte("garbage"), nil
+		}),
+		Backoff:     func(int) time.Duration { return time.Millisecond },
+		MaxAttempts: 3,
+	}
+	done := make(chan error)
+	go func() { done <- w.Run(context.Background()) }()
+	waitFor(t, "dead letters", func() bool { return len(q.DeadLetters()) == 2 })
+
+	q.Close()
+	if err := <-done; !errors.Is(err, queue.ErrClosed) {
+		t.Errorf("expected ErrClosed, got %v", err)
+	}
+	if attempts != 6 {
+		t.Errorf("expected 3 attempts per message, got %d", attempts)
+	}
+	for _, m := range q.DeadLetters() {
+		if !strings.Contains(m.Reason, "without an MSA segment (after 3 attempts)") {
+			t.Errorf("unexpected reason %q", m.Reason)
+		}
+	}
+}
+
+func TestMLLPTransport(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var mu sync.Mutex
+	var received []string
+	srv := &mllp.Server{Handler: mllp.HandlerFunc(func(msg []byte) []byte {
+		mu.Lock()
+		received = append(received, controlID(msg))
+		mu.Unlock()
+		return ack(t, msg, hl7.AckAccept)
+	})}
+	go srv.Serve(l)
+	defer srv.Close()
+
+	dir := t.TempDir()
+	q, err := queue.Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer q.Close()
+	transport := &queue.MLLPTransport{Timeout: 5 * time.Second}
+	defer transport.Close()
+
+	// Enough messages for the log to be compacted on the way.
+	const n = 600
+	var want []string
+	for i := range n {
+		id := fmt.Sprint(i)
+		want = append(want, id)
+		if _, err := q.Enqueue(l.Addr().String(), message(id)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go (&queue.Worker{Queue: q, Transport: transport}).Run(ctx)
+	waitFor(t, "delivery", func() bool { return len(q.Pending(l.Addr().String())) == 0 })
+
+	mu.Lock()
+	if got := strings.Join(received, " "); got != strings.Join(want, " ") {
+		t.Errorf("messages arrived out of order: %.80s...", got)
+	}
+	mu.Unlock()
+
+	info, err := os.Stat(filepath.Join(dir, "queue.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if size := info.Size(); size > int64(n*len(message("000"))) {
+		t.Errorf("expected the log to be compacted, got %d bytes", size)
+	}
+}
@@ -0,0 +1,96 @@
+package queue
+
+import (
+	"context"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/esequiel378/hl7/mllp"
+)
+
+// MLLPTransport sends messages over MLLP to destinations given as TCP
+// addresses, such as "lab.example.org:2575". It keeps one connection per
+// destination open between messages and reconnects after an error. The
+// zero value is ready to use; it is safe for concurrent use.
+type MLLPTransport struct {
+	// Timeout bounds connecting and each Send, from writing the message to
+	// reading the reply. Zero means no timeout.
+	Timeout time.Duration
+
+	mu     sync.Mutex
+	idle   map[string]*mllpConn
+	closed bool
+}
+
+type mllpConn struct {
+	conn   net.Conn
+	client *mllp.Client
+}
+
+// Send implements Transport.
+func (t *MLLPTransport) Send(ctx context.Context, dest string, msg []byte) ([]byte, error) {
+	c, err := t.get(ctx, dest)
+	if err != nil {
+		return nil, err
+	}
+	// Unblock the Send when ctx is done.
+	stop := context.AfterFunc(ctx, func() { c.conn.SetDeadline(time.Unix(1, 0)) })
+	reply, err := c.client.Send(msg)
+	if !stop() || err != nil {
+		c.conn.Close()
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, err
+	}
+	t.put(dest, c)
+	return reply, nil
+}
+
+// get returns the idle connection to dest, or a new one.
+func (t *MLLPTransport) get(ctx context.Context, dest string) (*mllpConn, error) {
+	t.mu.Lock()
+	c := t.idle[dest]
+	delete(t.idle, dest)
+	t.mu.Unlock()
+	if c != nil {
+		return c, nil
+	}
+
+	d := net.Dialer{Timeout: t.Timeout}
+	conn, err := d.DialContext(ctx, "tcp", dest)
+	if err != nil {
+		return nil, err
+	}
+	client := mllp.NewClient(conn)
+	client.Timeout = t.Timeout
+	return &mllpConn{conn: conn, client: client}, nil
+}
+
+// put keeps c as the idle connection to dest.
+func (t *MLLPTransport) put(dest string, c *mllpConn) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.closed || t.idle[dest] != nil {
+		c.conn.Close()
+		return
+	}
+	if t.idle == nil {
+		t.idle = make(map[string]*mllpConn)
+	}
+	t.idle[dest] = c
+}
+
+// Close closes the idle connections. Connections in use are closed once
+// their Send returns.
+func (t *MLLPTransport) Close() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.closed = true
+	for dest, c := range t.idle {
+		c.conn.Close()
+		delete(t.idle, dest)
+	}
+	return nil
+}
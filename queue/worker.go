@@ -0,0 +1,266 @@
+package queue
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/esequiel378/hl7"
+)
+
+// A Transport sends messages to their destination.
+type Transport interface {
+	// Send delivers msg to dest, a destination passed to Queue.Enqueue, and
+	// returns the reply, usually an ACK. It is called by one goroutine per
+	// destination, so calls for different destinations may run
+	// concurrently.
+	Send(ctx context.Context, dest string, msg []byte) ([]byte, error)
+}
+
+// An Outcome is what a Worker does with a message once it has its reply.
+type Outcome int
+
+const (
+	Commit     Outcome = iota // the message was delivered; remove it
+	Retry                     // send the message again after a backoff
+	DeadLetter                // set the message aside and move on
+)
+
+func (o Outcome) String() string {
+	switch o {
+	case Commit:
+		return "commit"
+	case Retry:
+		return "retry"
+	case DeadLetter:
+		return "dead letter"
+	}
+	return fmt.Sprintf("Outcome(%d)", int(o))
+}
+
+// ClassifyAck decides the outcome of a message from the MSA-1 code of its
+// acknowledgment. AA and CA commit the message. AE and CE, which report an
+// error in the message itself, make it a dead letter, as sending it again
+// would fail the same way. AR and CR, which a receiver also returns when it
+// is down or cannot process messages for now, and replies without an MSA
+// segment are retried; set Worker.MaxAttempts, or use a Classify of your
+// own, to give up on them.
+func ClassifyAck(ack []byte) Outcome {
+	msg, err := hl7.ParseGeneric(ack)
+	if err != nil {
+		return Retry
+	}
+	switch msg.Value(hl7.Path{Segment: "MSA", FieldPath: hl7.FieldPath{Field: 1}}) {
+	case hl7.AckAccept, "CA":
+		return Commit
+	case hl7.AckError, "CE":
+		return DeadLetter
+	}
+	return Retry
+}
+
+// DefaultBackoff waits one second before the first retry and doubles the
+// wait for every further one, up to five minutes.
+func DefaultBackoff(attempt int) time.Duration {
+	if attempt > 9 {
+		return 5 * time.Minute
+	}
+	return min(time.Second<<max(attempt-1, 0), 5*time.Minute)
+}
+
+// A Worker delivers the messages of a Queue. It sends the oldest message of
+// each destination and waits for its reply before sending the next, so
+// messages arrive in the order they were enqueued. A message that is
+// retried holds up the messages behind it; once it becomes a dead letter,
+// delivery moves on.
+type Worker struct {
+	Queue     *Queue
+	Transport Transport
+
+	// Classify decides the outcome of a message from its reply. Nil means
+	// ClassifyAck. Messages that the Transport fails to send, and messages
+	// whose reply has an MSA segment acknowledging another message (MSA-2
+	// differs from the MSH-10 sent), are retried without calling it.
+	Classify func(ack []byte) Outcome
+
+	// Backoff returns how long to wait before retrying a message for the
+	// given attempt, starting at 1. Nil means DefaultBackoff.
+	Backoff func(attempt int) time.Duration
+
+	// MaxAttempts makes a message a dead letter after it was tried this
+	// many times. Zero retries it until it is delivered. Attempts are
+	// counted from the last time the Worker was started.
+	MaxAttempts int
+
+	// ErrorLog is called with every failed attempt and every error writing
+	// to the queue. Nil discards them.
+	ErrorLog func(err error)
+}
+
+// Run delivers messages until ctx is done or the queue is closed, and
+// returns ctx.Err() or ErrClosed. A message that is being sent when Run
+// returns stays in the queue and is sent again by the next Run.
+func (w *Worker) Run(ctx context.Context) error {
+	// Deferred calls run last first: stop the deliveries, then wait for them.
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	running := make(map[string]bool)
+	for {
+		dests, changed, err := w.Queue.destinations()
+		if err != nil {
+			return err
+		}
+		for _, dest := range dests {
+			if running[dest] {
+				continue
+			}
+			running[dest] = true
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				w.deliver(ctx, dest)
+			}()
+		}
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// deliver sends the messages for dest until ctx is done or the queue is
+// closed.
+func (w *Worker) deliver(ctx context.Context, dest string) {
+	attempt := 0
+	for {
+		m, changed, err := w.Queue.head(dest)
+		if err != nil {
+			return
+		}
+		if m == nil {
+			select {
+			case <-changed:
+				continue
+			case <-ctx.Done():
+				return
+			}
+		}
+
+		attempt++
+		outcome, reason := w.send(ctx, m)
+		if ctx.Err() != nil {
+			return
+		}
+		if outcome == Retry && w.MaxAttempts > 0 && attempt >= w.MaxAttempts {
+			outcome = DeadLetter
+			reason = fmt.Sprintf("%s (after %d attempts)", reason, attempt)
+		}
+
+		switch outcome {
+		case Commit:
+			err = w.Queue.commit(m)
+		case DeadLetter:
+			w.logError(fmt.Errorf("queue: message %d to %s is a dead letter: %s", m.ID, dest, reason))
+			err = w.Queue.deadLetter(m, reason)
+		default:
+			w.logError(fmt.Errorf("queue: message %d to %s, attempt %d: %s", m.ID, dest, attempt, reason))
+		}
+		if errors.Is(err, ErrClosed) {
+			return
+		}
+		if err != nil {
+			w.logError(err)
+			outcome = Retry
+		}
+		if outcome != Retry {
+			attempt = 0
+			continue
+		}
+
+		if !sleep(ctx, w.backoff(attempt)) {
+			return
+		}
+	}
+}
+
+// send sends m and returns its outcome and, unless it is Commit, a reason
+// for it.
+func (w *Worker) send(ctx context.Context, m *Message) (Outcome, string) {
+	ack, err := w.Transport.Send(ctx, m.Destination, m.Data)
+	if err != nil {
+		return Retry, err.Error()
+	}
+	if acked, sent, ok := ackFor(ack, m.Data); !ok {
+		return Retry, fmt.Sprintf("reply acknowledges message %q, not %q", acked, sent)
+	}
+	classify := w.Classify
+	if classify == nil {
+		classify = ClassifyAck
+	}
+	outcome := classify(ack)
+	if outcome == Commit {
+		return Commit, ""
+	}
+	return outcome, "reply " + msaLine(ack)
+}
+
+// ackFor reports whether ack acknowledges msg, returning MSA-2 of ack and
+// MSH-10 of msg. A reply without an MSA segment is left to Classify.
+func ackFor(ack, msg []byte) (acked, sent string, ok bool) {
+	reply, err := hl7.ParseGeneric(ack)
+	if err != nil {
+		return "", "", true
+	}
+	if !slices.ContainsFunc(reply.Segments, func(seg hl7.GenericSegment) bool { return seg.Name == "MSA" }) {
+		return "", "", true
+	}
+	acked = reply.Value(hl7.Path{Segment: "MSA", FieldPath: hl7.FieldPath{Field: 2}})
+	if orig, err := hl7.ParseGeneric(msg); err == nil {
+		sent = orig.Value(hl7.Path{Segment: "MSH", FieldPath: hl7.FieldPath{Field: 10}})
+	}
+	return acked, sent, acked == sent
+}
+
+// msaLine returns the MSA segment of ack, which holds the acknowledgment
+// code and text, or a note that there is none.
+func msaLine(ack []byte) string {
+	for line := range bytes.FieldsFuncSeq(ack, func(r rune) bool { return r == '\r' || r == '\n' }) {
+		if bytes.HasPrefix(line, []byte("MSA")) {
+			return fmt.Sprintf("%q", line)
+		}
+	}
+	return "without an MSA segment"
+}
+
+func (w *Worker) backoff(attempt int) time.Duration {
+	if w.Backoff != nil {
+		return w.Backoff(attempt)
+	}
+	return DefaultBackoff(attempt)
+}
+
+func (w *Worker) logError(err error) {
+	if w.ErrorLog != nil {
+		w.ErrorLog(err)
+	}
+}
+
+// sleep waits for d and reports whether ctx is still running.
+func sleep(ctx context.Context, d time.Duration) bool {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
@@ -0,0 +1,221 @@
+package hl7
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// Redaction controls how error messages and log attributes show raw
+// message values, which may contain protected health information. The
+// Value fields of the error types always hold the raw value; only their
+// Error and LogValue output is redacted.
+type Redaction int32
+
+const (
+	// RedactDefault uses the package-level policy set by SetRedaction.
+	RedactDefault Redaction = iota
+	// RedactNone shows values verbatim. It is the initial package-level policy.
+	RedactNone
+	// RedactLength replaces values with their length, e.g. <redacted len=8>.
+	RedactLength
+	// RedactHash replaces values with a keyed SHA-256 digest, e.g.
+	// <hmac:3f2a9c1d0b7e>, so equal values can be correlated across log
+	// lines without being revealed. See SetRedactionKey.
+	RedactHash
+	// RedactMask replaces values with <redacted>.
+	RedactMask
+)
+
+var (
+	defaultRedaction atomic.Int32
+
+	redactionKeyMu sync.RWMutex
+	redactionKey   = newRedactionKey()
+)
+
+func newRedactionKey() []byte {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		panic("hl7: cannot generate redaction key: " + err.Error())
+	}
+	return key
+}
+
+// SetRedaction sets the package-level redaction policy used by errors whose
+// Redaction is RedactDefault. It is safe for concurrent use.
+func SetRedaction(r Redaction) {
+	defaultRedaction.Store(int32(r))
+}
+
+// SetRedactionKey sets the key of the RedactHash digests. By default a
+// random key is generated per process, so digests only correlate within one
+// process; share a key to correlate them across services. Without a secret
+// key, short values such as dates of birth could be recovered from their
+// digests by brute force.
+func SetRedactionKey(key []byte) {
+	redactionKeyMu.Lock()
+	defer redactionKeyMu.Unlock()
+	redactionKey = append([]byte(nil), key...)
+}
+
+// String returns the name of the policy.
+func (r Redaction) String() string {
+	switch r {
+	case RedactDefault:
+		return "default"
+	case RedactNone:
+		return "none"
+	case RedactLength:
+		return "length"
+	case RedactHash:
+		return "hash"
+	case RedactMask:
+		return "mask"
+	default:
+		return "Redaction(" + strconv.Itoa(int(r)) + ")"
+	}
+}
+
+// effective resolves RedactDefault to the package-level policy.
+func (r Redaction) effective() Redaction {
+	if r == RedactDefault {
+		r = Redaction(defaultRedaction.Load())
+	}
+	if r == RedactDefault {
+		return RedactNone
+	}
+	return r
+}
+
+// value returns how a raw value is shown under the policy: quoted when not
+// redacted, a placeholder otherwise.
+func (r Redaction) value(v string) string {
+	switch r.effective() {
+	case RedactLength:
+		return fmt.Sprintf("<redacted len=%d>", len(v))
+	case RedactHash:
+		redactionKeyMu.RLock()
+		mac := hmac.New(sha256.New, redactionKey)
+		redactionKeyMu.RUnlock()
+		mac.Write([]byte(v))
+		return "<hmac:" + hex.EncodeToString(mac.Sum(nil)[:6]) + ">"
+	case RedactMask:
+		return "<redacted>"
+	default:
+		return strconv.Quote(v)
+	}
+}
+
+// scrub returns err's message with every quoted occurrence of the raw value
+// v replaced by its placeholder, since wrapped errors such as those of
+// strconv quote the value they failed on. Unquoted occurrences are left
+// alone: a short value such as "1" would otherwise mangle the rest of the
+// message.
+func (r Redaction) scrub(err error, v string) string {
+	if err == nil {
+		return "<nil>"
+	}
+	msg := err.Error()
+	if v == "" || r.effective() == RedactNone {
+		return msg
+	}
+	return strings.ReplaceAll(msg, strconv.Quote(v), r.value(v))
+}
+
+// redactError applies a decoder's policy to the location errors it creates,
+// leaving errors that already have a policy alone.
+func redactError(err error, r Redaction) error {
+	if r == RedactDefault {
+		return err
+	}
+	switch e := err.(type) {
+	case *FieldError:
+		if e.Redaction == RedactDefault {
+			e.Redaction = r
+		}
+	case *ParseError:
+		if e.Redaction == RedactDefault {
+			e.Redaction = r
+		}
+	}
+	return err
+}
+
+// LogValue implements slog.LogValuer, returning the error location as
+// structured attributes with the value redacted like in Error.
+func (e *FieldError) LogValue() slog.Value {
+	attrs := []slog.Attr{
+		slog.String("segment", e.Segment),
+		slog.Int("field", e.Field),
+	}
+	if e.Occurrence > 0 {
+		attrs = append(attrs, slog.Int("occurrence", e.Occurrence))
+	}
+	if e.Repetition > 0 {
+		attrs = append(attrs, slog.Int("repetition", e.Repetition))
+	}
+	if e.Component > 0 {
+		attrs = append(attrs, slog.Int("component", e.Component))
+	}
+	if e.Subcomponent > 0 {
+		attrs = append(attrs, slog.Int("subcomponent", e.Subcomponent))
+	}
+	if e.Line > 0 {
+		attrs = append(attrs, slog.Int("line", e.Line), slog.Int("offset", e.Offset))
+	}
+	attrs = append(attrs,
+		slog.String("value", logValue(e.Redaction, e.Value)),
+		slog.String("error", e.Redaction.scrub(e.Err, e.Value)),
+	)
+	return slog.GroupValue(attrs...)
+}
+
+// LogValue implements slog.LogValuer, returning the segment location as
+// structured attributes.
+func (e *SegmentError) LogValue() slog.Value {
+	return slog.GroupValue(
+		slog.String("segment", e.Segment),
+		slog.Int("occurrence", e.Occurrence),
+		slog.Int("line", e.Line),
+		slog.Int("offset", e.Offset),
+		slog.String("error", fmt.Sprint(e.Err)),
+	)
+}
+
+// LogValue implements slog.LogValuer, returning the line location as
+// structured attributes with the line text redacted like in Error.
+func (e *ParseError) LogValue() slog.Value {
+	return slog.GroupValue(
+		slog.Int("line", e.Line),
+		slog.Int("offset", e.Offset),
+		slog.String("text", logValue(e.Redaction, e.Text)),
+		slog.String("error", e.Redaction.scrub(e.Err, e.Text)),
+	)
+}
+
+// LogValue implements slog.LogValuer, returning the schema path and error
+// as structured attributes. Schema errors describe the schema, not message
+// contents, so nothing is redacted.
+func (e *SchemaError) LogValue() slog.Value {
+	return slog.GroupValue(
+		slog.String("path", e.Path),
+		slog.String("error", fmt.Sprint(e.Err)),
+	)
+}
+
+// logValue returns a value for a log attribute: verbatim when not redacted,
+// the placeholder otherwise.
+func logValue(r Redaction, v string) string {
+	if r.effective() == RedactNone {
+		return v
+	}
+	return r.value(v)
+}
@@ -0,0 +1,150 @@
+package hl7_test
+
+import (
+	"bytes"
+	"errors"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"github.com/esequiel378/hl7"
+)
+
+const redactMessage = "MSH|^~\\&|App|Fac|||20250101||ADT^A01|1|P|2.5\rPID|1||MRN1||DOE^JANE||DOB1962X\r"
+
+type redactMessageType struct {
+	PID struct {
+		DateOfBirth hl7.Timestamp `hl7:"7"`
+		SetID       int           `hl7:"1"`
+	} `hl7:"segment:PID"`
+}
+
+func redactError(t *testing.T, opts hl7.DecodeOptions) *hl7.FieldError {
+	t.Helper()
+	var msg redactMessageType
+	err := hl7.NewDecoderWithOptions(strings.NewReader(redactMessage), opts).Decode(&msg)
+	var fe *hl7.FieldError
+	if !errors.As(err, &fe) {
+		t.Fatalf("expected FieldError, got %v", err)
+	}
+	return fe
+}
+
+func TestRedactionPolicies(t *testing.T) {
+	tests := []struct {
+		redaction hl7.Redaction
+		want      string
+	}{
+		{hl7.RedactNone, `value="DOB1962X"`},
+		{hl7.RedactLength, "value=<redacted len=8>"},
+		{hl7.RedactHash, "value=<hmac:"},
+		{hl7.RedactMask, "value=<redacted>"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.redaction.String(), func(t *testing.T) {
+			fe := redactError(t, hl7.DecodeOptions{Redaction: tt.redaction})
+			msg := fe.Error()
+			if !strings.Contains(msg, tt.want) {
+				t.Errorf("expected %q in %s", tt.want, msg)
+			}
+			if tt.redaction != hl7.RedactNone && strings.Contains(msg, "DOB1962X") {
+				t.Errorf("raw value leaked: %s", msg)
+			}
+			if fe.Value != "DOB1962X" {
+				t.Errorf("expected raw Value to be kept, got %q", fe.Value)
+			}
+		})
+	}
+}
+
+func TestRedactionHashCorrelates(t *testing.T) {
+	a := &hl7.FieldError{Segment: "PID", Field: 7, Value: "19620320", Err: errors.New("bad"), Redaction: hl7.RedactHash}
+	b := &hl7.FieldError{Segment: "PID", Field: 8, Value: "19620320", Err: errors.New("bad"), Redaction: hl7.RedactHash}
+	c := &hl7.FieldError{Segment: "PID", Field: 7, Value: "19620321", Err: errors.New("bad"), Redaction: hl7.RedactHash}
+
+	digest := func(e *hl7.FieldError) string {
+		msg := e.Error()
+		return msg[strings.Index(msg, "<hmac:"):]
+	}
+	if digest(a) != digest(b) {
+		t.Errorf("expected equal values to hash equally: %s vs %s", a, b)
+	}
+	if digest(a) == digest(c) {
+		t.Errorf("expected different values to hash differently: %s vs %s", a, c)
+	}
+
+	before := digest(a)
+	hl7.SetRedactionKey([]byte("shared key"))
+	if digest(a) == before {
+		t.Error("expected digest to depend on the redaction key")
+	}
+}
+
+func TestSetRedaction(t *testing.T) {
+	hl7.SetRedaction(hl7.RedactMask)
+	t.Cleanup(func() { hl7.SetRedaction(hl7.RedactDefault) })
+
+	var msg redactMessageType
+	err := hl7.Unmarshal([]byte(redactMessage), &msg)
+	if err == nil || strings.Contains(err.Error(), "DOB1962X") {
+		t.Fatalf("expected package-level redaction, got %v", err)
+	}
+
+	fe := redactError(t, hl7.DecodeOptions{Redaction: hl7.RedactNone})
+	if !strings.Contains(fe.Error(), "DOB1962X") {
+		t.Errorf("expected decoder policy to override package policy, got %s", fe)
+	}
+}
+
+func TestFieldErrorLogValue(t *testing.T) {
+	fe := redactError(t, hl7.DecodeOptions{Redaction: hl7.RedactMask})
+
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&buf, nil))
+	logger.Error("decode failed", "err", fe)
+
+	out := buf.String()
+	for _, want := range []string{`"segment":"PID"`, `"field":7`, `"line":2`, `"value":"<redacted>"`} {
+		if !strings.Contains(out, want) {
+			t.Errorf("expected %s in %s", want, out)
+		}
+	}
+	if strings.Contains(out, "DOB1962X") {
+		t.Errorf("raw value leaked: %s", out)
+	}
+}
+
+func TestParseErrorRedaction(t *testing.T) {
+	hl7.SetRedaction(hl7.RedactLength)
+	t.Cleanup(func() { hl7.SetRedaction(hl7.RedactDefault) })
+
+	_, err := hl7.ParseGeneric([]byte("MSH|^~\\&|App\r|DOE^JANE\r"))
+	var pe *hl7.ParseError
+	if !errors.As(err, &pe) {
+		t.Fatalf("expected ParseError, got %v", err)
+	}
+	if strings.Contains(pe.Error(), "JANE") {
+		t.Errorf("raw text leaked: %s", pe)
+	}
+
+	var buf bytes.Buffer
+	slog.New(slog.NewTextHandler(&buf, nil)).Info("parse", "err", pe)
+	if strings.Contains(buf.String(), "JANE") || !strings.Contains(buf.String(), "err.line=2") {
+		t.Errorf("unexpected log output: %s", buf.String())
+	}
+}
+
+func TestRedactionKeepsErrorText(t *testing.T) {
+	// Only the quoted value is replaced, so a short value does not mangle
+	// the words of the wrapped error that happen to contain it.
+	data := "MSH|^~\\&|App|Fac|||20250101||ADT^A01|1|P|2.5\rPID|a\r"
+	var msg redactMessageType
+	err := hl7.NewDecoderWithOptions(strings.NewReader(data), hl7.DecodeOptions{Redaction: hl7.RedactMask}).Decode(&msg)
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	if got := err.Error(); !strings.Contains(got, "parsing <redacted>: invalid syntax") {
+		t.Errorf("unexpected message %s", got)
+	}
+}
@@ -1,10 +1,12 @@
 package hl7
 
 import (
+	"bytes"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"os"
+	"slices"
 )
 
 // SchemaType represents the type of a field in a schema.
@@ -31,8 +33,15 @@ var validSchemaTypes = map[SchemaType]bool{
 }
 
 // MessageSchema defines the structure of an HL7 message for schema-based parsing.
+//
+// Order lists segment names in the order they are written when marshaling.
+// When a schema is parsed from JSON without an explicit "order", it defaults
+// to the order in which the segments appear in the JSON document. Segments
+// missing from Order are written after the listed ones, MSH first and the
+// rest sorted by name.
 type MessageSchema struct {
 	Segments map[string]*SegmentSchema `json:"segments"`
+	Order    []string                  `json:"order,omitempty"`
 }
 
 // SegmentSchema defines the fields within an HL7 segment.
@@ -59,9 +68,17 @@ func ParseSchema(data []byte) (*MessageSchema, error) {
 	if err := json.Unmarshal(data, &schema); err != nil {
 		return nil, fmt.Errorf("hl7: failed to parse schema: %w", err)
 	}
+	if len(schema.Order) == 0 {
+		order, err := segmentKeyOrder(data)
+		if err != nil {
+			return nil, fmt.Errorf("hl7: failed to parse schema: %w", err)
+		}
+		schema.Order = order
+	}
 	if err := schema.Validate(); err != nil {
 		return nil, err
 	}
+	schema.setDefaultTypes()
 	return &schema, nil
 }
 
@@ -74,11 +91,23 @@ func LoadSchemaFile(path string) (*MessageSchema, error) {
 	return ParseSchema(data)
 }
 
-// Validate checks the schema for structural consistency.
+// Validate checks the schema for structural consistency. It does not modify
+// the schema, so it is safe to call on a schema shared between goroutines.
 func (s *MessageSchema) Validate() error {
 	if len(s.Segments) == 0 {
 		return &SchemaError{Path: "segments", Err: errors.New("no segments defined")}
 	}
+	seen := make(map[string]bool, len(s.Order))
+	for i, name := range s.Order {
+		path := fmt.Sprintf("order.%d", i)
+		if _, ok := s.Segments[name]; !ok {
+			return &SchemaError{Path: path, Err: fmt.Errorf("segment %q is not defined", name)}
+		}
+		if seen[name] {
+			return &SchemaError{Path: path, Err: fmt.Errorf("segment %q is listed more than once", name)}
+		}
+		seen[name] = true
+	}
 	for segName, seg := range s.Segments {
 		if seg == nil {
 			return &SchemaError{Path: "segments." + segName, Err: errors.New("nil segment")}
@@ -113,6 +142,106 @@ func (s *MessageSchema) Validate() error {
 	return nil
 }
 
+// setDefaultTypes sets the type of every field that omits it to string.
+// It must only be called on a validated schema.
+func (s *MessageSchema) setDefaultTypes() {
+	for _, seg := range s.Segments {
+		setDefaultFieldTypes(seg.Fields)
+		if seg.Notes != nil {
+			setDefaultFieldTypes(seg.Notes.Fields)
+		}
+	}
+}
+
+func setDefaultFieldTypes(fields map[string]*FieldSchema) {
+	for _, f := range fields {
+		setDefaultFieldType(f)
+	}
+}
+
+func setDefaultFieldType(f *FieldSchema) {
+	if f.Type == "" {
+		f.Type = SchemaTypeString
+	}
+	setDefaultFieldTypes(f.Components)
+	if f.Items != nil {
+		setDefaultFieldType(f.Items)
+	}
+}
+
+// segmentOrder returns every segment name in the schema in marshal order:
+// the names listed in Order first, then the remaining ones with MSH leading
+// and the rest sorted by name.
+func (s *MessageSchema) segmentOrder() []string {
+	names := make([]string, 0, len(s.Segments))
+	listed := make(map[string]bool, len(s.Order))
+	for _, name := range s.Order {
+		if _, ok := s.Segments[name]; ok && !listed[name] {
+			names = append(names, name)
+			listed[name] = true
+		}
+	}
+
+	var rest []string
+	for name := range s.Segments {
+		if !listed[name] {
+			rest = append(rest, name)
+		}
+	}
+	slices.Sort(rest)
+	if i := slices.Index(rest, "MSH"); i > 0 {
+		copy(rest[1:i+1], rest[:i])
+		rest[0] = "MSH"
+	}
+	return append(names, rest...)
+}
+
+// segmentKeyOrder returns the keys of the top-level "segments" object in the
+// order they appear in the JSON document.
+func segmentKeyOrder(data []byte) ([]string, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	if _, err := dec.Token(); err != nil { // opening '{'
+		return nil, err
+	}
+
+	var order []string
+	for dec.More() {
+		key, err := dec.Token()
+		if err != nil {
+			return nil, err
+		}
+		if key != "segments" {
+			var skip json.RawMessage
+			if err := dec.Decode(&skip); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		if tok, err := dec.Token(); err != nil {
+			return nil, err
+		} else if tok != json.Delim('{') {
+			// A null or otherwise non-object value is reported by Validate.
+			return nil, nil
+		}
+		for dec.More() {
+			name, err := dec.Token()
+			if err != nil {
+				return nil, err
+			}
+			var skip json.RawMessage
+			if err := dec.Decode(&skip); err != nil {
+				return nil, err
+			}
+			order = append(order, name.(string))
+		}
+		if _, err := dec.Token(); err != nil { // closing '}'
+			return nil, err
+		}
+	}
+	return order, nil
+}
+
 func validateField(path string, f *FieldSchema, requireIndex bool) error {
 	if f == nil {
 		return &SchemaError{Path: path, Err: errors.New("nil field")}
@@ -122,12 +251,8 @@ func validateField(path string, f *FieldSchema, requireIndex bool) error {
 		return &SchemaError{Path: path, Err: fmt.Errorf("index is required and must be > 0, got %d", f.Index)}
 	}
 
-	// Default type to string
-	if f.Type == "" {
-		f.Type = SchemaTypeString
-	}
-
-	if !validSchemaTypes[f.Type] {
+	// An omitted type means string.
+	if f.Type != "" && !validSchemaTypes[f.Type] {
 		return &SchemaError{Path: path, Err: fmt.Errorf("invalid type %q", f.Type)}
 	}
 	if f.Type == SchemaTypeObject {
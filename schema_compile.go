@@ -0,0 +1,133 @@
+package hl7
+
+import (
+	"cmp"
+	"slices"
+)
+
+// CompiledSchema is an immutable, precomputed form of a MessageSchema.
+// Fields are sorted by index and their types resolved once, so decoding and
+// encoding never iterate over schema maps. A CompiledSchema is safe for
+// concurrent use by multiple goroutines.
+//
+// Create one with [MessageSchema.Compile] and reuse it for every message:
+//
+//	compiled, err := schema.Compile()
+//	result, err := compiled.Unmarshal(data)
+type CompiledSchema struct {
+	segments map[string]*segmentPlan
+	order    []*segmentPlan
+}
+
+// segmentPlan is the compiled form of a SegmentSchema.
+type segmentPlan struct {
+	name     string
+	repeat   bool
+	fields   []fieldPlan // sorted by index
+	maxIndex int
+	notes    *segmentPlan
+}
+
+// fieldPlan is the compiled form of a FieldSchema.
+type fieldPlan struct {
+	name       string
+	index      int
+	typ        SchemaType
+	components []fieldPlan // sorted by index
+	maxIndex   int         // highest component index
+	items      *fieldPlan
+}
+
+// Compile validates the schema and returns its compiled form. Later changes
+// to the MessageSchema do not affect the returned CompiledSchema.
+func (s *MessageSchema) Compile() (*CompiledSchema, error) {
+	if err := s.Validate(); err != nil {
+		return nil, err
+	}
+	return compileSchema(s), nil
+}
+
+// compileSchema builds the plan for a schema without validating it. Nil
+// segments and fields are skipped.
+func compileSchema(s *MessageSchema) *CompiledSchema {
+	c := &CompiledSchema{segments: make(map[string]*segmentPlan, len(s.Segments))}
+	for _, name := range s.segmentOrder() {
+		seg := s.Segments[name]
+		if seg == nil {
+			continue
+		}
+		plan := compileSegment(name, seg)
+		c.segments[name] = plan
+		c.order = append(c.order, plan)
+	}
+	return c
+}
+
+func compileSegment(name string, seg *SegmentSchema) *segmentPlan {
+	plan := &segmentPlan{
+		name:   name,
+		repeat: seg.Repeat,
+		fields: compileFields(seg.Fields),
+	}
+	if n := len(plan.fields); n > 0 {
+		plan.maxIndex = plan.fields[n-1].index
+	}
+	if seg.Notes != nil {
+		plan.notes = compileSegment("NTE", seg.Notes)
+	}
+	return plan
+}
+
+// compileFields returns the plans for a set of fields sorted by index, with
+// ties broken by name so the result does not depend on map order.
+func compileFields(fields map[string]*FieldSchema) []fieldPlan {
+	type entry struct {
+		index  int
+		name   string
+		schema *FieldSchema
+	}
+	entries := make([]entry, 0, len(fields))
+	for name, f := range fields {
+		if f == nil {
+			continue
+		}
+		entries = append(entries, entry{f.Index, name, f})
+	}
+	slices.SortFunc(entries, func(a, b entry) int {
+		if c := cmp.Compare(a.index, b.index); c != 0 {
+			return c
+		}
+		return cmp.Compare(a.name, b.name)
+	})
+
+	plans := make([]fieldPlan, len(entries))
+	for i, e := range entries {
+		plans[i] = compileField(e.name, e.schema)
+	}
+	return plans
+}
+
+func compileField(name string, f *FieldSchema) fieldPlan {
+	plan := fieldPlan{
+		name:  name,
+		index: f.Index,
+		typ:   f.Type,
+	}
+	if plan.typ == "" {
+		plan.typ = SchemaTypeString
+	}
+	switch plan.typ {
+	case SchemaTypeObject:
+		plan.components = compileFields(f.Components)
+		if n := len(plan.components); n > 0 {
+			plan.maxIndex = plan.components[n-1].index
+		}
+	case SchemaTypeArray:
+		items := fieldPlan{typ: SchemaTypeString}
+		if f.Items != nil {
+			items = compileField("", f.Items)
+		}
+		plan.items = &items
+	}
+	return plan
+}
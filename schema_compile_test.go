@@ -0,0 +1,176 @@
+package hl7_test
+
+import (
+	"reflect"
+	"sync"
+	"testing"
+
+	"github.com/esequiel378/hl7"
+)
+
+const compileTestSchema = `{
+	"segments": {
+		"MSH": {
+			"fields": {
+				"fieldSeparator":     { "index": 1 },
+				"encodingCharacters": { "index": 2 },
+				"sendingApplication": { "index": 3 },
+				"messageType": {
+					"index": 9, "type": "object",
+					"components": {
+						"code":    { "index": 1 },
+						"trigger": { "index": 2 }
+					}
+				},
+				"messageControlID": { "index": 10 }
+			}
+		},
+		"PID": {
+			"fields": {
+				"setID": { "index": 1, "type": "int" },
+				"patientIDs": {
+					"index": 3, "type": "array",
+					"items": {
+						"type": "object",
+						"components": {
+							"id":        { "index": 1 },
+							"authority": { "index": 4 }
+						}
+					}
+				},
+				"dateOfBirth": { "index": 7, "type": "timestamp" }
+			}
+		},
+		"OBX": {
+			"repeat": true,
+			"fields": {
+				"setID": { "index": 1, "type": "int" },
+				"value": { "index": 5 }
+			},
+			"notes": {
+				"fields": { "comment": { "index": 3 } }
+			}
+		}
+	}
+}`
+
+const compileTestMessage = "MSH|^~\\&|App1||||||ADT^A01|MSG001\n" +
+	"PID|1||123^^^HOSP~456^^^LAB||||19800101120000\n" +
+	"OBX|1||||positive\n" +
+	"NTE|||checked twice\n" +
+	"OBX|2||||negative"
+
+func TestCompiledSchemaMatchesUnmarshalWithSchema(t *testing.T) {
+	schema := mustParseSchema(t, compileTestSchema)
+
+	compiled, err := schema.Compile()
+	if err != nil {
+		t.Fatalf("Compile failed: %v", err)
+	}
+
+	expected, err := hl7.UnmarshalWithSchema([]byte(compileTestMessage), schema)
+	if err != nil {
+		t.Fatalf("UnmarshalWithSchema failed: %v", err)
+	}
+	got, err := compiled.Unmarshal([]byte(compileTestMessage))
+	if err != nil {
+		t.Fatalf("Unmarshal failed: %v", err)
+	}
+	if !reflect.DeepEqual(expected, got) {
+		t.Errorf("compiled result mismatch:\nexpected %v\ngot      %v", expected, got)
+	}
+
+	opts := hl7.DefaultMarshalOptions()
+	opts.LineEnding = "\n"
+	out, err := compiled.MarshalWithOptions(got, opts)
+	if err != nil {
+		t.Fatalf("MarshalWithOptions failed: %v", err)
+	}
+	if string(out) != compileTestMessage {
+		t.Errorf("round trip mismatch:\nexpected %q\ngot      %q", compileTestMessage, out)
+	}
+}
+
+func TestCompiledSchemaIsolatedFromSchemaChanges(t *testing.T) {
+	schema := mustParseSchema(t, compileTestSchema)
+
+	compiled, err := schema.Compile()
+	if err != nil {
+		t.Fatalf("Compile failed: %v", err)
+	}
+
+	delete(schema.Segments, "PID")
+
+	result, err := compiled.Unmarshal([]byte(compileTestMessage))
+	if err != nil {
+		t.Fatalf("Unmarshal failed: %v", err)
+	}
+	if _, ok := result["PID"]; !ok {
+		t.Error("expected PID to still be decoded by the compiled schema")
+	}
+}
+
+func TestCompileInvalidSchema(t *testing.T) {
+	schema := &hl7.MessageSchema{
+		Segments: map[string]*hl7.SegmentSchema{
+			"PID": {Fields: map[string]*hl7.FieldSchema{"setID": {Index: 0}}},
+		},
+	}
+
+	if _, err := schema.Compile(); err == nil {
+		t.Fatal("expected error for invalid schema")
+	}
+}
+
+func TestValidateDoesNotModifySchema(t *testing.T) {
+	schema := &hl7.MessageSchema{
+		Segments: map[string]*hl7.SegmentSchema{
+			"PID": {Fields: map[string]*hl7.FieldSchema{"setID": {Index: 1}}},
+		},
+	}
+
+	if err := schema.Validate(); err != nil {
+		t.Fatalf("Validate failed: %v", err)
+	}
+	if typ := schema.Segments["PID"].Fields["setID"].Type; typ != "" {
+		t.Errorf("expected Validate to leave the type empty, got %q", typ)
+	}
+}
+
+func TestCompiledSchemaConcurrentUse(t *testing.T) {
+	schema := mustParseSchema(t, compileTestSchema)
+
+	compiled, err := schema.Compile()
+	if err != nil {
+		t.Fatalf("Compile failed: %v", err)
+	}
+
+	expected, err := compiled.Unmarshal([]byte(compileTestMessage))
+	if err != nil {
+		t.Fatalf("Unmarshal failed: %v", err)
+	}
+
+	var wg sync.WaitGroup
+	for range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range 100 {
+				got, err := compiled.Unmarshal([]byte(compileTestMessage))
+				if err != nil {
+					t.Errorf("Unmarshal failed: %v", err)
+					return
+				}
+				if !reflect.DeepEqual(expected, got) {
+					t.Errorf("concurrent result mismatch: %v", got)
+					return
+				}
+				if _, err := compiled.Marshal(got); err != nil {
+					t.Errorf("Marshal failed: %v", err)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
@@ -6,13 +6,35 @@ import (
 	"strings"
 )
 
+// SegmentOrderKey is the result key under which a Decoder with
+// DecodeOptions.RecordSegmentOrder records the names of the decoded segments
+// in the order they appeared, one entry per occurrence. MarshalWithSchema
+// uses it to restore the original segment interleaving (e.g. OBR, OBX, OBX,
+// OBR, OBX) on a round trip.
+const SegmentOrderKey = "_order"
+
 // UnmarshalMultiWithSchema parses multiple HL7 messages using a schema definition,
 // returning a slice of maps, one per message.
 func UnmarshalMultiWithSchema(data []byte, schema *MessageSchema) ([]map[string]any, error) {
+	return compileSchema(schema).UnmarshalMulti(data)
+}
+
+// UnmarshalWithSchema parses HL7 data using a schema definition,
+// returning a map[string]any with field names as keys.
+//
+// The schema is compiled on every call; use [MessageSchema.Compile] to
+// compile it once when decoding many messages.
+func UnmarshalWithSchema(data []byte, schema *MessageSchema) (map[string]any, error) {
+	return compileSchema(schema).Unmarshal(data)
+}
+
+// UnmarshalMulti parses multiple HL7 messages, returning a slice of maps,
+// one per message.
+func (c *CompiledSchema) UnmarshalMulti(data []byte) ([]map[string]any, error) {
 	chunks := splitMessages(data)
 	results := make([]map[string]any, 0, len(chunks))
 	for _, chunk := range chunks {
-		result, err := UnmarshalWithSchema(chunk, schema)
+		result, err := c.Unmarshal(chunk)
 		if err != nil {
 			return nil, err
 		}
@@ -21,44 +43,51 @@ func UnmarshalMultiWithSchema(data []byte, schema *MessageSchema) ([]map[string]
 	return results, nil
 }
 
-// UnmarshalWithSchema parses HL7 data using a schema definition,
-// returning a map[string]any with field names as keys.
-func UnmarshalWithSchema(data []byte, schema *MessageSchema) (map[string]any, error) {
-	segments, err := parseMessage(data)
+// Unmarshal parses HL7 data, returning a map[string]any with field names as
+// keys, exactly like [UnmarshalWithSchema].
+func (c *CompiledSchema) Unmarshal(data []byte) (map[string]any, error) {
+	return c.unmarshal(data, nil)
+}
+
+// unmarshal is Unmarshal reporting recoverable problems through d.
+func (c *CompiledSchema) unmarshal(data []byte, d *decodeState) (map[string]any, error) {
+	segments, err := parseMessage(data, d)
 	if err != nil {
 		return nil, err
 	}
 
 	result := make(map[string]any)
+	var order []any
 
-	var lastSegSchema *SegmentSchema
+	var lastSegPlan *segmentPlan
 	var lastSegMap map[string]any
-	var lastSegName string
 	var lastSegStored bool
 
 	storeLastSeg := func() {
-		if lastSegStored || lastSegSchema == nil {
+		if lastSegStored || lastSegPlan == nil {
 			return
 		}
-		if lastSegSchema.Repeat {
-			existing, ok := result[lastSegName]
+		if lastSegPlan.repeat {
+			existing, ok := result[lastSegPlan.name]
 			if ok {
-				result[lastSegName] = append(existing.([]any), lastSegMap)
+				result[lastSegPlan.name] = append(existing.([]any), lastSegMap)
 			} else {
-				result[lastSegName] = []any{lastSegMap}
+				result[lastSegPlan.name] = []any{lastSegMap}
 			}
 		} else {
-			result[lastSegName] = lastSegMap
+			result[lastSegPlan.name] = lastSegMap
 		}
+		order = append(order, lastSegPlan.name)
 		lastSegStored = true
 	}
 
-	for _, seg := range segments {
+	for i := range segments {
+		seg := &segments[i]
 		if seg.name == "NTE" {
-			if lastSegSchema == nil || lastSegSchema.Notes == nil {
+			if lastSegPlan == nil || lastSegPlan.notes == nil {
 				continue
 			}
-			noteMap, err := decodeSegmentWithSchema(seg, lastSegSchema.Notes)
+			noteMap, err := decodeSegmentWithPlan(seg, lastSegPlan.notes, d)
 			if err != nil {
 				return nil, err
 			}
@@ -81,49 +110,43 @@ func UnmarshalWithSchema(data []byte, schema *MessageSchema) (map[string]any, er
 			continue
 		}
 
-		segSchema, ok := schema.Segments[string(seg.name)]
+		plan, ok := c.segments[string(seg.name)]
 		if !ok {
-			lastSegSchema = nil
+			if err := d.unknownSegment(seg); err != nil {
+				return nil, err
+			}
+			lastSegPlan = nil
 			lastSegMap = nil
-			lastSegName = ""
 			lastSegStored = false
 			continue
 		}
 
-		segMap, err := decodeSegmentWithSchema(seg, segSchema)
+		segMap, err := decodeSegmentWithPlan(seg, plan, d)
 		if err != nil {
 			return nil, err
 		}
 
 		// Always track the last seen segment so subsequent NTE lines are
 		// attributed to it, even when all its schema-mapped fields are empty.
-		lastSegSchema = segSchema
+		lastSegPlan = plan
 		lastSegMap = segMap
-		lastSegName = string(seg.name)
 		lastSegStored = false
 
 		if len(segMap) == 0 {
 			continue
 		}
 
-		if segSchema.Repeat {
-			existing, ok := result[string(seg.name)]
-			if ok {
-				arr := existing.([]any)
-				result[string(seg.name)] = append(arr, segMap)
-			} else {
-				result[string(seg.name)] = []any{segMap}
-			}
-		} else {
-			result[string(seg.name)] = segMap
-		}
-		lastSegStored = true
+		storeLastSeg()
+	}
+
+	if d != nil && d.opts.RecordSegmentOrder && len(order) > 0 {
+		result[SegmentOrderKey] = order
 	}
 
 	return result, nil
 }
 
-func decodeSegmentWithSchema(seg segmentLine, schema *SegmentSchema) (map[string]any, error) {
+func decodeSegmentWithPlan(seg *segmentLine, plan *segmentPlan, d *decodeState) (map[string]any, error) {
 	componentSeparator := "^"
 	if len(seg.encodingCharacters) > 0 {
 		componentSeparator = string(seg.encodingCharacters[0])
@@ -135,8 +158,9 @@ func decodeSegmentWithSchema(seg segmentLine, schema *SegmentSchema) (map[string
 
 	result := make(map[string]any)
 
-	for fieldName, fieldSchema := range schema.Fields {
-		idx := fieldSchema.Index
+	for i := range plan.fields {
+		field := &plan.fields[i]
+		idx := field.index
 
 		// HL7 field indexing: MSH-1 is the field separator (maps to parts[0] offset),
 		// other segments have parts[0] as segment name.
@@ -145,9 +169,13 @@ func decodeSegmentWithSchema(seg segmentLine, schema *SegmentSchema) (map[string
 			partsIdx = idx - 1
 		}
 
-		if partsIdx < 0 || partsIdx >= len(seg.fields) {
+		if partsIdx < 0 {
 			continue
 		}
+		// Fields are sorted by index, so none of the remaining ones is present.
+		if partsIdx >= len(seg.fields) {
+			break
+		}
 
 		rawValue := seg.fields[partsIdx]
 
@@ -160,31 +188,37 @@ func decodeSegmentWithSchema(seg segmentLine, schema *SegmentSchema) (map[string
 			continue
 		}
 
-		val, err := decodeFieldWithSchema(string(seg.name), idx, rawValue, fieldSchema, componentSeparator, repetitionSeparator)
+		val, err := decodeFieldWithPlan(seg, FieldPath{Field: idx}, rawValue, field, componentSeparator, repetitionSeparator, d)
 		if err != nil {
 			return nil, err
 		}
 
 		if val != nil {
-			result[fieldName] = val
+			result[field.name] = val
 		}
 	}
 
 	return result, nil
 }
 
-func decodeFieldWithSchema(segName string, fieldIdx int, raw string, schema *FieldSchema, cs, rs string) (any, error) {
-	switch schema.Type {
+// decodeFieldWithPlan decodes the value at path of seg. Values that cannot
+// be converted are reported through d and decode to nil when skipped.
+func decodeFieldWithPlan(seg *segmentLine, path FieldPath, raw string, plan *fieldPlan, cs, rs string, d *decodeState) (any, error) {
+	switch plan.typ {
 	case SchemaTypeArray:
-		return decodeArrayField(segName, fieldIdx, raw, schema, cs, rs)
+		return decodeArrayField(seg, path, raw, plan, cs, rs, d)
 	case SchemaTypeObject:
-		return decodeObjectField(segName, fieldIdx, raw, schema, cs)
+		return decodeObjectField(seg, path, raw, plan, cs, d)
 	default:
-		return coerceValue(segName, fieldIdx, 0, raw, schema.Type)
+		val, err := coerceValue(raw, plan.typ)
+		if err != nil {
+			return nil, d.valueError(seg.fieldError(path, raw, err))
+		}
+		return val, nil
 	}
 }
 
-func decodeArrayField(segName string, fieldIdx int, raw string, schema *FieldSchema, cs, rs string) (any, error) {
+func decodeArrayField(seg *segmentLine, path FieldPath, raw string, plan *fieldPlan, cs, rs string, d *decodeState) (any, error) {
 	var reps []string
 	if rs != "" {
 		reps = strings.Split(raw, rs)
@@ -193,22 +227,28 @@ func decodeArrayField(segName string, fieldIdx int, raw string, schema *FieldSch
 	}
 
 	items := make([]any, 0, len(reps))
-	for _, rep := range reps {
+	for i, rep := range reps {
 		if rep == "" {
 			continue
 		}
-		itemSchema := schema.Items
-		switch itemSchema.Type {
+		repPath := path
+		if rs != "" {
+			repPath.Repetition = i + 1
+		}
+		switch plan.items.typ {
 		case SchemaTypeObject:
-			val, err := decodeObjectField(segName, fieldIdx, rep, itemSchema, cs)
+			val, err := decodeObjectField(seg, repPath, rep, plan.items, cs, d)
 			if err != nil {
 				return nil, err
 			}
 			items = append(items, val)
 		default:
-			val, err := coerceValue(segName, fieldIdx, 0, rep, itemSchema.Type)
+			val, err := coerceValue(rep, plan.items.typ)
 			if err != nil {
-				return nil, err
+				if err := d.valueError(seg.fieldError(repPath, rep, err)); err != nil {
+					return nil, err
+				}
+				continue
 			}
 			items = append(items, val)
 		}
@@ -217,64 +257,65 @@ func decodeArrayField(segName string, fieldIdx int, raw string, schema *FieldSch
 	return items, nil
 }
 
-func decodeObjectField(segName string, fieldIdx int, raw string, schema *FieldSchema, cs string) (any, error) {
+func decodeObjectField(seg *segmentLine, path FieldPath, raw string, plan *fieldPlan, cs string, d *decodeState) (any, error) {
 	components := strings.Split(raw, cs)
-	result := make(map[string]any)
+	var result map[string]any
 
-	for compName, compSchema := range schema.Components {
-		idx := compSchema.Index
+	for i := range plan.components {
+		comp := &plan.components[i]
+		idx := comp.index
 
 		// Components are 1-based
 		arrIdx := idx - 1
-		if arrIdx < 0 || arrIdx >= len(components) {
+		if arrIdx < 0 {
 			continue
 		}
+		if arrIdx >= len(components) {
+			break
+		}
 
 		compValue := components[arrIdx]
 		if compValue == "" {
 			continue
 		}
 
-		val, err := coerceValue(segName, fieldIdx, idx, compValue, compSchema.Type)
+		val, err := coerceValue(compValue, comp.typ)
 		if err != nil {
-			return nil, err
+			compPath := path
+			compPath.Component = idx
+			if err := d.valueError(seg.fieldError(compPath, compValue, err)); err != nil {
+				return nil, err
+			}
+			continue
 		}
 
-		result[compName] = val
+		if result == nil {
+			result = make(map[string]any, len(plan.components))
+		}
+		result[comp.name] = val
 	}
 
-	if len(result) == 0 {
+	if result == nil {
 		return nil, nil
 	}
 	return result, nil
 }
 
-func coerceValue(segName string, fieldIdx, compIdx int, raw string, typ SchemaType) (any, error) {
+// coerceValue converts a raw value to the Go value of a schema type.
+func coerceValue(raw string, typ SchemaType) (any, error) {
 	switch typ {
 	case SchemaTypeString:
 		return raw, nil
 	case SchemaTypeInt:
 		v, err := strconv.ParseInt(raw, 10, 64)
 		if err != nil {
-			return nil, &FieldError{
-				Segment:   segName,
-				Field:     fieldIdx,
-				Component: compIdx,
-				Value:     raw,
-				Err:       fmt.Errorf("%w: %v", ErrInvalidIntValue, err),
-			}
+			return nil, fmt.Errorf("%w: %v", ErrInvalidIntValue, err)
 		}
 		return v, nil
 	case SchemaTypeFloat:
 		v, err := strconv.ParseFloat(raw, 64)
 		if err != nil {
-			return nil, &FieldError{
-				Segment:   segName,
-				Field:     fieldIdx,
-				Component: compIdx,
-				Value:     raw,
-				Err:       fmt.Errorf("%w: %v", ErrInvalidFloatValue, err),
-			}
+			return nil, fmt.Errorf("%w: %v", ErrInvalidFloatValue, err)
 		}
 		return v, nil
 	case SchemaTypeBool:
@@ -285,24 +326,12 @@ func coerceValue(segName string, fieldIdx, compIdx int, raw string, typ SchemaTy
 		case "N", "FALSE", "0":
 			return false, nil
 		default:
-			return nil, &FieldError{
-				Segment:   segName,
-				Field:     fieldIdx,
-				Component: compIdx,
-				Value:     raw,
-				Err:       fmt.Errorf("%w: %q", ErrInvalidBooleanValue, raw),
-			}
+			return nil, fmt.Errorf("%w: %q", ErrInvalidBooleanValue, raw)
 		}
 	case SchemaTypeTimestamp:
 		var ts Timestamp
 		if err := ts.Unmarshal([]byte(raw)); err != nil {
-			return nil, &FieldError{
-				Segment:   segName,
-				Field:     fieldIdx,
-				Component: compIdx,
-				Value:     raw,
-				Err:       err,
-			}
+			return nil, err
 		}
 		return ts.Time, nil
 	default:
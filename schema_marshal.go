@@ -16,7 +16,26 @@ func MarshalWithSchema(v map[string]any, schema *MessageSchema) ([]byte, error)
 
 // MarshalWithSchemaOptions serializes a map[string]any into HL7 format using a schema
 // definition and the provided marshal options.
+//
+// Segments are written in the order recorded under [SegmentOrderKey] when
+// present, so maps decoded with DecodeOptions.RecordSegmentOrder keep their
+// original interleaving. Any remaining segments follow in the schema's Order.
+//
+// The schema is compiled on every call; use [MessageSchema.Compile] to
+// compile it once when encoding many messages.
 func MarshalWithSchemaOptions(v map[string]any, schema *MessageSchema, opts MarshalOptions) ([]byte, error) {
+	return compileSchema(schema).MarshalWithOptions(v, opts)
+}
+
+// Marshal serializes a map[string]any into HL7 format using default marshal
+// options, exactly like [MarshalWithSchema].
+func (c *CompiledSchema) Marshal(v map[string]any) ([]byte, error) {
+	return c.MarshalWithOptions(v, DefaultMarshalOptions())
+}
+
+// MarshalWithOptions serializes a map[string]any into HL7 format using the
+// provided marshal options, exactly like [MarshalWithSchemaOptions].
+func (c *CompiledSchema) MarshalWithOptions(v map[string]any, opts MarshalOptions) ([]byte, error) {
 	fs := string(opts.FieldSeparator)
 	cs := string(opts.ComponentSeparator)
 	rs := string(opts.RepetitionSeparator)
@@ -27,81 +46,111 @@ func MarshalWithSchemaOptions(v map[string]any, schema *MessageSchema, opts Mars
 		opts.SubcomponentSeparator,
 	})
 
-	// We need a stable ordering for segments. HL7 messages typically start with MSH.
-	// Collect segment names in schema order, but ensure MSH comes first.
-	segNames := make([]string, 0, len(schema.Segments))
-	hasMSH := false
-	for name := range schema.Segments {
-		if name == "MSH" {
-			hasMSH = true
-			continue
+	var allLines [][]byte
+
+	appendSegment := func(plan *segmentPlan, segMap map[string]any) error {
+		line, err := marshalSegmentFromMap(plan, segMap, fs, cs, rs, ec, opts)
+		if err != nil {
+			return err
 		}
-		segNames = append(segNames, name)
-	}
-	if hasMSH {
-		segNames = append([]string{"MSH"}, segNames...)
+		allLines = append(allLines, line)
+
+		noteLines, err := marshalNotesFromSchema(segMap, plan, fs, cs, rs, ec, opts)
+		if err != nil {
+			return err
+		}
+		allLines = append(allLines, noteLines...)
+		return nil
 	}
 
-	var allLines [][]byte
+	// next tracks, per segment name, how many occurrences have been written:
+	// the index of the next repeat item, or 1 once a single segment is out.
+	next := make(map[string]int, len(c.order))
 
-	for _, segName := range segNames {
-		segData, ok := v[segName]
+	// Replay the original segment order recorded by the Decoder, if any.
+	for _, segName := range recordedSegmentOrder(v) {
+		plan, ok := c.segments[segName]
 		if !ok {
 			continue
 		}
+		segMap, ok := segmentOccurrence(v[segName], plan, next[segName])
+		if !ok {
+			continue
+		}
+		next[segName]++
+		if segMap == nil {
+			continue
+		}
+		if err := appendSegment(plan, segMap); err != nil {
+			return nil, err
+		}
+	}
 
-		segSchema := schema.Segments[segName]
-
-		if segSchema.Repeat {
-			arr, ok := segData.([]any)
+	// Write whatever the recorded order did not cover in schema order.
+	for _, plan := range c.order {
+		for {
+			segMap, ok := segmentOccurrence(v[plan.name], plan, next[plan.name])
+			next[plan.name]++
 			if !ok {
-				continue
-			}
-			for _, item := range arr {
-				segMap, ok := item.(map[string]any)
-				if !ok {
-					continue
-				}
-				line, err := marshalSegmentFromMap(segName, segMap, segSchema, fs, cs, rs, ec, opts)
-				if err != nil {
-					return nil, err
-				}
-				allLines = append(allLines, line)
-
-				noteLines, err := marshalNotesFromSchema(segMap, segSchema, fs, cs, rs, ec, opts)
-				if err != nil {
-					return nil, err
-				}
-				allLines = append(allLines, noteLines...)
+				break
 			}
-		} else {
-			segMap, ok := segData.(map[string]any)
-			if !ok {
+			if segMap == nil {
 				continue
 			}
-
-			line, err := marshalSegmentFromMap(segName, segMap, segSchema, fs, cs, rs, ec, opts)
-			if err != nil {
-				return nil, err
-			}
-			allLines = append(allLines, line)
-
-			noteLines, err := marshalNotesFromSchema(segMap, segSchema, fs, cs, rs, ec, opts)
-			if err != nil {
+			if err := appendSegment(plan, segMap); err != nil {
 				return nil, err
 			}
-			allLines = append(allLines, noteLines...)
 		}
 	}
 
 	if len(allLines) == 0 {
 		return []byte{}, nil
 	}
-	return bytes.Join(allLines, []byte(opts.LineEnding)), nil
+	return opts.transcode(opts.fillHeader(bytes.Join(allLines, []byte(opts.LineEnding))))
+}
+
+// recordedSegmentOrder returns the segment names stored under SegmentOrderKey.
+// It accepts both the []any produced by the Decoder (or encoding/json)
+// and a plain []string.
+func recordedSegmentOrder(v map[string]any) []string {
+	switch order := v[SegmentOrderKey].(type) {
+	case []string:
+		return order
+	case []any:
+		names := make([]string, 0, len(order))
+		for _, item := range order {
+			if name, ok := item.(string); ok {
+				names = append(names, name)
+			}
+		}
+		return names
+	default:
+		return nil
+	}
+}
+
+// segmentOccurrence returns the i-th occurrence of a segment from its map
+// value: an item of the array for repeating segments, or the map itself when
+// i is 0 for single segments. ok reports whether the occurrence exists; a
+// malformed occurrence exists but yields a nil map and produces no output.
+func segmentOccurrence(segData any, plan *segmentPlan, i int) (segMap map[string]any, ok bool) {
+	if plan.repeat {
+		arr, isArr := segData.([]any)
+		if !isArr || i >= len(arr) {
+			return nil, false
+		}
+		segMap, _ = arr[i].(map[string]any)
+		return segMap, true
+	}
+	if i > 0 {
+		return nil, false
+	}
+	segMap, ok = segData.(map[string]any)
+	return segMap, ok
 }
 
-func marshalNotesFromSchema(segMap map[string]any, segSchema *SegmentSchema, fs, cs, rs, ec string, opts MarshalOptions) ([][]byte, error) {
-	if segSchema.Notes == nil {
+func marshalNotesFromSchema(segMap map[string]any, plan *segmentPlan, fs, cs, rs, ec string, opts MarshalOptions) ([][]byte, error) {
+	if plan.notes == nil {
 		return nil, nil
 	}
 	notesData, ok := segMap["notes"]
@@ -118,7 +167,7 @@ func marshalNotesFromSchema(segMap map[string]any, segSchema *SegmentSchema, fs,
 		if !ok {
 			continue
 		}
-		line, err := marshalSegmentFromMap("NTE", noteMap, segSchema.Notes, fs, cs, rs, ec, opts)
+		line, err := marshalSegmentFromMap(plan.notes, noteMap, fs, cs, rs, ec, opts)
 		if err != nil {
 			return nil, err
 		}
@@ -127,27 +176,14 @@ func marshalNotesFromSchema(segMap map[string]any, segSchema *SegmentSchema, fs,
 	return lines, nil
 }
 
-func marshalSegmentFromMap(name string, data map[string]any, schema *SegmentSchema, fs, cs, rs, ec string, opts MarshalOptions) ([]byte, error) {
-	// Find max field index
-	maxIdx := 0
-	for _, fieldSchema := range schema.Fields {
-		if fieldSchema.Index > maxIdx {
-			maxIdx = fieldSchema.Index
-		}
-	}
-
-	// Build index-to-name lookup
-	indexToName := make(map[int]string, len(schema.Fields))
-	for fieldName, fieldSchema := range schema.Fields {
-		indexToName[fieldSchema.Index] = fieldName
-	}
-
-	isMSH := name == "MSH"
+func marshalSegmentFromMap(plan *segmentPlan, data map[string]any, fs, cs, rs, ec string, opts MarshalOptions) ([]byte, error) {
+	isMSH := plan.name == "MSH"
 
 	var buf bytes.Buffer
-	buf.WriteString(name)
+	buf.WriteString(plan.name)
 
-	for idx := 1; idx <= maxIdx; idx++ {
+	fi := 0
+	for idx := 1; idx <= plan.maxIndex; idx++ {
 		// MSH-1 is the field separator itself
 		if isMSH && idx == 1 {
 			buf.WriteByte(opts.FieldSeparator)
@@ -165,73 +201,67 @@ func marshalSegmentFromMap(name string, data map[string]any, schema *SegmentSche
 			continue
 		}
 
-		fieldName, ok := indexToName[idx]
-		if !ok {
-			continue
-		}
-		fieldSchema := schema.Fields[fieldName]
-
-		val, ok := data[fieldName]
-		if !ok {
-			continue
+		// Fields are sorted by index; when several share an index the first
+		// one with a value wins.
+		for fi < len(plan.fields) && plan.fields[fi].index < idx {
+			fi++
 		}
+		written := false
+		for ; fi < len(plan.fields) && plan.fields[fi].index == idx; fi++ {
+			field := &plan.fields[fi]
+			val, ok := data[field.name]
+			if !ok || written {
+				continue
+			}
 
-		str, err := marshalValueFromMap(val, fieldSchema, cs, rs)
-		if err != nil {
-			return nil, fmt.Errorf("hl7: %s.%d: %w", name, idx, err)
+			str, err := marshalValueFromMap(val, field, cs, rs)
+			if err != nil {
+				return nil, fmt.Errorf("hl7: %s.%d: %w", plan.name, idx, err)
+			}
+			buf.WriteString(str)
+			written = true
 		}
-		buf.WriteString(str)
 	}
 
 	return buf.Bytes(), nil
 }
 
-func marshalValueFromMap(val any, schema *FieldSchema, cs, rs string) (string, error) {
+func marshalValueFromMap(val any, plan *fieldPlan, cs, rs string) (string, error) {
 	if val == nil {
 		return "", nil
 	}
 
-	switch schema.Type {
+	switch plan.typ {
 	case SchemaTypeObject:
-		return marshalObjectFromMap(val, schema, cs)
+		return marshalObjectFromMap(val, plan, cs)
 	case SchemaTypeArray:
-		return marshalArrayFromMap(val, schema, cs, rs)
+		return marshalArrayFromMap(val, plan, cs, rs)
 	default:
-		return marshalScalarValue(val, schema.Type)
+		return marshalScalarValue(val, plan.typ)
 	}
 }
 
-func marshalObjectFromMap(val any, schema *FieldSchema, cs string) (string, error) {
+func marshalObjectFromMap(val any, plan *fieldPlan, cs string) (string, error) {
 	m, ok := val.(map[string]any)
 	if !ok {
 		return "", fmt.Errorf("expected map[string]any for object type, got %T", val)
 	}
 
-	// Find max component index
-	maxIdx := 0
-	for _, compSchema := range schema.Components {
-		if compSchema.Index > maxIdx {
-			maxIdx = compSchema.Index
+	parts := make([]string, plan.maxIndex)
+	for i := range plan.components {
+		comp := &plan.components[i]
+		if comp.index <= 0 || parts[comp.index-1] != "" {
+			continue
 		}
-	}
-
-	// Build index-to-name lookup
-	indexToName := make(map[int]string, len(schema.Components))
-	for compName, compSchema := range schema.Components {
-		indexToName[compSchema.Index] = compName
-	}
-
-	parts := make([]string, maxIdx)
-	for compName, compSchema := range schema.Components {
-		compVal, ok := m[compName]
+		compVal, ok := m[comp.name]
 		if !ok {
 			continue
 		}
-		str, err := marshalScalarValue(compVal, compSchema.Type)
+		str, err := marshalScalarValue(compVal, comp.typ)
 		if err != nil {
 			return "", err
 		}
-		parts[compSchema.Index-1] = str
+		parts[comp.index-1] = str
 	}
 
 	// Trim trailing empty parts
@@ -242,7 +272,7 @@ func marshalObjectFromMap(val any, schema *FieldSchema, cs string) (string, erro
 	return strings.Join(parts, cs), nil
 }
 
-func marshalArrayFromMap(val any, schema *FieldSchema, cs, rs string) (string, error) {
+func marshalArrayFromMap(val any, plan *fieldPlan, cs, rs string) (string, error) {
 	arr, ok := val.([]any)
 	if !ok {
 		return "", fmt.Errorf("expected []any for array type, got %T", val)
@@ -250,15 +280,15 @@ func marshalArrayFromMap(val any, schema *FieldSchema, cs, rs string) (string, e
 
 	parts := make([]string, 0, len(arr))
 	for _, item := range arr {
-		switch schema.Items.Type {
+		switch plan.items.typ {
 		case SchemaTypeObject:
-			str, err := marshalObjectFromMap(item, schema.Items, cs)
+			str, err := marshalObjectFromMap(item, plan.items, cs)
 			if err != nil {
 				return "", err
 			}
 			parts = append(parts, str)
 		default:
-			str, err := marshalScalarValue(item, schema.Items.Type)
+			str, err := marshalScalarValue(item, plan.items.typ)
 			if err != nil {
 				return "", err
 			}
@@ -314,6 +344,10 @@ func marshalScalarValue(val any, typ SchemaType) (string, error) {
 			}
 			return v.Format("20060102150405"), nil
 		case string:
+			// Times round-tripped through encoding/json arrive as RFC 3339.
+			if t, err := time.Parse(time.RFC3339Nano, v); err == nil {
+				return t.Format("20060102150405"), nil
+			}
 			return v, nil
 		default:
 			return fmt.Sprintf("%v", val), nil
@@ -1,6 +1,7 @@
 package hl7_test
 
 import (
+	"encoding/json"
 	"strings"
 	"testing"
 	"time"
@@ -279,6 +280,32 @@ func TestMarshalWithSchemaTimestamp(t *testing.T) {
 	}
 }
 
+func TestMarshalWithSchemaTimestampFromJSON(t *testing.T) {
+	schema := mustParseSchema(t, `{
+		"segments": {
+			"PID": {
+				"fields": {
+					"dateOfBirth": { "index": 7, "type": "timestamp" }
+				}
+			}
+		}
+	}`)
+
+	// time.Time values come back from encoding/json as RFC 3339 strings.
+	var data map[string]any
+	if err := json.Unmarshal([]byte(`{"PID": {"dateOfBirth": "1985-03-15T12:00:00Z"}}`), &data); err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := hl7.MarshalWithSchema(data, schema)
+	if err != nil {
+		t.Fatalf("MarshalWithSchema failed: %v", err)
+	}
+	if want := "PID|||||||19850315120000"; string(result) != want {
+		t.Errorf("expected %q, got %q", want, result)
+	}
+}
+
 func TestMarshalWithSchemaOptions(t *testing.T) {
 	schema := mustParseSchema(t, `{
 		"segments": {
@@ -582,3 +609,90 @@ func TestMarshalWithSchemaNTERepeat(t *testing.T) {
 		t.Errorf("line 3: %s", lines[3])
 	}
 }
+
+func TestMarshalWithSchemaFollowsSchemaOrder(t *testing.T) {
+	schema := mustParseSchema(t, `{
+		"segments": {
+			"MSH": { "fields": { "fieldSeparator": { "index": 1 }, "encodingCharacters": { "index": 2 } } },
+			"PID": { "fields": { "setID": { "index": 1 } } },
+			"PV1": { "fields": { "setID": { "index": 1 } } },
+			"OBX": { "repeat": true, "fields": { "setID": { "index": 1 } } }
+		}
+	}`)
+
+	data := map[string]any{
+		"OBX": []any{map[string]any{"setID": "1"}, map[string]any{"setID": "2"}},
+		"PV1": map[string]any{"setID": "1"},
+		"PID": map[string]any{"setID": "1"},
+		"MSH": map[string]any{"fieldSeparator": "|", "encodingCharacters": "^~\\&"},
+	}
+
+	// Map iteration order is random, so repeat to catch nondeterminism.
+	for range 20 {
+		out, err := hl7.MarshalWithSchema(data, schema)
+		if err != nil {
+			t.Fatalf("MarshalWithSchema failed: %v", err)
+		}
+		expected := "MSH|^~\\&\rPID|1\rPV1|1\rOBX|1\rOBX|2"
+		if string(out) != expected {
+			t.Fatalf("expected %q, got %q", expected, out)
+		}
+	}
+}
+
+func TestMarshalWithSchemaKeepsOriginalOrder(t *testing.T) {
+	schema := mustParseSchema(t, `{
+		"segments": {
+			"MSH": { "fields": { "fieldSeparator": { "index": 1 }, "encodingCharacters": { "index": 2 } } },
+			"OBR": { "repeat": true, "fields": { "setID": { "index": 1 } } },
+			"OBX": {
+				"repeat": true,
+				"fields": { "setID": { "index": 1 } },
+				"notes": { "fields": { "comment": { "index": 3 } } }
+			}
+		}
+	}`)
+
+	original := "MSH|^~\\&\nOBR|1\nOBX|1\nNTE|||first\nOBX|2\nOBR|2\nOBX|3"
+
+	plain, err := hl7.UnmarshalWithSchema([]byte(original), schema)
+	if err != nil {
+		t.Fatalf("UnmarshalWithSchema failed: %v", err)
+	}
+	if _, ok := plain[hl7.SegmentOrderKey]; ok {
+		t.Errorf("expected no %q key without RecordSegmentOrder", hl7.SegmentOrderKey)
+	}
+
+	dec := hl7.NewDecoderWithOptions(strings.NewReader(original), hl7.DecodeOptions{RecordSegmentOrder: true})
+	result, err := dec.DecodeWithSchema(schema)
+	if err != nil {
+		t.Fatalf("DecodeWithSchema failed: %v", err)
+	}
+
+	opts := hl7.DefaultMarshalOptions()
+	opts.LineEnding = "\n"
+	out, err := hl7.MarshalWithSchemaOptions(result, schema, opts)
+	if err != nil {
+		t.Fatalf("MarshalWithSchema failed: %v", err)
+	}
+	if string(out) != original {
+		t.Errorf("round trip mismatch:\nexpected %q\ngot      %q", original, out)
+	}
+
+	// The recorded order also survives a trip through JSON.
+	encoded, err := json.Marshal(result)
+	if err != nil {
+		t.Fatalf("json.Marshal failed: %v", err)
+	}
+	var decoded map[string]any
+	if err := json.Unmarshal(encoded, &decoded); err != nil {
+		t.Fatalf("json.Unmarshal failed: %v", err)
+	}
+	out, err = hl7.MarshalWithSchemaOptions(decoded, schema, opts)
+	if err != nil {
+		t.Fatalf("MarshalWithSchema failed: %v", err)
+	}
+	if string(out) != original {
+		t.Errorf("JSON round trip mismatch:\nexpected %q\ngot      %q", original, out)
+	}
+}
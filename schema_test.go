@@ -1,8 +1,10 @@
 package hl7_test
 
 import (
+	"errors"
 	"os"
 	"path/filepath"
+	"slices"
 	"testing"
 
 	"github.com/esequiel378/hl7"
@@ -189,3 +191,58 @@ func TestLoadSchemaFileNotFound(t *testing.T) {
 		t.Fatal("expected error for non-existent file")
 	}
 }
+
+func TestParseSchemaOrderFromJSONKeys(t *testing.T) {
+	schema, err := hl7.ParseSchema([]byte(`{
+		"segments": {
+			"MSH": { "fields": { "fieldSeparator": { "index": 1 } } },
+			"PID": { "fields": { "setID": { "index": 1 } } },
+			"PV1": { "fields": { "setID": { "index": 1 } } },
+			"OBX": { "fields": { "setID": { "index": 1 } } }
+		}
+	}`))
+	if err != nil {
+		t.Fatalf("ParseSchema failed: %v", err)
+	}
+
+	expected := []string{"MSH", "PID", "PV1", "OBX"}
+	if !slices.Equal(schema.Order, expected) {
+		t.Errorf("expected order %v, got %v", expected, schema.Order)
+	}
+}
+
+func TestParseSchemaExplicitOrder(t *testing.T) {
+	schema, err := hl7.ParseSchema([]byte(`{
+		"order": ["MSH", "PV1", "PID"],
+		"segments": {
+			"PID": { "fields": { "setID": { "index": 1 } } },
+			"MSH": { "fields": { "fieldSeparator": { "index": 1 } } },
+			"PV1": { "fields": { "setID": { "index": 1 } } }
+		}
+	}`))
+	if err != nil {
+		t.Fatalf("ParseSchema failed: %v", err)
+	}
+
+	expected := []string{"MSH", "PV1", "PID"}
+	if !slices.Equal(schema.Order, expected) {
+		t.Errorf("expected order %v, got %v", expected, schema.Order)
+	}
+}
+
+func TestParseSchemaOrderUnknownSegment(t *testing.T) {
+	_, err := hl7.ParseSchema([]byte(`{
+		"order": ["MSH", "PID"],
+		"segments": {
+			"MSH": { "fields": { "fieldSeparator": { "index": 1 } } }
+		}
+	}`))
+
+	var schemaErr *hl7.SchemaError
+	if !errors.As(err, &schemaErr) {
+		t.Fatalf("expected SchemaError, got %v", err)
+	}
+	if schemaErr.Path != "order.1" {
+		t.Errorf("expected path order.1, got %s", schemaErr.Path)
+	}
+}
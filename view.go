@@ -0,0 +1,318 @@
+package hl7
+
+import "bytes"
+
+// View is a read-only, zero-copy view over a single raw HL7 message. Segment
+// boundaries are indexed the first time a segment is looked up; fields,
+// repetitions, components and subcomponents are located on demand by
+// scanning the segment bytes. Every accessor returns a subslice of the
+// original input, so a View suits content-based routing where only a few
+// fields (e.g. MSH-9 and PID-3) are read per message.
+//
+// Values are returned exactly as they appear on the wire: escape sequences
+// are not decoded. The input must not be modified while the View is in use.
+// A View is not safe for concurrent use by multiple goroutines.
+//
+// Example:
+//
+//	v := hl7.NewView(data)
+//	msgType := v.Segment("MSH", 1).Field(9).Comp(1).Bytes()
+//	mrn := v.Segment("PID", 1).Field(3).Rep(1).Comp(1).Bytes()
+type View struct {
+	data    []byte
+	delims  delimiters
+	spans   []segmentSpan
+	indexed bool
+}
+
+// delimiters holds the separator characters of a message.
+type delimiters struct {
+	field        byte
+	component    byte
+	repetition   byte
+	subcomponent byte
+}
+
+// segmentSpan is the byte range of one segment within View.data.
+type segmentSpan struct {
+	start, end int
+}
+
+// NewView returns a View over data. Separators are read from the MSH header
+// when present; otherwise the standard |^~\& separators are assumed.
+func NewView(data []byte) *View {
+	v := &View{
+		data: data,
+		delims: delimiters{
+			field:        '|',
+			component:    '^',
+			repetition:   '~',
+			subcomponent: '&',
+		},
+	}
+
+	if len(data) > 3 && bytes.HasPrefix(data, []byte("MSH")) {
+		v.delims.field = data[3]
+		ec := data[4:]
+		if i := bytes.IndexAny(ec, "\r\n"); i >= 0 {
+			ec = ec[:i]
+		}
+		if i := bytes.IndexByte(ec, v.delims.field); i >= 0 {
+			ec = ec[:i]
+		}
+		if len(ec) > 0 {
+			v.delims.component = ec[0]
+		}
+		if len(ec) > 1 {
+			v.delims.repetition = ec[1]
+		}
+		if len(ec) > 3 {
+			v.delims.subcomponent = ec[3]
+		}
+	}
+
+	return v
+}
+
+// index records the boundaries of every non-empty segment. Segments may be
+// terminated by \r, \n or \r\n.
+func (v *View) index() {
+	if v.indexed {
+		return
+	}
+	v.indexed = true
+
+	// Every terminator ends at most one segment, so this bounds the count.
+	n := bytes.Count(v.data, []byte{'\r'}) + bytes.Count(v.data, []byte{'\n'}) + 1
+	v.spans = make([]segmentSpan, 0, n)
+
+	start := 0
+	for start < len(v.data) {
+		end := start
+		for end < len(v.data) && v.data[end] != '\r' && v.data[end] != '\n' {
+			end++
+		}
+		if end > start {
+			v.spans = append(v.spans, segmentSpan{start: start, end: end})
+		}
+		start = end + 1
+	}
+}
+
+// Len returns the number of segments in the message.
+func (v *View) Len() int {
+	v.index()
+	return len(v.spans)
+}
+
+// At returns the i-th segment (0-based) of the message, or an empty
+// SegmentView if i is out of range.
+func (v *View) At(i int) SegmentView {
+	v.index()
+	if i < 0 || i >= len(v.spans) {
+		return SegmentView{}
+	}
+	span := v.spans[i]
+	return SegmentView{b: v.data[span.start:span.end], d: v.delims}
+}
+
+// Segment returns the n-th (1-based) occurrence of the named segment, or an
+// empty SegmentView if there is no such occurrence.
+func (v *View) Segment(name string, n int) SegmentView {
+	v.index()
+	if n < 1 {
+		return SegmentView{}
+	}
+	for _, span := range v.spans {
+		seg := SegmentView{b: v.data[span.start:span.end], d: v.delims}
+		if string(seg.Name()) != name {
+			continue
+		}
+		n--
+		if n == 0 {
+			return seg
+		}
+	}
+	return SegmentView{}
+}
+
+// Count returns the number of occurrences of the named segment.
+func (v *View) Count(name string) int {
+	v.index()
+	count := 0
+	for _, span := range v.spans {
+		seg := SegmentView{b: v.data[span.start:span.end], d: v.delims}
+		if string(seg.Name()) == name {
+			count++
+		}
+	}
+	return count
+}
+
+// SegmentView is a single segment within a View.
+type SegmentView struct {
+	b []byte
+	d delimiters
+}
+
+// Exists reports whether the segment is present in the message.
+func (s SegmentView) Exists() bool {
+	return s.b != nil
+}
+
+// Bytes returns the raw segment, without its terminator.
+func (s SegmentView) Bytes() []byte {
+	return s.b
+}
+
+// Name returns the segment identifier (e.g. "PID").
+func (s SegmentView) Name() []byte {
+	if i := bytes.IndexByte(s.b, s.d.field); i >= 0 {
+		return s.b[:i]
+	}
+	return s.b
+}
+
+// Field returns the n-th (1-based) field of the segment, using the same
+// numbering as Unmarshal: MSH-1 is the field separator and MSH-2 the
+// encoding characters. Missing fields are empty.
+func (s SegmentView) Field(n int) FieldView {
+	if n < 1 || s.b == nil {
+		return FieldView{}
+	}
+	if string(s.Name()) == "MSH" {
+		switch {
+		case n == 1:
+			if len(s.b) < 4 {
+				return FieldView{}
+			}
+			return FieldView{b: s.b[3:4], d: s.d, literal: true}
+		case n == 2:
+			return FieldView{b: nthPart(s.b, s.d.field, 1), d: s.d, literal: true}
+		default:
+			n--
+		}
+	}
+	return FieldView{b: nthPart(s.b, s.d.field, n), d: s.d}
+}
+
+// FieldView is a single field within a segment.
+type FieldView struct {
+	b []byte
+	d delimiters
+	// literal marks MSH-1 and MSH-2, whose values contain the separators
+	// themselves and are never split.
+	literal bool
+}
+
+// Bytes returns the raw field value, including any repetitions.
+func (f FieldView) Bytes() []byte {
+	return f.b
+}
+
+// String returns the raw field value as a string. Unlike Bytes, it allocates.
+func (f FieldView) String() string {
+	return string(f.b)
+}
+
+// Reps returns the number of repetitions in the field; an empty field has none.
+func (f FieldView) Reps() int {
+	if len(f.b) == 0 {
+		return 0
+	}
+	if f.literal {
+		return 1
+	}
+	return bytes.Count(f.b, []byte{f.d.repetition}) + 1
+}
+
+// Rep returns the n-th (1-based) repetition of the field.
+func (f FieldView) Rep(n int) RepView {
+	if f.literal {
+		if n != 1 {
+			return RepView{}
+		}
+		return RepView{b: f.b, d: f.d, literal: true}
+	}
+	return RepView{b: nthPart(f.b, f.d.repetition, n-1), d: f.d}
+}
+
+// Comp returns the n-th (1-based) component of the first repetition.
+func (f FieldView) Comp(n int) ComponentView {
+	return f.Rep(1).Comp(n)
+}
+
+// RepView is a single repetition of a field.
+type RepView struct {
+	b       []byte
+	d       delimiters
+	literal bool
+}
+
+// Bytes returns the raw repetition value, including any components.
+func (r RepView) Bytes() []byte {
+	return r.b
+}
+
+// String returns the raw repetition value as a string. Unlike Bytes, it allocates.
+func (r RepView) String() string {
+	return string(r.b)
+}
+
+// Comp returns the n-th (1-based) component of the repetition.
+func (r RepView) Comp(n int) ComponentView {
+	if r.literal {
+		if n != 1 {
+			return ComponentView{}
+		}
+		return ComponentView{b: r.b, d: r.d, literal: true}
+	}
+	return ComponentView{b: nthPart(r.b, r.d.component, n-1), d: r.d}
+}
+
+// ComponentView is a single component of a field repetition.
+type ComponentView struct {
+	b       []byte
+	d       delimiters
+	literal bool
+}
+
+// Bytes returns the raw component value, including any subcomponents.
+func (c ComponentView) Bytes() []byte {
+	return c.b
+}
+
+// String returns the raw component value as a string. Unlike Bytes, it allocates.
+func (c ComponentView) String() string {
+	return string(c.b)
+}
+
+// Sub returns the n-th (1-based) subcomponent of the component.
+func (c ComponentView) Sub(n int) []byte {
+	if c.literal {
+		if n != 1 {
+			return nil
+		}
+		return c.b
+	}
+	return nthPart(c.b, c.d.subcomponent, n-1)
+}
+
+// nthPart returns the i-th (0-based) part of b split by sep, or nil if b has
+// fewer parts.
+func nthPart(b []byte, sep byte, i int) []byte {
+	if b == nil || i < 0 {
+		return nil
+	}
+	for ; i > 0; i-- {
+		j := bytes.IndexByte(b, sep)
+		if j < 0 {
+			return nil
+		}
+		b = b[j+1:]
+	}
+	if j := bytes.IndexByte(b, sep); j >= 0 {
+		return b[:j]
+	}
+	return b
+}
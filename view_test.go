@@ -0,0 +1,86 @@
+package hl7_test
+
+import (
+	"testing"
+
+	"github.com/esequiel378/hl7"
+)
+
+const viewTestMessage = "MSH|^~\\&|LAB|Fac|||20250101||ORU^R01^ORU_R01|MSG001|P|2.5\r\n" +
+	"PID|1||123^^^HOSP^MR~456^^^LAB||Doe^John&Q\r" +
+	"OBX|1|NM|GLU||98\n" +
+	"\n" +
+	"OBX|2|NM|NA||140"
+
+func TestViewAccessors(t *testing.T) {
+	v := hl7.NewView([]byte(viewTestMessage))
+
+	tests := []struct {
+		name string
+		got  string
+		want string
+	}{
+		{"MSH-1", v.Segment("MSH", 1).Field(1).String(), "|"},
+		{"MSH-2", v.Segment("MSH", 1).Field(2).String(), "^~\\&"},
+		{"MSH-2 comp", v.Segment("MSH", 1).Field(2).Comp(1).String(), "^~\\&"},
+		{"MSH-3", v.Segment("MSH", 1).Field(3).String(), "LAB"},
+		{"MSH-9.1", v.Segment("MSH", 1).Field(9).Comp(1).String(), "ORU"},
+		{"MSH-9.3", v.Segment("MSH", 1).Field(9).Comp(3).String(), "ORU_R01"},
+		{"MSH-12", v.Segment("MSH", 1).Field(12).String(), "2.5"},
+		{"PID-3", v.Segment("PID", 1).Field(3).String(), "123^^^HOSP^MR~456^^^LAB"},
+		{"PID-3(1).1", v.Segment("PID", 1).Field(3).Rep(1).Comp(1).String(), "123"},
+		{"PID-3(2).4", v.Segment("PID", 1).Field(3).Rep(2).Comp(4).String(), "LAB"},
+		{"PID-5.2.2", string(v.Segment("PID", 1).Field(5).Comp(2).Sub(2)), "Q"},
+		{"OBX(2)-3", v.Segment("OBX", 2).Field(3).String(), "NA"},
+		{"missing field", v.Segment("PID", 1).Field(30).String(), ""},
+		{"missing rep", v.Segment("PID", 1).Field(3).Rep(3).String(), ""},
+		{"missing segment", v.Segment("PV1", 1).Field(2).String(), ""},
+	}
+	for _, tc := range tests {
+		if tc.got != tc.want {
+			t.Errorf("%s = %q, want %q", tc.name, tc.got, tc.want)
+		}
+	}
+
+	if v.Len() != 4 {
+		t.Errorf("Len = %d, want 4", v.Len())
+	}
+	if v.Count("OBX") != 2 {
+		t.Errorf("Count(OBX) = %d, want 2", v.Count("OBX"))
+	}
+	if v.Segment("OBX", 3).Exists() {
+		t.Error("expected OBX(3) not to exist")
+	}
+	if got := v.Segment("PID", 1).Field(3).Reps(); got != 2 {
+		t.Errorf("PID-3 Reps = %d, want 2", got)
+	}
+	if got := string(v.At(1).Name()); got != "PID" {
+		t.Errorf("At(1).Name = %q, want PID", got)
+	}
+}
+
+func TestViewCustomSeparators(t *testing.T) {
+	v := hl7.NewView([]byte("MSH#*@\\%#App#Fac\nPID#1##A*B@C*D"))
+
+	if got := v.Segment("MSH", 1).Field(3).String(); got != "App" {
+		t.Errorf("MSH-3 = %q, want App", got)
+	}
+	if got := v.Segment("PID", 1).Field(3).Rep(2).Comp(2).String(); got != "D" {
+		t.Errorf("PID-3(2).2 = %q, want D", got)
+	}
+}
+
+func TestViewDoesNotAllocate(t *testing.T) {
+	data := []byte(viewTestMessage)
+	v := hl7.NewView(data)
+	v.Len() // build the segment index
+
+	allocs := testing.AllocsPerRun(100, func() {
+		_ = v.Segment("MSH", 1).Field(9).Comp(1).Bytes()
+		_ = v.Segment("PID", 1).Field(3).Rep(2).Comp(1).Bytes()
+		_ = v.Segment("OBX", 2).Field(5).Bytes()
+	})
+	if allocs != 0 {
+		t.Errorf("expected no allocations, got %v", allocs)
+	}
+}
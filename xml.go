@@ -0,0 +1,715 @@
+package hl7
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// xmlNamespace is the namespace of HL7 v2.xml documents.
+const xmlNamespace = "urn:hl7-org:v2xml"
+
+// XMLOptions configures MarshalXML.
+type XMLOptions struct {
+	// DataTypes adds to and overrides the built-in dictionary of data
+	// types (see FieldType and ComponentType). A key names either a
+	// segment field, such as "ZPI.2", or a component of a data type, such
+	// as "XPN.1", and its value is the data type of that field or
+	// component.
+	DataTypes map[string]string
+
+	// Structures maps message structure IDs, such as "ORU_R01", to the
+	// segment grammar used to group segments. Entries are added to the
+	// built-in ADT_A01, ORU_R01, VXU_V04 and ACK structures and replace
+	// those with the same ID. The grammar lists segment names in order;
+	// [ ] encloses optional items, { } repeating ones, and a bracket that
+	// starts with NAME: is a segment group:
+	//
+	//	MSH PID {ORDER: ORC [{OBSERVATION: OBX [{NTE}]}]}
+	Structures map[string]string
+
+	// Indent is written once per nesting level before each element on its
+	// own line. Empty writes the whole document on one line.
+	Indent string
+}
+
+// builtinStructures are the segment grammars of common HL7 v2.5 message
+// structures.
+var builtinStructures = map[string]string{
+	"ACK": "MSH [{SFT}] MSA [{ERR}]",
+	"ADT_A01": "MSH [{SFT}] EVN PID [PD1] [{ROL}] [{NK1}] PV1 [PV2] [{ROL}] [{DB1}] [{OBX}] [{AL1}] [{DG1}] [DRG] " +
+		"[{PROCEDURE: PR1 [{ROL}]}] [{GT1}] [{INSURANCE: IN1 [IN2] [{IN3}] [{ROL}]}] [ACC] [UB1] [UB2] [PDA]",
+	"ORU_R01": "MSH [{SFT}] {PATIENT_RESULT: [PATIENT: PID [PD1] [{NTE}] [{NK1}] [VISIT: PV1 [PV2]]] " +
+		"{ORDER_OBSERVATION: [ORC] OBR [{NTE}] [{TIMING_QTY: TQ1 [{TQ2}]}] [CTD] " +
+		"[{OBSERVATION: OBX [{NTE}]}] [{FT1}] [{CTI}] [{SPECIMEN: SPM [{OBX}]}]}} [DSC]",
+	"VXU_V04": "MSH [{SFT}] PID [PD1] [{NK1}] [PATIENT: PV1 [PV2]] [{GT1}] [{INSURANCE: IN1 [IN2] [IN3]}] " +
+		"[{ORDER: ORC [{TIMING: TQ1 [{TQ2}]}] RXA [RXR] [{OBSERVATION: OBX [{NTE}]}]}]",
+}
+
+// eventStructures maps message types whose MSH-9 has no structure ID to the
+// structure they share.
+var eventStructures = map[string]string{
+	"ADT_A04": "ADT_A01",
+	"ADT_A08": "ADT_A01",
+	"ADT_A13": "ADT_A01",
+}
+
+// MarshalXML encodes a message as HL7 v2.xml. The root element is named
+// after the message structure (MSH-9.3, or MSH-9.1 and MSH-9.2), and the
+// segments of known structures are nested in group elements such as
+// ORU_R01.ORDER_OBSERVATION.
+//
+// Fields are named after their segment, as in PID.5, and the components and
+// subcomponents of fields with a known composite data type after that
+// type, as in XPN.1 and FN.1. Values with separators but no known type
+// fall back to positional names, such as ZPI.2.1. Repetitions are repeated
+// elements, and escape sequences for the delimiters are written as the
+// characters they stand for; other escape sequences, such as \.br\, are
+// written as <escape V=".br"/> elements.
+func MarshalXML(msg *GenericMessage, opts XMLOptions) ([]byte, error) {
+	e := &xmlEncoder{
+		opts:      msg.Delimiters(),
+		dataTypes: opts.DataTypes,
+		composite: make(map[string]bool),
+		indent:    opts.Indent,
+	}
+	for key := range opts.DataTypes {
+		if t, _, ok := strings.Cut(key, "."); ok {
+			e.composite[t] = true
+		}
+	}
+
+	id, root := e.structureID(msg), "HL7Message"
+	if id != "" {
+		root = id
+	}
+	var structure *structNode
+	grammar, ok := opts.Structures[id]
+	if !ok {
+		grammar, ok = builtinStructures[id]
+	}
+	if ok {
+		structure = &structNode{}
+		if err := parseStructure(grammar, structure); err != nil {
+			return nil, fmt.Errorf("hl7: structure %s: %w", id, err)
+		}
+	}
+
+	e.b.WriteString(xml.Header)
+	e.b.WriteString("<" + root + ` xmlns="` + xmlNamespace + `">`)
+	e.depth++
+
+	g := &grouper{root: root, stack: []groupFrame{{node: structure, cur: -1}}}
+	for i := range msg.Segments {
+		seg := &msg.Segments[i]
+		if !isSegmentName(seg.Name) {
+			return nil, fmt.Errorf("hl7: invalid segment name %q", seg.Name)
+		}
+		if structure != nil {
+			g.place(e, seg.Name)
+		}
+		e.segment(seg)
+	}
+	for len(g.stack) > 1 {
+		g.pop(e)
+	}
+
+	e.depth--
+	e.newline()
+	e.b.WriteString("</" + root + ">")
+	if e.indent != "" {
+		e.b.WriteByte('\n')
+	}
+	return e.b.Bytes(), nil
+}
+
+// xmlEncoder writes the elements of MarshalXML.
+type xmlEncoder struct {
+	b         bytes.Buffer
+	opts      MarshalOptions
+	dataTypes map[string]string
+	composite map[string]bool // data types with components in dataTypes
+	indent    string
+	depth     int
+}
+
+// structureID returns the message structure ID of msg, or "".
+func (e *xmlEncoder) structureID(msg *GenericMessage) string {
+	msgType := msg.Value(Path{Segment: "MSH", FieldPath: FieldPath{Field: 9}})
+	parts := strings.Split(msgType, string(e.opts.ComponentSeparator))
+	if len(parts) > 2 && parts[2] != "" {
+		return parts[2]
+	}
+	if len(parts) < 2 || parts[0] == "" || parts[1] == "" {
+		return parts[0]
+	}
+	id := parts[0] + "_" + parts[1]
+	if s, ok := eventStructures[id]; ok {
+		return s
+	}
+	return id
+}
+
+func (e *xmlEncoder) newline() {
+	if e.indent == "" {
+		return
+	}
+	e.b.WriteByte('\n')
+	e.b.WriteString(strings.Repeat(e.indent, e.depth))
+}
+
+func (e *xmlEncoder) start(name string) {
+	e.newline()
+	e.b.WriteString("<" + name + ">")
+	e.depth++
+}
+
+func (e *xmlEncoder) end(name string) {
+	e.depth--
+	e.newline()
+	e.b.WriteString("</" + name + ">")
+}
+
+// fieldType returns the data type of a segment field, or "".
+func (e *xmlEncoder) fieldType(seg *GenericSegment, index int) string {
+	t, ok := e.dataTypes[seg.Name+"."+strconv.Itoa(index)]
+	if !ok {
+		t = FieldType(seg.Name, index)
+	}
+	if t == "varies" {
+		t = seg.Value(FieldPath{Field: 2}, e.opts)
+	}
+	return t
+}
+
+// componentType returns the data type of a component of a data type, or "".
+func (e *xmlEncoder) componentType(dataType string, index int) string {
+	if t, ok := e.dataTypes[dataType+"."+strconv.Itoa(index)]; ok {
+		return t
+	}
+	return ComponentType(dataType, index)
+}
+
+// isComposite reports whether a data type has components.
+func (e *xmlEncoder) isComposite(dataType string) bool {
+	return len(componentTypes[dataType]) > 0 || e.composite[dataType]
+}
+
+// segment writes one segment element.
+func (e *xmlEncoder) segment(seg *GenericSegment) {
+	maxIndex := 0
+	for _, f := range seg.Fields {
+		maxIndex = max(maxIndex, f.Index)
+	}
+	values := make([]string, maxIndex+1)
+	for _, f := range seg.Fields {
+		if f.Index > 0 {
+			values[f.Index] = f.Value
+		}
+	}
+
+	if maxIndex == 0 {
+		e.newline()
+		e.b.WriteString("<" + seg.Name + "/>")
+		return
+	}
+	e.start(seg.Name)
+	for i := 1; i <= maxIndex; i++ {
+		if values[i] == "" && i < maxIndex {
+			continue
+		}
+		name := seg.Name + "." + strconv.Itoa(i)
+		if seg.Name == "MSH" && i <= 2 {
+			e.newline()
+			e.b.WriteString("<" + name + ">")
+			xml.EscapeText(&e.b, []byte(values[i]))
+			e.b.WriteString("</" + name + ">")
+			continue
+		}
+		for _, rep := range strings.Split(values[i], string(e.opts.RepetitionSeparator)) {
+			e.value(name, rep, e.fieldType(seg, i), 0)
+		}
+	}
+	e.end(seg.Name)
+}
+
+// value writes the element of a repetition (depth 0), component (1) or
+// subcomponent (2) with the raw value v and the data type t.
+func (e *xmlEncoder) value(name, v, t string, depth int) {
+	sep := e.opts.ComponentSeparator
+	if depth == 1 {
+		sep = e.opts.SubcomponentSeparator
+	}
+	// A repetition holding only subcomponents, as in a primitive field
+	// "a&b", is a single component that is split further.
+	split := e.isComposite(t) || strings.IndexByte(v, sep) >= 0 ||
+		depth == 0 && strings.IndexByte(v, e.opts.SubcomponentSeparator) >= 0
+	if v == "" || depth == 2 || !split {
+		e.newline()
+		if v == "" {
+			e.b.WriteString("<" + name + "/>")
+			return
+		}
+		e.b.WriteString("<" + name + ">")
+		e.text(v)
+		e.b.WriteString("</" + name + ">")
+		return
+	}
+
+	prefix := name
+	if e.isComposite(t) {
+		prefix = t
+	}
+	parts := strings.Split(v, string(sep))
+	e.start(name)
+	for i, part := range parts {
+		if part == "" && i < len(parts)-1 {
+			continue
+		}
+		ct := ""
+		if e.isComposite(t) {
+			ct = e.componentType(t, i+1)
+		}
+		e.value(prefix+"."+strconv.Itoa(i+1), part, ct, depth+1)
+	}
+	e.end(name)
+}
+
+// text writes a raw value as character data, replacing the escape
+// sequences for delimiters by the delimiters and other escape sequences by
+// escape elements.
+func (e *xmlEncoder) text(v string) {
+	esc := e.opts.EscapeCharacter
+	for {
+		i := strings.IndexByte(v, esc)
+		if esc == 0 || i < 0 {
+			break
+		}
+		j := strings.IndexByte(v[i+1:], esc)
+		if j < 0 {
+			break
+		}
+		xml.EscapeText(&e.b, []byte(v[:i]))
+		seq := v[i+1 : i+1+j]
+		switch seq {
+		case "F", "S", "R", "T", "E":
+			xml.EscapeText(&e.b, []byte(e.opts.Unescape(v[i:i+j+2])))
+		default:
+			e.b.WriteString(`<escape V="`)
+			xml.EscapeText(&e.b, []byte(seq))
+			e.b.WriteString(`"/>`)
+		}
+		v = v[i+j+2:]
+	}
+	xml.EscapeText(&e.b, []byte(v))
+}
+
+// A structNode is a segment or a segment group of a message structure.
+type structNode struct {
+	name     string
+	group    bool
+	optional bool
+	repeat   bool
+	children []*structNode
+}
+
+// parseStructure parses a segment grammar into the children of root.
+func parseStructure(grammar string, root *structNode) error {
+	p := &structParser{tokens: tokenizeStructure(grammar)}
+	root.group = true
+	if err := p.items(root, ""); err != nil {
+		return err
+	}
+	if p.pos < len(p.tokens) {
+		return fmt.Errorf("unexpected %q", p.tokens[p.pos])
+	}
+	return nil
+}
+
+// tokenizeStructure splits a segment grammar into names and the characters
+// [ ] { } and :.
+func tokenizeStructure(s string) []string {
+	var tokens []string
+	start := -1
+	for i := 0; i <= len(s); i++ {
+		if i < len(s) && !strings.ContainsRune(" \t\r\n[]{}:", rune(s[i])) {
+			if start < 0 {
+				start = i
+			}
+			continue
+		}
+		if start >= 0 {
+			tokens = append(tokens, s[start:i])
+			start = -1
+		}
+		if i < len(s) && strings.ContainsRune("[]{}:", rune(s[i])) {
+			tokens = append(tokens, s[i:i+1])
+		}
+	}
+	return tokens
+}
+
+type structParser struct {
+	tokens []string
+	pos    int
+}
+
+// items parses items into the children of parent until the closing
+// bracket end, or the end of the grammar when end is "".
+func (p *structParser) items(parent *structNode, end string) error {
+	for p.pos < len(p.tokens) {
+		tok := p.tokens[p.pos]
+		switch tok {
+		case end:
+			return nil
+		case "[", "{":
+			p.pos++
+			n, err := p.bracket(map[string]string{"[": "]", "{": "}"}[tok])
+			if err != nil {
+				return err
+			}
+			n.optional = n.optional || tok == "["
+			n.repeat = n.repeat || tok == "{"
+			parent.children = append(parent.children, n)
+			continue
+		case "]", "}", ":":
+			return fmt.Errorf("unexpected %q", tok)
+		}
+		parent.children = append(parent.children, &structNode{name: tok})
+		p.pos++
+	}
+	if end != "" {
+		return fmt.Errorf("missing %q", end)
+	}
+	return nil
+}
+
+// bracket parses the contents of a bracket, after the opening one: either
+// a named group or a single item.
+func (p *structParser) bracket(end string) (*structNode, error) {
+	n := &structNode{group: true}
+	if p.pos+1 < len(p.tokens) && p.tokens[p.pos+1] == ":" {
+		n.name = p.tokens[p.pos]
+		p.pos += 2
+	}
+	if err := p.items(n, end); err != nil {
+		return nil, err
+	}
+	p.pos++
+	if n.name != "" {
+		return n, nil
+	}
+	if len(n.children) != 1 {
+		return nil, errors.New("brackets must enclose a single item or a named group")
+	}
+	return n.children[0], nil
+}
+
+// starts reports whether n can start with the segment name.
+func (n *structNode) starts(name string) bool {
+	if !n.group {
+		return n.name == name
+	}
+	for _, c := range n.children {
+		if c.starts(name) {
+			return true
+		}
+		if !c.optional {
+			return false
+		}
+	}
+	return false
+}
+
+// next returns the index of the child of n after cur that starts with the
+// segment name, or -1. The child at cur matches again when it repeats.
+func (n *structNode) next(cur int, name string) int {
+	for i := max(cur, 0); i < len(n.children); i++ {
+		c := n.children[i]
+		if i == cur && !c.repeat {
+			continue
+		}
+		if c.starts(name) {
+			return i
+		}
+	}
+	return -1
+}
+
+// A groupFrame is a group element being written, with the index of the
+// child that matched last.
+type groupFrame struct {
+	node *structNode
+	name string
+	cur  int
+}
+
+// grouper opens and closes the group elements of MarshalXML as segments
+// are written.
+type grouper struct {
+	root  string
+	stack []groupFrame
+}
+
+func (g *grouper) pop(e *xmlEncoder) {
+	e.end(g.stack[len(g.stack)-1].name)
+	g.stack = g.stack[:len(g.stack)-1]
+}
+
+// place opens and closes group elements so that the next segment is
+// written in the group it belongs to. A segment the structure does not
+// expect stays in the innermost open group.
+func (g *grouper) place(e *xmlEncoder, name string) {
+	for d := len(g.stack) - 1; d >= 0; d-- {
+		i := g.stack[d].node.next(g.stack[d].cur, name)
+		if i < 0 {
+			continue
+		}
+		for len(g.stack) > d+1 {
+			g.pop(e)
+		}
+		for {
+			top := &g.stack[len(g.stack)-1]
+			top.cur = i
+			child := top.node.children[i]
+			if !child.group {
+				return
+			}
+			groupName := g.root + "." + child.name
+			e.start(groupName)
+			g.stack = append(g.stack, groupFrame{node: child, name: groupName, cur: -1})
+			i = child.next(-1, name)
+		}
+	}
+}
+
+// UnmarshalXML decodes an HL7 v2.xml document into a GenericMessage, the
+// reverse of MarshalXML. Segments are read from the children of the root
+// element and of group elements, whose names contain a dot. Fields,
+// components and subcomponents are placed by the number after the last dot
+// of their element names, so both typed names such as XPN.1 and
+// positional ones are accepted. Delimiters in character data are escaped
+// for the separators declared by MSH.1 and MSH.2.
+func UnmarshalXML(data []byte) (*GenericMessage, error) {
+	root, err := readXMLTree(data)
+	if err != nil {
+		return nil, err
+	}
+	d := &xmlDecoder{opts: DefaultMarshalOptions(), msg: &GenericMessage{}}
+	if err := d.group(root); err != nil {
+		return nil, err
+	}
+	return d.msg, nil
+}
+
+// An xmlNode is an element of a v2.xml document, or character data when it
+// has no name.
+type xmlNode struct {
+	name     string
+	text     string // character data, or the V attribute of an escape
+	children []*xmlNode
+}
+
+// elements returns the child elements of n.
+func (n *xmlNode) elements() []*xmlNode {
+	var out []*xmlNode
+	for _, c := range n.children {
+		if c.name != "" {
+			out = append(out, c)
+		}
+	}
+	return out
+}
+
+// readXMLTree parses data into a tree of elements.
+func readXMLTree(data []byte) (*xmlNode, error) {
+	dec := xml.NewDecoder(bytes.NewReader(data))
+	var stack []*xmlNode
+	var root *xmlNode
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("hl7: invalid v2.xml: %w", err)
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			n := &xmlNode{name: t.Name.Local}
+			if n.name == "escape" {
+				for _, a := range t.Attr {
+					if a.Name.Local == "V" {
+						n.text = a.Value
+					}
+				}
+			}
+			if len(stack) > 0 {
+				parent := stack[len(stack)-1]
+				parent.children = append(parent.children, n)
+			} else if root == nil {
+				root = n
+			}
+			stack = append(stack, n)
+		case xml.EndElement:
+			stack = stack[:len(stack)-1]
+		case xml.CharData:
+			if len(stack) > 0 {
+				parent := stack[len(stack)-1]
+				parent.children = append(parent.children, &xmlNode{text: string(t)})
+			}
+		}
+	}
+	if root == nil {
+		return nil, errors.New("hl7: invalid v2.xml: no root element")
+	}
+	return root, nil
+}
+
+// xmlDecoder builds the message of UnmarshalXML.
+type xmlDecoder struct {
+	opts MarshalOptions
+	msg  *GenericMessage
+}
+
+// group reads the segments and groups that are children of n.
+func (d *xmlDecoder) group(n *xmlNode) error {
+	for _, c := range n.elements() {
+		if strings.Contains(c.name, ".") {
+			if err := d.group(c); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := d.segment(c); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// segment reads one segment element.
+func (d *xmlDecoder) segment(n *xmlNode) error {
+	reps := make(map[int][]string)
+	fields := n.elements()
+	if n.name == "MSH" {
+		for _, f := range fields {
+			switch f.name {
+			case "MSH.1":
+				if v := charData(f); v != "" {
+					d.opts.FieldSeparator = v[0]
+				}
+			case "MSH.2":
+				v := charData(f)
+				chars := []*byte{&d.opts.ComponentSeparator, &d.opts.RepetitionSeparator, &d.opts.EscapeCharacter, &d.opts.SubcomponentSeparator}
+				for i := 0; i < len(v) && i < len(chars); i++ {
+					*chars[i] = v[i]
+				}
+			}
+		}
+	}
+
+	maxIndex := 0
+	for _, f := range fields {
+		index, err := xmlIndex(f.name)
+		if err != nil {
+			return err
+		}
+		var v string
+		if n.name == "MSH" && index <= 2 {
+			v = charData(f)
+		} else if v, err = d.value(f, 0); err != nil {
+			return err
+		}
+		reps[index] = append(reps[index], v)
+		maxIndex = max(maxIndex, index)
+	}
+
+	seg := GenericSegment{Name: n.name, Fields: []GenericField{}}
+	first := 1
+	if n.name == "MSH" {
+		seg.Fields = append(seg.Fields, GenericField{Index: 1, Value: string(d.opts.FieldSeparator)})
+		first = 2
+	}
+	for i := first; i <= maxIndex; i++ {
+		v := strings.Join(reps[i], string(d.opts.RepetitionSeparator))
+		seg.Fields = append(seg.Fields, parseGenericField(i, v, string(d.opts.ComponentSeparator), string(d.opts.RepetitionSeparator)))
+	}
+	d.msg.Segments = append(d.msg.Segments, seg)
+	return nil
+}
+
+// value returns the raw value of a repetition (depth 0), component (1) or
+// subcomponent (2) element.
+func (d *xmlDecoder) value(n *xmlNode, depth int) (string, error) {
+	var parts []string
+	leaf := true
+	for _, c := range n.children {
+		if c.name != "" && c.name != "escape" {
+			leaf = false
+			break
+		}
+	}
+	if leaf {
+		var b strings.Builder
+		for _, c := range n.children {
+			if c.name == "" {
+				b.WriteString(d.opts.Escape(c.text))
+			} else {
+				b.WriteByte(d.opts.EscapeCharacter)
+				b.WriteString(c.text)
+				b.WriteByte(d.opts.EscapeCharacter)
+			}
+		}
+		return b.String(), nil
+	}
+	if depth >= 2 {
+		return "", fmt.Errorf("hl7: v2.xml element %s is nested too deeply", n.name)
+	}
+
+	for _, c := range n.elements() {
+		index, err := xmlIndex(c.name)
+		if err != nil {
+			return "", err
+		}
+		v, err := d.value(c, depth+1)
+		if err != nil {
+			return "", err
+		}
+		for len(parts) < index {
+			parts = append(parts, "")
+		}
+		parts[index-1] = v
+	}
+	sep := d.opts.ComponentSeparator
+	if depth == 1 {
+		sep = d.opts.SubcomponentSeparator
+	}
+	return strings.Join(parts, string(sep)), nil
+}
+
+// charData returns the character data of an element.
+func charData(n *xmlNode) string {
+	var b strings.Builder
+	for _, c := range n.children {
+		if c.name == "" {
+			b.WriteString(c.text)
+		}
+	}
+	return b.String()
+}
+
+// xmlIndex returns the position named by the number after the last dot of
+// an element name.
+func xmlIndex(name string) (int, error) {
+	i := strings.LastIndexByte(name, '.')
+	index, err := strconv.Atoi(name[i+1:])
+	if i < 0 || err != nil || index < 1 {
+		return 0, fmt.Errorf("hl7: invalid v2.xml element %q", name)
+	}
+	return index, nil
+}
@@ -0,0 +1,165 @@
+package hl7_test
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/esequiel378/hl7"
+)
+
+const xmlORU = "MSH|^~\\&|LAB|HOSP|EHR|HOSP|20250114120000||ORU^R01^ORU_R01|MSG002|P|2.5.1\r" +
+	"PID|1||123456^^^HOSP^MR~987^^^&2.16.840.1.113883.4.1&ISO^SS||Doe^John^^^^^L||19800215|M|||\r" +
+	"ORC|RE|ORD1\r" +
+	"OBR|1|ORD1||58410-2^CBC panel^LN\r" +
+	"OBX|1|NM|718-7^Hemoglobin^LN||13.5|g/dL|||||F\r" +
+	"OBX|2|ST|8251-1^Comment^LN||Sample \\T\\ repeat\\.br\\second line||||||P\r" +
+	"NTE|1||Checked by A\\S\\B\r" +
+	"ORC|RE|ORD2\r" +
+	"OBR|2|ORD2||24323-8^CMP^LN\r" +
+	"ZPI|1|a^b&c|\r" +
+	"DSC"
+
+func xmlRoundTrip(t *testing.T, data string, opts hl7.XMLOptions) string {
+	t.Helper()
+	msg, err := hl7.ParseGeneric([]byte(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := hl7.MarshalXML(msg, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	back, err := hl7.UnmarshalXML(out)
+	if err != nil {
+		t.Fatalf("%v\n%s", err, out)
+	}
+	er7, err := hl7.MarshalGeneric(back)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(er7) != data {
+		t.Errorf("round trip changed the message:\n%q\n%q\n%s", data, er7, out)
+	}
+	return string(out)
+}
+
+func TestMarshalXML(t *testing.T) {
+	out := xmlRoundTrip(t, xmlORU, hl7.XMLOptions{})
+
+	for _, want := range []string{
+		`<ORU_R01 xmlns="urn:hl7-org:v2xml">`,
+		`<MSH.1>|</MSH.1><MSH.2>^~\&amp;</MSH.2>`,
+		`<MSH.9><MSG.1>ORU</MSG.1><MSG.2>R01</MSG.2><MSG.3>ORU_R01</MSG.3></MSH.9>`,
+		`<PID.3><CX.1>123456</CX.1><CX.4><HD.1>HOSP</HD.1></CX.4><CX.5>MR</CX.5></PID.3>` +
+			`<PID.3><CX.1>987</CX.1><CX.4><HD.2>2.16.840.1.113883.4.1</HD.2><HD.3>ISO</HD.3></CX.4><CX.5>SS</CX.5></PID.3>`,
+		`<PID.5><XPN.1><FN.1>Doe</FN.1></XPN.1><XPN.2>John</XPN.2><XPN.7>L</XPN.7></PID.5>`,
+		`<PID.8>M</PID.8><PID.11/></PID>`,
+		`<OBX.2>NM</OBX.2><OBX.3><CE.1>718-7</CE.1><CE.2>Hemoglobin</CE.2><CE.3>LN</CE.3></OBX.3><OBX.5>13.5</OBX.5>`,
+		`<OBX.5>Sample &amp; repeat<escape V=".br"/>second line</OBX.5>`,
+		`<NTE.3>Checked by A^B</NTE.3>`,
+		`<ZPI.2><ZPI.2.1>a</ZPI.2.1><ZPI.2.2><ZPI.2.2.1>b</ZPI.2.2.1><ZPI.2.2.2>c</ZPI.2.2.2></ZPI.2.2></ZPI.2><ZPI.3/>`,
+		`<DSC/></ORU_R01>`,
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("expected %s in\n%s", want, out)
+		}
+	}
+
+	groups := "<ORU_R01.PATIENT_RESULT><ORU_R01.PATIENT><PID>*</PID></ORU_R01.PATIENT>" +
+		"<ORU_R01.ORDER_OBSERVATION><ORC>*</ORC><OBR>*</OBR>" +
+		"<ORU_R01.OBSERVATION><OBX>*</OBX></ORU_R01.OBSERVATION>" +
+		"<ORU_R01.OBSERVATION><OBX>*</OBX><NTE>*</NTE></ORU_R01.OBSERVATION></ORU_R01.ORDER_OBSERVATION>" +
+		"<ORU_R01.ORDER_OBSERVATION><ORC>*</ORC><OBR>*</OBR><ZPI>*</ZPI></ORU_R01.ORDER_OBSERVATION>" +
+		"</ORU_R01.PATIENT_RESULT><DSC/>"
+	if got := skeleton(out); !strings.Contains(got, groups) {
+		t.Errorf("unexpected groups:\n%s", got)
+	}
+}
+
+// segmentContents matches a segment element of a v2.xml document.
+var segmentContents = regexp.MustCompile(`<([A-Z][A-Z0-9]{2})>.*?</[A-Z][A-Z0-9]{2}>`)
+
+// skeleton replaces the contents of the segment elements of doc by *.
+func skeleton(doc string) string {
+	return segmentContents.ReplaceAllString(doc, "<$1>*</$1>")
+}
+
+func TestMarshalXMLSubcomponents(t *testing.T) {
+	data := "MSH|^~\\&|LAB|HOSP|||20250114||ORU^R01|1|P|2.5\r" +
+		"OBX|1|ST|x||a&b\r" +
+		"ZZZ|1|a&b~c"
+	out := xmlRoundTrip(t, data, hl7.XMLOptions{})
+	for _, want := range []string{
+		`<OBX.5><OBX.5.1><OBX.5.1.1>a</OBX.5.1.1><OBX.5.1.2>b</OBX.5.1.2></OBX.5.1></OBX.5>`,
+		`<ZZZ.2><ZZZ.2.1><ZZZ.2.1.1>a</ZZZ.2.1.1><ZZZ.2.1.2>b</ZZZ.2.1.2></ZZZ.2.1></ZZZ.2><ZZZ.2>c</ZZZ.2>`,
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("expected %s in\n%s", want, out)
+		}
+	}
+}
+
+func TestMarshalXMLIndent(t *testing.T) {
+	data := "MSH|^~\\&|A|B|||20250114||ACK^A01^ACK|1|P|2.5.1\rMSA|AA|MSG001|Text with  spaces\rERR||PID^1^3\r"
+	out := xmlRoundTrip(t, strings.TrimSuffix(data, "\r"), hl7.XMLOptions{Indent: "  "})
+	want := "<ACK xmlns=\"urn:hl7-org:v2xml\">\n  <MSH>\n    <MSH.1>|</MSH.1>\n"
+	if !strings.Contains(out, want) || !strings.Contains(out, "\n  <MSA>\n    <MSA.1>AA</MSA.1>") ||
+		!strings.HasSuffix(out, "</ACK>\n") {
+		t.Errorf("unexpected indentation:\n%s", out)
+	}
+}
+
+func TestMarshalXMLOptions(t *testing.T) {
+	data := "MSH|^~\\&|A|B|||20250114||ZZZ^Z01|1|P|2.5.1\rPID|1||42\rZRX|1|a^b\rZRX|2|c"
+	out := xmlRoundTrip(t, data, hl7.XMLOptions{
+		DataTypes:  map[string]string{"ZRX.2": "ZQT", "ZQT.1": "NM", "ZQT.2": "CE"},
+		Structures: map[string]string{"ZZZ_Z01": "MSH PID [{ITEM: ZRX}]"},
+	})
+	if !strings.Contains(out, `<ZZZ_Z01.ITEM><ZRX><ZRX.1>1</ZRX.1><ZRX.2><ZQT.1>a</ZQT.1><ZQT.2><CE.1>b</CE.1></ZQT.2></ZRX.2></ZRX></ZZZ_Z01.ITEM>`) ||
+		!strings.Contains(out, `<ZZZ_Z01.ITEM><ZRX><ZRX.1>2</ZRX.1><ZRX.2><ZQT.1>c</ZQT.1></ZRX.2></ZRX></ZZZ_Z01.ITEM></ZZZ_Z01>`) {
+		t.Errorf("unexpected custom types and groups:\n%s", out)
+	}
+
+	msg, _ := hl7.ParseGeneric([]byte(data))
+	if _, err := hl7.MarshalXML(msg, hl7.XMLOptions{Structures: map[string]string{"ZZZ_Z01": "MSH [PID ZRX]"}}); err == nil {
+		t.Error("expected an error for an unnamed group")
+	}
+}
+
+func TestUnmarshalXML(t *testing.T) {
+	doc := `<?xml version="1.0"?>
+<ADT_A01 xmlns="urn:hl7-org:v2xml">
+  <MSH>
+    <MSH.1>#</MSH.1>
+    <MSH.2>$%!*</MSH.2>
+    <MSH.9><MSG.1>ADT</MSG.1><MSG.2>A01</MSG.2></MSH.9>
+  </MSH>
+  <PID>
+    <PID.5><XPN.1><FN.1>O#Brien</FN.1></XPN.1><XPN.2>Pat</XPN.2></PID.5>
+    <PID.5><XPN.1><FN.1>Smith</FN.1></XPN.1></PID.5>
+    <PID.13><XTN.1>555 1234</XTN.1><XTN.2>PRN</XTN.2></PID.13>
+  </PID>
+</ADT_A01>`
+	msg, err := hl7.UnmarshalXML([]byte(doc))
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := hl7.MarshalGeneric(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "MSH#$%!*#######ADT$A01\rPID#####O!F!Brien$Pat%Smith########555 1234$PRN"
+	if string(out) != want {
+		t.Errorf("got %q, want %q", out, want)
+	}
+	if v := msg.Value(hl7.Path{Segment: "PID", FieldPath: hl7.FieldPath{Field: 5, Component: 1}}); v != "O!F!Brien" {
+		t.Errorf("got %q", v)
+	}
+
+	for _, bad := range []string{"", "<ADT_A01><PID><PID.x>1</PID.x></PID></ADT_A01>", "<A><PID><PID.1>"} {
+		if _, err := hl7.UnmarshalXML([]byte(bad)); err == nil {
+			t.Errorf("expected an error for %q", bad)
+		}
+	}
+}